@@ -0,0 +1,264 @@
+// Package audit keeps an append-only log of the actions taken on containers, items, locations and users,
+// along with the values of the fields they changed. Stores append an entry for every create, update, delete
+// and restore, entries are never changed or removed.
+package audit
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// QueryLimit is the number of entries per page unless another is requested.
+const QueryLimit = 50
+
+// The types of audited records
+const (
+	Container = "container"
+	Item      = "item"
+	Location  = "location"
+	User      = "user"
+)
+
+// Actions on records
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Sorter validates the sorts of entries, they are only listed most recent first.
+var Sorter = models.Sorter{
+	Fields:  map[string]string{"created": "created"},
+	Default: models.SortBy{Field: "created", Direction: models.DSC},
+}
+
+// Fields are the audited values of a record by field name, as presented in the API.
+type Fields map[string]interface{}
+
+// Change is the value of a field before and after an action, null when the record did not exist.
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Changes are the fields changed by an action.
+type Changes map[string]Change
+
+// Diff compares the fields of a record before and after an action, before is nil for creations
+// and after is nil for deletions. Fields are compared by their JSON representation.
+func Diff(before Fields, after Fields) Changes {
+	changes := make(Changes)
+	for field := range before {
+		changes.compare(field, before, after)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			changes.compare(field, before, after)
+		}
+	}
+	return changes
+}
+
+func (c Changes) compare(field string, before Fields, after Fields) {
+	b := encode(before, field)
+	a := encode(after, field)
+	if !bytes.Equal(a, b) {
+		c[field] = Change{Before: b, After: a}
+	}
+}
+
+func encode(fields Fields, field string) json.RawMessage {
+	value, _ := json.Marshal(fields[field])
+	return value
+}
+
+// Entry is an action taken on a record.
+type Entry struct {
+	ID int64 `json:"id"`
+	// Sequence orders the entries of a user as they were committed, it is assigned by SequenceCommitted
+	Sequence int64 `json:"-"`
+	// UserID is the owner of the record, entries are retrieved on their behalf
+	UserID int64 `json:"-"`
+	// ActorID is the user who took the action
+	ActorID    int64     `json:"actor_id"`
+	EntityType string    `json:"entity_type"`
+	EntityID   int64     `json:"entity_id"`
+	Action     string    `json:"action"`
+	Changes    Changes   `json:"changes"`
+	Created    time.Time `json:"created"`
+}
+
+// NewEntry describes an action taken by the authenticated user actorID on a record of the user userID.
+// Actions taken without an authenticated user (ie: scheduled jobs) are attributed to the owner when actorID is 0.
+func NewEntry(actorID int64, userID int64, entityType string, entityID int64, action string, changes Changes) Entry {
+	if actorID == 0 {
+		actorID = userID
+	}
+	return Entry{
+		UserID:     userID,
+		ActorID:    actorID,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changes,
+	}
+}
+
+// Execer runs statements, it is satisfied by *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record appends an entry to the log, updates that changed nothing are left out.
+func Record(db Execer, entry Entry) error {
+	if entry.Action == ActionUpdate && len(entry.Changes) == 0 {
+		return nil
+	}
+	if entry.Changes == nil {
+		entry.Changes = Changes{}
+	}
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	q := `
+		insert into audit_log (user_id, actor_id, entity_type, entity_id, action, changes, created)
+		values (?, ?, ?, ?, ?, ?, now())
+	`
+	_, err = db.Exec(q, entry.UserID, entry.ActorID, entry.EntityType, entry.EntityID, entry.Action, changes)
+	return err
+}
+
+// Filter restricts the entries of a user.
+type Filter struct {
+	UserID int64
+	// EntityType and EntityID optionally restrict the entries to those of a type or of a single record
+	EntityType string
+	EntityID   int64
+	Action     string
+	// Since and Until optionally restrict the entries to a period
+	Since *time.Time
+	Until *time.Time
+}
+
+// PagedResponse contains a page of entries and meta data for pagination
+type PagedResponse struct {
+	Entries       []Entry              `json:"entries"`
+	PagedResponse models.PagedResponse `json:"meta"`
+}
+
+// Entries retrieves the entries of a user matching a filter, most recent first.
+func Entries(db *sql.DB, filter Filter, limit models.QueryLimit) (PagedResponse, error) {
+	response := PagedResponse{Entries: make([]Entry, 0)}
+	keyset := models.Keyset{Sort: Sorter.Default, Limit: limit}
+	keysetFragment, keysetArgs, err := keyset.Where()
+	if err != nil {
+		return response, err
+	}
+	where := "where user_id = ?"
+	args := []interface{}{filter.UserID}
+	if filter.EntityType != "" {
+		where += " and entity_type = ?"
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID > 0 {
+		where += " and entity_id = ?"
+		args = append(args, filter.EntityID)
+	}
+	if filter.Action != "" {
+		where += " and action = ?"
+		args = append(args, filter.Action)
+	}
+	if filter.Since != nil {
+		where += " and created >= ?"
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		where += " and created < ?"
+		args = append(args, *filter.Until)
+	}
+	total, err := database.CountRows(db, limit.Total, "select id from audit_log "+where, args...)
+	if err != nil {
+		return response, err
+	}
+	response.PagedResponse.SetTotal(total, limit)
+	q := fmt.Sprintf(`
+		select id, user_id, actor_id, entity_type, entity_id, action, changes, created, %v
+		from audit_log
+		%v %v
+		%v
+	`, keyset.Columns(), where, keysetFragment, keyset.OrderBy())
+	rows, err := db.Query(q, append(args, keysetArgs...)...)
+	if err != nil {
+		return response, err
+	}
+	defer rows.Close()
+	values := make([][]interface{}, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		entry := Entry{}
+		var changes []byte
+		row, value := keyset.Scan(&entry.ID, &entry.UserID, &entry.ActorID, &entry.EntityType, &entry.EntityID, &entry.Action, &changes, &entry.Created)
+		if err = rows.Scan(row...); err != nil {
+			return response, err
+		}
+		if err = json.Unmarshal(changes, &entry.Changes); err != nil {
+			return response, err
+		}
+		response.Entries = append(response.Entries, entry)
+		values = append(values, value)
+		ids = append(ids, entry.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return response, err
+	}
+	keyset.Page(&response.Entries, values, ids, &response.PagedResponse)
+	response.PagedResponse.RequestTotal = len(response.Entries)
+	return response, nil
+}
+
+// After retrieves at most limit entries of a user sequenced after a sequence, in sequence order.
+// Identifiers are assigned as entries are appended rather than committed, so entries are followed by their sequence:
+// entries committed since the last call of SequenceCommitted are not sequenced yet,
+// they are retrieved once it is called again.
+func After(db *sql.DB, userID int64, sequence int64, limit int) ([]Entry, error) {
+	q := `
+		select id, sequence, user_id, actor_id, entity_type, entity_id, action, changes, created
+		from audit_log
+		where user_id = ? and sequence > ?
+		order by sequence
+		limit %v
+	`
+	rows, err := db.Query(fmt.Sprintf(q, limit), userID, sequence)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		entry := Entry{}
+		var changes []byte
+		err = rows.Scan(&entry.ID, &entry.Sequence, &entry.UserID, &entry.ActorID, &entry.EntityType, &entry.EntityID, &entry.Action, &changes, &entry.Created)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// SequenceCommitted numbers the entries of a user committed since it was last called, so that After returns them,
+// and returns the sequence of the latest entry, 0 when the user has none (see database.Sequence).
+func SequenceCommitted(db *sql.DB, userID int64) (int64, error) {
+	return database.Sequence(db, "audit_sequences", "audit_log", "id", userID)
+}
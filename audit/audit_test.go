@@ -0,0 +1,39 @@
+package audit_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+)
+
+func TestDiff(t *testing.T) {
+	two := 2
+	before := audit.Fields{"name": "Winter", "quantity": 1, "min_quantity": nil, "tags": []string{"coats"}}
+	after := audit.Fields{"name": "Winter", "quantity": 3, "min_quantity": &two, "tags": []string{"coats"}}
+	changes := audit.Diff(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("Expected quantity and min_quantity to change but got %v", changes)
+	}
+	if change := changes["quantity"]; string(change.Before) != "1" || string(change.After) != "3" {
+		t.Errorf("Expected quantity to change from 1 to 3 but got %s to %s", change.Before, change.After)
+	}
+	if change := changes["min_quantity"]; string(change.Before) != "null" || string(change.After) != "2" {
+		t.Errorf("Expected min_quantity to change from null to 2 but got %s to %s", change.Before, change.After)
+	}
+}
+
+func TestDiffCreated(t *testing.T) {
+	changes := audit.Diff(nil, audit.Fields{"name": "Garage"})
+	if change, ok := changes["name"]; !ok || string(change.Before) != "null" || string(change.After) != `"Garage"` {
+		t.Errorf("Expected every field of a created record but got %v", changes)
+	}
+}
+
+func TestNewEntryActor(t *testing.T) {
+	if entry := audit.NewEntry(2, 1, audit.Item, 5, audit.ActionDelete, nil); entry.ActorID != 2 || entry.UserID != 1 {
+		t.Errorf("Expected the action of user 2 on a record of user 1 but got %+v", entry)
+	}
+	if entry := audit.NewEntry(0, 1, audit.Item, 5, audit.ActionDelete, nil); entry.ActorID != 1 {
+		t.Errorf("Expected an action without an actor to be attributed to the owner but got %+v", entry)
+	}
+}
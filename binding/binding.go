@@ -0,0 +1,274 @@
+// Package binding decodes request bodies into typed request structs whatever their encoding
+// and validates them, reporting every problem along with the field it concerns.
+//
+// Struct fields are named by their json tag for every encoding and validated by their validate tag (see Validate).
+package binding
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxMemory is how much of a multipart body is held in memory, the rest is stored in temporary files.
+const maxMemory = 32 << 20
+
+// maxJSONBody is the largest JSON body read, as large as the bodies kept by the idempotency middleware.
+const maxJSONBody = 1 << 20
+
+// errTrailingData is returned for JSON bodies holding more than a single value.
+var errTrailingData = errors.New("trailing data after the JSON value")
+
+// FieldError describes why the value of a field was rejected.
+// Problems with the body as a whole have no field.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors are the problems found with a request body.
+type Errors []FieldError
+
+// Add records a problem with a field.
+func (e *Errors) Add(field string, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		if fieldError.Field == "" {
+			messages[i] = fieldError.Message
+		} else {
+			messages[i] = fieldError.Field + " " + fieldError.Message
+		}
+	}
+	return "invalid request: " + strings.Join(messages, ", ")
+}
+
+// Bind decodes the body of a request into dest, a pointer to a struct, and validates it (see Decode and Validate).
+func Bind(req *http.Request, dest interface{}) Errors {
+	if errs := Decode(req, dest); errs != nil {
+		return errs
+	}
+	return Validate(dest)
+}
+
+// Decode reads the body of a request into dest, a pointer to a struct, according to its content type.
+// JSON, form-urlencoded and multipart bodies are accepted, bodies without a content type are read as forms.
+// Fields missing from the body are left untouched so pointer fields tell absent values from empty ones.
+func Decode(req *http.Request, dest interface{}) Errors {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return decodeJSON(req.Body, dest)
+	case mediaType == "multipart/form-data":
+		if err := req.ParseMultipartForm(maxMemory); err != nil {
+			return Errors{{Message: "malformed multipart body"}}
+		}
+	case mediaType == "" || mediaType == "application/x-www-form-urlencoded":
+		if err := req.ParseForm(); err != nil {
+			return Errors{{Message: "malformed form body"}}
+		}
+	default:
+		return Errors{{Message: "unsupported content type " + mediaType}}
+	}
+	return decodeForm(req.PostForm, dest)
+}
+
+func decodeJSON(body io.ReadCloser, dest interface{}) Errors {
+	err := readJSON(body, dest)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.UnmarshalTypeError:
+		return Errors{{Field: e.Field, Message: "must be " + describe(e.Type)}}
+	default:
+		if err == io.EOF {
+			return nil
+		}
+		if tooLarge(err) {
+			return Errors{{Message: "the body must be at most 1MB"}}
+		}
+		return Errors{{Message: "malformed JSON body"}}
+	}
+}
+
+// readJSON decodes a body holding a single JSON value, of at most maxJSONBody bytes, into dest.
+func readJSON(body io.ReadCloser, dest interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, body, maxJSONBody))
+	if err := decoder.Decode(dest); err != nil {
+		return err
+	}
+	// Anything but the end of the body follows the value, including stray closing delimiters that More ignores
+	if _, err := decoder.Token(); err != io.EOF {
+		if tooLarge(err) {
+			return err
+		}
+		return errTrailingData
+	}
+	return nil
+}
+
+// tooLarge reports whether reading a body failed for exceeding its limit.
+// The error of http.MaxBytesReader has no type of its own before Go 1.19.
+func tooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
+// decodeForm sets the fields of dest from form values.
+// Empty values of fields that are not text or lists are treated as absent.
+func decodeForm(form url.Values, dest interface{}) Errors {
+	var errs Errors
+	value := reflect.ValueOf(dest).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := fieldName(value.Type().Field(i))
+		values, ok := form[name]
+		if name == "" || !ok || len(values) == 0 {
+			continue
+		}
+		if err := setField(value.Field(i), values); err != nil {
+			errs.Add(name, err.Error())
+		}
+	}
+	return errs
+}
+
+type decodeError string
+
+func (e decodeError) Error() string {
+	return string(e)
+}
+
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Ptr {
+		if !keepsEmpty(field.Type().Elem()) && strings.TrimSpace(values[0]) == "" {
+			return nil
+		}
+		target := reflect.New(field.Type().Elem())
+		if err := setField(target.Elem(), values); err != nil {
+			return err
+		}
+		field.Set(target)
+		return nil
+	}
+	if field.Kind() == reflect.Slice {
+		items := reflect.MakeSlice(field.Type(), 0, len(values))
+		for _, value := range values {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part == "" {
+					continue
+				}
+				item := reflect.New(field.Type().Elem()).Elem()
+				if err := setValue(item, part); err != nil {
+					return decodeError("values must each be " + describe(item.Type()))
+				}
+				items = reflect.Append(items, item)
+			}
+		}
+		field.Set(items)
+		return nil
+	}
+	if !keepsEmpty(field.Type()) && strings.TrimSpace(values[0]) == "" {
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+func setValue(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return decodeError("must be " + describe(field.Type()))
+		}
+		field.SetInt(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return decodeError("must be " + describe(field.Type()))
+		}
+		field.SetFloat(number)
+	case reflect.Bool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return decodeError("must be " + describe(field.Type()))
+		}
+		field.SetBool(flag)
+	default:
+		return decodeError("can not be sent as a form value")
+	}
+	return nil
+}
+
+// keepsEmpty reports whether an empty form value is meaningful for a type (an empty text or list).
+func keepsEmpty(kind reflect.Type) bool {
+	return kind.Kind() == reflect.String || kind.Kind() == reflect.Slice
+}
+
+// describe names a type the way a client would understand it.
+func describe(kind reflect.Type) string {
+	switch kind.Kind() {
+	case reflect.Ptr:
+		return describe(kind.Elem())
+	case reflect.String:
+		return "text"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+	return "an object"
+}
+
+// fieldName is the name of a struct field in request bodies, empty for fields that are not decoded.
+func fieldName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// List is text values that may also be sent as a single comma separated value (ie: "tools,garden" or ["tools", "garden"]).
+type List []string
+
+// UnmarshalJSON accepts an array of strings or a comma separated string.
+func (l *List) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		var value string
+		if json.Unmarshal(data, &value) != nil {
+			return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(values)}
+		}
+		values = strings.Split(value, ",")
+	}
+	list := make(List, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	*l = list
+	return nil
+}
@@ -0,0 +1,158 @@
+package binding_test
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+)
+
+type itemRequest struct {
+	Body     string        `json:"body" validate:"required,max=10"`
+	Quantity *int          `json:"quantity" validate:"min=1"`
+	Expires  string        `json:"expires" validate:"date"`
+	Tags     *binding.List `json:"tags"`
+}
+
+func TestBindForm(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("body=Hammer&quantity=3&tags=tools,+garden"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var body itemRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		t.Fatal(errs)
+	}
+	if body.Body != "Hammer" || body.Quantity == nil || *body.Quantity != 3 {
+		t.Errorf("Unexpected body %+v", body)
+	}
+	if body.Tags == nil || !reflect.DeepEqual(*body.Tags, binding.List{"tools", "garden"}) {
+		t.Errorf("Unexpected tags %v", body.Tags)
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"body": "Hammer", "tags": "tools,garden"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	var body itemRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		t.Fatal(errs)
+	}
+	if body.Quantity != nil {
+		t.Errorf("Expected quantity to be absent but got %v", *body.Quantity)
+	}
+	if body.Tags == nil || !reflect.DeepEqual(*body.Tags, binding.List{"tools", "garden"}) {
+		t.Errorf("Unexpected tags %v", body.Tags)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("body=A+very+long+hammer&quantity=0&expires=tomorrow"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var body itemRequest
+	errs := binding.Bind(req, &body)
+	expected := binding.Errors{
+		{Field: "body", Message: "must be at most 10 characters"},
+		{Field: "quantity", Message: "must be at least 1"},
+		{Field: "expires", Message: "must be a date in the form of YYYY-MM-DD"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected %v but got %v", expected, errs)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"body": "Hammer", "quantity": "three"}`))
+	req.Header.Set("Content-Type", "application/json")
+	errs = binding.Bind(req, &body)
+	if len(errs) != 1 || errs[0].Field != "quantity" || errs[0].Message != "must be a whole number" {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"body": "Hammer"} {"body": "Saw"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if errs = binding.Bind(req, &body); len(errs) != 1 || errs[0].Message != "malformed JSON body" {
+		t.Errorf("Expected trailing data to be rejected but got %v", errs)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"body": "`+strings.Repeat("a", 2<<20)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if errs = binding.Bind(req, &body); len(errs) != 1 || errs[0].Message != "the body must be at most 1MB" {
+		t.Errorf("Expected the body to be capped but got %v", errs)
+	}
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("<item/>"))
+	req.Header.Set("Content-Type", "application/xml")
+	if errs = binding.Bind(req, &body); len(errs) != 1 || errs[0].Field != "" {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	var body struct {
+		URL string `json:"url" validate:"url"`
+	}
+	for input, valid := range map[string]bool{
+		"https://hooks.example.com/boxmeup": true,
+		"http://192.168.1.20:8123/api":      true,
+		"ftp://example.com":                 false,
+		"/relative":                         false,
+		"not a url":                         false,
+	} {
+		body.URL = input
+		if errs := binding.Validate(&body); (errs == nil) != valid {
+			t.Errorf("Expected %v to be valid (%v) but got %v", input, valid, errs)
+		}
+	}
+}
+
+type locationPatch struct {
+	Name    string  `json:"name" validate:"required"`
+	Address *string `json:"address"`
+	Count   int     `json:"count"`
+}
+
+func TestBindMergePatch(t *testing.T) {
+	address := "1 Main St"
+	body := locationPatch{Name: "Garage", Address: &address, Count: 2}
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"address": null, "count": 3}`))
+	req.Header.Set("Content-Type", binding.MergePatchContentType)
+	patch, errs := binding.BindPatch(req, &body)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if body.Name != "Garage" || body.Address != nil || body.Count != 3 {
+		t.Errorf("Unexpected body %+v", body)
+	}
+	if !patch.Has("address") || !patch.IsNull("address") || patch.Has("name") {
+		t.Errorf("Unexpected patch %v", patch)
+	}
+
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name": null, "color": "red"}`))
+	req.Header.Set("Content-Type", binding.MergePatchContentType)
+	_, errs = binding.BindPatch(req, &body)
+	expected := binding.Errors{{Field: "color", Message: "can not be changed"}}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected %v but got %v", expected, errs)
+	}
+}
+
+func TestBindJSONPatch(t *testing.T) {
+	address := "1 Main St"
+	body := locationPatch{Name: "Garage", Address: &address}
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`[
+		{"op": "replace", "path": "/name", "value": "Shed"},
+		{"op": "remove", "path": "/address"}
+	]`))
+	req.Header.Set("Content-Type", binding.JSONPatchContentType)
+	if _, errs := binding.BindPatch(req, &body); errs != nil {
+		t.Fatal(errs)
+	}
+	if body.Name != "Shed" || body.Address != nil {
+		t.Errorf("Unexpected body %+v", body)
+	}
+
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "move", "from": "/name", "path": "/address"}]`))
+	req.Header.Set("Content-Type", binding.JSONPatchContentType)
+	if _, errs := binding.BindPatch(req, &body); len(errs) != 1 {
+		t.Errorf("Expected the operation to be rejected but got %v", errs)
+	}
+}
@@ -0,0 +1,142 @@
+package binding
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Content types of partial updates
+const (
+	// MergePatchContentType is a JSON merge patch (RFC 7396), the default for PATCH requests
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType is a JSON patch (RFC 6902), limited to add, replace and remove operations on fields
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// Patch lists the fields a partial update changes along with their new value, a null value clears a field.
+type Patch map[string]json.RawMessage
+
+// Has reports whether a field is changed.
+func (p Patch) Has(field string) bool {
+	_, ok := p[field]
+	return ok
+}
+
+// IsNull reports whether a field is cleared.
+func (p Patch) IsNull(field string) bool {
+	value, ok := p[field]
+	return ok && isNull(value)
+}
+
+func isNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// BindPatch applies the partial update of a request to dest, a pointer to a struct holding the current values
+// of a record, and validates the result (see DecodePatch and Patch.Apply).
+func BindPatch(req *http.Request, dest interface{}) (Patch, Errors) {
+	patch, errs := DecodePatch(req)
+	if errs != nil {
+		return patch, errs
+	}
+	if errs = patch.Apply(dest); errs != nil {
+		return patch, errs
+	}
+	return patch, Validate(dest)
+}
+
+// DecodePatch reads a partial update from the body of a request.
+// Merge patches (and plain JSON objects) are read as is, JSON patches are converted to the equivalent merge patch.
+func DecodePatch(req *http.Request) (Patch, Errors) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case MergePatchContentType, "application/json", "":
+		var patch Patch
+		if err := readJSON(req.Body, &patch); err != nil || patch == nil {
+			return nil, Errors{{Message: "the body must be a JSON object"}}
+		}
+		return patch, nil
+	case JSONPatchContentType:
+		return decodeJSONPatch(req)
+	}
+	return nil, Errors{{Message: "unsupported content type " + mediaType}}
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// decodeJSONPatch converts the operations of a JSON patch on the fields of a record into a merge patch.
+func decodeJSONPatch(req *http.Request) (Patch, Errors) {
+	var operations []operation
+	if err := readJSON(req.Body, &operations); err != nil {
+		return nil, Errors{{Message: "the body must be a JSON array of operations"}}
+	}
+	patch := make(Patch)
+	var errs Errors
+	for _, operation := range operations {
+		field := strings.TrimPrefix(operation.Path, "/")
+		if !strings.HasPrefix(operation.Path, "/") || field == "" || strings.Contains(field, "/") {
+			errs.Add(operation.Path, "only fields of the record can be patched")
+			continue
+		}
+		field = strings.NewReplacer("~1", "/", "~0", "~").Replace(field)
+		switch operation.Op {
+		case "add", "replace":
+			if operation.Value == nil {
+				errs.Add(field, "the value is missing")
+				continue
+			}
+			patch[field] = operation.Value
+		case "remove":
+			patch[field] = json.RawMessage("null")
+		default:
+			errs.Add(field, "unsupported operation "+operation.Op)
+		}
+	}
+	return patch, errs
+}
+
+// Apply sets the fields of dest, a pointer to a struct, that are changed by the patch.
+// Cleared fields are set to their zero value (nil for pointers), fields dest does not have are rejected.
+func (p Patch) Apply(dest interface{}) Errors {
+	var errs Errors
+	value := reflect.ValueOf(dest).Elem()
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < value.NumField(); i++ {
+		if name := fieldName(value.Type().Field(i)); name != "" {
+			fields[name] = value.Field(i)
+		}
+	}
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw := p[name]
+		field, ok := fields[name]
+		if !ok {
+			errs.Add(name, "can not be changed")
+			continue
+		}
+		if isNull(raw) {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		target := reflect.New(field.Type())
+		if err := json.Unmarshal(raw, target.Interface()); err != nil {
+			errs.Add(name, "must be "+describe(field.Type()))
+			continue
+		}
+		field.Set(target.Elem())
+	}
+	return errs
+}
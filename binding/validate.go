@@ -0,0 +1,134 @@
+package binding
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// Validator is implemented by request structs with rules that validate tags can not express.
+// It is called after the validate tags are checked.
+type Validator interface {
+	Validate() Errors
+}
+
+// Validate checks the fields of a struct against the comma separated rules of their validate tag:
+//   required (present and not empty)
+//   min=N, max=N (the length of text or lists, the value of numbers)
+//   email (an email address)
+//   date (a date in the form of YYYY-MM-DD)
+//   url (an absolute http or https URL)
+// Rules other than required are skipped for absent (nil) values.
+func Validate(dest interface{}) Errors {
+	var errs Errors
+	value := reflect.ValueOf(dest)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		name := fieldName(structField)
+		rules := structField.Tag.Get("validate")
+		if name == "" || rules == "" {
+			continue
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if message := check(value.Field(i), rule); message != "" {
+				errs.Add(name, message)
+				break
+			}
+		}
+	}
+	if validator, ok := dest.(Validator); ok {
+		errs = append(errs, validator.Validate()...)
+	}
+	return errs
+}
+
+// check applies a rule to a field, describing the problem when the rule is broken.
+func check(field reflect.Value, rule string) string {
+	name, argument := rule, ""
+	if parts := strings.SplitN(rule, "=", 2); len(parts) == 2 {
+		name, argument = parts[0], parts[1]
+	}
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			if name == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		field = field.Elem()
+	}
+	switch name {
+	case "required":
+		if isEmpty(field) {
+			return "is required"
+		}
+	case "min", "max":
+		bound, err := strconv.Atoi(argument)
+		if err != nil {
+			panic(fmt.Sprintf("binding: invalid rule %v", rule))
+		}
+		return checkBound(field, name, bound)
+	case "email":
+		if text := field.String(); text != "" {
+			if _, err := mail.ParseAddress(text); err != nil {
+				return "must be an email address"
+			}
+		}
+	case "date":
+		if text := field.String(); text != "" {
+			if _, err := models.ParseDate(text); err != nil {
+				return "must be a date in the form of YYYY-MM-DD"
+			}
+		}
+	case "url":
+		if text := field.String(); text != "" {
+			if parsed, err := url.Parse(text); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return "must be an http or https URL"
+			}
+		}
+	default:
+		panic(fmt.Sprintf("binding: unknown rule %v", rule))
+	}
+	return ""
+}
+
+func checkBound(field reflect.Value, name string, bound int) string {
+	var size int64
+	unit := ""
+	switch field.Kind() {
+	case reflect.String:
+		size, unit = int64(utf8.RuneCountInString(field.String())), " characters"
+	case reflect.Slice, reflect.Array:
+		size, unit = int64(field.Len()), " values"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = field.Int()
+	default:
+		return ""
+	}
+	if name == "min" && size < int64(bound) {
+		return fmt.Sprintf("must be at least %v%v", bound, unit)
+	}
+	if name == "max" && size > int64(bound) {
+		return fmt.Sprintf("must be at most %v%v", bound, unit)
+	}
+	return ""
+}
+
+func isEmpty(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(field.String()) == ""
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return field.Len() == 0
+	}
+	return reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface())
+}
@@ -0,0 +1,42 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+)
+
+// ErrNotFound is returned when a key does not exist in a store.
+var ErrNotFound = errors.New("blob not found")
+
+// Store persists binary objects by key.
+type Store interface {
+	// Put stores data under a key, replacing anything previously stored there.
+	Put(key string, contentType string, data []byte) error
+	// Get opens the data stored under a key. The caller must close it.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes a key. Removing a key that does not exist is not an error.
+	Delete(key string) error
+}
+
+// FromConfig constructs the blob store selected by the BLOB_STORE configuration.
+func FromConfig(c config.Configuration) (Store, error) {
+	switch c.BlobStore {
+	case "", "local":
+		return NewLocalStore(c.BlobLocalPath), nil
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required for the s3 blob store")
+		}
+		return NewS3Store(S3Config{
+			Endpoint:  c.S3Endpoint,
+			Bucket:    c.S3Bucket,
+			Region:    c.S3Region,
+			AccessKey: c.S3AccessKey,
+			SecretKey: c.S3SecretKey,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown blob store: %v", c.BlobStore)
+}
@@ -0,0 +1,104 @@
+package blob_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/blob"
+)
+
+// s3StandIn is a minimal in memory imitation of an S3 compatible (MinIO style) server.
+type s3StandIn struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	t       *testing.T
+}
+
+func (s *s3StandIn) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		s.t.Errorf("Unexpected authorization header: %v", auth)
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.Method {
+	case "PUT":
+		body, _ := ioutil.ReadAll(req.Body)
+		sum := sha256.Sum256(body)
+		if req.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			s.t.Error("Payload hash does not match the body.")
+		}
+		s.objects[req.URL.Path] = body
+	case "GET":
+		body, ok := s.objects[req.URL.Path]
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		res.Write(body)
+	case "DELETE":
+		delete(s.objects, req.URL.Path)
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	standIn := &s3StandIn{objects: make(map[string][]byte), t: t}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	store := blob.NewS3Store(blob.S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "photos",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	testStore(t, store)
+	if _, ok := standIn.objects["/photos/1/a b.jpg"]; ok {
+		t.Error("Expected object to be removed from the bucket.")
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(root)
+	testStore(t, blob.NewLocalStore(root))
+}
+
+func testStore(t *testing.T, store blob.Store) {
+	if err := store.Put("1/a b.jpg", "image/jpeg", []byte("jpeg data")); err != nil {
+		t.Error(err)
+		return
+	}
+	reader, err := store.Get("1/a b.jpg")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, _ := ioutil.ReadAll(reader)
+	reader.Close()
+	if string(data) != "jpeg data" {
+		t.Errorf("Expected stored data but got %q", data)
+	}
+	if err = store.Delete("1/a b.jpg"); err != nil {
+		t.Error(err)
+	}
+	if _, err = store.Get("1/a b.jpg"); err != blob.ErrNotFound {
+		t.Errorf("Expected not found error but got %v", err)
+	}
+	if err = store.Delete("1/a b.jpg"); err != nil {
+		t.Errorf("Expected deleting a missing key to succeed but got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package blob
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files below a root directory.
+type LocalStore struct {
+	Root string
+}
+
+// NewLocalStore constructs a store rooted at a directory.
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{Root: root}
+}
+
+func (s *LocalStore) path(key string) string {
+	// Clean against a virtual root so keys can never escape the store directory.
+	clean := filepath.Clean("/" + strings.TrimLeft(key, "/"))
+	return filepath.Join(s.Root, filepath.FromSlash(clean))
+}
+
+// Put writes the data to a file, creating intermediate directories as needed.
+func (s *LocalStore) Put(key string, contentType string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens the file of a key.
+func (s *LocalStore) Get(key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete removes the file of a key.
+func (s *LocalStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config describes how to reach an S3 compatible bucket (AWS, MinIO, etc).
+type S3Config struct {
+	// Endpoint is the base URL of the service, ie: https://s3.amazonaws.com or http://minio:9000
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store keeps blobs in an S3 compatible bucket using path style requests.
+type S3Store struct {
+	config S3Config
+	Client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Store constructs a store for a bucket.
+func NewS3Store(config S3Config) *S3Store {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	return &S3Store{
+		config: config,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (s *S3Store) objectURL(key string) string {
+	segments := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%v/%v/%v", s.config.Endpoint, url.PathEscape(s.config.Bucket), strings.Join(segments, "/"))
+}
+
+// Put uploads the data as an object.
+func (s *S3Store) Put(key string, contentType string, data []byte) error {
+	req, err := http.NewRequest("PUT", s.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := s.do(req, data)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Get downloads an object.
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Delete removes an object.
+func (s *S3Store) Delete(key string) error {
+	req, err := http.NewRequest("DELETE", s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, nil)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3Store) do(req *http.Request, payload []byte) (*http.Response, error) {
+	s.sign(req, payload)
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("s3 responded with status %v: %s", res.StatusCode, message)
+	}
+	return res, nil
+}
+
+// sign adds an AWS Signature Version 4 authorization to the request.
+func (s *S3Store) sign(req *http.Request, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := emptyPayloadHash
+	if len(payload) > 0 {
+		sum := sha256.Sum256(payload)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%v\nx-amz-content-sha256:%v\nx-amz-date:%v\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", day, s.config.Region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), day)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
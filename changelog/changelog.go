@@ -0,0 +1,125 @@
+// Package changelog records, in sequence, every change of the records kept in sync by clients (see modules/delta).
+// Stores record a change within the transaction that makes it, removals are recorded as tombstones.
+// The log keeps the latest change of each record, it is sequenced once committed (see Latest).
+package changelog
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// ErrInvalidToken is returned for sync tokens that were not issued by Token.
+var ErrInvalidToken error = &models.Error{Kind: models.ErrValidation, Code: "invalid_sync_token", Message: "invalid sync token"}
+
+// The types of records in the change log
+const (
+	Container = "container"
+	Item      = "item"
+	Location  = "location"
+)
+
+// owners selects the owner and ID of records of each type, the record table is aliased as x.
+var owners = map[string]string{
+	Container: "select user_id, x.id from containers x where %v",
+	Item:      "select c.user_id, x.id from container_items x inner join containers c on c.id = x.container_id where %v",
+	Location:  "select user_id, x.id from locations x where %v",
+}
+
+// Change is the latest change of a record.
+type Change struct {
+	// Sequence orders the changes of a user, it increases with every change
+	Sequence int64
+	Type     string
+	ID       int64
+	// Deleted marks a tombstone, the record was removed
+	Deleted bool
+	Created time.Time
+}
+
+// Execer runs statements, it is satisfied by *sql.DB and *sql.Tx.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Changed records that a record of a type was created or modified.
+func Changed(db Execer, recordType string, id int64) error {
+	return Record(db, recordType, false, "x.id = ?", id)
+}
+
+// Deleted records the tombstone of a record, it must be called before the record is removed.
+func Deleted(db Execer, recordType string, id int64) error {
+	return Record(db, recordType, true, "x.id = ?", id)
+}
+
+// Record replaces the change of every record of a type matching a condition on its table, aliased as x,
+// ie: Record(tx, Item, true, "x.container_id = ?", containerID) before the items of a container are removed.
+// The change is left without a sequence until it is committed and sequenced by Latest.
+func Record(db Execer, recordType string, deleted bool, where string, args ...interface{}) error {
+	owner, ok := owners[recordType]
+	if !ok {
+		return fmt.Errorf("unknown change log type %v", recordType)
+	}
+	q := fmt.Sprintf(`
+		insert into changes (user_id, entity_type, entity_id, deleted, created)
+		select owner.user_id, ?, owner.id, ?, now() from (%v) owner
+		on duplicate key update sequence = null, deleted = values(deleted), created = values(created)
+	`, fmt.Sprintf(owner, where))
+	_, err := db.Exec(q, append([]interface{}{recordType, deleted}, args...)...)
+	return err
+}
+
+// Since retrieves the changes of a user sequenced after a sequence, in sequence order.
+// At most limit changes are returned, the sequence of the last one continues the retrieval.
+// Tombstones are left out when since is 0 since clients have nothing to remove.
+// Changes committed since the last call of Latest are not sequenced yet, they are retrieved once it is called again.
+func Since(db *sql.DB, userID int64, since int64, limit int) ([]Change, error) {
+	q := `
+		select sequence, entity_type, entity_id, deleted, created
+		from changes
+		where user_id = ? and sequence > ? and (deleted = false or ? > 0)
+		order by sequence
+		limit ?
+	`
+	rows, err := db.Query(q, userID, since, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	changes := make([]Change, 0)
+	for rows.Next() {
+		change := Change{}
+		if err = rows.Scan(&change.Sequence, &change.Type, &change.ID, &change.Deleted, &change.Created); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// Latest sequences the changes of a user committed since it was last called and returns the sequence of the
+// latest change, 0 when nothing was recorded (see database.Sequence).
+func Latest(db *sql.DB, userID int64) (int64, error) {
+	return database.Sequence(db, "change_sequences", "changes", "created, entity_type, entity_id", userID)
+}
+
+// Token encodes a sequence for clients.
+func Token(sequence int64) string {
+	return strconv.FormatInt(sequence, 10)
+}
+
+// ParseToken decodes the sequence of a token, an empty token is the start of the log.
+func ParseToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	sequence, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || sequence < 0 {
+		return 0, ErrInvalidToken
+	}
+	return sequence, nil
+}
@@ -0,0 +1,22 @@
+package changelog_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/changelog"
+)
+
+func TestToken(t *testing.T) {
+	sequence, err := changelog.ParseToken(changelog.Token(42))
+	if err != nil || sequence != 42 {
+		t.Errorf("Expected the token to hold 42 but got %v (%v)", sequence, err)
+	}
+	if sequence, err = changelog.ParseToken(""); err != nil || sequence != 0 {
+		t.Errorf("Expected an empty token to start the log but got %v (%v)", sequence, err)
+	}
+	for _, token := range []string{"abc", "-1", "2018-01-01"} {
+		if _, err = changelog.ParseToken(token); err != changelog.ErrInvalidToken {
+			t.Errorf("Expected %q to be invalid but got %v", token, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -23,6 +24,40 @@ type Configuration struct {
 	WebHost           string   `env:"WEB_HOST" envDefault:"http://localhost:8080"`
 	AllowedOrigin     []string `env:"CORS_ORIGIN" envDefault:"http://localhost:3000" envSeparater:","`
 	AllowedExtensions []string `env:"EXTENSIONS" envDefault:"export,imagery" envSeparater:","`
+
+	SchedulerEnabled       bool          `env:"SCHEDULER_ENABLED" envDefault:"true"`
+	ExpiryReminderInterval time.Duration `env:"EXPIRY_REMINDER_INTERVAL" envDefault:"1h"`
+	ReminderNotifier       string        `env:"REMINDER_NOTIFIER"`
+	ReminderWebhookURL     string        `env:"REMINDER_WEBHOOK_URL"`
+	SMTPHost               string        `env:"SMTP_HOST"`
+	SMTPPort               int           `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername           string        `env:"SMTP_USERNAME"`
+	SMTPPassword           string        `env:"SMTP_PASSWORD"`
+	SMTPFrom               string        `env:"SMTP_FROM" envDefault:"noreply@boxmeupapp.com"`
+
+	BlobStore      string `env:"BLOB_STORE" envDefault:"local"`
+	BlobLocalPath  string `env:"BLOB_LOCAL_PATH" envDefault:"uploads"`
+	S3Endpoint     string `env:"S3_ENDPOINT"`
+	S3Bucket       string `env:"S3_BUCKET"`
+	S3Region       string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3AccessKey    string `env:"S3_ACCESS_KEY"`
+	S3SecretKey    string `env:"S3_SECRET_KEY"`
+	UploadMaxBytes int64  `env:"UPLOAD_MAX_BYTES" envDefault:"10485760"`
+
+	SearchBackend string `env:"SEARCH_BACKEND" envDefault:"mysql"`
+	MaxPerPage    int    `env:"MAX_PER_PAGE" envDefault:"100"`
+
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	TrashRetention time.Duration `env:"TRASH_RETENTION" envDefault:"720h"`
+	UndoWindow     time.Duration `env:"UNDO_WINDOW" envDefault:"10m"`
+
+	WebhookInterval     time.Duration `env:"WEBHOOK_INTERVAL" envDefault:"10s"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookLogRetention time.Duration `env:"WEBHOOK_LOG_RETENTION" envDefault:"720h"`
+
+	StreamHeartbeat    time.Duration `env:"STREAM_HEARTBEAT" envDefault:"30s"`
+	StreamPollInterval time.Duration `env:"STREAM_POLL_INTERVAL" envDefault:"5s"`
 }
 
 var Config Configuration
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// Queryer runs queries on a database or within a transaction.
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// CountRows counts the rows selected by a query, exactly or estimated from its query plan (see models.TotalMode).
+// Counting within the transaction that selects a page keeps the total consistent with the page.
+func CountRows(db Queryer, mode models.TotalMode, q string, args ...interface{}) (int, error) {
+	switch mode {
+	case models.TotalNone:
+		return 0, nil
+	case models.TotalEstimate:
+		return estimateRows(db, q, args...)
+	}
+	var total int
+	err := db.QueryRow(fmt.Sprintf("select count(*) from (%v) counted", q), args...).Scan(&total)
+	return total, err
+}
+
+// estimateRows multiplies the rows the planner expects to read from each table joined by the outer query.
+func estimateRows(db Queryer, q string, args ...interface{}) (int, error) {
+	rows, err := db.Query("explain "+q, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	estimate := 1.0
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		plan := make(map[string]string)
+		for i, column := range columns {
+			plan[column] = string(values[i])
+		}
+		if plan["select_type"] != "SIMPLE" && plan["select_type"] != "PRIMARY" {
+			continue
+		}
+		count, _ := strconv.ParseFloat(plan["rows"], 64)
+		if filtered, err := strconv.ParseFloat(plan["filtered"], 64); err == nil {
+			count *= filtered / 100
+		}
+		estimate *= count
+	}
+	return int(estimate + 0.5), rows.Err()
+}
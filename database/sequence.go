@@ -0,0 +1,45 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Sequence numbers the committed rows of a user that have no sequence yet, following the sequence of the user kept
+// in the counters table, and returns the latest sequence of the user, 0 when nothing was numbered.
+// Both tables have user_id and sequence columns, rows are numbered in the order of the order by clause.
+// Rows are numbered once they are visible rather than by the transactions inserting them, under the lock of the
+// sequence of the user, so a row committed late is never given a sequence lower than one already read.
+func Sequence(db *sql.DB, counters string, table string, orderBy string, userID int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	q := fmt.Sprintf("insert into %v (user_id, sequence) values (?, 0) on duplicate key update sequence = sequence", counters)
+	if _, err = tx.Exec(q, userID); err != nil {
+		return 0, err
+	}
+	var sequence int64
+	if err = tx.QueryRow(fmt.Sprintf("select sequence from %v where user_id = ? for update", counters), userID).Scan(&sequence); err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec("set @sequence := ?", sequence); err != nil {
+		return 0, err
+	}
+	q = fmt.Sprintf(`
+		update %v set sequence = (@sequence := @sequence + 1)
+		where user_id = ? and sequence is null
+		order by %v
+	`, table, orderBy)
+	if _, err = tx.Exec(q, userID); err != nil {
+		return 0, err
+	}
+	if err = tx.QueryRow("select @sequence").Scan(&sequence); err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(fmt.Sprintf("update %v set sequence = ? where user_id = ?", counters), sequence, userID); err != nil {
+		return 0, err
+	}
+	return sequence, tx.Commit()
+}
@@ -0,0 +1,198 @@
+// Package events is the in-process bus of domain events. The containers, items, locations and users stores
+// publish an event for every create, update, delete and restore once it is committed, built in modules and
+// plugins (see hooks.EventHook) subscribe to the events they react to.
+package events
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+)
+
+// The events published by the stores, named type.action
+const (
+	ContainerCreated  = "container.created"
+	ContainerUpdated  = "container.updated"
+	ContainerDeleted  = "container.deleted"
+	ContainerRestored = "container.restored"
+	ItemCreated       = "item.created"
+	ItemUpdated       = "item.updated"
+	ItemDeleted       = "item.deleted"
+	ItemRestored      = "item.restored"
+	LocationCreated   = "location.created"
+	LocationUpdated   = "location.updated"
+	LocationDeleted   = "location.deleted"
+	LocationRestored  = "location.restored"
+	UserCreated       = "user.created"
+	UserUpdated       = "user.updated"
+)
+
+// QueueSize is the number of events waiting for an asynchronous subscriber before further events are dropped.
+const QueueSize = 1024
+
+var pastTense = map[string]string{
+	audit.ActionCreate:  "created",
+	audit.ActionUpdate:  "updated",
+	audit.ActionDelete:  "deleted",
+	audit.ActionRestore: "restored",
+}
+
+// NameOf names the event of an action on a type of record (see the audit types and actions).
+func NameOf(entityType string, action string) string {
+	return entityType + "." + pastTense[action]
+}
+
+// Event is an action committed on a record.
+type Event struct {
+	Name string `json:"event"`
+	// UserID is the owner of the record
+	UserID     int64  `json:"-"`
+	EntityType string `json:"entity_type"`
+	EntityID   int64  `json:"entity_id"`
+	Action     string `json:"action"`
+	// Changes are the fields changed by the action, as recorded in the audit log
+	Changes  audit.Changes `json:"changes"`
+	Occurred time.Time     `json:"occurred"`
+}
+
+// FromEntry describes the action of an audit entry as an event occurring now.
+func FromEntry(entry audit.Entry) Event {
+	return Event{
+		Name:       NameOf(entry.EntityType, entry.Action),
+		UserID:     entry.UserID,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Action:     entry.Action,
+		Changes:    entry.Changes,
+		Occurred:   time.Now(),
+	}
+}
+
+// Match reports whether an event name is selected by a pattern: the name itself, type.* or *.
+func Match(pattern string, name string) bool {
+	if pattern == "*" || pattern == name {
+		return true
+	}
+	return strings.HasSuffix(pattern, ".*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*"))
+}
+
+// Handler reacts to an event.
+type Handler func(event Event)
+
+type subscriber struct {
+	pattern string
+	handler Handler
+	// queue holds the events of asynchronous subscribers, it is nil for synchronous ones
+	queue chan Event
+}
+
+// Bus delivers published events to the subscribers of their name.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []*subscriber
+	wg          sync.WaitGroup
+}
+
+// NewBus constructs a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls a handler with the events matching a pattern (see Match) before Publish returns,
+// in the goroutine of the publisher. Handlers should be quick, a panic is recovered and logged.
+func (b *Bus) Subscribe(pattern string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, &subscriber{pattern: pattern, handler: handler})
+}
+
+// SubscribeAsync calls a handler with the events matching a pattern in a goroutine of its own, in the order
+// they were published. Events are dropped, and logged, while QueueSize events are waiting for the handler.
+func (b *Bus) SubscribeAsync(pattern string, handler Handler) {
+	s := &subscriber{pattern: pattern, handler: handler, queue: make(chan Event, QueueSize)}
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, s)
+	b.mu.Unlock()
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for event := range s.queue {
+			call(s, event)
+		}
+	}()
+}
+
+// Publish delivers an event to its subscribers.
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subscribers {
+		if !Match(s.pattern, event.Name) {
+			continue
+		}
+		if s.queue == nil {
+			call(s, event)
+			continue
+		}
+		select {
+		case s.queue <- event:
+		default:
+			log.Printf("events: dropped %v %v of a subscriber to %v, its queue is full", event.Name, event.EntityID, s.pattern)
+		}
+	}
+}
+
+// Close stops the asynchronous subscribers once they handled the events waiting for them.
+// Events must not be published afterwards.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	for _, s := range b.subscribers {
+		if s.queue != nil {
+			close(s.queue)
+		}
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func call(s *subscriber, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("events: a subscriber to %v failed on %v %v: %v", s.pattern, event.Name, event.EntityID, r)
+		}
+	}()
+	s.handler(event)
+}
+
+// Default is the bus the stores publish to.
+var Default = NewBus()
+
+// Subscribe calls a handler with the events of the default bus matching a pattern (see Bus.Subscribe).
+func Subscribe(pattern string, handler Handler) {
+	Default.Subscribe(pattern, handler)
+}
+
+// SubscribeAsync calls a handler with the events of the default bus matching a pattern in a goroutine of its own
+// (see Bus.SubscribeAsync).
+func SubscribeAsync(pattern string, handler Handler) {
+	Default.SubscribeAsync(pattern, handler)
+}
+
+// Publish delivers an event to the subscribers of the default bus.
+func Publish(event Event) {
+	Default.Publish(event)
+}
+
+// Committed publishes the events of audit entries once their transaction is committed.
+// Updates that changed nothing are left out, as they are from the audit log.
+func Committed(entries ...audit.Entry) {
+	for _, entry := range entries {
+		if entry.Action == audit.ActionUpdate && len(entry.Changes) == 0 {
+			continue
+		}
+		Publish(FromEntry(entry))
+	}
+}
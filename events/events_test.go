@@ -0,0 +1,88 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/events"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*", events.ItemCreated, true},
+		{events.ItemCreated, events.ItemCreated, true},
+		{"item.*", events.ItemDeleted, true},
+		{"item.*", events.ContainerDeleted, false},
+		{"item", events.ItemCreated, false},
+		{events.ItemUpdated, events.ItemCreated, false},
+	}
+	for _, c := range cases {
+		if events.Match(c.pattern, c.name) != c.match {
+			t.Errorf("Expected Match(%v, %v) to be %v", c.pattern, c.name, c.match)
+		}
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	if name := events.NameOf(audit.Container, audit.ActionRestore); name != events.ContainerRestored {
+		t.Errorf("Expected %v, got %v", events.ContainerRestored, name)
+	}
+}
+
+func TestBus_Subscribe(t *testing.T) {
+	bus := events.NewBus()
+	var received []string
+	bus.Subscribe("item.*", func(event events.Event) {
+		received = append(received, event.Name)
+	})
+	bus.Subscribe("*", func(event events.Event) {
+		panic("failing subscriber")
+	})
+	bus.Publish(events.Event{Name: events.ItemCreated})
+	bus.Publish(events.Event{Name: events.LocationCreated})
+	bus.Publish(events.Event{Name: events.ItemDeleted})
+	if len(received) != 2 || received[0] != events.ItemCreated || received[1] != events.ItemDeleted {
+		t.Errorf("Unexpected events received: %v", received)
+	}
+}
+
+func TestBus_SubscribeAsync(t *testing.T) {
+	bus := events.NewBus()
+	var received []int64
+	bus.SubscribeAsync(events.ContainerUpdated, func(event events.Event) {
+		received = append(received, event.EntityID)
+	})
+	for i := int64(1); i <= 3; i++ {
+		bus.Publish(events.Event{Name: events.ContainerUpdated, EntityID: i})
+	}
+	bus.Close()
+	if len(received) != 3 || received[0] != 1 || received[2] != 3 {
+		t.Errorf("Expected the events in the order they were published, got %v", received)
+	}
+}
+
+func TestCommitted(t *testing.T) {
+	var received []events.Event
+	events.Subscribe("location.*", func(event events.Event) {
+		received = append(received, event)
+	})
+	events.Committed(
+		audit.NewEntry(1, 1, audit.Location, 2, audit.ActionUpdate, nil),
+		audit.NewEntry(1, 1, audit.Location, 2, audit.ActionUpdate, audit.Diff(audit.Fields{"name": "a"}, audit.Fields{"name": "b"})),
+		audit.NewEntry(1, 1, audit.Location, 2, audit.ActionDelete, nil),
+	)
+	if len(received) != 2 {
+		t.Errorf("Expected the update without changes to be left out, got %+v", received)
+		return
+	}
+	if received[0].Name != events.LocationUpdated || received[0].UserID != 1 || received[0].EntityID != 2 {
+		t.Errorf("Unexpected event: %+v", received[0])
+	}
+	if received[1].Name != events.LocationDeleted {
+		t.Errorf("Unexpected event: %+v", received[1])
+	}
+}
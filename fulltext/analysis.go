@@ -0,0 +1,110 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a single word found in a text.
+type Token struct {
+	// Word is the lower cased word as it appeared in the text
+	Word string
+	// Term is the stemmed form of the word used for matching
+	Term string
+	// Start and End are the byte offsets of the word in the text
+	Start int
+	End   int
+}
+
+// Tokenize splits text into words on anything that is not a letter or a digit.
+func Tokenize(text string) []Token {
+	tokens := make([]Token, 0)
+	start := -1
+	for i, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start int, end int) Token {
+	word := strings.ToLower(text[start:end])
+	return Token{
+		Word:  word,
+		Term:  Stem(word),
+		Start: start,
+		End:   end,
+	}
+}
+
+// Stem reduces an english word to a common root so that "drills", "drilling" and "drilled" all match "drill".
+// This is a deliberately light stemmer: inventory text is mostly nouns and it favours predictable results.
+func Stem(word string) string {
+	if utf8.RuneCountInString(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-2]
+	case hasAnySuffix(word, "xes", "ches", "shes", "zes"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !hasAnySuffix(word, "ss", "us", "is"):
+		word = word[:len(word)-1]
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		if stem := strings.TrimSuffix(word, suffix); stem != word && len(stem) >= 3 && containsVowel(stem) {
+			word = undouble(stem)
+			break
+		}
+	}
+	if len(word) > 3 {
+		switch word[len(word)-1] {
+		case 'y':
+			word = word[:len(word)-1] + "i"
+		case 'e':
+			word = word[:len(word)-1]
+		}
+	}
+	return word
+}
+
+// root is the part of a stem that every inflection of the word starts with.
+// It is used where stems can not be matched directly (ie: MySQL prefix searches).
+func root(term string) string {
+	if len(term) > 3 && strings.HasSuffix(term, "i") {
+		return term[:len(term)-1]
+	}
+	return term
+}
+
+func hasAnySuffix(word string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsVowel(word string) bool {
+	return strings.ContainsAny(word, "aeiouy")
+}
+
+func undouble(word string) string {
+	n := len(word)
+	if n >= 2 && word[n-1] == word[n-2] && strings.IndexByte("bdgmnprt", word[n-1]) >= 0 {
+		return word[:n-1]
+	}
+	return word
+}
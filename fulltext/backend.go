@@ -0,0 +1,232 @@
+package fulltext
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// SortRelevance is the sort field used to order results by how well they match the query.
+const SortRelevance = "relevance"
+
+// Backend is a search implementation.
+type Backend interface {
+	Search(req Request) (Results, error)
+}
+
+// Matcher is implemented by backends that can restrict SQL queries to the documents matching a query.
+// Callers use it to sort and page matches in the database rather than fetching every hit first.
+type Matcher interface {
+	// Match is a predicate over the columns of the source of a document type, it is also the score of a document.
+	Match(docType string, query Query) (Predicate, bool)
+}
+
+// Request describes a search of a single user's documents.
+type Request struct {
+	UserID int64
+	// Types restricts the search to these document types, all registered sources when empty
+	Types []string
+	Query Query
+	// Limit pages the hits, a zero limit returns every hit
+	Limit models.QueryLimit
+}
+
+// Hit is a single document matching a search.
+type Hit struct {
+	Type    string  `json:"type"`
+	ID      int64   `json:"id"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet,omitempty"`
+}
+
+// Results of a search ordered by descending score.
+type Results struct {
+	Hits []Hit
+	// Total is the number of matching documents before the limit was applied
+	Total int
+	// Counts is the number of matching documents of each type
+	Counts map[string]int
+}
+
+// IDs of the hits in the order they were found.
+func (r Results) IDs() []int64 {
+	ids := make([]int64, len(r.Hits))
+	for i, hit := range r.Hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// Source describes where the searchable text of a document type is stored.
+type Source struct {
+	// From is the table expression documents are selected from
+	From string
+	// ID is the column identifying a document
+	ID string
+	// User is the column of the user owning the document
+	User string
+	// Columns are the text columns that are searched, in order of importance
+	Columns []string
+	// Where optionally restricts the rows of From that are documents
+	Where string
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]Source)
+)
+
+// RegisterSource makes a document type searchable.
+// Modules register their sources from init so that backends can index them.
+func RegisterSource(docType string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[docType] = source
+}
+
+func sourceOf(docType string) (Source, bool) {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	source, ok := sources[docType]
+	return source, ok
+}
+
+// requestTypes resolves the document types a request covers.
+func requestTypes(req Request) []string {
+	if len(req.Types) > 0 {
+		return req.Types
+	}
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	types := make([]string, 0, len(sources))
+	for docType := range sources {
+		types = append(types, docType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// shared is the in process index used by the memory backend.
+var shared = NewMemoryIndex()
+
+// Open returns the backend configured with SEARCH_BACKEND.
+func Open(db *sql.DB) Backend {
+	if config.Config.SearchBackend == "memory" {
+		return &memoryBackend{index: shared, db: db}
+	}
+	return &MySQLBackend{DB: db}
+}
+
+func init() {
+	// Synchronously, so that a record is found by the searches following the request that changed it.
+	events.Subscribe("*", changed)
+}
+
+// changed keeps the indexes and the cached vocabulary of the owner of a document current as records are
+// created, modified or removed (see events.Committed).
+func changed(event events.Event) {
+	if _, ok := sourceOf(event.EntityType); !ok {
+		return
+	}
+	vocabularies.invalidate(event.EntityType, event.UserID)
+	if config.Config.SearchBackend != "memory" || !shared.isLoaded(event.EntityType) {
+		return
+	}
+	db, err := database.GetDBResource()
+	if err == nil {
+		defer db.Close()
+		err = reindex(db, event.EntityType, event.EntityID)
+	}
+	if err != nil {
+		log.Printf("fulltext: unable to index %v %v: %v", event.EntityType, event.EntityID, err)
+	}
+}
+
+// reindex replaces a document of the memory index with its record, removing it when the record no longer exists.
+func reindex(db *sql.DB, docType string, id int64) error {
+	source, _ := sourceOf(docType)
+	row := db.QueryRow(selectDocuments(source, source.ID+" = ?"), id)
+	var docID, userID int64
+	fields := make([]sql.NullString, len(source.Columns))
+	dest := []interface{}{&docID, &userID}
+	for i := range fields {
+		dest = append(dest, &fields[i])
+	}
+	err := row.Scan(dest...)
+	if err == sql.ErrNoRows {
+		shared.Remove(docType, id)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	shared.Add(docType, docID, userID, nullStrings(fields)...)
+	return nil
+}
+
+func selectDocuments(source Source, where string) string {
+	conditions := make([]string, 0, 2)
+	if source.Where != "" {
+		conditions = append(conditions, source.Where)
+	}
+	if where != "" {
+		conditions = append(conditions, where)
+	}
+	q := "select " + source.ID + ", " + source.User + ", " + strings.Join(source.Columns, ", ") + " from " + source.From
+	if len(conditions) > 0 {
+		q += " where " + strings.Join(conditions, " and ")
+	}
+	return q
+}
+
+func nullStrings(values []sql.NullString) []string {
+	out := make([]string, len(values))
+	for i, value := range values {
+		out[i] = value.String
+	}
+	return out
+}
+
+// Snippet highlights the first of the fields that matches the query.
+func Snippet(fields []string, query Query) string {
+	for _, field := range fields {
+		if s := Highlight(field, query); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// sortHits orders hits by descending score, newest documents first on ties.
+func sortHits(hits []Hit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].ID != hits[j].ID {
+			return hits[i].ID > hits[j].ID
+		}
+		return hits[i].Type < hits[j].Type
+	})
+}
+
+// page applies a query limit to a sorted list of hits.
+func page(hits []Hit, limit models.QueryLimit) []Hit {
+	if limit.Limit <= 0 {
+		return hits
+	}
+	if limit.Offset >= len(hits) {
+		return []Hit{}
+	}
+	end := limit.Offset + limit.Limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[limit.Offset:end]
+}
@@ -0,0 +1,198 @@
+package fulltext
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// Operator compares a field to the value of a filter.
+type Operator string
+
+const (
+	// OpMatch is written as field:value, it is an equality test for numbers and dates and contains for text.
+	OpMatch Operator = ":"
+	// OpLess is written as field<value or field:<value
+	OpLess Operator = "<"
+	// OpLessOrEqual is written as field<=value or field:<=value
+	OpLessOrEqual Operator = "<="
+	// OpGreater is written as field>value or field:>value
+	OpGreater Operator = ">"
+	// OpGreaterOrEqual is written as field>=value or field:>=value
+	OpGreaterOrEqual Operator = ">="
+)
+
+// Filter restricts results by the value of a field (ie: tag:tools, qty>2 or modified:<2024-01-01).
+type Filter struct {
+	Field    string
+	Operator Operator
+	Value    string
+	// Exclude negates the filter (ie: -tag:broken)
+	Exclude bool
+	// Position is the byte offset of the filter in the query
+	Position int
+	raw      string
+}
+
+// ParseError describes why a query could not be understood.
+type ParseError struct {
+	// Position is the byte offset of the offending term in the query
+	Position int    `json:"position"`
+	Term     string `json:"term"`
+	Message  string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at position %v (%v)", e.Message, e.Position, e.Term)
+}
+
+var filterPattern = regexp.MustCompile(`^(-?)([a-zA-Z_]+)(:<=|:>=|:<|:>|<=|>=|:|<|>|=)(.*)$`)
+
+// parseFilter recognizes a filter clause, clauses that are not filters are reported as not ok.
+func parseFilter(raw string, position int) (Filter, bool, error) {
+	matches := filterPattern.FindStringSubmatch(raw)
+	if matches == nil {
+		return Filter{}, false, nil
+	}
+	filter := Filter{
+		Field:    strings.ToLower(matches[2]),
+		Operator: Operator(strings.TrimPrefix(matches[3], ":")),
+		Exclude:  matches[1] == "-",
+		Position: position,
+		raw:      raw,
+	}
+	if filter.Operator == "" || filter.Operator == "=" {
+		filter.Operator = OpMatch
+	}
+	value := matches[4]
+	if strings.HasPrefix(value, `"`) {
+		value = strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`)
+	}
+	filter.Value = strings.TrimSpace(value)
+	if filter.Value == "" {
+		return filter, false, &ParseError{Position: position, Term: raw, Message: "missing value for " + filter.Field}
+	}
+	return filter, true, nil
+}
+
+// FieldKind determines how a field is compared.
+type FieldKind int
+
+const (
+	// TextField contains the value, case insensitive (only the : operator)
+	TextField FieldKind = iota
+	// NumberField compares whole numbers
+	NumberField
+	// DateField compares calendar days
+	DateField
+	// ListField is a comma separated list that must include the value (only the : operator)
+	ListField
+)
+
+// Field maps a filter name to an SQL expression.
+type Field struct {
+	Kind FieldKind
+	// Column is the SQL expression of the field, it must never contain user input
+	Column string
+}
+
+// Fields are the filters available for a type of record.
+type Fields map[string]Field
+
+// Predicate is a parameterised SQL condition.
+type Predicate struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Empty reports whether the predicate has no conditions.
+func (p Predicate) Empty() bool {
+	return p.SQL == ""
+}
+
+// And prefixes the predicate to be appended to an existing where clause.
+func (p Predicate) And() string {
+	if p.Empty() {
+		return ""
+	}
+	return "and " + p.SQL
+}
+
+// Compile converts the filters of a query into a predicate.
+// Unknown fields or values that do not suit a field result in a *ParseError.
+func (q Query) Compile(fields Fields) (Predicate, error) {
+	conditions := make([]string, 0, len(q.Filters))
+	predicate := Predicate{Args: make([]interface{}, 0)}
+	for _, filter := range q.Filters {
+		field, ok := fields[filter.Field]
+		if !ok {
+			return Predicate{}, filterError(filter, "unknown field "+filter.Field)
+		}
+		condition, args, err := compileFilter(filter, field)
+		if err != nil {
+			return Predicate{}, err
+		}
+		if filter.Exclude {
+			condition = "not " + condition
+		}
+		conditions = append(conditions, condition)
+		predicate.Args = append(predicate.Args, args...)
+	}
+	predicate.SQL = strings.Join(conditions, " and ")
+	return predicate, nil
+}
+
+func compileFilter(filter Filter, field Field) (string, []interface{}, error) {
+	switch field.Kind {
+	case TextField, ListField:
+		if filter.Operator != OpMatch {
+			return "", nil, filterError(filter, fmt.Sprintf("%v can not be compared with %v", filter.Field, filter.Operator))
+		}
+		if field.Kind == ListField {
+			return fmt.Sprintf("coalesce(find_in_set(?, %v) > 0, false)", field.Column), []interface{}{strings.ToLower(filter.Value)}, nil
+		}
+		return fmt.Sprintf("coalesce(%v like ?, false)", field.Column), []interface{}{"%" + escapeLike(filter.Value) + "%"}, nil
+	case NumberField:
+		value, err := strconv.Atoi(filter.Value)
+		if err != nil {
+			return "", nil, filterError(filter, filter.Field+" must be a whole number")
+		}
+		operator := string(filter.Operator)
+		if filter.Operator == OpMatch {
+			operator = "="
+		}
+		return fmt.Sprintf("coalesce(%v %v ?, false)", field.Column, operator), []interface{}{value}, nil
+	case DateField:
+		day, err := models.ParseDate(filter.Value)
+		if err != nil {
+			return "", nil, filterError(filter, filter.Field+" must be a date in the form of YYYY-MM-DD")
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+		next := day.AddDate(0, 0, 1)
+		switch filter.Operator {
+		case OpLess:
+			return fmt.Sprintf("coalesce(%v < ?, false)", field.Column), []interface{}{day}, nil
+		case OpLessOrEqual:
+			return fmt.Sprintf("coalesce(%v < ?, false)", field.Column), []interface{}{next}, nil
+		case OpGreater:
+			return fmt.Sprintf("coalesce(%v >= ?, false)", field.Column), []interface{}{next}, nil
+		case OpGreaterOrEqual:
+			return fmt.Sprintf("coalesce(%v >= ?, false)", field.Column), []interface{}{day}, nil
+		default:
+			return fmt.Sprintf("coalesce(%v >= ? and %v < ?, false)", field.Column, field.Column), []interface{}{day, next}, nil
+		}
+	}
+	return "", nil, filterError(filter, "unsupported field "+filter.Field)
+}
+
+func filterError(filter Filter, message string) *ParseError {
+	return &ParseError{Position: filter.Position, Term: filter.raw, Message: message}
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
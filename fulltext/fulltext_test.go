@@ -0,0 +1,266 @@
+package fulltext_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+func TestStem(t *testing.T) {
+	cases := map[string]string{
+		"drill":     "drill",
+		"drills":    "drill",
+		"drilling":  "drill",
+		"drilled":   "drill",
+		"boxes":     "box",
+		"batteries": "batteri",
+		"battery":   "batteri",
+		"cables":    "cabl",
+		"cable":     "cabl",
+		"glass":     "glass",
+		"bus":       "bus",
+		"shopping":  "shop",
+	}
+	for word, expected := range cases {
+		if stem := fulltext.Stem(word); stem != expected {
+			t.Errorf("Expected %v to stem to %v but got %v", word, expected, stem)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	query := fulltext.ParseQuery(`Cordless drills "phillips head" scr* -broken`)
+	if len(query.Clauses) != 5 {
+		t.Errorf("Expected 5 clauses but got %v", len(query.Clauses))
+		return
+	}
+	if query.Clauses[1].Terms[0] != "drill" {
+		t.Errorf("Expected words to be stemmed but got %v", query.Clauses[1].Terms)
+	}
+	if !query.Clauses[2].IsPhrase() || query.Clauses[2].Raw != "phillips head" {
+		t.Errorf("Expected a phrase clause but got %+v", query.Clauses[2])
+	}
+	if !query.Clauses[3].Prefix || query.Clauses[3].Terms[0] != "scr" {
+		t.Errorf("Expected a prefix clause but got %+v", query.Clauses[3])
+	}
+	if !query.Clauses[4].Exclude {
+		t.Errorf("Expected an excluded clause but got %+v", query.Clauses[4])
+	}
+	if fulltext.ParseQuery("-broken").Empty() != true {
+		t.Error("Expected a query of only exclusions to be empty.")
+	}
+	expected := `+cordless* +drill* +"phillips head" +scr* -broken*`
+	if boolean := fulltext.BooleanQuery(query); boolean != expected {
+		t.Errorf("Expected boolean query %v but got %v", expected, boolean)
+	}
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	index := fulltext.NewMemoryIndex()
+	index.Add("item", 1, 10, "Cordless drill with two batteries")
+	index.Add("item", 2, 10, "Drill bits, assorted")
+	index.Add("item", 3, 10, "Broken drill")
+	index.Add("item", 4, 10, "Phillips head screwdriver")
+	index.Add("item", 5, 10, "Flat head screws, box of 100")
+	index.Add("item", 6, 20, "Drill belonging to someone else")
+
+	search := func(input string) fulltext.Results {
+		results, _ := index.Search(fulltext.Request{UserID: 10, Types: []string{"item"}, Query: fulltext.ParseQuery(input)})
+		return results
+	}
+	assertIDs := func(input string, expected ...int64) {
+		ids := search(input).IDs()
+		if len(ids) != len(expected) {
+			t.Errorf("Expected %v to match %v but got %v", input, expected, ids)
+			return
+		}
+		for i := range ids {
+			if ids[i] != expected[i] {
+				t.Errorf("Expected %v to match %v but got %v", input, expected, ids)
+				return
+			}
+		}
+	}
+	assertIDs("drills", 3, 2, 1)
+	assertIDs("drill battery", 1)
+	assertIDs("drill -broken", 2, 1)
+	assertIDs(`"phillips head"`, 4)
+	assertIDs(`"head phillips"`)
+	assertIDs("scr*", 4, 5)
+	assertIDs("head screwdriver", 4)
+
+	results := search("batteries")
+	if results.Hits[0].Snippet != "Cordless drill with two <mark>batteries</mark>" {
+		t.Errorf("Unexpected snippet %v", results.Hits[0].Snippet)
+	}
+	if results.Counts["item"] != 1 || results.Total != 1 {
+		t.Errorf("Unexpected counts %v of %v", results.Counts, results.Total)
+	}
+
+	paged, _ := index.Search(fulltext.Request{
+		UserID: 10,
+		Types:  []string{"item"},
+		Query:  fulltext.ParseQuery("drill"),
+		Limit:  models.QueryLimit{Limit: 2, Offset: 2},
+	})
+	if paged.Total != 3 || len(paged.Hits) != 1 {
+		t.Errorf("Expected the last page of 3 hits but got %v of %v", len(paged.Hits), paged.Total)
+	}
+
+	index.Remove("item", 3)
+	assertIDs("drill", 2, 1)
+	index.Add("item", 2, 10, "Hammer")
+	assertIDs("drill", 1)
+}
+
+func TestMemoryIndexSearchTypes(t *testing.T) {
+	index := fulltext.NewMemoryIndex()
+	index.Add("item", 1, 10, "Hose", "garden", "")
+	index.Add("item", 2, 10, "Rake", "", "Lives in the garden shed")
+	index.Add("container", 1, 10, "Garden tools")
+	index.Add("location", 1, 10, "Shed", "12 Garden Lane")
+	index.Add("location", 2, 10, "Garage", "12 Garden Lane")
+
+	results, _ := index.Search(fulltext.Request{
+		UserID: 10,
+		Types:  []string{"item", "container", "location"},
+		Query:  fulltext.ParseQuery("garden"),
+	})
+	if results.Total != 5 || results.Counts["item"] != 2 || results.Counts["container"] != 1 || results.Counts["location"] != 2 {
+		t.Errorf("Unexpected counts %v of %v", results.Counts, results.Total)
+	}
+	// Phrases must not match across fields.
+	results, _ = index.Search(fulltext.Request{
+		UserID: 10,
+		Types:  []string{"location"},
+		Query:  fulltext.ParseQuery(`"shed 12"`),
+	})
+	if results.Total != 0 {
+		t.Errorf("Expected a phrase spanning fields not to match but got %v", results.IDs())
+	}
+	results, _ = index.Search(fulltext.Request{
+		UserID: 10,
+		Types:  []string{"item"},
+		Query:  fulltext.ParseQuery("shed"),
+	})
+	if results.Total != 1 || results.Hits[0].Snippet != "Lives in the garden <mark>shed</mark>" {
+		t.Errorf("Expected the notes of the rake to match but got %+v", results.Hits)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	query := fulltext.ParseQuery("box")
+	text := "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen sixteen <box> eighteen"
+	expected := "&hellip;thirteen fourteen fifteen sixteen &lt;<mark>box</mark>&gt; eighteen"
+	if snippet := fulltext.Highlight(text, query); snippet != expected {
+		t.Errorf("Expected %v but got %v", expected, snippet)
+	}
+	if snippet := fulltext.Highlight("nothing here", query); snippet != "" {
+		t.Errorf("Expected no snippet but got %v", snippet)
+	}
+}
+
+var testFields = fulltext.Fields{
+	"location": {Kind: fulltext.TextField, Column: "lo.name"},
+	"qty":      {Kind: fulltext.NumberField, Column: "ci.quantity"},
+	"tag":      {Kind: fulltext.ListField, Column: "ci.tags"},
+	"modified": {Kind: fulltext.DateField, Column: "ci.modified"},
+}
+
+func TestParseFilters(t *testing.T) {
+	query, err := fulltext.Parse(`drill location:"my garage" qty>2 tag:tools modified:<2024-01-01 -tag:broken`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(query.Clauses) != 1 || query.Clauses[0].Raw != "drill" {
+		t.Errorf("Expected a single text clause but got %+v", query.Clauses)
+	}
+	predicate, err := query.Compile(testFields)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expectedSQL := "coalesce(lo.name like ?, false) and coalesce(ci.quantity > ?, false) and " +
+		"coalesce(find_in_set(?, ci.tags) > 0, false) and coalesce(ci.modified < ?, false) and " +
+		"not coalesce(find_in_set(?, ci.tags) > 0, false)"
+	if predicate.SQL != expectedSQL {
+		t.Errorf("Expected %v but got %v", expectedSQL, predicate.SQL)
+	}
+	expectedArgs := []interface{}{"%my garage%", 2, "tools", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "broken"}
+	if !reflect.DeepEqual(predicate.Args, expectedArgs) {
+		t.Errorf("Expected %v but got %v", expectedArgs, predicate.Args)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]fulltext.ParseError{
+		`drill "cordless`:      {Position: 6, Term: `"cordless`, Message: "unterminated quote"},
+		"drill tag:":           {Position: 6, Term: "tag:", Message: "missing value for tag"},
+		"qty>two":              {Position: 0, Term: "qty>two", Message: "qty must be a whole number"},
+		"a colour:red":         {Position: 2, Term: "colour:red", Message: "unknown field colour"},
+		"location>garage":      {Position: 0, Term: "location>garage", Message: "location can not be compared with >"},
+		"x modified:yesterday": {Position: 2, Term: "modified:yesterday", Message: "modified must be a date in the form of YYYY-MM-DD"},
+	}
+	for input, expected := range cases {
+		query, err := fulltext.Parse(input)
+		if err == nil {
+			_, err = query.Compile(testFields)
+		}
+		parseErr, ok := err.(*fulltext.ParseError)
+		if !ok {
+			t.Errorf("Expected a parse error for %v but got %v", input, err)
+			continue
+		}
+		if *parseErr != expected {
+			t.Errorf("Expected %+v for %v but got %+v", expected, input, *parseErr)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := map[[2]string]int{
+		{"screwdirver", "screwdriver"}: 1,
+		{"drill", "drill"}:             0,
+		{"drill", "grill"}:             1,
+		{"hamer", "hammer"}:            1,
+		{"kitten", "sitting"}:          3,
+	}
+	for words, expected := range cases {
+		if distance := fulltext.EditDistance(words[0], words[1]); distance != expected {
+			t.Errorf("Expected the distance between %v and %v to be %v but got %v", words[0], words[1], expected, distance)
+		}
+	}
+}
+
+func TestVocabulary(t *testing.T) {
+	vocabulary := fulltext.NewVocabulary()
+	vocabulary.Add("Phillips head screwdriver")
+	vocabulary.Add("Flat head screwdriver")
+	vocabulary.Add("Screws")
+	vocabulary.Add("Scarf")
+
+	suggestion, ok := vocabulary.Suggest(fulltext.ParseQuery("screwdirver tag:hed"))
+	if !ok || suggestion != "screwdriver tag:hed" {
+		t.Errorf("Expected a corrected suggestion but got %q", suggestion)
+	}
+	if _, ok := vocabulary.Suggest(fulltext.ParseQuery("screws heads")); ok {
+		t.Error("Expected no suggestion when every word is known.")
+	}
+	completions := vocabulary.Complete("scr", 5)
+	if !reflect.DeepEqual(completions, []string{"screwdriver", "screws"}) {
+		t.Errorf("Unexpected completions %v", completions)
+	}
+
+	index := fulltext.NewMemoryIndex()
+	index.Add("item", 1, 10, "Phillips head screwdriver")
+	index.Add("item", 2, 10, "Screws")
+	query := vocabulary.Fuzzy(fulltext.ParseQuery("screwdirver"))
+	results, _ := index.Search(fulltext.Request{UserID: 10, Types: []string{"item"}, Query: query})
+	if results.Total != 1 || results.Hits[0].Snippet != "Phillips head <mark>screwdriver</mark>" {
+		t.Errorf("Expected the misspelling to match the screwdriver but got %+v", results.Hits)
+	}
+}
@@ -0,0 +1,353 @@
+package fulltext
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxAlternatives is the number of similarly spelled words a misspelled word may match.
+	maxAlternatives = 5
+	// minFuzzyLength is the shortest word that is corrected, shorter words are too ambiguous.
+	minFuzzyLength = 4
+)
+
+// Vocabulary is the set of words used in a user's records along with how often each is used.
+// It is used to tolerate typos and suggest corrections.
+type Vocabulary struct {
+	words map[string]int
+	terms map[string]bool
+}
+
+// NewVocabulary creates an empty vocabulary.
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{
+		words: make(map[string]int),
+		terms: make(map[string]bool),
+	}
+}
+
+// LoadVocabulary builds the vocabulary of a user from the records of the given document types (all registered sources when none are given).
+// Vocabularies are cached until a record of the user changes (see changed) or for at most vocabularyTTL.
+// The returned vocabulary is shared and must not be modified.
+func LoadVocabulary(db *sql.DB, userID int64, types ...string) (*Vocabulary, error) {
+	types = requestTypes(Request{Types: types})
+	key := vocabularyKey{user: userID, types: strings.Join(types, ",")}
+	vocabulary, generation := vocabularies.get(key)
+	if vocabulary != nil {
+		return vocabulary, nil
+	}
+	vocabulary, err := readVocabulary(db, userID, types)
+	if err != nil {
+		return vocabulary, err
+	}
+	vocabularies.put(key, vocabulary, generation)
+	return vocabulary, nil
+}
+
+// readVocabulary builds the vocabulary of a user from the records of document types.
+func readVocabulary(db *sql.DB, userID int64, types []string) (*Vocabulary, error) {
+	vocabulary := NewVocabulary()
+	for _, docType := range types {
+		source, ok := sourceOf(docType)
+		if !ok {
+			continue
+		}
+		rows, err := db.Query(selectDocuments(source, source.User+" = ?"), userID)
+		if err != nil {
+			return vocabulary, err
+		}
+		for rows.Next() {
+			var id, owner int64
+			fields := make([]sql.NullString, len(source.Columns))
+			dest := []interface{}{&id, &owner}
+			for i := range fields {
+				dest = append(dest, &fields[i])
+			}
+			if err = rows.Scan(dest...); err != nil {
+				rows.Close()
+				return vocabulary, err
+			}
+			for _, field := range fields {
+				vocabulary.Add(field.String)
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return vocabulary, err
+		}
+	}
+	return vocabulary, nil
+}
+
+const (
+	// vocabularyTTL bounds how long a vocabulary is cached, changes made by other processes are not seen before.
+	vocabularyTTL = 10 * time.Minute
+	// maxVocabularies is the number of vocabularies cached at once.
+	maxVocabularies = 1000
+)
+
+// vocabularies caches the vocabularies loaded by LoadVocabulary.
+var vocabularies = &vocabularyCache{entries: make(map[vocabularyKey]cachedVocabulary)}
+
+type vocabularyKey struct {
+	user  int64
+	types string
+}
+
+type cachedVocabulary struct {
+	vocabulary *Vocabulary
+	expires    time.Time
+}
+
+// vocabularyCache holds vocabularies until the records of their user change.
+// Its generation is incremented by every invalidation so that vocabularies read meanwhile are not cached.
+type vocabularyCache struct {
+	mu         sync.Mutex
+	entries    map[vocabularyKey]cachedVocabulary
+	generation int64
+}
+
+// get returns a cached vocabulary, or nil along with the generation to cache it with once read.
+func (c *vocabularyCache) get(key vocabularyKey) (*Vocabulary, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation
+	}
+	return entry.vocabulary, c.generation
+}
+
+func (c *vocabularyCache) put(key vocabularyKey, vocabulary *Vocabulary, generation int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if len(c.entries) >= maxVocabularies {
+		for evicted := range c.entries {
+			delete(c.entries, evicted)
+			break
+		}
+	}
+	c.entries[key] = cachedVocabulary{vocabulary: vocabulary, expires: time.Now().Add(vocabularyTTL)}
+}
+
+// invalidate drops the vocabularies including a document type, of a single user or of every user when userID is 0.
+func (c *vocabularyCache) invalidate(docType string, userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for key := range c.entries {
+		if userID != 0 && key.user != userID {
+			continue
+		}
+		for _, cached := range strings.Split(key.types, ",") {
+			if cached == docType {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// Add counts the words of a text.
+func (v *Vocabulary) Add(text string) {
+	for _, token := range Tokenize(text) {
+		v.words[token.Word]++
+		v.terms[token.Term] = true
+	}
+}
+
+// Known reports whether a word, or another inflection of it, is in the vocabulary.
+func (v *Vocabulary) Known(word string) bool {
+	return v.terms[Stem(strings.ToLower(word))]
+}
+
+// similar lists the vocabulary words within the typo tolerance of a word, closest and most used first.
+func (v *Vocabulary) similar(word string) []string {
+	length := utf8.RuneCountInString(word)
+	if length < minFuzzyLength {
+		return nil
+	}
+	maxDistance := 1
+	if length > 7 {
+		maxDistance = 2
+	}
+	type candidate struct {
+		word     string
+		distance int
+		count    int
+	}
+	candidates := make([]candidate, 0)
+	for known, count := range v.words {
+		if abs(utf8.RuneCountInString(known)-length) > maxDistance {
+			continue
+		}
+		if distance := EditDistance(word, known); distance <= maxDistance {
+			candidates = append(candidates, candidate{known, distance, count})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		if candidates[i].count != candidates[j].count {
+			return candidates[i].count > candidates[j].count
+		}
+		return candidates[i].word < candidates[j].word
+	})
+	words := make([]string, len(candidates))
+	for i, c := range candidates {
+		words[i] = c.word
+	}
+	return words
+}
+
+// Correct finds the most likely intended word for a word that is not in the vocabulary.
+func (v *Vocabulary) Correct(word string) (string, bool) {
+	word = strings.ToLower(word)
+	if v.Known(word) {
+		return word, false
+	}
+	if similar := v.similar(word); len(similar) > 0 {
+		return similar[0], true
+	}
+	return word, false
+}
+
+// Fuzzy allows the unknown words of a query to also match similarly spelled words of the vocabulary.
+// Phrases, prefixes and exclusions are left as typed.
+func (v *Vocabulary) Fuzzy(query Query) Query {
+	clauses := make([]Clause, len(query.Clauses))
+	for i, clause := range query.Clauses {
+		clauses[i] = clause
+		if clause.Exclude || clause.Prefix || clause.IsPhrase() || v.terms[clause.Terms[0]] {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, word := range v.similar(Tokenize(clause.Raw)[0].Word) {
+			term := Stem(word)
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			clauses[i].Alternatives = append(clauses[i].Alternatives, term)
+			if len(clauses[i].Alternatives) == maxAlternatives {
+				break
+			}
+		}
+	}
+	query.Clauses = clauses
+	return query
+}
+
+// Suggest rewrites the input of a query with its unknown words corrected ("did you mean").
+// Filters are kept as typed. Nothing is suggested when every word is known or no correction is found.
+func (v *Vocabulary) Suggest(query Query) (string, bool) {
+	input := query.Input
+	var suggestion strings.Builder
+	position := 0
+	corrected := false
+	for _, token := range Tokenize(input) {
+		// Skip filter names and values (ie: tag:tools) and prefixes (ie: scr*)
+		if isFilterToken(input, token) || strings.HasPrefix(input[token.End:], "*") {
+			continue
+		}
+		correction, ok := v.Correct(token.Word)
+		if !ok {
+			continue
+		}
+		suggestion.WriteString(input[position:token.Start])
+		suggestion.WriteString(correction)
+		position = token.End
+		corrected = true
+	}
+	if !corrected {
+		return "", false
+	}
+	suggestion.WriteString(input[position:])
+	return suggestion.String(), true
+}
+
+// Complete lists the vocabulary words starting with a prefix, most used first.
+func (v *Vocabulary) Complete(prefix string, limit int) []string {
+	prefix = strings.ToLower(prefix)
+	words := make([]string, 0)
+	for word := range v.words {
+		if strings.HasPrefix(word, prefix) && word != prefix {
+			words = append(words, word)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if v.words[words[i]] != v.words[words[j]] {
+			return v.words[words[i]] > v.words[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if limit > 0 && len(words) > limit {
+		words = words[:limit]
+	}
+	return words
+}
+
+// isFilterToken reports whether a word is part of a filter clause of the input.
+func isFilterToken(input string, token Token) bool {
+	start := strings.LastIndexAny(input[:token.Start], " \t\r\n") + 1
+	end := strings.IndexAny(input[token.End:], " \t\r\n")
+	if end < 0 {
+		end = len(input)
+	} else {
+		end += token.End
+	}
+	return filterPattern.MatchString(input[start:end])
+}
+
+// EditDistance is the number of single letter insertions, deletions, substitutions
+// or transpositions of adjacent letters needed to turn one word into another.
+func EditDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	rows := make([][]int, len(s)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(t)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			rows[i][j] = minimum(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				rows[i][j] = minimum(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(s)][len(t)]
+}
+
+func minimum(values ...int) int {
+	lowest := values[0]
+	for _, value := range values[1:] {
+		if value < lowest {
+			lowest = value
+		}
+	}
+	return lowest
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package fulltext
+
+import (
+	"html"
+	"strings"
+)
+
+const (
+	// HighlightStart is placed before each matched word in a snippet.
+	HighlightStart = "<mark>"
+	// HighlightEnd is placed after each matched word in a snippet.
+	HighlightEnd = "</mark>"
+	// snippetWords is the number of words of context kept around matches.
+	snippetWords = 16
+)
+
+// Highlight produces an HTML escaped snippet of text around the words matching the query,
+// with each match wrapped in HighlightStart/HighlightEnd.
+// An empty string is returned when nothing in the text matches.
+func Highlight(text string, query Query) string {
+	tokens := Tokenize(text)
+	matched := make([]bool, len(tokens))
+	any := false
+	for i, token := range tokens {
+		matched[i] = query.Matches(token)
+		any = any || matched[i]
+	}
+	if !any {
+		return ""
+	}
+	// Choose the window of words holding the most matches.
+	best, bestCount := 0, -1
+	for start := 0; start < len(tokens); start++ {
+		count := 0
+		for i := start; i < len(tokens) && i < start+snippetWords; i++ {
+			if matched[i] {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = start, count
+		}
+		if start+snippetWords >= len(tokens) {
+			break
+		}
+	}
+	// Keep a little context before the first match of the window.
+	for i := best; i < len(tokens); i++ {
+		if matched[i] {
+			if i-snippetWords/4 > best {
+				best = i - snippetWords/4
+			}
+			break
+		}
+	}
+	last := best + snippetWords - 1
+	if last >= len(tokens) {
+		last = len(tokens) - 1
+	}
+	from, to := tokens[best].Start, tokens[last].End
+	if best == 0 {
+		from = 0
+	}
+	if last == len(tokens)-1 {
+		to = len(text)
+	}
+	var snippet strings.Builder
+	if from > 0 {
+		snippet.WriteString("&hellip;")
+	}
+	position := from
+	for i := best; i <= last; i++ {
+		if !matched[i] {
+			continue
+		}
+		snippet.WriteString(html.EscapeString(text[position:tokens[i].Start]))
+		snippet.WriteString(HighlightStart)
+		snippet.WriteString(html.EscapeString(text[tokens[i].Start:tokens[i].End]))
+		snippet.WriteString(HighlightEnd)
+		position = tokens[i].End
+	}
+	snippet.WriteString(html.EscapeString(text[position:to]))
+	if to < len(text) {
+		snippet.WriteString("&hellip;")
+	}
+	return snippet.String()
+}
@@ -0,0 +1,337 @@
+package fulltext
+
+import (
+	"database/sql"
+	"math"
+	"strings"
+	"sync"
+)
+
+const (
+	// fieldGap separates the positions of fields of a document so phrases never span two fields.
+	fieldGap = 100
+	bm25K1   = 1.2
+	bm25B    = 0.75
+	// fuzzyWeight discounts matches of alternative spellings
+	fuzzyWeight = 0.5
+)
+
+type docKey struct {
+	Type string
+	ID   int64
+}
+
+type document struct {
+	User   int64
+	Fields []string
+	Length int
+}
+
+// MemoryIndex is an in process inverted index ranking documents with BM25.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[docKey]*document
+	postings map[string]map[docKey][]int
+	// words maps every word seen to its term so prefixes can be expanded
+	words  map[string]string
+	loaded map[string]bool
+}
+
+// NewMemoryIndex creates an empty index.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     make(map[docKey]*document),
+		postings: make(map[string]map[docKey][]int),
+		words:    make(map[string]string),
+		loaded:   make(map[string]bool),
+	}
+}
+
+// Add indexes a document, replacing any previous version of it.
+func (m *MemoryIndex) Add(docType string, id int64, userID int64, fields ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := docKey{docType, id}
+	m.remove(key)
+	doc := &document{User: userID, Fields: fields}
+	position := 0
+	for _, field := range fields {
+		for _, token := range Tokenize(field) {
+			posting, ok := m.postings[token.Term]
+			if !ok {
+				posting = make(map[docKey][]int)
+				m.postings[token.Term] = posting
+			}
+			posting[key] = append(posting[key], position)
+			m.words[token.Word] = token.Term
+			position++
+			doc.Length++
+		}
+		position += fieldGap
+	}
+	m.docs[key] = doc
+}
+
+// Remove drops a document from the index.
+func (m *MemoryIndex) Remove(docType string, id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(docKey{docType, id})
+}
+
+func (m *MemoryIndex) remove(key docKey) {
+	doc, ok := m.docs[key]
+	if !ok {
+		return
+	}
+	for _, field := range doc.Fields {
+		for _, token := range Tokenize(field) {
+			if posting, ok := m.postings[token.Term]; ok {
+				delete(posting, key)
+				if len(posting) == 0 {
+					delete(m.postings, token.Term)
+				}
+			}
+		}
+	}
+	delete(m.docs, key)
+}
+
+// Search ranks the documents of a user against a query.
+func (m *MemoryIndex) Search(req Request) (Results, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	results := Results{Hits: []Hit{}, Counts: make(map[string]int)}
+	types := requestTypes(req)
+	for _, docType := range types {
+		results.Counts[docType] = 0
+	}
+	if req.Query.Empty() {
+		return results, nil
+	}
+	var candidates map[docKey]float64
+	for _, docType := range types {
+		stats := m.statsOf(docType)
+		var typeCandidates map[docKey]float64
+		for _, clause := range req.Query.Clauses {
+			if clause.Exclude {
+				continue
+			}
+			scores := m.scoreClause(clause, docType, req.UserID, stats)
+			if typeCandidates == nil {
+				typeCandidates = scores
+				continue
+			}
+			for key, score := range typeCandidates {
+				if extra, ok := scores[key]; ok {
+					typeCandidates[key] = score + extra
+				} else {
+					delete(typeCandidates, key)
+				}
+			}
+		}
+		for _, clause := range req.Query.Clauses {
+			if !clause.Exclude {
+				continue
+			}
+			for key := range m.scoreClause(clause, docType, req.UserID, stats) {
+				delete(typeCandidates, key)
+			}
+		}
+		if candidates == nil {
+			candidates = make(map[docKey]float64)
+		}
+		for key, score := range typeCandidates {
+			candidates[key] = score
+		}
+	}
+	for key, score := range candidates {
+		results.Hits = append(results.Hits, Hit{Type: key.Type, ID: key.ID, Score: score})
+		results.Counts[key.Type]++
+	}
+	results.Total = len(results.Hits)
+	sortHits(results.Hits)
+	results.Hits = page(results.Hits, req.Limit)
+	for i, hit := range results.Hits {
+		results.Hits[i].Snippet = Snippet(m.docs[docKey{hit.Type, hit.ID}].Fields, req.Query)
+	}
+	return results, nil
+}
+
+type typeStats struct {
+	Count         int
+	AverageLength float64
+}
+
+func (m *MemoryIndex) statsOf(docType string) typeStats {
+	stats := typeStats{}
+	total := 0
+	for key, doc := range m.docs {
+		if key.Type == docType {
+			stats.Count++
+			total += doc.Length
+		}
+	}
+	if stats.Count > 0 {
+		stats.AverageLength = float64(total) / float64(stats.Count)
+	}
+	return stats
+}
+
+// scoreClause finds the documents of a user matching a clause along with their BM25 score.
+func (m *MemoryIndex) scoreClause(clause Clause, docType string, userID int64, stats typeStats) map[docKey]float64 {
+	scores := make(map[docKey]float64)
+	if clause.IsPhrase() {
+		for key, count := range m.phraseMatches(clause.Terms, docType, userID) {
+			idf := 0.0
+			for _, term := range clause.Terms {
+				idf += m.idf(term, docType, stats)
+			}
+			scores[key] = bm25(idf, count, m.docs[key].Length, stats)
+		}
+		return scores
+	}
+	terms := clause.Terms
+	if clause.Prefix {
+		terms = m.expandPrefix(clause.Terms[0])
+	}
+	m.scoreTerms(scores, terms, 1, docType, userID, stats)
+	m.scoreTerms(scores, clause.Alternatives, fuzzyWeight, docType, userID, stats)
+	return scores
+}
+
+func (m *MemoryIndex) scoreTerms(scores map[docKey]float64, terms []string, weight float64, docType string, userID int64, stats typeStats) {
+	for _, term := range terms {
+		idf := m.idf(term, docType, stats)
+		for key, positions := range m.postings[term] {
+			if key.Type != docType || m.docs[key].User != userID {
+				continue
+			}
+			scores[key] += weight * bm25(idf, len(positions), m.docs[key].Length, stats)
+		}
+	}
+}
+
+// phraseMatches counts the occurrences of consecutive terms in each document.
+func (m *MemoryIndex) phraseMatches(terms []string, docType string, userID int64) map[docKey]int {
+	matches := make(map[docKey]int)
+	for key, positions := range m.postings[terms[0]] {
+		if key.Type != docType || m.docs[key].User != userID {
+			continue
+		}
+		count := 0
+		for _, start := range positions {
+			if m.followedBy(key, start, terms[1:]) {
+				count++
+			}
+		}
+		if count > 0 {
+			matches[key] = count
+		}
+	}
+	return matches
+}
+
+func (m *MemoryIndex) followedBy(key docKey, position int, terms []string) bool {
+	for offset, term := range terms {
+		found := false
+		for _, p := range m.postings[term][key] {
+			if p == position+offset+1 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// expandPrefix lists the terms of every indexed word starting with prefix.
+func (m *MemoryIndex) expandPrefix(prefix string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for word, term := range m.words {
+		if strings.HasPrefix(word, prefix) && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (m *MemoryIndex) idf(term string, docType string, stats typeStats) float64 {
+	frequency := 0
+	for key := range m.postings[term] {
+		if key.Type == docType {
+			frequency++
+		}
+	}
+	return math.Log(1 + (float64(stats.Count)-float64(frequency)+0.5)/(float64(frequency)+0.5))
+}
+
+func bm25(idf float64, frequency int, length int, stats typeStats) float64 {
+	tf := float64(frequency)
+	norm := 1 - bm25B
+	if stats.AverageLength > 0 {
+		norm += bm25B * float64(length) / stats.AverageLength
+	}
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+func (m *MemoryIndex) isLoaded(docType string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.loaded[docType]
+}
+
+// Load indexes every document of a registered source.
+func (m *MemoryIndex) Load(db *sql.DB, docType string) error {
+	source, ok := sourceOf(docType)
+	if !ok {
+		return nil
+	}
+	rows, err := db.Query(selectDocuments(source, ""))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, userID int64
+		fields := make([]sql.NullString, len(source.Columns))
+		dest := []interface{}{&id, &userID}
+		for i := range fields {
+			dest = append(dest, &fields[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		m.Add(docType, id, userID, nullStrings(fields)...)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.loaded[docType] = true
+	m.mu.Unlock()
+	return nil
+}
+
+// memoryBackend loads document types into a memory index the first time they are searched.
+type memoryBackend struct {
+	index *MemoryIndex
+	db    *sql.DB
+}
+
+func (b *memoryBackend) Search(req Request) (Results, error) {
+	for _, docType := range requestTypes(req) {
+		if b.index.isLoaded(docType) {
+			continue
+		}
+		if err := b.index.Load(b.db, docType); err != nil {
+			return Results{}, err
+		}
+	}
+	return b.index.Search(req)
+}
@@ -0,0 +1,126 @@
+package fulltext
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// MySQLBackend searches with InnoDB FULLTEXT indexes.
+// Each registered source must have a FULLTEXT key covering exactly its columns.
+type MySQLBackend struct {
+	DB *sql.DB
+}
+
+// Search runs a boolean mode full-text search for every requested document type and merges the ranked results.
+func (b *MySQLBackend) Search(req Request) (Results, error) {
+	results := Results{Hits: []Hit{}, Counts: make(map[string]int)}
+	types := requestTypes(req)
+	for _, docType := range types {
+		results.Counts[docType] = 0
+	}
+	if req.Query.Empty() {
+		return results, nil
+	}
+	against := BooleanQuery(req.Query)
+	fields := make(map[docKey][]string)
+	for _, docType := range types {
+		source, ok := sourceOf(docType)
+		if !ok {
+			continue
+		}
+		match := fmt.Sprintf("match(%v) against(? in boolean mode)", strings.Join(source.Columns, ", "))
+		where := fmt.Sprintf("%v = ? and %v", source.User, match)
+		if source.Where != "" {
+			where = source.Where + " and " + where
+		}
+		var count int
+		err := b.DB.QueryRow(fmt.Sprintf("select count(*) from %v where %v", source.From, where), req.UserID, against).Scan(&count)
+		if err != nil {
+			return results, err
+		}
+		results.Counts[docType] = count
+		results.Total += count
+		// The score is the last selected column.
+		q := fmt.Sprintf(
+			"select %v, %v, %v from %v where %v order by %v desc, 1 desc",
+			source.ID, strings.Join(source.Columns, ", "), match, source.From, where, len(source.Columns)+2,
+		)
+		// Every type may contribute the whole page so fetch up to the end of it from each.
+		if req.Limit.Limit > 0 {
+			q += fmt.Sprintf(" limit %v", req.Limit.Offset+req.Limit.Limit)
+		}
+		rows, err := b.DB.Query(q, against, req.UserID, against)
+		if err != nil {
+			return results, err
+		}
+		for rows.Next() {
+			hit := Hit{Type: docType}
+			values := make([]sql.NullString, len(source.Columns))
+			dest := []interface{}{&hit.ID}
+			for i := range values {
+				dest = append(dest, &values[i])
+			}
+			dest = append(dest, &hit.Score)
+			if err = rows.Scan(dest...); err != nil {
+				rows.Close()
+				return results, err
+			}
+			fields[docKey{docType, hit.ID}] = nullStrings(values)
+			results.Hits = append(results.Hits, hit)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return results, err
+		}
+	}
+	sortHits(results.Hits)
+	results.Hits = page(results.Hits, req.Limit)
+	for i, hit := range results.Hits {
+		results.Hits[i].Snippet = Snippet(fields[docKey{hit.Type, hit.ID}], req.Query)
+	}
+	return results, nil
+}
+
+// Match restricts a query of the source of a document type to the rows matching a full-text query.
+func (b *MySQLBackend) Match(docType string, query Query) (Predicate, bool) {
+	source, ok := sourceOf(docType)
+	if !ok || query.Empty() {
+		return Predicate{}, false
+	}
+	return Predicate{
+		SQL:  fmt.Sprintf("match(%v) against(? in boolean mode)", strings.Join(source.Columns, ", ")),
+		Args: []interface{}{BooleanQuery(query)},
+	}, true
+}
+
+// BooleanQuery converts a parsed query to MySQL boolean mode syntax.
+// Terms are matched by the prefix shared by their inflections since MySQL does not stem.
+func BooleanQuery(query Query) string {
+	parts := make([]string, 0, len(query.Clauses))
+	for _, clause := range query.Clauses {
+		operator := "+"
+		if clause.Exclude {
+			operator = "-"
+		}
+		switch {
+		case clause.IsPhrase():
+			words := make([]string, 0, len(clause.Terms))
+			for _, token := range Tokenize(clause.Raw) {
+				words = append(words, token.Word)
+			}
+			parts = append(parts, operator+`"`+strings.Join(words, " ")+`"`)
+		case clause.Prefix:
+			parts = append(parts, operator+clause.Terms[0]+"*")
+		case len(clause.Alternatives) > 0:
+			words := []string{root(clause.Terms[0]) + "*"}
+			for _, term := range clause.Alternatives {
+				words = append(words, root(term)+"*")
+			}
+			parts = append(parts, operator+"("+strings.Join(words, " ")+")")
+		default:
+			parts = append(parts, operator+root(clause.Terms[0])+"*")
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,196 @@
+package fulltext
+
+import (
+	"strings"
+)
+
+// Clause is a single condition of a search query.
+type Clause struct {
+	// Raw is the clause as it was typed
+	Raw string
+	// Terms are the analysed terms of the clause, more than one term is a phrase
+	Terms []string
+	// Prefix matches any word starting with the (unstemmed) text of the clause
+	Prefix bool
+	// Exclude removes documents matching the clause
+	Exclude bool
+	// Alternatives are terms of similarly spelled words that also satisfy the clause (see Vocabulary.Fuzzy)
+	Alternatives []string
+}
+
+// IsPhrase reports whether the terms of the clause must appear next to each other.
+func (c Clause) IsPhrase() bool {
+	return len(c.Terms) > 1
+}
+
+// Query is a parsed search.
+// Plain words must all be present, "quoted text" must appear as a phrase,
+// a trailing * matches words by prefix and a leading - excludes matches.
+// Filters (ie: tag:tools or qty>2) are only recognized by Parse.
+type Query struct {
+	// Input is the query as it was typed
+	Input   string
+	Clauses []Clause
+	Filters []Filter
+}
+
+// ParseQuery parses user search input into a query of plain text.
+// It never fails: anything that is not understood is searched for as text.
+func ParseQuery(input string) Query {
+	query, _ := parse(input, false)
+	return query
+}
+
+// Parse parses user search input that may contain field filters.
+// The error is a *ParseError describing the first problem found.
+func Parse(input string) (Query, error) {
+	return parse(input, true)
+}
+
+func parse(input string, withFilters bool) (Query, error) {
+	query := Query{Input: input}
+	clauses, unterminated := splitClauses(input)
+	if unterminated >= 0 && withFilters {
+		return query, &ParseError{Position: unterminated, Term: input[unterminated:], Message: "unterminated quote"}
+	}
+	for _, raw := range clauses {
+		if withFilters {
+			filter, ok, err := parseFilter(raw.Text, raw.Position)
+			if err != nil {
+				return query, err
+			}
+			if ok {
+				query.Filters = append(query.Filters, filter)
+				continue
+			}
+		}
+		if clause, ok := parseClause(raw.Text); ok {
+			query.Clauses = append(query.Clauses, clause)
+		}
+	}
+	return query, nil
+}
+
+func parseClause(raw string) (Clause, bool) {
+	clause := Clause{}
+	if strings.HasPrefix(raw, "-") && len(raw) > 1 {
+		clause.Exclude = true
+		raw = raw[1:]
+	}
+	phrase := strings.HasPrefix(raw, `"`)
+	text := strings.Trim(raw, `"`)
+	if !phrase && strings.HasSuffix(text, "*") {
+		clause.Prefix = true
+		text = strings.TrimRight(text, "*")
+	}
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return clause, false
+	}
+	if clause.Prefix {
+		// A prefix is matched against words as typed, so it is not stemmed.
+		clause.Raw = tokens[0].Word
+		clause.Terms = []string{tokens[0].Word}
+		if len(tokens) > 1 {
+			clause.Prefix = false
+			clause.Terms = termsOf(tokens)
+			clause.Raw = text
+		}
+	} else {
+		clause.Raw = text
+		clause.Terms = termsOf(tokens)
+	}
+	return clause, true
+}
+
+// Empty reports whether the query has nothing to positively match.
+func (q Query) Empty() bool {
+	for _, clause := range q.Clauses {
+		if !clause.Exclude {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether a word (as produced by Tokenize) satisfies any positive clause.
+// It is used to decide which words to highlight.
+func (q Query) Matches(token Token) bool {
+	for _, clause := range q.Clauses {
+		if clause.Exclude {
+			continue
+		}
+		if clause.Prefix {
+			if strings.HasPrefix(token.Word, clause.Terms[0]) {
+				return true
+			}
+			continue
+		}
+		for _, term := range clause.Terms {
+			if term == token.Term {
+				return true
+			}
+		}
+		for _, term := range clause.Alternatives {
+			if term == token.Term {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func termsOf(tokens []Token) []string {
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token.Term
+	}
+	return terms
+}
+
+type rawClause struct {
+	Text     string
+	Position int
+}
+
+// splitClauses breaks input on whitespace while keeping quoted text together.
+// An unterminated quote runs to the end of the input and its position is returned (-1 when all quotes are closed).
+func splitClauses(input string) ([]rawClause, int) {
+	clauses := make([]rawClause, 0)
+	var current strings.Builder
+	start, quote := -1, -1
+	flush := func() {
+		if current.Len() > 0 {
+			clauses = append(clauses, rawClause{Text: current.String(), Position: start})
+			current.Reset()
+		}
+		start = -1
+	}
+	for i, r := range input {
+		switch {
+		case r == '"':
+			if start < 0 {
+				start = i
+			}
+			current.WriteRune(r)
+			if quote >= 0 {
+				quote = -1
+				// A closing quote ends a phrase but a quoted filter value (ie: location:"my garage") ends at whitespace.
+				if strings.HasPrefix(current.String(), `"`) || strings.HasPrefix(current.String(), `-"`) {
+					flush()
+				}
+			} else {
+				quote = i
+			}
+		case quote < 0 && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			flush()
+		default:
+			if start < 0 {
+				start = i
+			}
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return clauses, quote
+}
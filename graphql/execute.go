@@ -0,0 +1,497 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type executor struct {
+	ctx       context.Context
+	schema    Schema
+	fragments map[string]*Fragment
+	// variables are the values of the variables of the operation, coerced to their type
+	variables map[string]interface{}
+	errors    []*Error
+}
+
+// result is an object of the response, its fields are written in the order they were selected.
+type result struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newResult() *result {
+	return &result{values: make(map[string]interface{})}
+}
+
+func (r *result) set(key string, value interface{}) {
+	if _, ok := r.values[key]; !ok {
+		r.keys = append(r.keys, key)
+	}
+	r.values[key] = value
+}
+
+func (r *result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(r.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// task is the selection of the fields of an object of the response.
+type task struct {
+	source     interface{}
+	object     *Object
+	selections []Selection
+	result     *result
+	path       []interface{}
+}
+
+// fieldGroup are the selections of a field under a response key, merged.
+type fieldGroup struct {
+	key        string
+	selections []*FieldSelection
+}
+
+// call is the resolution of a field of an object of the response.
+type call struct {
+	task  *task
+	group fieldGroup
+	field *Field
+	value interface{}
+	err   error
+}
+
+// execute resolves the fields of the operation level by level: every field of a level is resolved, then the thunks
+// returned by resolvers are computed, then the objects they resolved to are selected from at the next level.
+func (e *executor) execute(operation *Operation) (*result, error) {
+	data := newResult()
+	level := []*task{{object: e.schema.Query, selections: operation.SelectionSet, result: data}}
+	for len(level) > 0 {
+		// The request may be over, ie: the client went away or its deadline passed
+		if err := e.ctx.Err(); err != nil {
+			return nil, err
+		}
+		var calls []*call
+		for _, t := range level {
+			groups, err := e.collect(t.object, t.selections)
+			if err != nil {
+				return nil, err
+			}
+			for _, group := range groups {
+				if group.selections[0].Name == "__typename" {
+					t.result.set(group.key, t.object.Name)
+					continue
+				}
+				c := &call{task: t, group: group, field: e.schema.field(t.object, group.selections[0].Name)}
+				t.result.set(group.key, nil)
+				c.value, c.err = e.resolve(t, c)
+				calls = append(calls, c)
+			}
+		}
+		for _, c := range calls {
+			if thunk, ok := c.value.(Thunk); ok && c.err == nil {
+				c.value, c.err = thunk()
+			}
+		}
+		level = nil
+		for _, c := range calls {
+			path := append(append([]interface{}{}, c.task.path...), c.group.key)
+			if c.err != nil {
+				e.fail(c.err, c.group.selections[0].Location, path)
+				continue
+			}
+			value, next := e.complete(c, path)
+			c.task.result.set(c.group.key, value)
+			level = append(level, next...)
+		}
+	}
+	return data, nil
+}
+
+// nodes estimates the objects selected from an object resolve to: every object field resolves to its Cost of
+// objects, each selecting its subfields. The estimate stops growing once it is over Schema.MaxNodes.
+func (e *executor) nodes(object *Object, selections []Selection) (int, error) {
+	groups, err := e.collect(object, selections)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, group := range groups {
+		field := e.schema.field(object, group.selections[0].Name)
+		if field == nil || field.Type == nil {
+			continue
+		}
+		cost := 1
+		if field.Cost != nil {
+			// Arguments that can not be coerced fail the field once it is resolved
+			if args, err := e.arguments(field, group.selections[0]); err == nil {
+				cost = field.Cost(args)
+			}
+		}
+		var children []Selection
+		for _, selection := range group.selections {
+			children = append(children, selection.SelectionSet...)
+		}
+		nodes, err := e.nodes(field.Type, children)
+		if err != nil {
+			return 0, err
+		}
+		total += cost * (1 + nodes)
+		if total > e.schema.MaxNodes {
+			return total, nil
+		}
+	}
+	return total, nil
+}
+
+func (e *executor) resolve(t *task, c *call) (value interface{}, err error) {
+	args, err := e.arguments(c.field, c.group.selections[0])
+	if err != nil {
+		return nil, &Error{Message: err.Error(), Locations: []Location{c.group.selections[0].Location}}
+	}
+	if c.field.Resolve == nil {
+		return DefaultResolver(Params{Context: e.ctx, Source: t.source}, c.group.selections[0].Name)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("resolver of %v.%v panicked: %v", t.object.Name, c.group.selections[0].Name, r)
+		}
+	}()
+	return c.field.Resolve(Params{Context: e.ctx, Source: t.source, Args: args})
+}
+
+func (e *executor) fail(err error, location Location, path []interface{}) {
+	failure := &Error{Message: err.Error(), Locations: []Location{location}, Path: path}
+	if located, ok := err.(*Error); ok {
+		if len(located.Locations) > 0 {
+			failure.Locations = located.Locations
+		}
+	} else if e.schema.ErrorMessage != nil {
+		failure.Message = e.schema.ErrorMessage(err)
+	}
+	e.errors = append(e.errors, failure)
+}
+
+// complete writes the value of a field, values of object fields are selected from by tasks of the next level.
+func (e *executor) complete(c *call, path []interface{}) (interface{}, []*task) {
+	if c.field.Type == nil || isNil(c.value) {
+		if isNil(c.value) {
+			return nil, nil
+		}
+		return c.value, nil
+	}
+	var selections []Selection
+	for _, selection := range c.group.selections {
+		selections = append(selections, selection.SelectionSet...)
+	}
+	newTask := func(source interface{}, path []interface{}) *task {
+		return &task{source: source, object: c.field.Type, selections: selections, result: newResult(), path: path}
+	}
+	value := reflect.ValueOf(c.value)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		t := newTask(c.value, path)
+		return t.result, []*task{t}
+	}
+	list := make([]interface{}, value.Len())
+	tasks := make([]*task, 0, value.Len())
+	for i := range list {
+		item := value.Index(i).Interface()
+		if isNil(item) {
+			continue
+		}
+		t := newTask(item, append(append([]interface{}{}, path...), i))
+		list[i] = t.result
+		tasks = append(tasks, t)
+	}
+	return list, tasks
+}
+
+// collect merges the fields selected from an object by response key, in the order they were first selected.
+func (e *executor) collect(object *Object, selections []Selection) ([]fieldGroup, error) {
+	var groups []fieldGroup
+	index := make(map[string]int)
+	var walk func(selections []Selection) error
+	walk = func(selections []Selection) error {
+		for _, selection := range selections {
+			var err error
+			switch selection := selection.(type) {
+			case *FieldSelection:
+				var included bool
+				if included, err = e.included(selection.Directives); err != nil || !included {
+					break
+				}
+				key := selection.ResponseKey()
+				if i, ok := index[key]; ok {
+					if groups[i].selections[0].Name != selection.Name {
+						return &Error{Message: fmt.Sprintf("Fields %q conflict because %v and %v are different fields.", key, groups[i].selections[0].Name, selection.Name), Locations: []Location{selection.Location}}
+					}
+					if !sameArguments(groups[i].selections[0].Arguments, selection.Arguments) {
+						return &Error{Message: fmt.Sprintf("Fields %q conflict because they have differing arguments.", key), Locations: []Location{selection.Location}}
+					}
+					groups[i].selections = append(groups[i].selections, selection)
+					break
+				}
+				index[key] = len(groups)
+				groups = append(groups, fieldGroup{key: key, selections: []*FieldSelection{selection}})
+			case *InlineFragment:
+				var included bool
+				if included, err = e.included(selection.Directives); err == nil && included {
+					err = walk(selection.SelectionSet)
+				}
+			case *FragmentSpread:
+				var included bool
+				if included, err = e.included(selection.Directives); err == nil && included {
+					err = walk(e.fragments[selection.Name].SelectionSet)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return groups, walk(selections)
+}
+
+// sameArguments reports whether two selections of a field are given the same arguments.
+func sameArguments(a, b map[string]Value) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+// included evaluates the @include and @skip directives of a selection.
+func (e *executor) included(directives []Directive) (bool, error) {
+	for _, directive := range directives {
+		value, err := coerce("Boolean!", directive.Arguments["if"], e.variables)
+		if err != nil {
+			return false, fmt.Errorf("Directive \"@%v\" argument \"if\": %v", directive.Name, err)
+		}
+		if value.(bool) == (directive.Name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// coerceVariables coerces the values of the variables of an operation to their type.
+func (e *executor) coerceVariables(definitions []VariableDefinition, values map[string]interface{}) error {
+	e.variables = make(map[string]interface{})
+	for _, definition := range definitions {
+		value, ok := values[definition.Name]
+		if !ok && definition.Default == nil {
+			if strings.HasSuffix(definition.Type, "!") {
+				return &Error{Message: fmt.Sprintf("Variable \"$%v\" of required type %v was not provided.", definition.Name, definition.Type), Locations: []Location{definition.Location}}
+			}
+			continue
+		}
+		if !ok {
+			value = definition.Default
+		}
+		coerced, err := coerce(definition.Type, value, e.variables)
+		if err != nil {
+			return &Error{Message: fmt.Sprintf("Variable \"$%v\" got an invalid value: %v", definition.Name, err), Locations: []Location{definition.Location}}
+		}
+		e.variables[definition.Name] = coerced
+	}
+	return nil
+}
+
+// arguments coerces the arguments given to a field to their type.
+func (e *executor) arguments(field *Field, selection *FieldSelection) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(field.Args))
+	for name, typ := range field.Args {
+		value, ok := selection.Arguments[name]
+		if variable, isVariable := value.(Variable); isVariable {
+			value, ok = e.variables[string(variable)]
+		}
+		if !ok {
+			if strings.HasSuffix(typ, "!") {
+				return nil, fmt.Errorf("Argument %q of required type %v was not provided.", name, typ)
+			}
+			continue
+		}
+		coerced, err := coerce(typ, value, e.variables)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %q has an invalid value: %v", name, err)
+		}
+		args[name] = coerced
+	}
+	return args, nil
+}
+
+// coerce converts a literal or the value of a variable to a type (see Field.Args).
+func coerce(typ string, value Value, variables map[string]interface{}) (interface{}, error) {
+	if variable, ok := value.(Variable); ok {
+		value = variables[string(variable)]
+	}
+	required := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+	if value == nil {
+		if required {
+			return nil, fmt.Errorf("expected a non-null %v", typ)
+		}
+		return nil, nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		items, ok := value.([]Value)
+		if !ok {
+			items = []Value{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if list[i], err = coerce(typ[1:len(typ)-1], item, variables); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	switch typ {
+	case "Int":
+		if number, ok := integer(value); ok && number >= math.MinInt32 && number <= math.MaxInt32 {
+			return int(number), nil
+		}
+	case "Float":
+		switch number := value.(type) {
+		case float64:
+			return number, nil
+		case int64:
+			return float64(number), nil
+		case int:
+			return float64(number), nil
+		}
+	case "String":
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+	case "ID":
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+		if number, ok := integer(value); ok {
+			return strconv.FormatInt(number, 10), nil
+		}
+	case "Boolean":
+		if boolean, ok := value.(bool); ok {
+			return boolean, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %v, found %v", typ, describe(value))
+}
+
+// integer reads an integer literal or a number of a JSON variable without a fractional part.
+func integer(value Value) (int64, bool) {
+	switch number := value.(type) {
+	case int64:
+		return number, true
+	case int:
+		return int64(number), true
+	case float64:
+		if number == math.Trunc(number) && math.Abs(number) < 1<<53 {
+			return int64(number), true
+		}
+	}
+	return 0, false
+}
+
+func describe(value Value) string {
+	switch value := value.(type) {
+	case Enum:
+		return string(value)
+	case []Value:
+		return "a list"
+	case map[string]Value:
+		return "an object"
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+// DefaultResolver resolves a field to the field of the source with the same JSON name (see encoding/json),
+// or the entry of the same key when the source is a map.
+func DefaultResolver(p Params, name string) (interface{}, error) {
+	source := reflect.ValueOf(p.Source)
+	for source.Kind() == reflect.Ptr || source.Kind() == reflect.Interface {
+		if source.IsNil() {
+			return nil, nil
+		}
+		source = source.Elem()
+	}
+	switch source.Kind() {
+	case reflect.Map:
+		if source.Type().Key().Kind() == reflect.String {
+			if value := source.MapIndex(reflect.ValueOf(name).Convert(source.Type().Key())); value.IsValid() {
+				return value.Interface(), nil
+			}
+			return nil, nil
+		}
+	case reflect.Struct:
+		if index, ok := jsonFields(source.Type())[name]; ok {
+			return source.FieldByIndex(index).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("%v has no field %v", source.Type(), name)
+}
+
+var jsonFieldCache sync.Map
+
+// jsonFields indexes the exported fields of a struct type, embedded fields included, by JSON name.
+func jsonFields(typ reflect.Type) map[string][]int {
+	if fields, ok := jsonFieldCache.Load(typ); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded, index := range jsonFields(field.Type) {
+				if _, ok := fields[embedded]; !ok {
+					fields[embedded] = append([]int{i}, index...)
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = []int{i}
+	}
+	jsonFieldCache.Store(typ, fields)
+	return fields
+}
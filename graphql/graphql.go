@@ -0,0 +1,162 @@
+// Package graphql executes GraphQL queries (https://spec.graphql.org) against a schema of object types whose fields
+// are computed by resolvers. It supports the query language used by clients to read a graph: variables, aliases,
+// fragments, inline fragments, the @include and @skip directives and introspection (the __schema, __type and
+// __typename fields). Mutations, subscriptions, interfaces, unions, enums and input objects are not supported.
+//
+// Queries are executed breadth first: the fields of every object of a level of the response are resolved before the
+// fields of the next level, so that the values resolvers defer to a Loader are retrieved in a single batch.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Error is an error of a request, located in the query and, for errors of fields, at a path of the response.
+type Error struct {
+	Message   string        `json:"message"`
+	Locations []Location    `json:"locations,omitempty"`
+	Path      []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Request is a query along with the variables of its operations.
+type Request struct {
+	Query string `json:"query"`
+	// OperationName selects the operation to execute when the query has several
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response is the result of a request. Data is absent when the request could not be executed, otherwise fields
+// that failed are null and described by Errors.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Schema describes the graph clients query.
+type Schema struct {
+	// Query is the type of the root of the graph
+	Query *Object
+	// MaxDepth limits the nesting of fields of queries, unlimited when 0
+	MaxDepth int
+	// MaxFields limits the fields selected by queries, counting every alias and every spread of a fragment,
+	// unlimited when 0
+	MaxFields int
+	// MaxNodes limits the objects queries may resolve to, as estimated from the Cost of their fields before they
+	// are executed, unlimited when 0
+	MaxNodes int
+	// ErrorMessage, when set, is the message reported for an error of a resolver, ie: to hide internal errors.
+	// Errors of type *Error are reported as is.
+	ErrorMessage func(err error) string
+}
+
+// Object is an object type of the graph.
+type Object struct {
+	Name   string
+	Fields Fields
+}
+
+// Fields are the fields of an object type by name.
+type Fields map[string]*Field
+
+// Field is a field of an object type.
+type Field struct {
+	// Type is the object type of fields holding an object or a list of objects, nil for other values.
+	// Other values are written as JSON.
+	Type *Object
+	// List tells introspection the field holds a list of objects of Type.
+	List bool
+	// Scalar tells introspection the type of the value of fields without a Type, written as the types of Args,
+	// the JSON scalar (any value) when empty. Values are not checked against it.
+	Scalar string
+	// Args are the arguments of the field by name along with their type: Int, Float, String, Boolean or ID,
+	// a list of a type within brackets and a ! suffix for required types, ie: [ID!]!
+	Args map[string]string
+	// Resolve computes the value of the field, when nil the value is the field of the source
+	// with the JSON name of the field (see DefaultResolver).
+	Resolve Resolver
+	// Cost is the most objects of its type the field resolves to given its arguments, ie: the page size of a list,
+	// 1 when nil (see Schema.MaxNodes).
+	Cost func(args map[string]interface{}) int
+}
+
+// Resolver computes the value of a field of an object, or a Thunk computing it once it is needed.
+type Resolver func(p Params) (interface{}, error)
+
+// Params are the inputs of a resolver.
+type Params struct {
+	Context context.Context
+	// Source is the object whose field is resolved, nil for the fields of the root
+	Source interface{}
+	// Args are the arguments given to the field, coerced to their type: int, float64, string (strings and IDs),
+	// bool and []interface{}. Arguments that were not given are absent, those given as null are nil.
+	Args map[string]interface{}
+}
+
+// Thunk defers the computation of a value, so that values can be retrieved in batches (see Loader).
+type Thunk func() (interface{}, error)
+
+// Execute runs the query of a request against a schema.
+func Execute(ctx context.Context, schema Schema, request Request) Response {
+	doc, err := Parse(request.Query)
+	if err != nil {
+		return Response{Errors: []*Error{asError(err)}}
+	}
+	operation, err := doc.operation(request.OperationName)
+	if err != nil {
+		return Response{Errors: []*Error{asError(err)}}
+	}
+	if operation.Type != "query" {
+		return Response{Errors: []*Error{{Message: "Only queries are supported.", Locations: []Location{operation.Location}}}}
+	}
+	if errs := validate(schema, doc, operation); len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+	e := &executor{ctx: ctx, schema: schema, fragments: doc.Fragments}
+	if err = e.coerceVariables(operation.Variables, request.Variables); err != nil {
+		return Response{Errors: []*Error{asError(err)}}
+	}
+	if schema.MaxNodes > 0 {
+		if nodes, err := e.nodes(schema.Query, operation.SelectionSet); err != nil {
+			return Response{Errors: []*Error{asError(err)}}
+		} else if nodes > schema.MaxNodes {
+			message := fmt.Sprintf("The query may resolve more than %v objects.", schema.MaxNodes)
+			return Response{Errors: []*Error{{Message: message, Locations: []Location{operation.Location}}}}
+		}
+	}
+	data, err := e.execute(operation)
+	if err != nil {
+		return Response{Errors: append(e.errors, asError(err))}
+	}
+	return Response{Data: data, Errors: e.errors}
+}
+
+// operation selects the operation of a document to execute.
+func (d *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return d.Operations[0], nil
+	}
+	for _, operation := range d.Operations {
+		if operation.Name == name {
+			return operation, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+func asError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Message: err.Error()}
+}
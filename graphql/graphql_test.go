@@ -0,0 +1,622 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/graphql"
+)
+
+type shelf struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Secret  string `json:"-"`
+	BoxIDs  []int64
+	private string
+}
+
+type box struct {
+	ID    int64  `json:"id"`
+	Label string `json:"label"`
+}
+
+// testSchema is a graph of shelves holding boxes, boxes are retrieved by the loader of the context.
+func testSchema() graphql.Schema {
+	boxType := &graphql.Object{Name: "Box", Fields: graphql.Fields{
+		"id":    {Scalar: "ID!"},
+		"label": {Scalar: "String"},
+	}}
+	shelfType := &graphql.Object{Name: "Shelf", Fields: graphql.Fields{
+		"id":   {Scalar: "ID!"},
+		"name": {Scalar: "String!"},
+		"boxes": {Type: boxType, List: true, Resolve: func(p graphql.Params) (interface{}, error) {
+			loader := p.Context.Value("boxes").(*graphql.Loader)
+			thunks := make([]graphql.Thunk, 0)
+			for _, ID := range p.Source.(shelf).BoxIDs {
+				thunks = append(thunks, loader.Load(ID))
+			}
+			return graphql.Thunk(func() (interface{}, error) {
+				boxes := make([]interface{}, 0, len(thunks))
+				for _, thunk := range thunks {
+					value, err := thunk()
+					if err != nil {
+						return nil, err
+					}
+					boxes = append(boxes, value)
+				}
+				return boxes, nil
+			}), nil
+		}},
+		"broken": {Resolve: func(p graphql.Params) (interface{}, error) {
+			return nil, errors.New("connection refused")
+		}},
+	}}
+	shelves := []shelf{{ID: 1, Name: "Garage", BoxIDs: []int64{10, 11}}, {ID: 2, Name: "Attic", BoxIDs: []int64{11, 12}}}
+	queryType := &graphql.Object{Name: "Query", Fields: graphql.Fields{
+		"shelves": {Type: shelfType, List: true, Args: map[string]string{"first": "Int"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			if first, ok := p.Args["first"].(int); ok && first < len(shelves) {
+				return shelves[:first], nil
+			}
+			return shelves, nil
+		}},
+		"shelf": {Type: shelfType, Args: map[string]string{"id": "ID!"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			for _, s := range shelves {
+				if strconv.FormatInt(s.ID, 10) == p.Args["id"] {
+					return s, nil
+				}
+			}
+			return nil, nil
+		}},
+		"echo": {Args: map[string]string{"ids": "[ID]", "text": "String"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Args, nil
+		}},
+	}}
+	return graphql.Schema{
+		Query:    queryType,
+		MaxDepth: 3,
+		ErrorMessage: func(err error) string {
+			return "Internal error."
+		},
+	}
+}
+
+func execute(t *testing.T, query string, variables map[string]interface{}) (string, [][]int64) {
+	return executeRequest(t, testSchema(), graphql.Request{Query: query, Variables: variables})
+}
+
+func executeRequest(t *testing.T, schema graphql.Schema, request graphql.Request) (string, [][]int64) {
+	var batches [][]int64
+	loader := graphql.NewLoader(func(keys []int64) (map[int64]interface{}, error) {
+		batches = append(batches, keys)
+		boxes := make(map[int64]interface{})
+		for _, key := range keys {
+			boxes[key] = box{ID: key, Label: "Box " + strconv.FormatInt(key, 10)}
+		}
+		return boxes, nil
+	})
+	ctx := context.WithValue(context.Background(), "boxes", loader)
+	response := graphql.Execute(ctx, schema, request)
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded), batches
+}
+
+func TestExecute(t *testing.T) {
+	query := `
+		query Shelves($first: Int = 5, $withBoxes: Boolean!) {
+			shelves(first: $first) {
+				name
+				kind: __typename
+				...identified
+				boxes @include(if: $withBoxes) { id label }
+			}
+		}
+		fragment identified on Shelf { id }
+	`
+	out, batches := execute(t, query, map[string]interface{}{"withBoxes": true})
+	expected := `{"data":{"shelves":[` +
+		`{"name":"Garage","kind":"Shelf","id":1,"boxes":[{"id":10,"label":"Box 10"},{"id":11,"label":"Box 11"}]},` +
+		`{"name":"Attic","kind":"Shelf","id":2,"boxes":[{"id":11,"label":"Box 11"},{"id":12,"label":"Box 12"}]}]}}`
+	if out != expected {
+		t.Errorf("Unexpected response:\n%v\nexpected:\n%v", out, expected)
+	}
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Errorf("Expected the boxes of every shelf to be loaded in a single batch of distinct keys, got %v", batches)
+	}
+}
+
+func TestExecute_Skip(t *testing.T) {
+	out, batches := execute(t, `{ shelves(first: 1) { id boxes @skip(if: true) { id } } }`, nil)
+	if out != `{"data":{"shelves":[{"id":1}]}}` {
+		t.Errorf("Unexpected response: %v", out)
+	}
+	if len(batches) != 0 {
+		t.Errorf("Expected skipped fields not to be resolved, got %v", batches)
+	}
+}
+
+func TestExecute_Arguments(t *testing.T) {
+	out, _ := execute(t, `query ($id: ID!) { shelf(id: $id) { name } echo(ids: 7, text: "a\"b") }`, map[string]interface{}{"id": float64(2)})
+	if out != `{"data":{"shelf":{"name":"Attic"},"echo":{"ids":["7"],"text":"a\"b"}}}` {
+		t.Errorf("Unexpected response: %v", out)
+	}
+}
+
+func TestExecute_FieldError(t *testing.T) {
+	out, _ := execute(t, `{ shelves(first: 1) { id broken } }`, nil)
+	expected := `{"data":{"shelves":[{"id":1,"broken":null}]},"errors":[{"message":"Internal error.","locations":[{"line":1,"column":26}],"path":["shelves",0,"broken"]}]}`
+	if out != expected {
+		t.Errorf("Unexpected response:\n%v\nexpected:\n%v", out, expected)
+	}
+}
+
+func TestExecute_Invalid(t *testing.T) {
+	cases := []struct {
+		query   string
+		message string
+	}{
+		{`{ shelves { id`, `Syntax Error: Expected Name, found <EOF>.`},
+		{`{ shelves { secret } }`, `Cannot query field "secret" on type "Shelf".`},
+		{`{ shelf { id } }`, `Field "shelf" argument "id" of type ID! is required but not provided.`},
+		{`{ shelves(last: 1) { id } }`, `Unknown argument "last" on field "shelves" of type "Query".`},
+		{`{ shelves }`, `Field "shelves" of type "Shelf" must have a selection of subfields.`},
+		{`{ shelves { id(x: 1) } }`, `Unknown argument "x" on field "id" of type "Shelf".`},
+		{`{ shelves(first: $n) { id } }`, `Variable "$n" is not defined.`},
+		{`{ shelves { ...missing } }`, `Unknown fragment "missing".`},
+		{`{ shelves { ...a } } fragment a on Shelf { ...a }`, `Cannot spread fragment "a" within itself.`},
+		{`{ shelves { boxes { ... on Shelf { id } } } }`, `Fragment cannot be spread here as objects of type "Box" can never be of type "Shelf".`},
+		{`{ shelves { boxes { id } } shelf(id: 1) { boxes { label } } }`, ``},
+		{`mutation { shelves { id } }`, `Only queries are supported.`},
+		{`query ($n: Int!) { shelves(first: $n) { id } }`, `Variable "$n" of required type Int! was not provided.`},
+		{`subscription { shelves { id } }`, `Only queries are supported.`},
+		{`{ }`, `Syntax Error: Expected Name, found "}".`},
+		{`fragment f on Shelf { id }`, `The document has no operation.`},
+		{`{ shelves(first: 01) { id } }`, `Syntax Error: Invalid number 01.`},
+		{`{ shelves(first: 1.) { id } }`, `Syntax Error: Invalid number 1..`},
+		{`{ shelves(first: 1a) { id } }`, `Syntax Error: Invalid number 1a.`},
+		{`{ echo(text: "a\qb") }`, `Syntax Error: Invalid escape \q.`},
+		{`{ echo(text: "open) }`, `Syntax Error: Unterminated string.`},
+		{`{ echo(text: """open) }`, `Syntax Error: Unterminated string.`},
+		{`{ shelves(first: 1, first: 2) { id } }`, `There can be only one argument named "first".`},
+		{`{ shelves { id } } { shelf(id: 1) { id } }`, `This anonymous operation must be the only defined operation.`},
+		{`query A { shelves { id } } query A { shelves { name } }`, `There can be only one operation named "A".`},
+		{`{ shelves { ...f } } fragment f on Shelf { id } fragment f on Shelf { name }`, `There can be only one fragment named "f".`},
+		{`{ shelves { id { x } } }`, `Field "id" must not have a selection since it has no subfields.`},
+		{`{ shelves { __typename(x: 1) } }`, `Field "__typename" has no arguments or subfields.`},
+		{`{ shelves(first: "2") { id } }`, `Argument "first" has an invalid value: expected Int, found "2".`},
+		{`{ shelves(first: 3000000000) { id } }`, `Argument "first" has an invalid value: expected Int, found 3000000000.`},
+		{`{ shelves(first: 1.5) { id } }`, `Argument "first" has an invalid value: expected Int, found 1.5.`},
+		{`{ shelf(id: null) { id } }`, `Field "shelf" argument "id" of type ID! is required but not provided.`},
+		{`{ shelf(id: true) { id } }`, `Argument "id" has an invalid value: expected ID, found true.`},
+		{`{ echo(ids: [1, [2]]) }`, `Argument "ids" has an invalid value: expected ID, found a list.`},
+		{`{ echo(text: {a: 1}) }`, `Argument "text" has an invalid value: expected String, found an object.`},
+		{`{ echo(text: RED) }`, `Argument "text" has an invalid value: expected String, found RED.`},
+		{`{ shelves { id @include(if: "yes") } }`, `Directive "@include" argument "if" has an invalid value: expected Boolean, found "yes".`},
+		{`{ shelves { id @include } }`, `Directive "@include" takes a single argument "if" of type Boolean!.`},
+		{`{ shelves { id @deprecated } }`, `Unknown directive "@deprecated".`},
+		{`query ($n: String) { shelves(first: $n) { id } }`, `Variable "$n" of type String used in position expecting type Int.`},
+		{`query ($id: ID) { shelf(id: $id) { id } }`, `Variable "$id" of type ID used in position expecting type ID!.`},
+		{`query ($id: ID = 1) { shelf(id: $id) { id } }`, ``},
+		{`query ($ids: [ID!]) { echo(ids: $ids) }`, ``},
+		{`query ($id: ID) { echo(ids: [$id]) }`, ``},
+		{`query ($ids: ID) { echo(ids: $ids) }`, `Variable "$ids" of type ID used in position expecting type [ID].`},
+		{`query ($ids: [[ID]]) { echo(ids: $ids) }`, `Variable "$ids" of type [[ID]] used in position expecting type [ID].`},
+		{`query ($b: Boolean) { shelves { id @skip(if: $b) } }`, `Variable "$b" of type Boolean used in position expecting type Boolean!.`},
+		{`query ($n: Int, $n: Int) { shelves(first: $n) { id } }`, `There can be only one variable named "$n".`},
+		{`query ($n: Shelf) { shelves { id } }`, `Variable "$n" has an unknown type Shelf.`},
+		{`query ($n: Int) { shelves { id } }`, `Variable "$n" is never used.`},
+		{`query ($n: Int) { shelves { ...f } } fragment f on Shelf { boxes { id @skip(if: $n) } }`, `Variable "$n" of type Int used in position expecting type Boolean!.`},
+		{`{ shelves { ...f } } fragment f on Shelf { id } fragment g on Shelf { name }`, `Fragment "g" is never used.`},
+		{`{ shelves { ...f } } fragment f on Shelf { ...g } fragment g on Shelf { name }`, ``},
+		{`{ shelves { id } } fragment unused on Shelf { id }`, `Fragment "unused" is never used.`},
+		{`{ shelves { ... on Nope { id } } }`, `Unknown type "Nope".`},
+		{`{ shelves { ...f } } fragment f on Nope { id }`, `Unknown type "Nope".`},
+		{`{ shelves { ... on Int { id } } }`, `Fragment cannot condition on non composite type "Int".`},
+		{`{ shelves { x: id x: name } }`, `Fields "x" conflict because id and name are different fields.`},
+		{`{ shelves(first: 1) { id } shelves(first: 2) { name } }`, `Fields "shelves" conflict because they have differing arguments.`},
+		{`{ shelves { id } shelves() { name } }`, ``},
+		{`{ shelves { __schema { types { name } } } }`, `Cannot query field "__schema" on type "Shelf".`},
+		{`{ __type { name } }`, `Field "__type" argument "name" of type String! is required but not provided.`},
+		{`{ __schema }`, `Field "__schema" of type "__Schema" must have a selection of subfields.`},
+		{`{ __type(name: "Shelf") { fields(includeDeprecated: 1) { name } } }`, `Argument "includeDeprecated" has an invalid value: expected Boolean, found 1.`},
+	}
+	for _, c := range cases {
+		response := graphql.Execute(context.WithValue(context.Background(), "boxes", graphql.NewLoader(func(keys []int64) (map[int64]interface{}, error) {
+			return nil, nil
+		})), testSchema(), graphql.Request{Query: c.query})
+		if c.message == "" {
+			if len(response.Errors) > 0 {
+				t.Errorf("Unexpected errors for %v: %v", c.query, response.Errors[0])
+			}
+			continue
+		}
+		if len(response.Errors) == 0 || response.Errors[0].Message != c.message {
+			t.Errorf("Expected %q for %v, got %+v", c.message, c.query, response.Errors)
+			continue
+		}
+		if response.Data != nil {
+			t.Errorf("Expected no data for %v", c.query)
+		}
+	}
+}
+
+func TestExecute_MaxDepth(t *testing.T) {
+	response := graphql.Execute(context.Background(), graphql.Schema{Query: &graphql.Object{Name: "Query", Fields: graphql.Fields{}}, MaxDepth: 1}, graphql.Request{Query: `{ __typename }`})
+	if len(response.Errors) > 0 {
+		t.Errorf("Unexpected errors: %v", response.Errors[0])
+	}
+	nested := &graphql.Object{Name: "Node"}
+	nested.Fields = graphql.Fields{"next": {Type: nested, Resolve: func(p graphql.Params) (interface{}, error) {
+		return map[string]interface{}{}, nil
+	}}}
+	schema := graphql.Schema{Query: nested, MaxDepth: 2}
+	response = graphql.Execute(context.Background(), schema, graphql.Request{Query: `{ next { next { __typename } } }`})
+	if len(response.Errors) != 1 || response.Errors[0].Message != "The query is nested deeper than 2 fields." {
+		t.Errorf("Expected the query to be too deep, got %+v", response.Errors)
+	}
+	response = graphql.Execute(context.Background(), schema, graphql.Request{Query: `{ __type(name: "Node") { fields { type { ofType { name } } } } }`})
+	if len(response.Errors) > 0 {
+		t.Errorf("Expected introspection not to be limited in depth, got %+v", response.Errors)
+	}
+}
+
+func TestExecute_MaxFields(t *testing.T) {
+	schema := testSchema()
+	schema.MaxFields = 3
+	query := `{ shelves { a: id b: id } shelf(id: 1) { name } }`
+	response := graphql.Execute(context.Background(), schema, graphql.Request{Query: query})
+	if len(response.Errors) != 1 || response.Errors[0].Message != "The query selects more than 3 fields." || response.Data != nil {
+		t.Errorf("Expected aliases to count as fields, got %+v", response.Errors)
+	}
+	query = `{ shelves { ...f ...f ...f } } fragment f on Shelf { id }`
+	response = graphql.Execute(context.Background(), schema, graphql.Request{Query: query})
+	if len(response.Errors) != 1 || response.Errors[0].Message != "The query selects more than 3 fields." {
+		t.Errorf("Expected fragments to count every time they are spread, got %+v", response.Errors)
+	}
+}
+
+func TestExecute_MaxNodes(t *testing.T) {
+	node := &graphql.Object{Name: "Node"}
+	resolved := false
+	node.Fields = graphql.Fields{
+		"id": {},
+		"children": {Type: node, Args: map[string]string{"first": "Int"}, Cost: func(args map[string]interface{}) int {
+			if first, ok := args["first"].(int); ok {
+				return first
+			}
+			return 10
+		}, Resolve: func(p graphql.Params) (interface{}, error) {
+			resolved = true
+			return []interface{}{}, nil
+		}},
+	}
+	schema := graphql.Schema{Query: node, MaxNodes: 100}
+	cases := []struct {
+		query     string
+		variables map[string]interface{}
+		allowed   bool
+	}{
+		{`{ children { id } }`, nil, true},
+		{`{ children(first: 4) { children(first: 20) { id } } }`, nil, true},
+		{`{ children { children { id } } }`, nil, false},
+		{`query ($n: Int) { children(first: $n) { id } }`, map[string]interface{}{"n": float64(101)}, false},
+		{`{ children(first: 60) { id } more: children(first: 60) { id } }`, nil, false},
+	}
+	for _, c := range cases {
+		resolved = false
+		response := graphql.Execute(context.Background(), schema, graphql.Request{Query: c.query, Variables: c.variables})
+		if c.allowed && len(response.Errors) > 0 {
+			t.Errorf("Unexpected errors for %v: %v", c.query, response.Errors[0])
+		}
+		if !c.allowed && (len(response.Errors) != 1 || response.Errors[0].Message != "The query may resolve more than 100 objects." || resolved) {
+			t.Errorf("Expected %v to be refused before it is resolved, got %+v", c.query, response.Errors)
+		}
+	}
+}
+
+func TestExecute_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "boxes", graphql.NewLoader(func(keys []int64) (map[int64]interface{}, error) {
+		return nil, nil
+	})))
+	cancel()
+	response := graphql.Execute(ctx, testSchema(), graphql.Request{Query: `{ shelves { id } }`})
+	if len(response.Errors) != 1 || response.Errors[0].Message != context.Canceled.Error() || response.Data != nil {
+		t.Errorf("Expected a canceled request not to be executed, got %+v", response)
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc, err := graphql.Parse(`
+		# the shelves
+		query Named($ids: [ID!]! = ["1"]) @cached {
+			all: shelves(first: -1, ratio: 1.5e2, where: {name: "x", tags: [A, null]}) {
+				... on Shelf { id }
+			}
+		}
+		fragment f on Shelf { """block
+		string""" }
+	`)
+	if err == nil {
+		t.Error("Expected a string not to be a selection")
+	}
+	doc, err = graphql.Parse(`query Named($ids: [ID!]! = ["1"]) { all: shelves(first: -1, ratio: 1.5e2, where: {tags: [A, null]}) { ... on Shelf { id } } }`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	operation := doc.Operations[0]
+	if operation.Name != "Named" || operation.Variables[0].Type != "[ID!]!" || operation.Variables[0].Default.([]graphql.Value)[0] != "1" {
+		t.Errorf("Unexpected operation: %+v", operation)
+	}
+	field := operation.SelectionSet[0].(*graphql.FieldSelection)
+	if field.ResponseKey() != "all" || field.Arguments["first"] != int64(-1) || field.Arguments["ratio"] != 150.0 {
+		t.Errorf("Unexpected field: %+v", field)
+	}
+	tags := field.Arguments["where"].(map[string]graphql.Value)["tags"].([]graphql.Value)
+	if tags[0] != graphql.Enum("A") || tags[1] != nil {
+		t.Errorf("Unexpected list: %v", tags)
+	}
+	if fragment, ok := field.SelectionSet[0].(*graphql.InlineFragment); !ok || fragment.TypeCondition != "Shelf" {
+		t.Errorf("Unexpected inline fragment: %+v", field.SelectionSet[0])
+	}
+}
+
+func TestParse_Location(t *testing.T) {
+	_, err := graphql.Parse("{\n  shelves {\n    id ?\n  }\n}")
+	e, ok := err.(*graphql.Error)
+	if !ok || e.Locations[0].Line != 3 || e.Locations[0].Column != 8 {
+		t.Errorf("Expected the error to be located at 3:8, got %+v", err)
+	}
+}
+
+func TestDefaultResolver(t *testing.T) {
+	source := &shelf{ID: 3, Name: "Basement", Secret: "s", private: "p"}
+	if value, err := graphql.DefaultResolver(graphql.Params{Source: source}, "name"); err != nil || value != "Basement" {
+		t.Errorf("Expected the field with the JSON name, got %v %v", value, err)
+	}
+	if _, err := graphql.DefaultResolver(graphql.Params{Source: source}, "Secret"); err == nil {
+		t.Error("Expected fields left out of JSON not to be resolved")
+	}
+	if value, err := graphql.DefaultResolver(graphql.Params{Source: map[string]interface{}{"a": 1}}, "a"); err != nil || value != 1 {
+		t.Errorf("Expected the entry of the map, got %v %v", value, err)
+	}
+	var missing *shelf
+	if value, err := graphql.DefaultResolver(graphql.Params{Source: missing}, "name"); err != nil || value != nil {
+		t.Errorf("Expected nil, got %v %v", value, err)
+	}
+}
+
+func TestExecute_Spec(t *testing.T) {
+	cases := []struct {
+		query     string
+		variables map[string]interface{}
+		expected  string
+	}{
+		{`{ __typename }`, nil, `{"__typename":"Query"}`},
+		{`{ a: shelf(id: 1) { name } b: shelf(id: 2) { name } }`, nil, `{"a":{"name":"Garage"},"b":{"name":"Attic"}}`},
+		{`{ shelf(id: 1) { id } shelf(id: 1) { name } }`, nil, `{"shelf":{"id":1,"name":"Garage"}}`},
+		{`{ shelf(id: 1) { name id } }`, nil, `{"shelf":{"name":"Garage","id":1}}`},
+		{`{ shelf(id: 9) { name } }`, nil, `{"shelf":null}`},
+		{`{ shelf(id: 1) { ... { id } ... @include(if: false) { name } } }`, nil, `{"shelf":{"id":1}}`},
+		{`{ shelf(id: 1) { ...f @skip(if: true) name } } fragment f on Shelf { id }`, nil, `{"shelf":{"name":"Garage"}}`},
+		{`{ shelf(id: 1) { ...f } } fragment f on Shelf { ...g name } fragment g on Shelf { id }`, nil, `{"shelf":{"id":1,"name":"Garage"}}`},
+		{`{ shelf(id: 1) { id @skip(if: false) @include(if: true) name @skip(if: true) @include(if: true) } }`, nil, `{"shelf":{"id":1}}`},
+		{`{ shelves(first: null) { id } }`, nil, `{"shelves":[{"id":1},{"id":2}]}`},
+		{`query ($n: Int = 1) { shelves(first: $n) { id } }`, nil, `{"shelves":[{"id":1}]}`},
+		{`query ($n: Int = 1) { shelves(first: $n) { id } }`, map[string]interface{}{"n": float64(2)}, `{"shelves":[{"id":1},{"id":2}]}`},
+		{`query ($n: Int = 1) { shelves(first: $n) { id } }`, map[string]interface{}{"n": nil}, `{"shelves":[{"id":1},{"id":2}]}`},
+		{`query ($show: Boolean!) { shelf(id: 1) { id name @include(if: $show) } }`, map[string]interface{}{"show": false}, `{"shelf":{"id":1}}`},
+		{`{ echo(ids: [1, "2"]) }`, nil, `{"echo":{"ids":["1","2"]}}`},
+		{`query ($id: ID) { echo(ids: [$id, 3]) }`, map[string]interface{}{"id": "x"}, `{"echo":{"ids":["x","3"]}}`},
+		{`{ echo(ids: null) }`, nil, `{"echo":{"ids":null}}`},
+		{`{ echo(text: "\u00e9\t\\\/") }`, nil, `{"echo":{"text":"é\t\\/"}}`},
+		{"{ echo(text: \"\"\"\n    first\n      second\n\n    \\\"\"\" third\n  \"\"\") }", nil, `{"echo":{"text":"first\n  second\n\n\"\"\" third"}}`},
+		{"{ echo(text: \"\"\"  one line  \"\"\") }", nil, `{"echo":{"text":"  one line  "}}`},
+		{"# comment\n{ shelves(first: 1,) { id, name # trailing\n } }", nil, `{"shelves":[{"id":1,"name":"Garage"}]}`},
+		{`{ shelves(first: 1) { id __typename boxes { __typename } } }`, nil, `{"shelves":[{"id":1,"__typename":"Shelf","boxes":[{"__typename":"Box"},{"__typename":"Box"}]}]}`},
+	}
+	for _, c := range cases {
+		out, _ := execute(t, c.query, c.variables)
+		if expected := `{"data":` + c.expected + `}`; out != expected {
+			t.Errorf("Unexpected response for %v:\n%v\nexpected:\n%v", c.query, out, expected)
+		}
+	}
+}
+
+func TestExecute_OperationName(t *testing.T) {
+	query := `query A { shelf(id: 1) { name } } query B { shelf(id: 2) { name } }`
+	cases := []struct {
+		operationName string
+		expected      string
+	}{
+		{"B", `{"data":{"shelf":{"name":"Attic"}}}`},
+		{"A", `{"data":{"shelf":{"name":"Garage"}}}`},
+		{"", `{"errors":[{"message":"Must provide operation name if query contains multiple operations."}]}`},
+		{"C", `{"errors":[{"message":"Unknown operation named \"C\"."}]}`},
+	}
+	for _, c := range cases {
+		out, _ := executeRequest(t, testSchema(), graphql.Request{Query: query, OperationName: c.operationName})
+		if out != c.expected {
+			t.Errorf("Unexpected response for %q: %v", c.operationName, out)
+		}
+	}
+}
+
+func TestExecute_VariableErrors(t *testing.T) {
+	cases := []struct {
+		query     string
+		variables map[string]interface{}
+		message   string
+	}{
+		{`query ($n: Int) { shelves(first: $n) { id } }`, map[string]interface{}{"n": "2"}, `Variable "$n" got an invalid value: expected Int, found "2"`},
+		{`query ($n: Int) { shelves(first: $n) { id } }`, map[string]interface{}{"n": 1.5}, `Variable "$n" got an invalid value: expected Int, found 1.5`},
+		{`query ($id: ID!) { shelf(id: $id) { id } }`, map[string]interface{}{"id": nil}, `Variable "$id" got an invalid value: expected a non-null ID`},
+		{`query ($ids: [ID!]) { echo(ids: $ids) }`, map[string]interface{}{"ids": []interface{}{"1", nil}}, `Variable "$ids" got an invalid value: expected a non-null ID`},
+		{`query ($b: Boolean! = "yes") { shelves { id @skip(if: $b) } }`, nil, `Variable "$b" got an invalid value: expected Boolean, found "yes"`},
+	}
+	for _, c := range cases {
+		response := graphql.Execute(context.Background(), testSchema(), graphql.Request{Query: c.query, Variables: c.variables})
+		if len(response.Errors) != 1 || response.Errors[0].Message != c.message || response.Data != nil {
+			t.Errorf("Expected %q for %v, got %+v", c.message, c.query, response.Errors)
+		}
+	}
+}
+
+// introspect executes a query of the test schema without its depth limit, introspection queries being deeply nested.
+func introspect(t *testing.T, query string) string {
+	schema := testSchema()
+	schema.MaxDepth = 0
+	out, _ := executeRequest(t, schema, graphql.Request{Query: query})
+	return out
+}
+
+func TestIntrospection_Schema(t *testing.T) {
+	out := introspect(t, `{ __schema {
+		__typename description queryType { name } mutationType { name } subscriptionType { name }
+		types { name kind }
+		directives { name description locations isRepeatable args { name defaultValue type { kind name ofType { kind name } } } }
+	} }`)
+	var response struct {
+		Data struct {
+			Schema struct {
+				Typename         string            `json:"__typename"`
+				Description      *string           `json:"description"`
+				QueryType        map[string]string `json:"queryType"`
+				MutationType     map[string]string `json:"mutationType"`
+				SubscriptionType map[string]string `json:"subscriptionType"`
+				Types            []struct {
+					Name string `json:"name"`
+					Kind string `json:"kind"`
+				} `json:"types"`
+				Directives json.RawMessage `json:"directives"`
+			} `json:"__schema"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(out), &response); err != nil {
+		t.Fatal(err)
+	}
+	schema := response.Data.Schema
+	if schema.Typename != "__Schema" || schema.Description != nil || schema.QueryType["name"] != "Query" || schema.MutationType != nil || schema.SubscriptionType != nil {
+		t.Errorf("Unexpected schema: %v", out)
+	}
+	kinds := make(map[string]string)
+	for i, typ := range schema.Types {
+		kinds[typ.Name] = typ.Kind
+		if i > 0 && schema.Types[i-1].Name >= typ.Name {
+			t.Errorf("Expected the types to be sorted by name, got %v before %v", schema.Types[i-1].Name, typ.Name)
+		}
+	}
+	expected := map[string]string{
+		"Query": "OBJECT", "Shelf": "OBJECT", "Box": "OBJECT",
+		"Boolean": "SCALAR", "Float": "SCALAR", "ID": "SCALAR", "Int": "SCALAR", "String": "SCALAR", "JSON": "SCALAR",
+		"__Schema": "OBJECT", "__Type": "OBJECT", "__Field": "OBJECT", "__InputValue": "OBJECT", "__EnumValue": "OBJECT",
+		"__Directive": "OBJECT", "__TypeKind": "ENUM", "__DirectiveLocation": "ENUM",
+	}
+	for name, kind := range expected {
+		if kinds[name] != kind {
+			t.Errorf("Expected %v to be of kind %v, got %q", name, kind, kinds[name])
+		}
+	}
+	if len(kinds) != len(expected) {
+		t.Errorf("Unexpected types: %v", kinds)
+	}
+	directive := `"description":null,"locations":["FIELD","FRAGMENT_SPREAD","INLINE_FRAGMENT"],"isRepeatable":false,` +
+		`"args":[{"name":"if","defaultValue":null,"type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"Boolean"}}}]`
+	if directives := `[{"name":"include",` + directive + `},{"name":"skip",` + directive + `}]`; string(schema.Directives) != directives {
+		t.Errorf("Unexpected directives:\n%s\nexpected:\n%v", schema.Directives, directives)
+	}
+}
+
+func TestIntrospection_Type(t *testing.T) {
+	out := introspect(t, `{ __type(name: "Box") {
+		__typename kind name description specifiedByURL
+		fields(includeDeprecated: true) { name description isDeprecated deprecationReason args { name } type { kind name ofType { kind name } } }
+		interfaces { name } possibleTypes { name } enumValues { name } inputFields { name } ofType { name }
+	} }`)
+	expected := `{"data":{"__type":{"__typename":"__Type","kind":"OBJECT","name":"Box","description":null,"specifiedByURL":null,"fields":[` +
+		`{"name":"id","description":null,"isDeprecated":false,"deprecationReason":null,"args":[],"type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"ID"}}},` +
+		`{"name":"label","description":null,"isDeprecated":false,"deprecationReason":null,"args":[],"type":{"kind":"SCALAR","name":"String","ofType":null}}` +
+		`],"interfaces":[],"possibleTypes":null,"enumValues":null,"inputFields":null,"ofType":null}}}`
+	if out != expected {
+		t.Errorf("Unexpected response:\n%v\nexpected:\n%v", out, expected)
+	}
+	if out = introspect(t, `{ __type(name: "Nope") { name } }`); out != `{"data":{"__type":null}}` {
+		t.Errorf("Expected unknown types to be null, got %v", out)
+	}
+	if out = introspect(t, `{ __type(name: "Int") { kind name fields { name } interfaces { name } } }`); out != `{"data":{"__type":{"kind":"SCALAR","name":"Int","fields":null,"interfaces":null}}}` {
+		t.Errorf("Unexpected scalar: %v", out)
+	}
+}
+
+func TestIntrospection_TypeReferences(t *testing.T) {
+	out := introspect(t, `{ __type(name: "Query") { fields { name args { name type { ...ref } } type { ...ref } } } }
+		fragment ref on __Type { kind name ofType { kind name ofType { kind name } } }`)
+	var response struct {
+		Data struct {
+			Type struct {
+				Fields []struct {
+					Name string            `json:"name"`
+					Args []json.RawMessage `json:"args"`
+					Type json.RawMessage   `json:"type"`
+				} `json:"fields"`
+			} `json:"__type"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(out), &response); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]struct {
+		args string
+		typ  string
+	}{
+		"echo": {
+			`[{"name":"ids","type":{"kind":"LIST","name":null,"ofType":{"kind":"SCALAR","name":"ID","ofType":null}}}` +
+				`,{"name":"text","type":{"kind":"SCALAR","name":"String","ofType":null}}]`,
+			`{"kind":"SCALAR","name":"JSON","ofType":null}`,
+		},
+		"shelf": {
+			`[{"name":"id","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"ID","ofType":null}}}]`,
+			`{"kind":"OBJECT","name":"Shelf","ofType":null}`,
+		},
+		"shelves": {
+			`[{"name":"first","type":{"kind":"SCALAR","name":"Int","ofType":null}}]`,
+			`{"kind":"LIST","name":null,"ofType":{"kind":"OBJECT","name":"Shelf","ofType":null}}`,
+		},
+	}
+	if len(response.Data.Type.Fields) != len(expected) {
+		t.Fatalf("Unexpected fields: %v", out)
+	}
+	for _, field := range response.Data.Type.Fields {
+		args, _ := json.Marshal(field.Args)
+		if string(args) != expected[field.Name].args || string(field.Type) != expected[field.Name].typ {
+			t.Errorf("Unexpected field %v: %s %s", field.Name, args, field.Type)
+		}
+	}
+}
+
+func TestIntrospection_Enum(t *testing.T) {
+	out := introspect(t, `{ __type(name: "__TypeKind") { kind enumValues(includeDeprecated: false) { name isDeprecated } } }`)
+	expected := `{"data":{"__type":{"kind":"ENUM","enumValues":[` +
+		`{"name":"SCALAR","isDeprecated":false},{"name":"OBJECT","isDeprecated":false},{"name":"INTERFACE","isDeprecated":false},` +
+		`{"name":"UNION","isDeprecated":false},{"name":"ENUM","isDeprecated":false},{"name":"INPUT_OBJECT","isDeprecated":false},` +
+		`{"name":"LIST","isDeprecated":false},{"name":"NON_NULL","isDeprecated":false}]}}}`
+	if out != expected {
+		t.Errorf("Unexpected response:\n%v\nexpected:\n%v", out, expected)
+	}
+}
+
+func TestIntrospection_Directives(t *testing.T) {
+	out := introspect(t, `query ($full: Boolean!) { __type(name: "Shelf") { name fields @include(if: $full) { name } } }`)
+	if out != `{"errors":[{"message":"Variable \"$full\" of required type Boolean! was not provided.","locations":[{"line":1,"column":8}]}]}` {
+		t.Errorf("Unexpected response: %v", out)
+	}
+	out = introspect(t, `{ __type(name: "Shelf") { name fields @skip(if: true) { name } } }`)
+	if out != `{"data":{"__type":{"name":"Shelf"}}}` {
+		t.Errorf("Unexpected response: %v", out)
+	}
+}
@@ -0,0 +1,270 @@
+package graphql
+
+import (
+	"sort"
+	"strings"
+)
+
+// The objects of introspection (https://spec.graphql.org/October2021/#sec-Schema-Introspection), their sources
+// are the descriptions of the schema built by introspect.
+var (
+	schemaObject     = &Object{Name: "__Schema"}
+	typeObject       = &Object{Name: "__Type"}
+	fieldObject      = &Object{Name: "__Field"}
+	inputValueObject = &Object{Name: "__InputValue"}
+	enumValueObject  = &Object{Name: "__EnumValue"}
+	directiveObject  = &Object{Name: "__Directive"}
+)
+
+// introspectionEnums are the enums of introspection by name along with their values.
+var introspectionEnums = map[string][]string{
+	"__TypeKind": {"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"},
+	"__DirectiveLocation": {"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD",
+		"INLINE_FRAGMENT", "VARIABLE_DEFINITION", "SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION",
+		"INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION"},
+}
+
+func init() {
+	schemaObject.Fields = Fields{
+		"description":      {Scalar: "String"},
+		"types":            {Type: typeObject, List: true},
+		"queryType":        {Type: typeObject},
+		"mutationType":     {Type: typeObject},
+		"subscriptionType": {Type: typeObject},
+		"directives":       {Type: directiveObject, List: true},
+	}
+	typeObject.Fields = Fields{
+		"kind":        {Scalar: "__TypeKind!"},
+		"name":        {Scalar: "String"},
+		"description": {Scalar: "String"},
+		"fields": {Type: fieldObject, List: true, Args: map[string]string{"includeDeprecated": "Boolean"}, Resolve: func(p Params) (interface{}, error) {
+			return p.Source.(*typeInfo).fields(), nil
+		}},
+		"interfaces": {Type: typeObject, List: true, Resolve: func(p Params) (interface{}, error) {
+			if p.Source.(*typeInfo).object == nil {
+				return nil, nil
+			}
+			return []*typeInfo{}, nil
+		}},
+		"possibleTypes":  {Type: typeObject, List: true, Resolve: resolveNull},
+		"enumValues":     {Type: enumValueObject, List: true, Args: map[string]string{"includeDeprecated": "Boolean"}},
+		"inputFields":    {Type: inputValueObject, List: true, Resolve: resolveNull},
+		"ofType":         {Type: typeObject},
+		"specifiedByURL": {Scalar: "String", Resolve: resolveNull},
+	}
+	fieldObject.Fields = Fields{
+		"name":              {Scalar: "String!"},
+		"description":       {Scalar: "String"},
+		"args":              {Type: inputValueObject, List: true},
+		"type":              {Type: typeObject},
+		"isDeprecated":      {Scalar: "Boolean!"},
+		"deprecationReason": {Scalar: "String"},
+	}
+	inputValueObject.Fields = Fields{
+		"name":         {Scalar: "String!"},
+		"description":  {Scalar: "String"},
+		"type":         {Type: typeObject},
+		"defaultValue": {Scalar: "String"},
+	}
+	enumValueObject.Fields = Fields{
+		"name":              {Scalar: "String!"},
+		"description":       {Scalar: "String"},
+		"isDeprecated":      {Scalar: "Boolean!"},
+		"deprecationReason": {Scalar: "String"},
+	}
+	directiveObject.Fields = Fields{
+		"name":         {Scalar: "String!"},
+		"description":  {Scalar: "String"},
+		"locations":    {Scalar: "[__DirectiveLocation!]!"},
+		"args":         {Type: inputValueObject, List: true},
+		"isRepeatable": {Scalar: "Boolean!"},
+	}
+}
+
+func resolveNull(p Params) (interface{}, error) {
+	return nil, nil
+}
+
+// field is the field of an object by name, nil when the object has no such field. The root of the query also has
+// the __schema and __type fields introspecting the schema.
+func (s Schema) field(object *Object, name string) *Field {
+	if object == s.Query {
+		switch name {
+		case "__schema":
+			return &Field{Type: schemaObject, Resolve: func(p Params) (interface{}, error) {
+				return introspect(s), nil
+			}}
+		case "__type":
+			return &Field{Type: typeObject, Args: map[string]string{"name": "String!"}, Resolve: func(p Params) (interface{}, error) {
+				return introspect(s).named[p.Args["name"].(string)], nil
+			}}
+		}
+	}
+	return object.Fields[name]
+}
+
+// typeName is the type of the value of a field, written as the types of Args.
+func (f *Field) typeName() string {
+	switch {
+	case f.Type == nil && f.Scalar == "":
+		return "JSON"
+	case f.Type == nil:
+		return f.Scalar
+	case f.List:
+		return "[" + f.Type.Name + "]"
+	}
+	return f.Type.Name
+}
+
+// schemaInfo describes a schema, the source of __Schema.
+type schemaInfo struct {
+	Description      *string          `json:"description"`
+	Types            []*typeInfo      `json:"types"`
+	QueryType        *typeInfo        `json:"queryType"`
+	MutationType     *typeInfo        `json:"mutationType"`
+	SubscriptionType *typeInfo        `json:"subscriptionType"`
+	Directives       []*directiveInfo `json:"directives"`
+	// named are the named types by name
+	named map[string]*typeInfo
+}
+
+// typeInfo describes a type, the source of __Type. Types are named, or lists and non-null types of another type.
+type typeInfo struct {
+	Kind        string           `json:"kind"`
+	Name        *string          `json:"name"`
+	Description *string          `json:"description"`
+	EnumValues  []*enumValueInfo `json:"enumValues"`
+	OfType      *typeInfo        `json:"ofType"`
+	object      *Object
+	schema      *schemaInfo
+}
+
+// fieldInfo describes a field of an object type, the source of __Field.
+type fieldInfo struct {
+	Name              string       `json:"name"`
+	Description       *string      `json:"description"`
+	Args              []*inputInfo `json:"args"`
+	Type              *typeInfo    `json:"type"`
+	IsDeprecated      bool         `json:"isDeprecated"`
+	DeprecationReason *string      `json:"deprecationReason"`
+}
+
+// inputInfo describes an argument, the source of __InputValue.
+type inputInfo struct {
+	Name         string    `json:"name"`
+	Description  *string   `json:"description"`
+	Type         *typeInfo `json:"type"`
+	DefaultValue *string   `json:"defaultValue"`
+}
+
+// enumValueInfo describes a value of an enum, the source of __EnumValue.
+type enumValueInfo struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+// directiveInfo describes a directive, the source of __Directive.
+type directiveInfo struct {
+	Name         string       `json:"name"`
+	Description  *string      `json:"description"`
+	Locations    []string     `json:"locations"`
+	Args         []*inputInfo `json:"args"`
+	IsRepeatable bool         `json:"isRepeatable"`
+}
+
+// introspect describes a schema: the object types reachable from the root of the query, the types of introspection,
+// the scalars (fields without a Scalar type being of the JSON scalar) and the @include and @skip directives.
+func introspect(schema Schema) *schemaInfo {
+	s := &schemaInfo{named: make(map[string]*typeInfo)}
+	for _, name := range []string{"Boolean", "Float", "ID", "Int", "String"} {
+		s.add(&typeInfo{Kind: "SCALAR"}, name)
+	}
+	for name, values := range introspectionEnums {
+		enum := s.add(&typeInfo{Kind: "ENUM"}, name)
+		for _, value := range values {
+			enum.EnumValues = append(enum.EnumValues, &enumValueInfo{Name: value})
+		}
+	}
+	s.object(schemaObject)
+	s.QueryType = s.object(schema.Query)
+	sort.Slice(s.Types, func(i, j int) bool {
+		return *s.Types[i].Name < *s.Types[j].Name
+	})
+	for _, name := range []string{"include", "skip"} {
+		s.Directives = append(s.Directives, &directiveInfo{
+			Name:      name,
+			Locations: []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+			Args:      s.inputs(map[string]string{"if": "Boolean!"}),
+		})
+	}
+	return s
+}
+
+func (s *schemaInfo) add(t *typeInfo, name string) *typeInfo {
+	t.Name = &name
+	t.schema = s
+	s.named[name] = t
+	s.Types = append(s.Types, t)
+	return t
+}
+
+// object adds an object type along with the types of its fields and their arguments.
+func (s *schemaInfo) object(object *Object) *typeInfo {
+	if t, ok := s.named[object.Name]; ok {
+		return t
+	}
+	t := s.add(&typeInfo{Kind: "OBJECT", object: object}, object.Name)
+	for _, field := range object.Fields {
+		if field.Type != nil {
+			s.object(field.Type)
+		}
+		s.ref(field.typeName())
+		for _, typ := range field.Args {
+			s.ref(typ)
+		}
+	}
+	return t
+}
+
+// ref is the type written as the types of Args, ie: [ID!]!, unknown names are added as scalars.
+func (s *schemaInfo) ref(typ string) *typeInfo {
+	if strings.HasSuffix(typ, "!") {
+		return &typeInfo{Kind: "NON_NULL", OfType: s.ref(strings.TrimSuffix(typ, "!")), schema: s}
+	}
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		return &typeInfo{Kind: "LIST", OfType: s.ref(typ[1 : len(typ)-1]), schema: s}
+	}
+	if t, ok := s.named[typ]; ok {
+		return t
+	}
+	return s.add(&typeInfo{Kind: "SCALAR"}, typ)
+}
+
+// inputs describes arguments, sorted by name.
+func (s *schemaInfo) inputs(args map[string]string) []*inputInfo {
+	inputs := make([]*inputInfo, 0, len(args))
+	for name, typ := range args {
+		inputs = append(inputs, &inputInfo{Name: name, Type: s.ref(typ)})
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].Name < inputs[j].Name
+	})
+	return inputs
+}
+
+// fields describes the fields of an object type sorted by name, nil for other types.
+func (t *typeInfo) fields() []*fieldInfo {
+	if t.object == nil {
+		return nil
+	}
+	fields := make([]*fieldInfo, 0, len(t.object.Fields))
+	for name, field := range t.object.Fields {
+		fields = append(fields, &fieldInfo{Name: name, Args: t.schema.inputs(field.Args), Type: t.schema.ref(field.typeName())})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
@@ -0,0 +1,54 @@
+package graphql
+
+// BatchFunc retrieves the values of several keys at once, keys without a value resolve to nil.
+type BatchFunc func(keys []int64) (map[int64]interface{}, error)
+
+// Loader batches the retrievals of values by key. Resolvers return the thunk of the key they need (see Load),
+// the values of every key loaded while a level of the response is resolved are retrieved by a single call of the
+// BatchFunc once the first of them is needed. Values are kept for the rest of the request.
+// A loader serves a single request, it is not safe for concurrent use.
+type Loader struct {
+	batch   BatchFunc
+	queue   []int64
+	pending map[int64]bool
+	loaded  map[int64]loaded
+}
+
+type loaded struct {
+	value interface{}
+	err   error
+}
+
+// NewLoader constructs a loader retrieving values with a BatchFunc.
+func NewLoader(batch BatchFunc) *Loader {
+	return &Loader{batch: batch, pending: make(map[int64]bool), loaded: make(map[int64]loaded)}
+}
+
+// Load queues the retrieval of a key, the value is retrieved along with the other keys queued once the thunk is called.
+func (l *Loader) Load(key int64) Thunk {
+	if _, ok := l.loaded[key]; !ok && !l.pending[key] {
+		l.queue = append(l.queue, key)
+		l.pending[key] = true
+	}
+	return func() (interface{}, error) {
+		if _, ok := l.loaded[key]; !ok {
+			l.dispatch()
+		}
+		result := l.loaded[key]
+		return result.value, result.err
+	}
+}
+
+// dispatch retrieves the values of the queued keys.
+func (l *Loader) dispatch() {
+	keys := l.queue
+	l.queue = nil
+	if len(keys) == 0 {
+		return
+	}
+	values, err := l.batch(keys)
+	for _, key := range keys {
+		l.loaded[key] = loaded{value: values[key], err: err}
+		delete(l.pending, key)
+	}
+}
@@ -0,0 +1,736 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed request of operations and the fragments they spread.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query, mutation or subscription of a document.
+type Operation struct {
+	// Type is query, mutation or subscription
+	Type         string
+	Name         string
+	Variables    []VariableDefinition
+	SelectionSet []Selection
+	Location     Location
+}
+
+// VariableDefinition declares a variable of an operation, its type is written as in the query, ie: [ID!]!
+type VariableDefinition struct {
+	Name     string
+	Type     string
+	Default  Value
+	Location Location
+}
+
+// Selection is a *FieldSelection, a *FragmentSpread or an *InlineFragment.
+type Selection interface{}
+
+// FieldSelection selects a field of an object, its response key is its alias when it has one.
+type FieldSelection struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]Value
+	Directives   []Directive
+	SelectionSet []Selection
+	Location     Location
+}
+
+// ResponseKey is the key of the field in the response.
+func (f *FieldSelection) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// FragmentSpread selects the fields of a named fragment.
+type FragmentSpread struct {
+	Name       string
+	Directives []Directive
+	Location   Location
+}
+
+// InlineFragment selects fields, of objects of a type when it has a type condition.
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []Directive
+	SelectionSet  []Selection
+	Location      Location
+}
+
+// Fragment is a named selection of fields of a type.
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []Selection
+	Location      Location
+}
+
+// Directive annotates a selection, ie: @include(if: $expanded)
+type Directive struct {
+	Name      string
+	Arguments map[string]Value
+}
+
+// Value is a literal of a query: nil, int64, float64, string, bool, Enum, Variable, []Value or map[string]Value.
+// Values of variables decoded from JSON are values as well.
+type Value = interface{}
+
+// Enum is an enum literal.
+type Enum string
+
+// Variable refers to a variable of the operation.
+type Variable string
+
+// Location is a position in a query, lines and columns start at 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// The kinds of tokens
+const (
+	tokenEOF = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind     int
+	value    string
+	location Location
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "<EOF>"
+	case tokenString:
+		return strconv.Quote(t.value)
+	}
+	return `"` + t.value + `"`
+}
+
+type lexer struct {
+	source string
+	pos    int
+	line   int
+	// lineStart is the position of the start of the line
+	lineStart int
+}
+
+// next reads the following token, skipping whitespace, commas and comments.
+func (l *lexer) next() (token, error) {
+skip:
+	for l.pos < len(l.source) {
+		switch c := l.source[l.pos]; {
+		case c == '\n':
+			l.pos++
+			l.line++
+			l.lineStart = l.pos
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			break skip
+		}
+	}
+	location := Location{Line: l.line, Column: l.pos - l.lineStart + 1}
+	if l.pos >= len(l.source) {
+		return token{kind: tokenEOF, location: location}, nil
+	}
+	c := l.source[l.pos]
+	switch {
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunctuator, value: string(c), location: location}, nil
+	case c == '.':
+		if strings.HasPrefix(l.source[l.pos:], "...") {
+			l.pos += 3
+			return token{kind: tokenPunctuator, value: "...", location: location}, nil
+		}
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || isLetter(l.source[l.pos]) || isDigit(l.source[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.source[start:l.pos], location: location}, nil
+	case c == '-' || isDigit(c):
+		return l.number(location)
+	case c == '"':
+		return l.string(location)
+	}
+	r, _ := utf8.DecodeRuneInString(l.source[l.pos:])
+	return token{}, syntaxError(location, "Unexpected character %q.", r)
+}
+
+func (l *lexer) number(location Location) (token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.source[l.pos] == '-' {
+		l.pos++
+	}
+	// digits reads at least one digit
+	digits := func() bool {
+		from := l.pos
+		for l.pos < len(l.source) && isDigit(l.source[l.pos]) {
+			l.pos++
+		}
+		return l.pos > from
+	}
+	integer := l.pos
+	valid := digits() && (l.source[integer] != '0' || l.pos == integer+1)
+	if l.pos < len(l.source) && l.source[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		valid = digits() && valid
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == 'e' || l.source[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.source) && (l.source[l.pos] == '+' || l.source[l.pos] == '-') {
+			l.pos++
+		}
+		valid = digits() && valid
+	}
+	// A number may not be followed by a name or a dot, ie: 1a or 1.2.3
+	for l.pos < len(l.source) && (l.source[l.pos] == '.' || l.source[l.pos] == '_' || isLetter(l.source[l.pos]) || isDigit(l.source[l.pos])) {
+		valid = false
+		l.pos++
+	}
+	value := l.source[start:l.pos]
+	if !valid {
+		return token{}, syntaxError(location, "Invalid number %v.", value)
+	}
+	var err error
+	if kind == tokenInt {
+		_, err = strconv.ParseInt(value, 10, 64)
+	} else {
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return token{}, syntaxError(location, "Invalid number %v.", value)
+	}
+	return token{kind: kind, value: value, location: location}, nil
+}
+
+func (l *lexer) string(location Location) (token, error) {
+	if strings.HasPrefix(l.source[l.pos:], `"""`) {
+		start := l.pos + 3
+		for end := start; end < len(l.source); end++ {
+			switch {
+			case strings.HasPrefix(l.source[end:], `\"""`):
+				end += 3
+			case strings.HasPrefix(l.source[end:], `"""`):
+				l.pos = end + 3
+				return token{kind: tokenString, value: blockString(l.source[start:end]), location: location}, nil
+			case l.source[end] == '\n':
+				l.line++
+				l.lineStart = end + 1
+			}
+		}
+		return token{}, syntaxError(location, "Unterminated string.")
+	}
+	var value strings.Builder
+	l.pos++
+	for l.pos < len(l.source) {
+		c := l.source[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{kind: tokenString, value: value.String(), location: location}, nil
+		case c == '\n':
+			return token{}, syntaxError(location, "Unterminated string.")
+		case c == '\\' && l.pos+1 < len(l.source):
+			escaped := l.source[l.pos+1]
+			l.pos += 2
+			switch escaped {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			case 'b':
+				value.WriteByte('\b')
+			case 'f':
+				value.WriteByte('\f')
+			case 'u':
+				if l.pos+4 > len(l.source) {
+					return token{}, syntaxError(location, "Invalid unicode escape.")
+				}
+				code, err := strconv.ParseUint(l.source[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return token{}, syntaxError(location, "Invalid unicode escape.")
+				}
+				value.WriteRune(rune(code))
+				l.pos += 4
+			case '"', '\\', '/':
+				value.WriteByte(escaped)
+			default:
+				return token{}, syntaxError(location, "Invalid escape \\%c.", escaped)
+			}
+		default:
+			value.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, syntaxError(location, "Unterminated string.")
+}
+
+// blockString is the value of the raw content of a block string: escaped triple quotes are unescaped, the indentation
+// common to the lines following the first is removed as are the leading and trailing blank lines.
+func blockString(raw string) string {
+	raw = strings.ReplaceAll(raw, `\"""`, `"""`)
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(raw), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) < indent {
+				lines[i] = ""
+			} else {
+				lines[i] = lines[i][indent:]
+			}
+		}
+	}
+	blank := func(line string) bool {
+		return strings.TrimLeft(line, " \t") == ""
+	}
+	for len(lines) > 0 && blank(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && blank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func syntaxError(location Location, format string, args ...interface{}) *Error {
+	return &Error{Message: "Syntax Error: " + fmt.Sprintf(format, args...), Locations: []Location{location}}
+}
+
+type parser struct {
+	lexer lexer
+	token token
+}
+
+// Parse reads a query document (see https://spec.graphql.org), syntax errors are returned as an *Error.
+// Type system definitions are not supported.
+func Parse(query string) (*Document, error) {
+	p := &parser{lexer: lexer{source: query, line: 1}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek("{"):
+			operation := &Operation{Type: "query", Location: p.token.location}
+			var err error
+			if operation.SelectionSet, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, operation)
+		case p.peekName("query") || p.peekName("mutation") || p.peekName("subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, operation)
+		case p.peekName("fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[fragment.Name]; ok {
+				return nil, &Error{Message: fmt.Sprintf("There can be only one fragment named %q.", fragment.Name), Locations: []Location{fragment.Location}}
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, &Error{Message: "The document has no operation."}
+	}
+	names := make(map[string]bool, len(doc.Operations))
+	for _, operation := range doc.Operations {
+		if operation.Name == "" && len(doc.Operations) > 1 {
+			return nil, &Error{Message: "This anonymous operation must be the only defined operation.", Locations: []Location{operation.Location}}
+		}
+		if names[operation.Name] {
+			return nil, &Error{Message: fmt.Sprintf("There can be only one operation named %q.", operation.Name), Locations: []Location{operation.Location}}
+		}
+		names[operation.Name] = true
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	var err error
+	p.token, err = p.lexer.next()
+	return err
+}
+
+func (p *parser) peek(punctuator string) bool {
+	return p.token.kind == tokenPunctuator && p.token.value == punctuator
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.token.kind == tokenName && p.token.value == name
+}
+
+func (p *parser) unexpected() error {
+	return syntaxError(p.token.location, "Unexpected %v.", p.token)
+}
+
+// skip advances past a punctuator when it is the current token.
+func (p *parser) skip(punctuator string) (bool, error) {
+	if !p.peek(punctuator) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(punctuator string) error {
+	if !p.peek(punctuator) {
+		return syntaxError(p.token.location, "Expected %q, found %v.", punctuator, p.token)
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", syntaxError(p.token.location, "Expected Name, found %v.", p.token)
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	operation := &Operation{Type: p.token.value, Location: p.token.location}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.token.kind == tokenName {
+		if operation.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if operation.Variables, err = p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = p.directives(); err != nil {
+		return nil, err
+	}
+	operation.SelectionSet, err = p.selectionSet()
+	return operation, err
+}
+
+func (p *parser) variableDefinitions() ([]VariableDefinition, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var definitions []VariableDefinition
+	for !p.peek(")") {
+		definition := VariableDefinition{Location: p.token.location}
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		var err error
+		if definition.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if definition.Type, err = p.typeReference(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip("="); err != nil {
+			return nil, err
+		} else if ok {
+			if definition.Default, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = p.directives(); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, p.advance()
+}
+
+func (p *parser) typeReference() (string, error) {
+	var typ string
+	if ok, err := p.skip("["); err != nil {
+		return "", err
+	} else if ok {
+		inner, err := p.typeReference()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if ok, err := p.skip("!"); err != nil {
+		return "", err
+	} else if ok {
+		typ += "!"
+	}
+	return typ, nil
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	fragment := &Fragment{Location: p.token.location}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if fragment.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, syntaxError(fragment.Location, "Unexpected Name \"on\".")
+	}
+	if !p.peekName("on") {
+		return nil, syntaxError(p.token.location, "Expected \"on\", found %v.", p.token)
+	}
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if _, err = p.directives(); err != nil {
+		return nil, err
+	}
+	fragment.SelectionSet, err = p.selectionSet()
+	return fragment, err
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var selections []Selection
+	for !p.peek("}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	if len(selections) == 0 {
+		return nil, syntaxError(p.token.location, "Expected Name, found \"}\".")
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (Selection, error) {
+	location := p.token.location
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		if p.token.kind == tokenName && !p.peekName("on") {
+			spread := &FragmentSpread{Location: location}
+			if spread.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			spread.Directives, err = p.directives()
+			return spread, err
+		}
+		fragment := &InlineFragment{Location: location}
+		if p.peekName("on") {
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+			if fragment.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if fragment.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		fragment.SelectionSet, err = p.selectionSet()
+		return fragment, err
+	}
+	field := &FieldSelection{Location: location}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		field.Alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	field.Name = name
+	if p.peek("(") {
+		if field.Arguments, err = p.arguments(); err != nil {
+			return nil, err
+		}
+	}
+	if field.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek("{") {
+		field.SelectionSet, err = p.selectionSet()
+	}
+	return field, err
+}
+
+func (p *parser) arguments() (map[string]Value, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arguments := make(map[string]Value)
+	for !p.peek(")") {
+		location := p.token.location
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := arguments[name]; ok {
+			return nil, &Error{Message: fmt.Sprintf("There can be only one argument named %q.", name), Locations: []Location{location}}
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if arguments[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return arguments, p.advance()
+}
+
+func (p *parser) directives() ([]Directive, error) {
+	var directives []Directive
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		directive := Directive{Name: name}
+		if p.peek("(") {
+			if directive.Arguments, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value reads a literal, constant literals may not refer to variables.
+func (p *parser) value(constant bool) (Value, error) {
+	t := p.token
+	switch {
+	case p.peek("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := make([]Value, 0)
+		for !p.peek("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		object := make(map[string]Value)
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.advance()
+	case t.kind == tokenInt:
+		value, _ := strconv.ParseInt(t.value, 10, 64)
+		return value, p.advance()
+	case t.kind == tokenFloat:
+		value, _ := strconv.ParseFloat(t.value, 64)
+		return value, p.advance()
+	case t.kind == tokenString:
+		return t.value, p.advance()
+	case t.kind == tokenName:
+		var value Value
+		switch t.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = Enum(t.value)
+		}
+		return value, p.advance()
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,304 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// validator checks an operation against a schema before it is executed.
+type validator struct {
+	schema    Schema
+	fragments map[string]*Fragment
+	// variables are the types of the variables of the operation by name
+	variables map[string]string
+	// defaulted are the variables with a default value, they may be given in place of non-null values
+	defaulted map[string]bool
+	// used are the variables the operation refers to
+	used map[string]bool
+	// types are the types of the schema, described once a fragment condition is checked against them
+	types *schemaInfo
+	// spreading are the fragments being validated, to detect cycles
+	spreading map[string]bool
+	// fields counts the fields selected, fragments are counted every time they are spread
+	fields int
+	errors []*Error
+}
+
+// validate reports the fields, arguments, variables, fragments and directives of an operation that are unknown or
+// misused, as well as selections nested deeper or selecting more fields than allowed.
+func validate(schema Schema, doc *Document, operation *Operation) []*Error {
+	v := &validator{
+		schema:    schema,
+		fragments: doc.Fragments,
+		variables: make(map[string]string),
+		defaulted: make(map[string]bool),
+		used:      make(map[string]bool),
+		spreading: make(map[string]bool),
+	}
+	for _, definition := range operation.Variables {
+		if _, ok := v.variables[definition.Name]; ok {
+			v.report(definition.Location, "There can be only one variable named \"$%v\".", definition.Name)
+		}
+		v.variables[definition.Name] = definition.Type
+		v.defaulted[definition.Name] = definition.Default != nil
+		if !knownType(definition.Type) {
+			v.report(definition.Location, "Variable \"$%v\" has an unknown type %v.", definition.Name, definition.Type)
+		}
+	}
+	v.selections(schema.Query, operation.SelectionSet, 1)
+	// Selections past the limits are not validated, their variables would be reported as unused
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	for _, definition := range operation.Variables {
+		if !v.used[definition.Name] {
+			v.report(definition.Location, "Variable \"$%v\" is never used.", definition.Name)
+		}
+	}
+	spread := make(map[string]bool)
+	for _, operation := range doc.Operations {
+		spreads(doc, operation.SelectionSet, spread)
+	}
+	names := make([]string, 0, len(doc.Fragments))
+	for name := range doc.Fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !spread[name] {
+			v.report(doc.Fragments[name].Location, "Fragment %q is never used.", name)
+		}
+	}
+	return v.errors
+}
+
+// spreads adds the fragments spread by selections, directly or by the fragments they spread.
+func spreads(doc *Document, selections []Selection, spread map[string]bool) {
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *FieldSelection:
+			spreads(doc, selection.SelectionSet, spread)
+		case *InlineFragment:
+			spreads(doc, selection.SelectionSet, spread)
+		case *FragmentSpread:
+			if fragment, ok := doc.Fragments[selection.Name]; ok && !spread[selection.Name] {
+				spread[selection.Name] = true
+				spreads(doc, fragment.SelectionSet, spread)
+			}
+		}
+	}
+}
+
+func (v *validator) report(location Location, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{location}})
+}
+
+func (v *validator) selections(object *Object, selections []Selection, depth int) {
+	// The objects of introspection describe the schema, however deep they are nested (ie: the types wrapped by a type)
+	if v.schema.MaxDepth > 0 && depth > v.schema.MaxDepth && !strings.HasPrefix(object.Name, "__") {
+		if len(selections) > 0 {
+			v.report(locationOf(selections[0]), "The query is nested deeper than %v fields.", v.schema.MaxDepth)
+		}
+		return
+	}
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *FieldSelection:
+			v.directives(selection.Directives, selection.Location)
+			v.field(object, selection, depth)
+		case *InlineFragment:
+			v.directives(selection.Directives, selection.Location)
+			if v.applies(object, selection.TypeCondition, selection.Location) {
+				v.selections(object, selection.SelectionSet, depth)
+			}
+		case *FragmentSpread:
+			v.directives(selection.Directives, selection.Location)
+			fragment, ok := v.fragments[selection.Name]
+			if !ok {
+				v.report(selection.Location, "Unknown fragment %q.", selection.Name)
+				continue
+			}
+			if v.spreading[fragment.Name] {
+				v.report(selection.Location, "Cannot spread fragment %q within itself.", fragment.Name)
+				continue
+			}
+			if v.applies(object, fragment.TypeCondition, selection.Location) {
+				v.spreading[fragment.Name] = true
+				v.selections(object, fragment.SelectionSet, depth)
+				delete(v.spreading, fragment.Name)
+			}
+		}
+	}
+}
+
+// applies reports whether a fragment with a type condition may be spread within the selection of an object.
+func (v *validator) applies(object *Object, typeCondition string, location Location) bool {
+	if typeCondition == "" || typeCondition == object.Name {
+		return true
+	}
+	if v.types == nil {
+		v.types = introspect(v.schema)
+	}
+	switch t, ok := v.types.named[typeCondition]; {
+	case !ok:
+		v.report(location, "Unknown type %q.", typeCondition)
+	case t.object == nil:
+		v.report(location, "Fragment cannot condition on non composite type %q.", typeCondition)
+	default:
+		v.report(location, "Fragment cannot be spread here as objects of type %q can never be of type %q.", object.Name, typeCondition)
+	}
+	return false
+}
+
+func (v *validator) field(object *Object, selection *FieldSelection, depth int) {
+	v.fields++
+	if v.schema.MaxFields > 0 && v.fields > v.schema.MaxFields {
+		if v.fields == v.schema.MaxFields+1 {
+			v.report(selection.Location, "The query selects more than %v fields.", v.schema.MaxFields)
+		}
+		return
+	}
+	if selection.Name == "__typename" {
+		if len(selection.Arguments) > 0 || selection.SelectionSet != nil {
+			v.report(selection.Location, "Field \"__typename\" has no arguments or subfields.")
+		}
+		return
+	}
+	field := v.schema.field(object, selection.Name)
+	if field == nil {
+		v.report(selection.Location, "Cannot query field %q on type %q.", selection.Name, object.Name)
+		return
+	}
+	for name, value := range selection.Arguments {
+		v.values(value, selection.Location)
+		typ, ok := field.Args[name]
+		if !ok {
+			v.report(selection.Location, "Unknown argument %q on field %q of type %q.", name, selection.Name, object.Name)
+		} else if value != nil {
+			v.argument(fmt.Sprintf("Argument %q", name), typ, value, selection.Location)
+		}
+	}
+	for name, typ := range field.Args {
+		value, ok := selection.Arguments[name]
+		if strings.HasSuffix(typ, "!") && (!ok || value == nil) {
+			v.report(selection.Location, "Field %q argument %q of type %v is required but not provided.", selection.Name, name, typ)
+		}
+	}
+	switch {
+	case field.Type != nil && selection.SelectionSet == nil:
+		v.report(selection.Location, "Field %q of type %q must have a selection of subfields.", selection.Name, field.Type.Name)
+	case field.Type == nil && selection.SelectionSet != nil:
+		v.report(selection.Location, "Field %q must not have a selection since it has no subfields.", selection.Name)
+	case field.Type != nil:
+		v.selections(field.Type, selection.SelectionSet, depth+1)
+	}
+}
+
+func (v *validator) directives(directives []Directive, location Location) {
+	for _, directive := range directives {
+		if directive.Name != "include" && directive.Name != "skip" {
+			v.report(location, "Unknown directive \"@%v\".", directive.Name)
+			continue
+		}
+		value, ok := directive.Arguments["if"]
+		if !ok || len(directive.Arguments) != 1 {
+			v.report(location, "Directive \"@%v\" takes a single argument \"if\" of type Boolean!.", directive.Name)
+			continue
+		}
+		v.values(value, location)
+		v.argument(fmt.Sprintf("Directive \"@%v\" argument \"if\"", directive.Name), "Boolean!", value, location)
+	}
+}
+
+// argument reports the literals given to an argument that can not be coerced to its type, and the variables of a
+// type that may not be used in its place.
+func (v *validator) argument(name string, typ string, value Value, location Location) {
+	switch value := value.(type) {
+	case Variable:
+		variableType, ok := v.variables[string(value)]
+		if !ok {
+			return
+		}
+		// A variable with a default value is never null
+		given := variableType
+		if v.defaulted[string(value)] && !strings.HasSuffix(given, "!") {
+			given += "!"
+		}
+		if !compatible(given, typ) {
+			v.report(location, "Variable \"$%v\" of type %v used in position expecting type %v.", value, variableType, typ)
+		}
+		return
+	case []Value:
+		if list := strings.TrimSuffix(typ, "!"); strings.HasPrefix(list, "[") {
+			for _, item := range value {
+				v.argument(name, list[1:len(list)-1], item, location)
+			}
+			return
+		}
+	}
+	if _, err := coerce(typ, value, nil); err != nil {
+		v.report(location, "%v has an invalid value: %v.", name, err)
+	}
+}
+
+// values reports the variables of a value that are not defined by the operation.
+func (v *validator) values(value Value, location Location) {
+	switch value := value.(type) {
+	case Variable:
+		v.used[string(value)] = true
+		if _, ok := v.variables[string(value)]; !ok {
+			v.report(location, "Variable \"$%v\" is not defined.", value)
+		}
+	case []Value:
+		for _, item := range value {
+			v.values(item, location)
+		}
+	case map[string]Value:
+		for _, item := range value {
+			v.values(item, location)
+		}
+	}
+}
+
+// knownType reports whether a type of variables is a scalar or a list of scalars.
+func knownType(typ string) bool {
+	typ = strings.TrimSuffix(typ, "!")
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		return knownType(typ[1 : len(typ)-1])
+	}
+	switch typ {
+	case "Int", "Float", "String", "Boolean", "ID":
+		return true
+	}
+	return false
+}
+
+// compatible reports whether a variable of a type may be given in place of a value of another type.
+func compatible(variableType string, typ string) bool {
+	variableRequired, required := strings.HasSuffix(variableType, "!"), strings.HasSuffix(typ, "!")
+	if required && !variableRequired {
+		return false
+	}
+	variableType, typ = strings.TrimSuffix(variableType, "!"), strings.TrimSuffix(typ, "!")
+	variableList, list := strings.HasPrefix(variableType, "["), strings.HasPrefix(typ, "[")
+	if variableList != list {
+		return false
+	}
+	if list {
+		return compatible(variableType[1:len(variableType)-1], typ[1:len(typ)-1])
+	}
+	return variableType == typ
+}
+
+func locationOf(selection Selection) Location {
+	switch selection := selection.(type) {
+	case *FieldSelection:
+		return selection.Location
+	case *InlineFragment:
+		return selection.Location
+	case *FragmentSpread:
+		return selection.Location
+	}
+	return Location{}
+}
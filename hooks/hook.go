@@ -1,9 +1,15 @@
 package hooks
 
 import (
+	"github.com/cjsaylor/boxmeup-go/events"
 	"github.com/gorilla/mux"
 )
 
 type RouteHook interface {
 	Apply(router *mux.Router)
 }
+
+// EventHook is the optional symbol of plugins reacting to the events of the stores (see events.Bus).
+type EventHook interface {
+	Subscribe(bus *events.Bus)
+}
@@ -46,12 +46,12 @@ func AuthHandler(next http.Handler) http.Handler {
 		} else {
 			authHeader := req.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(res, "Authorization required.", 401)
+				WriteProblem(res, req, Unauthorized, "Authorization required.")
 				return
 			}
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				http.Error(res, "Authorization header must be in the form of: Bearer {token}", 401)
+				WriteProblem(res, req, Unauthorized, "Authorization header must be in the form of: Bearer {token}")
 				return
 			}
 			token = parts[1]
@@ -61,11 +61,11 @@ func AuthHandler(next http.Handler) http.Handler {
 			JWTSecret: config.Config.JWTSecret,
 		})
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			WriteProblem(res, req, Unauthorized, err.Error())
 			return
 		}
 		if req.Method != "GET" && sessionCookie != nil && req.Header.Get("x-xsrf-token") != claims["xsrfToken"] {
-			http.Error(res, "XSRF token mismatch!", http.StatusForbidden)
+			WriteProblem(res, req, XSRFMismatch, "XSRF token mismatch!")
 			return
 		}
 		var userKey userKey = "user"
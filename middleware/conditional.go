@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// SetETag tags a response with the version of the record it represents followed by a digest of its representation,
+// ie: "3-2fd4e1c67a2d28fc", as counts kept on a record (such as the items of a container) change without its version.
+// GET requests whose If-None-Match lists the tag are answered with 304 Not Modified (see ConditionalHandler),
+// requests changing the record may send it back as is in If-Match (see IfMatch).
+func SetETag(res http.ResponseWriter, record models.Versioned) {
+	body, _ := json.Marshal(record)
+	digest := sha1.Sum(body)
+	version, _ := strconv.Unquote(record.ETag())
+	res.Header().Set("ETag", strconv.Quote(fmt.Sprintf("%v-%x", version, digest[:8])))
+}
+
+// versionTag strips the digest of the representation from an entity tag set by SetETag, ie: "3-2fd4e1c67a2d28fc" is "3".
+func versionTag(etag string) string {
+	if i := strings.IndexByte(etag, '-'); i > 0 && strings.HasSuffix(etag, `"`) {
+		return etag[:i] + `"`
+	}
+	return etag
+}
+
+// IfMatch checks the If-Match precondition of a request changing a record (PUT, PATCH or DELETE).
+// It results in models.ErrPreconditionFailed unless the header is absent, is * or lists the version of the record,
+// only the version counts so the tag of any representation of that version matches.
+// Stores update records on the condition of the version they were retrieved with, so the record may
+// not change between this check and the update.
+func IfMatch(req *http.Request, record models.Versioned) error {
+	header := req.Header.Get("If-Match")
+	if header == "" || matchesETag(header, record.ETag(), false) {
+		return nil
+	}
+	return models.ErrPreconditionFailed
+}
+
+type recordKey struct{}
+
+// RecordLoader retrieves the record a request changes on behalf of the authenticated user (see PreconditionHandler).
+// Requests creating a record have none, the loader returns a nil record.
+type RecordLoader func(req *http.Request) (models.Versioned, error)
+
+// PreconditionHandler retrieves the record a request changes and checks the If-Match precondition of the request
+// against it (see IfMatch) before the request is handled, the record is then available with RecordFromRequest.
+// It must follow AuthHandler, failures are written as problems described by message.
+func PreconditionHandler(load RecordLoader, message string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(res http.ResponseWriter, req *http.Request) {
+			record, err := load(req)
+			if err == nil && record != nil {
+				err = IfMatch(req, record)
+			}
+			if err != nil {
+				WriteError(res, req, err, message)
+				return
+			}
+			next.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), recordKey{}, record)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RecordFromRequest is the record retrieved by PreconditionHandler, nil when the request has none.
+func RecordFromRequest(req *http.Request) models.Versioned {
+	record, _ := req.Context().Value(recordKey{}).(models.Versioned)
+	return record
+}
+
+// ConditionalHandler answers GET and HEAD requests with 304 Not Modified, without a body,
+// when the ETag of the response (see SetETag) is listed by the If-None-Match header of the request.
+func ConditionalHandler(next http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		if (req.Method != "GET" && req.Method != "HEAD") || req.Header.Get("If-None-Match") == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+		next.ServeHTTP(&conditionalWriter{ResponseWriter: res, ifNoneMatch: req.Header.Get("If-None-Match")}, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+type conditionalWriter struct {
+	http.ResponseWriter
+	ifNoneMatch string
+	wroteHeader bool
+	notModified bool
+}
+
+func (w *conditionalWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	etag := w.Header().Get("ETag")
+	if status == http.StatusOK && etag != "" && matchesETag(w.ifNoneMatch, etag, true) {
+		w.notModified = true
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Length")
+		status = http.StatusNotModified
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *conditionalWriter) Write(body []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notModified {
+		return len(body), nil
+	}
+	return w.ResponseWriter.Write(body)
+}
+
+// Flush lets streamed responses through.
+func (w *conditionalWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// matchesETag reports whether a list of entity tags (an If-Match or If-None-Match header) includes etag.
+// Weak comparison ignores the W/ prefix of weak tags and compares whole tags (If-None-Match),
+// strong comparison never matches weak tags and compares versions only (If-Match).
+func matchesETag(list string, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(candidate, "W/") || strings.HasPrefix(etag, "W/") {
+			continue
+		} else {
+			candidate = versionTag(candidate)
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
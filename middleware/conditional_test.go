@@ -0,0 +1,139 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+type record struct {
+	version int64
+}
+
+func (r record) ETag() string {
+	return models.ETag(r.version)
+}
+
+// countedRecord keeps a count that changes without its version.
+type countedRecord struct {
+	Version int64 `json:"version"`
+	Count   int   `json:"count"`
+}
+
+func (r countedRecord) ETag() string {
+	return models.ETag(r.Version)
+}
+
+func conditionalGet(ifNoneMatch string) *httptest.ResponseRecorder {
+	return conditionalGetRecord(ifNoneMatch, record{3})
+}
+
+func conditionalGetRecord(ifNoneMatch string, versioned models.Versioned) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/container/1", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	res := httptest.NewRecorder()
+	middleware.ConditionalHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		middleware.SetETag(res, versioned)
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte(`{"id": 1}`))
+	})).ServeHTTP(res, req)
+	return res
+}
+
+func TestConditionalGet(t *testing.T) {
+	res := conditionalGet("")
+	etag := res.Header().Get("ETag")
+	if res.Code != http.StatusOK || !strings.HasPrefix(etag, `"3-`) || res.Body.Len() == 0 {
+		t.Errorf("Unexpected response %v %v %q", res.Code, etag, res.Body.String())
+	}
+	res = conditionalGet(`"2", W/` + etag)
+	if res.Code != http.StatusNotModified || res.Body.Len() != 0 {
+		t.Errorf("Expected the response to be not modified but got %v %q", res.Code, res.Body.String())
+	}
+	res = conditionalGet(`"2"`)
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected the changed record to be sent but got %v", res.Code)
+	}
+	res = conditionalGet(`"3"`)
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected the bare version not to match a representation but got %v", res.Code)
+	}
+}
+
+func TestConditionalGet_CountChanged(t *testing.T) {
+	etag := conditionalGetRecord("", countedRecord{Version: 3, Count: 1}).Header().Get("ETag")
+	res := conditionalGetRecord(etag, countedRecord{Version: 3, Count: 2})
+	if res.Code != http.StatusOK || res.Header().Get("ETag") == etag {
+		t.Errorf("Expected a changed count to change the representation but got %v %v", res.Code, res.Header().Get("ETag"))
+	}
+	req := httptest.NewRequest("PUT", "/api/container/1", nil)
+	req.Header.Set("If-Match", etag)
+	if err := middleware.IfMatch(req, countedRecord{Version: 3, Count: 2}); err != nil {
+		t.Errorf("Expected the tag to match the unchanged version but got %v", err)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	cases := map[string]error{
+		"":                     nil,
+		"*":                    nil,
+		`"3"`:                  nil,
+		`"1", "3"`:             nil,
+		`"3-2fd4e1c67a2d28fc"`: nil,
+		`"2-2fd4e1c67a2d28fc"`: models.ErrPreconditionFailed,
+		`"2"`:                  models.ErrPreconditionFailed,
+		`W/"3"`:                models.ErrPreconditionFailed,
+	}
+	for header, expected := range cases {
+		req := httptest.NewRequest("PUT", "/api/container/1", nil)
+		req.Header.Set("If-Match", header)
+		if err := middleware.IfMatch(req, record{3}); err != expected {
+			t.Errorf("Expected %v for %q but got %v", expected, header, err)
+		}
+	}
+	_, problem := writeError(models.ErrPreconditionFailed)
+	if problem.Status != http.StatusPreconditionFailed || problem.Code != "precondition_failed" {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+}
+
+func TestPreconditionHandler(t *testing.T) {
+	load := func(req *http.Request) (models.Versioned, error) {
+		if req.URL.Path == "/api/container/2" {
+			return record{}, models.NewError(models.ErrNotFound, "container not found")
+		}
+		return record{3}, nil
+	}
+	cases := []struct {
+		path     string
+		ifMatch  string
+		expected int
+	}{
+		{"/api/container/1", "", http.StatusNoContent},
+		{"/api/container/1", `"3"`, http.StatusNoContent},
+		{"/api/container/1", `"2"`, http.StatusPreconditionFailed},
+		{"/api/container/2", `"3"`, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("PUT", c.path, nil)
+		if c.ifMatch != "" {
+			req.Header.Set("If-Match", c.ifMatch)
+		}
+		res := httptest.NewRecorder()
+		middleware.PreconditionHandler(load, "Unable to retrieve the container.")(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if middleware.RecordFromRequest(req) != (record{3}) {
+				t.Errorf("Expected the loaded record to be handed to the handler, got %v", middleware.RecordFromRequest(req))
+			}
+			res.WriteHeader(http.StatusNoContent)
+		})).ServeHTTP(res, req)
+		if res.Code != c.expected {
+			t.Errorf("Expected %v for %v with %q but got %v", c.expected, c.path, c.ifMatch, res.Code)
+		}
+	}
+}
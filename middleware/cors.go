@@ -7,6 +7,9 @@ import (
 	"github.com/rs/cors"
 )
 
+// UndoTokenHeader carries the token reversing the change made by a request (see POST /api/undo/{token})
+const UndoTokenHeader = "Undo-Token"
+
 func CORSHandler(next http.Handler) http.Handler {
 	return corsSetup().Handler(next)
 }
@@ -19,8 +22,9 @@ func corsSetup() *cors.Cors {
 	return cors.New(cors.Options{
 		AllowedOrigins:   config.Config.AllowedOrigin,
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-		AllowedHeaders:   []string{"X-Xsrf-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "X-Xsrf-Token", "If-Match", "If-None-Match", IdempotencyKeyHeader, RequestIDHeader, "Last-Event-ID"},
+		ExposedHeaders:   []string{"ETag", IdempotentReplayedHeader, RequestIDHeader, UndoTokenHeader},
 		MaxAge:           600,
 	})
 }
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+const (
+	// IdempotencyKeyHeader carries a key chosen by clients to identify a request, and its retries, uniquely
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks a response replayed from the first request made with an idempotency key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Errors of requests with an idempotency key
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with another request
+	ErrIdempotencyKeyReused error = &models.Error{Kind: models.ErrConflict, Code: "idempotency_key_reused", Message: "the idempotency key was used for another request"}
+	// ErrIdempotencyKeyInUse is returned when a key is sent again before the first request finished
+	ErrIdempotencyKeyInUse error = &models.Error{Kind: models.ErrConflict, Code: "idempotency_key_in_use", Message: "a request with the idempotency key is in progress"}
+)
+
+// maxIdempotentBody is the largest body of a request with an idempotency key, it is kept in memory to be fingerprinted.
+const maxIdempotentBody = 1 << 20
+
+var validIdempotencyKey = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// savedHeaders are the response headers replayed along with the status and body.
+var savedHeaders = []string{"Content-Type", "Location", "ETag", UndoTokenHeader}
+
+// SavedResponse is the first response to a request with an idempotency key.
+type SavedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore keeps the first response to requests with an idempotency key for each user.
+type IdempotencyStore interface {
+	// Reserve claims a key for a request, identified by its fingerprint, until ttl has passed.
+	// It returns nil when the key is claimed and the saved response when the key was used by the same request before.
+	// ErrIdempotencyKeyReused or ErrIdempotencyKeyInUse are returned otherwise.
+	Reserve(userID int64, key string, fingerprint string, ttl time.Duration) (*SavedResponse, error)
+	// Save records the response to the request that claimed a key.
+	Save(userID int64, key string, response SavedResponse) error
+	// Release gives up a claimed key so the request may be retried.
+	Release(userID int64, key string) error
+}
+
+// IdempotencyKeys stores the responses replayed by IdempotencyHandler, in the database unless replaced.
+var IdempotencyKeys IdempotencyStore = databaseIdempotencyStore{}
+
+// IdempotencyHandler replays the response to the first request made with an idempotency key, for the
+// configured TTL, so that clients may safely retry requests creating records.
+// The key is scoped to the user (it must follow AuthHandler) and may not be reused with another request,
+// requests without the header are served as usual. Server errors and panics are not saved, the request may be retried.
+func IdempotencyHandler(next http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+		if !validIdempotencyKey.MatchString(key) {
+			WriteProblem(res, req, BadRequest, "The idempotency key must be 1 to 255 visible characters.")
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(res, req.Body, maxIdempotentBody))
+		if err != nil {
+			WriteProblem(res, req, PayloadTooLarge, "Requests with an idempotency key are limited to 1MB.")
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		userID := UserIDFromRequest(req)
+		saved, err := IdempotencyKeys.Reserve(userID, key, fingerprint(req, body), config.Config.IdempotencyTTL)
+		if err != nil {
+			WriteError(res, req, err, "Unable to check the idempotency key.")
+			return
+		}
+		if saved != nil {
+			for name, values := range saved.Header {
+				res.Header()[name] = values
+			}
+			res.Header().Set(IdempotentReplayedHeader, "true")
+			res.WriteHeader(saved.Status)
+			res.Write(saved.Body)
+			return
+		}
+		recorder := &responseRecorder{ResponseWriter: res, status: http.StatusOK}
+		// A handler that panics leaves no response to save, the key is released before the panic goes on
+		// so that it is not held in use until it expires.
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err := IdempotencyKeys.Release(userID, key); err != nil {
+					logError(req, err)
+				}
+				panic(recovered)
+			}
+		}()
+		next.ServeHTTP(recorder, req)
+		if recorder.status >= http.StatusInternalServerError {
+			err = IdempotencyKeys.Release(userID, key)
+		} else {
+			err = IdempotencyKeys.Save(userID, key, recorder.saved())
+		}
+		if err != nil {
+			logError(req, err)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// fingerprint identifies a request by its method, path, content type and body.
+func fingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%v %v\n%v\n", req.Method, req.URL.Path, req.Header.Get("Content-Type"))
+	hash.Write(body)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// responseRecorder copies a response as it is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(body []byte) (int, error) {
+	r.body.Write(body)
+	return r.ResponseWriter.Write(body)
+}
+
+func (r *responseRecorder) saved() SavedResponse {
+	header := make(http.Header)
+	for _, name := range savedHeaders {
+		if value := r.Header().Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	return SavedResponse{Status: r.status, Header: header, Body: r.body.Bytes()}
+}
+
+// databaseIdempotencyStore keeps responses in the idempotency_keys table, a key is pending until its status is set.
+type databaseIdempotencyStore struct{}
+
+func (databaseIdempotencyStore) Reserve(userID int64, key string, fingerprint string, ttl time.Duration) (*SavedResponse, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	_, err := db.Exec("delete from idempotency_keys where user_id = ? and idempotency_key = ? and expires <= now()", userID, key)
+	if err != nil {
+		return nil, err
+	}
+	q := `
+		insert ignore into idempotency_keys (user_id, idempotency_key, fingerprint, created, expires)
+		values (?, ?, ?, now(), date_add(now(), interval ? second))
+	`
+	res, err := db.Exec(q, userID, key, fingerprint, int64(ttl/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 1 {
+		return nil, err
+	}
+	var savedFingerprint string
+	var status sql.NullInt64
+	var header []byte
+	saved := SavedResponse{}
+	q = "select fingerprint, status, header, body from idempotency_keys where user_id = ? and idempotency_key = ?"
+	err = db.QueryRow(q, userID, key).Scan(&savedFingerprint, &status, &header, &saved.Body)
+	switch {
+	case err != nil:
+		return nil, err
+	case savedFingerprint != fingerprint:
+		return nil, ErrIdempotencyKeyReused
+	case !status.Valid:
+		return nil, ErrIdempotencyKeyInUse
+	}
+	saved.Status = int(status.Int64)
+	return &saved, json.Unmarshal(header, &saved.Header)
+}
+
+func (databaseIdempotencyStore) Save(userID int64, key string, response SavedResponse) error {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+	q := "update idempotency_keys set status = ?, header = ?, body = ? where user_id = ? and idempotency_key = ?"
+	_, err = db.Exec(q, response.Status, header, response.Body, userID, key)
+	return err
+}
+
+func (databaseIdempotencyStore) Release(userID int64, key string) error {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	_, err := db.Exec("delete from idempotency_keys where user_id = ? and idempotency_key = ?", userID, key)
+	return err
+}
+
+// PurgeIdempotencyKeys removes the expired keys of all users.
+func PurgeIdempotencyKeys(db *sql.DB) error {
+	_, err := db.Exec("delete from idempotency_keys where expires <= now()")
+	return err
+}
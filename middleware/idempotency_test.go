@@ -0,0 +1,122 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+type savedKey struct {
+	fingerprint string
+	response    *middleware.SavedResponse
+}
+
+// memoryIdempotencyStore keeps the keys of a single user.
+type memoryIdempotencyStore map[string]*savedKey
+
+func (m memoryIdempotencyStore) Reserve(userID int64, key string, fingerprint string, ttl time.Duration) (*middleware.SavedResponse, error) {
+	saved, ok := m[key]
+	switch {
+	case !ok:
+		m[key] = &savedKey{fingerprint: fingerprint}
+		return nil, nil
+	case saved.fingerprint != fingerprint:
+		return nil, middleware.ErrIdempotencyKeyReused
+	case saved.response == nil:
+		return nil, middleware.ErrIdempotencyKeyInUse
+	}
+	return saved.response, nil
+}
+
+func (m memoryIdempotencyStore) Save(userID int64, key string, response middleware.SavedResponse) error {
+	m[key].response = &response
+	return nil
+}
+
+func (m memoryIdempotencyStore) Release(userID int64, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func idempotentPost(handler http.Handler, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/container", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, jwt.MapClaims{"id": float64(1)}))
+	res := httptest.NewRecorder()
+	middleware.IdempotencyHandler(handler).ServeHTTP(res, req)
+	return res
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	middleware.IdempotencyKeys = make(memoryIdempotencyStore)
+	created := 0
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		created++
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte(`{"id": 7}`))
+	})
+	first := idempotentPost(handler, "abc", `{"name": "Winter"}`)
+	retry := idempotentPost(handler, "abc", `{"name": "Winter"}`)
+	if created != 1 {
+		t.Errorf("Expected the container to be created once but it was created %v times", created)
+	}
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the response to be replayed but got %v %q", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" || first.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Error("Expected only the retry to be marked as replayed")
+	}
+
+	reused := idempotentPost(handler, "abc", `{"name": "Summer"}`)
+	if reused.Code != http.StatusConflict || !strings.Contains(reused.Body.String(), "idempotency_key_reused") {
+		t.Errorf("Expected a conflict but got %v %q", reused.Code, reused.Body.String())
+	}
+	if created != 1 {
+		t.Errorf("Expected the reused key not to create a container but %v were created", created)
+	}
+}
+
+func TestIdempotencyServerErrorIsRetried(t *testing.T) {
+	middleware.IdempotencyKeys = make(memoryIdempotencyStore)
+	status := http.StatusInternalServerError
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+	})
+	if res := idempotentPost(handler, "abc", "{}"); res.Code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status %v", res.Code)
+	}
+	status = http.StatusOK
+	res := idempotentPost(handler, "abc", "{}")
+	if res.Code != http.StatusOK || res.Header().Get(middleware.IdempotentReplayedHeader) != "" {
+		t.Errorf("Expected the request to be served again but got %v", res.Code)
+	}
+}
+
+func TestIdempotencyPanicIsRetried(t *testing.T) {
+	middleware.IdempotencyKeys = make(memoryIdempotencyStore)
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		panic("connection reset")
+	})
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != "connection reset" {
+				t.Errorf("Expected the panic to go on, got %v", recovered)
+			}
+		}()
+		idempotentPost(handler, "abc", "{}")
+	}()
+	handler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+	if res := idempotentPost(handler, "abc", "{}"); res.Code != http.StatusOK {
+		t.Errorf("Expected the key to be released after the panic but got %v", res.Code)
+	}
+}
@@ -2,6 +2,9 @@ package middleware
 
 import "net/http"
 
+// JsonErrorResponse is the error response of routes that predate problem responses.
+//
+// Deprecated: respond with WriteProblem or WriteError instead.
 type JsonErrorResponse struct {
 	Code int    `json:"code"`
 	Text string `json:"text"`
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/gorilla/mux"
+)
+
+// ProblemContentType is the content type of error responses (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// ProblemType is an entry of the error catalogue.
+// Its code is stable and is what clients should tell errors apart by, its title and status never change either.
+type ProblemType struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+}
+
+// URI identifies the problem type in responses, it resolves to the catalogue entry (see ProblemTypeHandler).
+func (t ProblemType) URI() string {
+	return "/problems/" + t.Code
+}
+
+// The error catalogue
+var (
+	BadRequest           = ProblemType{"bad_request", http.StatusBadRequest, "The request is malformed."}
+	ValidationFailed     = ProblemType{"validation_failed", http.StatusBadRequest, "The request has invalid fields."}
+	InvalidSort          = ProblemType{"invalid_sort", http.StatusBadRequest, "The requested sort is not allowed."}
+	InvalidCursor        = ProblemType{"invalid_cursor", http.StatusBadRequest, "The cursor is malformed or was issued for another sort."}
+	InvalidQuery         = ProblemType{"invalid_query", http.StatusBadRequest, "The search query could not be understood."}
+	InvalidSyncToken     = ProblemType{"invalid_sync_token", http.StatusBadRequest, "The sync token is malformed."}
+	Unauthorized         = ProblemType{"unauthorized", http.StatusUnauthorized, "Authentication is required."}
+	InvalidCredentials   = ProblemType{"invalid_credentials", http.StatusUnauthorized, "The email or password is incorrect."}
+	XSRFMismatch         = ProblemType{"xsrf_mismatch", http.StatusForbidden, "The XSRF token does not match the session."}
+	Forbidden            = ProblemType{"forbidden", http.StatusForbidden, "The resource belongs to another user."}
+	NotFound             = ProblemType{"not_found", http.StatusNotFound, "The resource was not found."}
+	UndoTokenNotFound    = ProblemType{"undo_token_not_found", http.StatusNotFound, "The undo token is unknown, expired or was already used."}
+	Conflict             = ProblemType{"conflict", http.StatusConflict, "The request conflicts with the state of the resource."}
+	EmailTaken           = ProblemType{"email_taken", http.StatusConflict, "A user is already registered with this email."}
+	InsufficientQuantity = ProblemType{"insufficient_quantity", http.StatusConflict, "There is not enough quantity to remove."}
+	AlreadyCheckedOut    = ProblemType{"already_checked_out", http.StatusConflict, "The item is already checked out."}
+	NotCheckedOut        = ProblemType{"not_checked_out", http.StatusConflict, "The item is not checked out."}
+	ContainerTrashed     = ProblemType{"container_trashed", http.StatusConflict, "The container of the item is in the trash, restore the container instead."}
+	UndoConflict         = ProblemType{"undo_conflict", http.StatusConflict, "The records were changed since the operation, it can no longer be undone."}
+	PreconditionFailed   = ProblemType{"precondition_failed", http.StatusPreconditionFailed, "The resource was changed since it was retrieved."}
+	IdempotencyKeyReused = ProblemType{"idempotency_key_reused", http.StatusConflict, "The idempotency key was used for another request."}
+	IdempotencyKeyInUse  = ProblemType{"idempotency_key_in_use", http.StatusConflict, "A request with the idempotency key is in progress."}
+	PayloadTooLarge      = ProblemType{"payload_too_large", http.StatusRequestEntityTooLarge, "The request body is too large."}
+	UnsupportedMedia     = ProblemType{"unsupported_media_type", http.StatusUnsupportedMediaType, "The media type is not supported."}
+	InternalError        = ProblemType{"internal_error", http.StatusInternalServerError, "An unexpected error occurred."}
+	StorageUnavailable   = ProblemType{"storage_unavailable", http.StatusServiceUnavailable, "File storage is not available."}
+)
+
+// Catalogue lists every problem type by code.
+var Catalogue = catalogue(
+	BadRequest, ValidationFailed, InvalidSort, InvalidCursor, InvalidQuery, InvalidSyncToken,
+	Unauthorized, InvalidCredentials, XSRFMismatch, Forbidden,
+	NotFound, UndoTokenNotFound, Conflict, EmailTaken, InsufficientQuantity, AlreadyCheckedOut, NotCheckedOut, ContainerTrashed, UndoConflict,
+	PreconditionFailed, IdempotencyKeyReused, IdempotencyKeyInUse, PayloadTooLarge, UnsupportedMedia, InternalError, StorageUnavailable,
+)
+
+func catalogue(types ...ProblemType) map[string]ProblemType {
+	byCode := make(map[string]ProblemType, len(types))
+	for _, problemType := range types {
+		byCode[problemType.Code] = problemType
+	}
+	return byCode
+}
+
+// Problem is an error response (RFC 7807).
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is the code of the problem type
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors details the fields that were rejected
+	Errors interface{} `json:"errors,omitempty"`
+}
+
+// NewProblem describes an occurrence of a problem type.
+func NewProblem(problemType ProblemType, detail string) Problem {
+	return Problem{
+		Type:   problemType.URI(),
+		Title:  problemType.Title,
+		Status: problemType.Status,
+		Detail: detail,
+		Code:   problemType.Code,
+	}
+}
+
+// Write sends the problem as the response to a request.
+func (p Problem) Write(res http.ResponseWriter, req *http.Request) {
+	p.Instance = req.URL.Path
+	p.RequestID = RequestIDFromRequest(req)
+	res.Header().Set("Content-Type", ProblemContentType)
+	res.WriteHeader(p.Status)
+	json.NewEncoder(res).Encode(p)
+}
+
+// WriteProblem responds to a request with a problem of a type.
+func WriteProblem(res http.ResponseWriter, req *http.Request, problemType ProblemType, detail string) {
+	NewProblem(problemType, detail).Write(res, req)
+}
+
+// WriteError responds to a request with the problem an error describes (see ProblemOf).
+func WriteError(res http.ResponseWriter, req *http.Request, err error, fallback string) {
+	ProblemOf(req, err, fallback).Write(res, req)
+}
+
+// ProblemOf describes an error that occurred while serving a request:
+// the errors of stores (see models.Error), binding.Errors, *models.SortError and *fulltext.ParseError.
+// Other errors are logged and reported as internal errors described by fallback, their message is not sent to clients.
+func ProblemOf(req *http.Request, err error, fallback string) Problem {
+	var fieldErrors binding.Errors
+	var sortErr *models.SortError
+	var parseErr *fulltext.ParseError
+	var storeErr *models.Error
+	switch {
+	case errors.As(err, &fieldErrors):
+		problem := NewProblem(ValidationFailed, fieldErrors.Error())
+		problem.Errors = fieldErrors
+		return problem
+	case errors.As(err, &sortErr):
+		problem := NewProblem(InvalidSort, sortErr.Error())
+		problem.Errors = []*models.SortError{sortErr}
+		return problem
+	case errors.As(err, &parseErr):
+		problem := NewProblem(InvalidQuery, parseErr.Error())
+		problem.Errors = []*fulltext.ParseError{parseErr}
+		return problem
+	case errors.As(err, &storeErr):
+		return NewProblem(storeProblemType(storeErr), storeErr.Message)
+	}
+	logError(req, err)
+	return NewProblem(InternalError, fallback)
+}
+
+// logError records an error that occurred while serving a request.
+func logError(req *http.Request, err error) {
+	log.Printf("%v %v (request %v): %v", req.Method, req.URL.Path, RequestIDFromRequest(req), err)
+}
+
+// WriteInvalid responds to a request with the problems found with its body (see binding.Bind).
+func WriteInvalid(res http.ResponseWriter, req *http.Request, errs binding.Errors) {
+	ProblemOf(req, errs, "").Write(res, req)
+}
+
+func storeProblemType(err *models.Error) ProblemType {
+	if problemType, ok := Catalogue[err.Code]; ok {
+		return problemType
+	}
+	switch err.Kind {
+	case models.ErrNotFound:
+		return NotFound
+	case models.ErrForbidden:
+		return Forbidden
+	case models.ErrConflict:
+		return Conflict
+	case models.ErrValidation:
+		return ValidationFailed
+	}
+	return InternalError
+}
+
+// ProblemTypeHandler describes the problem type of the code route variable.
+func ProblemTypeHandler(res http.ResponseWriter, req *http.Request) {
+	problemType, ok := Catalogue[mux.Vars(req)["code"]]
+	if !ok {
+		WriteProblem(res, req, NotFound, "Unknown problem type.")
+		return
+	}
+	res.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(res).Encode(problemType)
+}
@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+func writeError(err error) (*httptest.ResponseRecorder, middleware.Problem) {
+	req := httptest.NewRequest("GET", "/api/container/1", nil)
+	res := httptest.NewRecorder()
+	middleware.RequestIDHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		middleware.WriteError(res, req, err, "Unable to retrieve the container.")
+	})).ServeHTTP(res, req)
+	var problem middleware.Problem
+	json.NewDecoder(res.Body).Decode(&problem)
+	return res, problem
+}
+
+func TestWriteErrorOfStore(t *testing.T) {
+	res, problem := writeError(models.NewError(models.ErrNotFound, "container not found"))
+	if res.Code != http.StatusNotFound || problem.Code != "not_found" || problem.Detail != "container not found" {
+		t.Errorf("Unexpected problem %v %+v", res.Code, problem)
+	}
+	if res.Header().Get("Content-Type") != middleware.ProblemContentType {
+		t.Errorf("Unexpected content type %v", res.Header().Get("Content-Type"))
+	}
+	if problem.RequestID == "" || problem.RequestID != res.Header().Get(middleware.RequestIDHeader) {
+		t.Errorf("Expected the request ID %v but got %v", res.Header().Get(middleware.RequestIDHeader), problem.RequestID)
+	}
+	if problem.Instance != "/api/container/1" || problem.Type != "/problems/not_found" {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+
+	_, problem = writeError(models.ErrInvalidCursor)
+	if problem.Code != "invalid_cursor" || problem.Status != http.StatusBadRequest {
+		t.Errorf("Expected the code of the error to be used but got %+v", problem)
+	}
+}
+
+func TestWriteErrorOfValidation(t *testing.T) {
+	var errs binding.Errors
+	errs.Add("name", "is required")
+	res, problem := writeError(errs)
+	if res.Code != http.StatusBadRequest || problem.Code != "validation_failed" {
+		t.Errorf("Unexpected problem %v %+v", res.Code, problem)
+	}
+	fields, ok := problem.Errors.([]interface{})
+	if !ok || len(fields) != 1 {
+		t.Errorf("Expected the field errors but got %+v", problem.Errors)
+	}
+}
+
+func TestWriteErrorOfUnknown(t *testing.T) {
+	res, problem := writeError(errors.New("connection refused"))
+	if res.Code != http.StatusInternalServerError || problem.Detail != "Unable to retrieve the container." {
+		t.Errorf("Unexpected problem %v %+v", res.Code, problem)
+	}
+}
+
+func TestRequestIDIsKept(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	res := httptest.NewRecorder()
+	var id string
+	middleware.RequestIDHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		id = middleware.RequestIDFromRequest(req)
+	})).ServeHTTP(res, req)
+	if id != "abc-123" || res.Header().Get(middleware.RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected the request ID to be kept but got %v", id)
+	}
+}
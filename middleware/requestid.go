@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// RequestIDHeader carries the ID of a request, sent by clients or proxies or assigned otherwise.
+const RequestIDHeader = "X-Request-Id"
+
+const requestIDKey userKey = "requestID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDHandler identifies every request for the correlation of responses and logs.
+// The ID of the request header is kept when it is sensible, a random one is assigned otherwise.
+// The ID is echoed in the response header.
+func RequestIDHandler(next http.Handler) http.Handler {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		res.Header().Set(RequestIDHeader, id)
+		*req = *req.WithContext(context.WithValue(req.Context(), requestIDKey, id))
+		next.ServeHTTP(res, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// RequestIDFromRequest retrieves the ID assigned to a request by RequestIDHandler.
+func RequestIDFromRequest(req *http.Request) string {
+	id, _ := req.Context().Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return fmt.Sprintf("%x", id)
+}
@@ -5,3 +5,208 @@ ALTER TABLE `containers` DROP FOREIGN KEY `fk_containers_users`;
 ALTER TABLE `containers` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
 ALTER TABLE `api_users` DROP FOREIGN KEY `fk_user_id_constraint`;
 ALTER TABLE `api_users` ADD FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE;
+
+CREATE TABLE `item_loans` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
+  `container_item_id` int(11) NOT NULL,
+  `user_id` int(11) NOT NULL,
+  `borrower_user_id` int(11) DEFAULT NULL,
+  `borrower_name` varchar(100) NOT NULL DEFAULT '',
+  `notes` text,
+  `due` datetime DEFAULT NULL,
+  `checked_out` datetime NOT NULL,
+  `checked_in` datetime DEFAULT NULL,
+  `created` datetime NOT NULL,
+  `modified` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `container_item_checked_in` (`container_item_id`, `checked_in`),
+  KEY `user_checked_in` (`user_id`, `checked_in`),
+  FOREIGN KEY (`container_item_id`) REFERENCES `container_items` (`id`) ON DELETE CASCADE ON UPDATE CASCADE,
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `container_items` ADD `min_quantity` int(11) DEFAULT NULL AFTER `quantity`;
+
+CREATE TABLE `item_quantity_changes` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
+  `container_item_id` int(11) NOT NULL,
+  `delta` int(11) NOT NULL,
+  `quantity` int(11) NOT NULL,
+  `reason` varchar(255) NOT NULL DEFAULT '',
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `container_item_created` (`container_item_id`, `created`),
+  FOREIGN KEY (`container_item_id`) REFERENCES `container_items` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `container_items` ADD `expires` datetime DEFAULT NULL AFTER `min_quantity`;
+ALTER TABLE `container_items` ADD `expiry_reminded` datetime DEFAULT NULL AFTER `expires`;
+ALTER TABLE `container_items` ADD KEY `expires` (`expires`);
+ALTER TABLE `users` ADD `expiry_reminder_days` int(11) NOT NULL DEFAULT '7' AFTER `reset_password`;
+
+CREATE TABLE `photos` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `entity_type` enum('container','item') NOT NULL,
+  `entity_id` int(11) NOT NULL,
+  `uuid` char(36) NOT NULL,
+  `content_type` varchar(40) NOT NULL,
+  `size` int(11) NOT NULL,
+  `width` int(11) NOT NULL,
+  `height` int(11) NOT NULL,
+  `blob_key` varchar(255) NOT NULL,
+  `thumbnail_key` varchar(255) NOT NULL,
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `entity` (`entity_type`, `entity_id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `container_items` ADD FULLTEXT KEY `body_fulltext` (`body`);
+
+ALTER TABLE `container_items` ADD `notes` text AFTER `body`;
+ALTER TABLE `container_items` ADD `tags` varchar(255) NOT NULL DEFAULT '' AFTER `notes`;
+ALTER TABLE `container_items` DROP KEY `body_fulltext`;
+ALTER TABLE `container_items` ADD FULLTEXT KEY `search_fulltext` (`body`, `tags`, `notes`);
+ALTER TABLE `containers` ADD FULLTEXT KEY `search_fulltext` (`name`);
+ALTER TABLE `locations` ADD FULLTEXT KEY `search_fulltext` (`name`, `address`);
+
+CREATE TABLE `smart_containers` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `uuid` char(36) NOT NULL,
+  `name` varchar(40) NOT NULL,
+  `query` varchar(255) NOT NULL,
+  `created` datetime NOT NULL,
+  `modified` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user` (`user_id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `containers` ADD `version` int(11) unsigned NOT NULL DEFAULT '1' AFTER `container_item_count`;
+ALTER TABLE `container_items` ADD `version` int(11) unsigned NOT NULL DEFAULT '1' AFTER `quantity`;
+ALTER TABLE `locations` ADD `version` int(11) unsigned NOT NULL DEFAULT '1' AFTER `container_count`;
+ALTER TABLE `smart_containers` ADD `version` int(11) unsigned NOT NULL DEFAULT '1' AFTER `query`;
+
+CREATE TABLE `idempotency_keys` (
+  `user_id` int(11) NOT NULL,
+  `idempotency_key` varchar(255) CHARACTER SET ascii NOT NULL,
+  `fingerprint` char(64) NOT NULL,
+  `status` smallint(6) DEFAULT NULL,
+  `header` text,
+  `body` mediumblob,
+  `created` datetime NOT NULL,
+  `expires` datetime NOT NULL,
+  PRIMARY KEY (`user_id`, `idempotency_key`),
+  KEY `expires` (`expires`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `changes` (
+  `user_id` int(11) NOT NULL,
+  `entity_type` enum('container','item','location') NOT NULL,
+  `entity_id` int(11) NOT NULL,
+  `sequence` bigint(20) unsigned DEFAULT NULL,
+  `deleted` tinyint(1) NOT NULL DEFAULT '0',
+  `created` datetime NOT NULL,
+  PRIMARY KEY (`user_id`, `entity_type`, `entity_id`),
+  KEY `user_sequence` (`user_id`, `sequence`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `change_sequences` (
+  `user_id` int(11) NOT NULL,
+  `sequence` bigint(20) unsigned NOT NULL DEFAULT '0',
+  PRIMARY KEY (`user_id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+SET @sequence := 0;
+INSERT INTO `changes` (`user_id`, `entity_type`, `entity_id`, `sequence`, `created`)
+  SELECT `user_id`, 'location', `id`, @sequence := @sequence + 1, now() FROM `locations`;
+INSERT INTO `changes` (`user_id`, `entity_type`, `entity_id`, `sequence`, `created`)
+  SELECT `user_id`, 'container', `id`, @sequence := @sequence + 1, now() FROM `containers`;
+INSERT INTO `changes` (`user_id`, `entity_type`, `entity_id`, `sequence`, `created`)
+  SELECT c.`user_id`, 'item', ci.`id`, @sequence := @sequence + 1, now() FROM `container_items` ci INNER JOIN `containers` c ON c.`id` = ci.`container_id`;
+INSERT INTO `change_sequences` (`user_id`, `sequence`)
+  SELECT `user_id`, max(`sequence`) FROM `changes` GROUP BY `user_id`;
+
+ALTER TABLE `containers` ADD `deleted` datetime DEFAULT NULL AFTER `modified`;
+ALTER TABLE `containers` ADD KEY `deleted` (`deleted`);
+ALTER TABLE `container_items` ADD `deleted` datetime DEFAULT NULL AFTER `modified`;
+ALTER TABLE `container_items` ADD KEY `deleted` (`deleted`);
+ALTER TABLE `locations` ADD `deleted` datetime DEFAULT NULL AFTER `modified`;
+ALTER TABLE `locations` ADD KEY `deleted` (`deleted`);
+
+CREATE TABLE `audit_log` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `actor_id` int(11) NOT NULL,
+  `entity_type` enum('container','item','location','user') NOT NULL,
+  `entity_id` int(11) NOT NULL,
+  `action` enum('create','update','delete','restore') NOT NULL,
+  `changes` text NOT NULL,
+  `created` datetime NOT NULL,
+  `sequence` bigint(20) unsigned DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_entry` (`user_id`, `id`),
+  KEY `user_sequence` (`user_id`, `sequence`),
+  KEY `user_created` (`user_id`, `created`),
+  KEY `entity` (`entity_type`, `entity_id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `audit_sequences` (
+  `user_id` int(11) NOT NULL,
+  `sequence` bigint(20) unsigned NOT NULL DEFAULT '0',
+  PRIMARY KEY (`user_id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `undo_operations` (
+  `token` char(32) CHARACTER SET ascii NOT NULL,
+  `user_id` int(11) NOT NULL,
+  `operation` mediumtext NOT NULL,
+  `created` datetime NOT NULL,
+  `expires` datetime NOT NULL,
+  `used` datetime DEFAULT NULL,
+  PRIMARY KEY (`token`),
+  KEY `expires` (`expires`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `webhooks` (
+  `id` int(11) NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `url` varchar(2048) NOT NULL,
+  `events` varchar(1024) NOT NULL,
+  `secret` char(64) CHARACTER SET ascii NOT NULL,
+  `active` tinyint(1) NOT NULL DEFAULT '1',
+  `created` datetime NOT NULL,
+  `modified` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_id` (`user_id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `webhook_deliveries` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+  `webhook_id` int(11) NOT NULL,
+  `event_id` char(32) CHARACTER SET ascii NOT NULL,
+  `event` varchar(64) NOT NULL,
+  `payload` mediumtext NOT NULL,
+  `status` enum('pending','delivered','failed') NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT '0',
+  `response_status` smallint(6) DEFAULT NULL,
+  `error` varchar(255) DEFAULT NULL,
+  `next_attempt` datetime NOT NULL,
+  `created` datetime NOT NULL,
+  `delivered` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `status_next_attempt` (`status`, `next_attempt`),
+  KEY `webhook_created` (`webhook_id`, `created`),
+  FOREIGN KEY (`webhook_id`) REFERENCES `webhooks` (`id`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE `smart_containers` ADD `item_count` int(11) unsigned NOT NULL DEFAULT '0' AFTER `query`;
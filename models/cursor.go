@@ -0,0 +1,265 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued for another sort.
+var ErrInvalidCursor error = &Error{Kind: ErrValidation, Code: "invalid_cursor", Message: "invalid cursor"}
+
+// cursorTimeFormat is how dates are compared by MySQL
+const cursorTimeFormat = "2006-01-02 15:04:05.999999"
+
+// Cursor is a position in a sorted list of records: the sort values and ID of a record.
+// It is handed to clients as an opaque string (see String and ParseCursor).
+type Cursor struct {
+	// Sort is the sort the cursor was issued for (see SortBy.String)
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int64    `json:"i"`
+	// Backward continues with the records before the position rather than after it
+	Backward bool `json:"b,omitempty"`
+}
+
+// NewCursor creates a cursor positioned on a record with the values (as scanned from the database) of the sort fields.
+func NewCursor(sort SortBy, values []interface{}, id int64) Cursor {
+	cursor := Cursor{Sort: sort.String(), Values: make([]string, len(values)), ID: id}
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			cursor.Values[i] = v.Format(cursorTimeFormat)
+		case []byte:
+			cursor.Values[i] = string(v)
+		case nil:
+		default:
+			cursor.Values[i] = fmt.Sprint(v)
+		}
+	}
+	return cursor
+}
+
+// String encodes the cursor for use in a URL.
+func (c Cursor) String() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// ParseCursor decodes a cursor encoded by String.
+func ParseCursor(input string) (Cursor, error) {
+	var cursor Cursor
+	decoded, err := base64.RawURLEncoding.DecodeString(input)
+	if err != nil || json.Unmarshal(decoded, &cursor) != nil || cursor.Sort == "" || len(cursor.Values) == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// TotalMode determines how the total number of results of a paged query is counted.
+type TotalMode string
+
+const (
+	// TotalExact counts every result, the default
+	TotalExact TotalMode = "exact"
+	// TotalEstimate uses the estimate of the query planner, much cheaper for large lists
+	TotalEstimate TotalMode = "estimate"
+	// TotalNone skips counting, total and pages are left at 0
+	TotalNone TotalMode = "none"
+)
+
+// ErrInvalidTotal is returned for total modes other than exact, estimate and none.
+var ErrInvalidTotal error = &Error{Kind: ErrValidation, Code: "invalid_total", Message: "total must be exact, estimate or none"}
+
+// ParseTotalMode reads the total mode requested by a client, exact when none is requested.
+func ParseTotalMode(input string) (TotalMode, error) {
+	switch mode := TotalMode(input); mode {
+	case "", TotalExact, TotalEstimate, TotalNone:
+		return mode, nil
+	}
+	return "", ErrInvalidTotal
+}
+
+// Exact reports whether every result is counted.
+func (m TotalMode) Exact() bool {
+	return m == "" || m == TotalExact
+}
+
+// Keyset pages through records sorted by fields of a table with its id column breaking ties between equal values.
+// Without a cursor the offset of the query limit is used so page numbers keep working.
+type Keyset struct {
+	Sort SortBy
+	// Alias qualifies the columns when the table is joined
+	Alias string
+	Limit QueryLimit
+}
+
+// Backward reports whether the records are read in reverse order (towards the start of the list).
+func (k Keyset) Backward() bool {
+	return k.Limit.Cursor != nil && k.Limit.Cursor.Backward
+}
+
+// Columns lists the columns to select along with a record to create its cursor (see Scan).
+func (k Keyset) Columns() string {
+	return strings.Join(k.Sort.Columns(k.Alias), ", ")
+}
+
+// ColumnsAs lists the columns of Columns named sort_0, sort_1 and so on, so that a derived table may select them
+// along with the columns of the record they are read from (see UnionOrderBy).
+func (k Keyset) ColumnsAs() string {
+	columns := k.Sort.Columns(k.Alias)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("%v as sort_%v", columns[i], i)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Scan adds the destinations of the columns listed by Columns to those of a row, the sort values are read into values.
+func (k Keyset) Scan(dest ...interface{}) (row []interface{}, values []interface{}) {
+	values = make([]interface{}, len(k.Sort.Then)+1)
+	for i := range values {
+		dest = append(dest, &values[i])
+	}
+	return dest, values
+}
+
+// Where restricts a query to the records past the cursor, to be appended to an existing where clause.
+// Cursors issued for another sort result in ErrInvalidCursor.
+func (k Keyset) Where() (string, []interface{}, error) {
+	cursor := k.Limit.Cursor
+	if cursor == nil {
+		return "", nil, nil
+	}
+	fields := k.Sort.Fields()
+	if cursor.Sort != k.Sort.String() || len(cursor.Values) != len(fields) {
+		return "", nil, ErrInvalidCursor
+	}
+	columns := append(k.Sort.Columns(k.Alias), qualify(k.Alias, "id"))
+	directions := make([]SortType, 0, len(columns))
+	values := make([]interface{}, 0, len(columns))
+	for i, field := range fields {
+		directions = append(directions, field.Direction)
+		values = append(values, cursor.Values[i])
+	}
+	directions = append(directions, k.Sort.Direction)
+	values = append(values, cursor.ID)
+	// (a > ?) or (a = ? and b > ?) or (a = ? and b = ? and id > ?)
+	conditions := make([]string, 0, len(columns))
+	args := make([]interface{}, 0)
+	for i, column := range columns {
+		operator := ">"
+		if (directions[i] == DSC) != cursor.Backward {
+			operator = "<"
+		}
+		terms := make([]string, 0, i+1)
+		for _, equal := range columns[:i] {
+			terms = append(terms, equal+" = ?")
+		}
+		terms = append(terms, fmt.Sprintf("%v %v ?", column, operator))
+		conditions = append(conditions, "("+strings.Join(terms, " and ")+")")
+		args = append(args, values[:i+1]...)
+	}
+	return "and (" + strings.Join(conditions, " or ") + ")", args, nil
+}
+
+// OrderBy sorts and limits a query, one record more than the limit is read to know whether another page follows.
+func (k Keyset) OrderBy() string {
+	sort := k.directed()
+	clause := fmt.Sprintf("order by %v, %v %v limit %v", sort.OrderBy(k.Alias), qualify(k.Alias, "id"), sort.Direction, k.Limit.Limit+1)
+	if k.Limit.Cursor == nil {
+		clause += fmt.Sprintf(" offset %v", k.Limit.Offset)
+	}
+	return clause
+}
+
+// UnionOrderBy orders a derived table of the union of queries (each selecting ColumnsAs and ordered by OrderBy)
+// as OrderBy orders each of them, ie: to read a page of several lists in one query.
+func (k Keyset) UnionOrderBy() string {
+	sort := k.directed()
+	terms := make([]string, 0, len(sort.Then)+1)
+	for i, field := range sort.Fields() {
+		terms = append(terms, fmt.Sprintf("sort_%v %v", i, field.Direction))
+	}
+	return fmt.Sprintf("order by %v, id %v", strings.Join(terms, ", "), sort.Direction)
+}
+
+// directed is the sort the records are read in, reversed when reading backward.
+func (k Keyset) directed() SortBy {
+	sort := k.Sort
+	sort.Then = append([]SortBy{}, sort.Then...)
+	if k.Backward() {
+		sort.Direction = reverse(sort.Direction)
+		for i := range sort.Then {
+			sort.Then[i].Direction = reverse(sort.Then[i].Direction)
+		}
+	}
+	return sort
+}
+
+func reverse(direction SortType) SortType {
+	if direction == ASC {
+		return DSC
+	}
+	return ASC
+}
+
+// Page trims a slice of records read with OrderBy (and the matching sort values and IDs) to the limit,
+// restores their order and sets the cursors of the neighbouring pages.
+func (k Keyset) Page(records interface{}, values [][]interface{}, ids []int64, meta *PagedResponse) {
+	// The values and IDs are copied as records may share their array (ie: when the records are the IDs)
+	values = append([][]interface{}{}, values...)
+	ids = append([]int64{}, ids...)
+	count := len(ids)
+	more := count > k.Limit.Limit
+	if more {
+		count = k.Limit.Limit
+	}
+	for _, slice := range []interface{}{records, &values, &ids} {
+		trimmed := reflect.ValueOf(slice).Elem()
+		trimmed.Set(trimmed.Slice(0, count))
+		if k.Backward() {
+			swap := reflect.Swapper(trimmed.Interface())
+			for i, j := 0, count-1; i < j; i, j = i+1, j-1 {
+				swap(i, j)
+			}
+		}
+	}
+	if count == 0 {
+		return
+	}
+	first := NewCursor(k.Sort, values[0], ids[0])
+	first.Backward = true
+	last := NewCursor(k.Sort, values[count-1], ids[count-1])
+	if k.Backward() {
+		meta.NextCursor = last.String()
+		if more {
+			meta.PrevCursor = first.String()
+		}
+		return
+	}
+	if more {
+		meta.NextCursor = last.String()
+	}
+	if k.Limit.Cursor != nil || k.Limit.Offset > 0 {
+		meta.PrevCursor = first.String()
+	}
+}
+
+// SetLinks sets the links of the neighbouring pages from the URL of the current page.
+func (r *PagedResponse) SetLinks(current *url.URL) {
+	link := func(cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+		params := current.Query()
+		params.Del("page")
+		params.Set("cursor", cursor)
+		return current.Path + "?" + params.Encode()
+	}
+	r.Next = link(r.NextCursor)
+	r.Prev = link(r.PrevCursor)
+}
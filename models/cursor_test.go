@@ -0,0 +1,145 @@
+package models_test
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	sort := models.SortBy{Field: "modified", Direction: models.DSC}
+	cursor := models.NewCursor(sort, []interface{}{time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)}, 42)
+	parsed, err := models.ParseCursor(cursor.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, cursor) {
+		t.Errorf("Expected %+v but got %+v", cursor, parsed)
+	}
+	if parsed.Values[0] != "2024-03-01 10:30:00" {
+		t.Errorf("Expected the value to be formatted for MySQL but got %v", parsed.Values[0])
+	}
+	if _, err = models.ParseCursor("not a cursor"); err != models.ErrInvalidCursor {
+		t.Errorf("Expected an invalid cursor error but got %v", err)
+	}
+}
+
+func TestKeysetWhere(t *testing.T) {
+	sort := models.SortBy{Field: "name", Direction: models.ASC}
+	cursor := models.NewCursor(sort, []interface{}{[]byte("Garage")}, 7)
+	keyset := models.Keyset{Sort: sort, Limit: models.QueryLimit{Limit: 2, Cursor: &cursor}}
+	where, args, err := keyset.Where()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "and ((name > ?) or (name = ? and id > ?))" {
+		t.Errorf("Unexpected condition %v", where)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"Garage", "Garage", int64(7)}) {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+	if order := keyset.OrderBy(); order != "order by name ASC, id ASC limit 3" {
+		t.Errorf("Unexpected order %v", order)
+	}
+	cursor.Backward = true
+	if where, _, _ = keyset.Where(); where != "and ((name < ?) or (name = ? and id < ?))" {
+		t.Errorf("Unexpected backward condition %v", where)
+	}
+	if order := keyset.OrderBy(); order != "order by name DESC, id DESC limit 3" {
+		t.Errorf("Unexpected backward order %v", order)
+	}
+	keyset.Sort.Direction = models.DSC
+	if _, _, err = keyset.Where(); err != models.ErrInvalidCursor {
+		t.Errorf("Expected a cursor of another sort to be rejected but got %v", err)
+	}
+}
+
+func TestKeysetWhereMultipleFields(t *testing.T) {
+	sort := models.SortBy{Field: "name", Direction: models.ASC, Then: []models.SortBy{{Field: "modified", Direction: models.DSC}}}
+	cursor := models.NewCursor(sort, []interface{}{"Garage", "2024-01-01 00:00:00"}, 7)
+	keyset := models.Keyset{Sort: sort, Alias: "c", Limit: models.QueryLimit{Limit: 2, Offset: 10}}
+	if order := keyset.OrderBy(); order != "order by c.name ASC, c.modified DESC, c.id ASC limit 3 offset 10" {
+		t.Errorf("Unexpected order %v", order)
+	}
+	keyset.Limit.Cursor = &cursor
+	where, args, err := keyset.Where()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "and ((c.name > ?) or (c.name = ? and c.modified < ?) or (c.name = ? and c.modified = ? and c.id > ?))"
+	if where != expected {
+		t.Errorf("Expected %v but got %v", expected, where)
+	}
+	if len(args) != 6 {
+		t.Errorf("Expected 6 arguments but got %v", args)
+	}
+}
+
+func TestKeysetPage(t *testing.T) {
+	sort := models.SortBy{Field: "name", Direction: models.ASC}
+	keyset := models.Keyset{Sort: sort, Limit: models.QueryLimit{Limit: 2}}
+	names := []string{"a", "b", "c"}
+	meta := models.PagedResponse{}
+	keyset.Page(&names, [][]interface{}{{"a"}, {"b"}, {"c"}}, []int64{1, 2, 3}, &meta)
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Expected the extra record to be trimmed but got %v", names)
+	}
+	if meta.PrevCursor != "" || meta.NextCursor == "" {
+		t.Fatalf("Expected only a next cursor but got %+v", meta)
+	}
+	next, _ := models.ParseCursor(meta.NextCursor)
+	if next.ID != 2 || next.Values[0] != "b" || next.Backward {
+		t.Errorf("Expected the next page to follow b but got %+v", next)
+	}
+
+	// Reading backward from c returns b then a
+	back := models.NewCursor(sort, []interface{}{"c"}, 3)
+	back.Backward = true
+	keyset.Limit.Cursor = &back
+	ids := []int64{2, 1}
+	meta = models.PagedResponse{}
+	keyset.Page(&ids, [][]interface{}{{"b"}, {"a"}}, ids, &meta)
+	if !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("Expected records in sort order but got %v", ids)
+	}
+	if meta.PrevCursor != "" || meta.NextCursor == "" {
+		t.Errorf("Expected only a next cursor at the start of the list but got %+v", meta)
+	}
+
+	current, _ := url.Parse("/api/container?page=2&sort=name")
+	meta.SetLinks(current)
+	if meta.Next != "/api/container?cursor="+meta.NextCursor+"&sort=name" {
+		t.Errorf("Unexpected next link %v", meta.Next)
+	}
+}
+
+func TestParseTotalMode(t *testing.T) {
+	for _, input := range []string{"", "exact", "estimate", "none"} {
+		if mode, err := models.ParseTotalMode(input); err != nil || string(mode) != input {
+			t.Errorf("Expected %q to be accepted but got %q (%v)", input, mode, err)
+		}
+	}
+	if _, err := models.NewQueryLimit(url.Values{"total": {"approximate"}}, 20, 100); err != models.ErrInvalidTotal {
+		t.Errorf("Expected an invalid total error but got %v", err)
+	}
+}
+
+func TestKeysetUnionOrderBy(t *testing.T) {
+	sort := models.SortBy{Field: "name", Direction: models.ASC, Then: []models.SortBy{{Field: "modified", Direction: models.DSC}}}
+	keyset := models.Keyset{Sort: sort, Alias: "c", Limit: models.QueryLimit{Limit: 5}}
+	if columns := keyset.ColumnsAs(); columns != "c.name as sort_0, c.modified as sort_1" {
+		t.Errorf("Unexpected columns %v", columns)
+	}
+	if order := keyset.UnionOrderBy(); order != "order by sort_0 ASC, sort_1 DESC, id ASC" {
+		t.Errorf("Unexpected order %v", order)
+	}
+	back := models.NewCursor(sort, []interface{}{"b", "2024-03-01 10:30:00"}, 3)
+	back.Backward = true
+	keyset.Limit.Cursor = &back
+	if order := keyset.UnionOrderBy(); order != "order by sort_0 DESC, sort_1 ASC, id DESC" {
+		t.Errorf("Expected the order to be reversed reading backward but got %v", order)
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// DateFormat is the format of calendar dates accepted from users.
+const DateFormat = "2006-01-02"
+
+// ParseDate accepts either a calendar date (YYYY-MM-DD) or a full RFC 3339 timestamp.
+func ParseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(DateFormat, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// PastDue reports whether a due date, when there is one, has passed at a time.
+// Due dates are compared with the clock of the application rather than of the database so that every response,
+// and every filter, agrees on what is overdue.
+func PastDue(due *time.Time, at time.Time) bool {
+	return due != nil && due.Before(at)
+}
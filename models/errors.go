@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// The kinds of errors returned by stores, tell them apart with errors.Is.
+var (
+	// ErrNotFound is the kind of errors for records that do not exist
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is the kind of errors for records belonging to another user
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict is the kind of errors for changes the current state of a record does not allow
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is the kind of errors for invalid input
+	ErrValidation = errors.New("invalid")
+)
+
+// Error is an error of a store with a message fit to be shown to clients.
+type Error struct {
+	// Kind is one of the sentinel errors above
+	Kind error
+	// Code identifies the error in responses (see middleware.Catalogue), the code of its kind when empty
+	Code    string
+	Message string
+}
+
+// NewError creates an error of a kind.
+func NewError(kind error, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap exposes the kind of the error to errors.Is.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// NotFound converts sql.ErrNoRows into an ErrNotFound error with a message, other errors are returned as is.
+func NotFound(err error, message string) error {
+	if err == sql.ErrNoRows {
+		return NewError(ErrNotFound, message)
+	}
+	return err
+}
+
+// CheckOwner results in an ErrForbidden error unless a record of ownerID belongs to userID.
+func CheckOwner(ownerID int64, userID int64, message string) error {
+	if ownerID != userID {
+		return NewError(ErrForbidden, message)
+	}
+	return nil
+}
@@ -1,6 +1,11 @@
 package models
 
-import "math"
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
 
 // SortType is a locked string
 type SortType string
@@ -16,12 +21,65 @@ const (
 type SortBy struct {
 	Field     string
 	Direction SortType
+	// Then breaks ties between records with equal values of Field, in order
+	Then []SortBy
+}
+
+// Fields lists the fields sorted by, Field first.
+func (s SortBy) Fields() []SortBy {
+	fields := []SortBy{{Field: s.Field, Direction: s.Direction}}
+	for _, then := range s.Then {
+		fields = append(fields, SortBy{Field: then.Field, Direction: then.Direction})
+	}
+	return fields
+}
+
+// Columns lists the sorted fields qualified by a table alias (none when empty), ie: c.name, c.modified
+func (s SortBy) Columns(alias string) []string {
+	columns := make([]string, 0, len(s.Then)+1)
+	for _, field := range s.Fields() {
+		columns = append(columns, qualify(alias, field.Field))
+	}
+	return columns
+}
+
+// OrderBy is the list of an order by clause, ie: c.name ASC, c.modified DESC
+func (s SortBy) OrderBy(alias string) string {
+	terms := make([]string, 0, len(s.Then)+1)
+	for i, column := range s.Columns(alias) {
+		terms = append(terms, column+" "+string(s.Fields()[i].Direction))
+	}
+	return strings.Join(terms, ", ")
+}
+
+// String writes the sort in the syntax read by Sorter.Parse, ie: name,-modified
+func (s SortBy) String() string {
+	fields := make([]string, 0, len(s.Then)+1)
+	for _, field := range s.Fields() {
+		if field.Direction == DSC {
+			fields = append(fields, "-"+field.Field)
+		} else {
+			fields = append(fields, field.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func qualify(alias string, column string) string {
+	if alias == "" {
+		return column
+	}
+	return alias + "." + column
 }
 
 // QueryLimit is a construct for limiting and paginating queries.
 type QueryLimit struct {
 	Limit  int
 	Offset int
+	// Cursor continues from a position in the results instead of Offset (see Keyset)
+	Cursor *Cursor
+	// Total is how the total number of results is counted, exactly when empty
+	Total TotalMode
 }
 
 // SetPage will calculate the limit and offset based on page and size.
@@ -34,11 +92,55 @@ func (l *QueryLimit) SetPage(page int, size int) {
 	l.Offset = page * size
 }
 
+// NewQueryLimit reads the page, per_page (see PageSize), cursor and total params of a paged request.
+// A malformed cursor results in ErrInvalidCursor, an unknown total mode in ErrInvalidTotal.
+func NewQueryLimit(params url.Values, size int, max int) (QueryLimit, error) {
+	total, err := ParseTotalMode(params.Get("total"))
+	if err != nil {
+		return QueryLimit{}, err
+	}
+	limit := QueryLimit{Total: total}
+	page, _ := strconv.Atoi(params.Get("page"))
+	limit.SetPage(page, PageSize(params.Get("per_page"), size, max))
+	return limit, limit.SetCursor(params.Get("cursor"))
+}
+
+// PageSize is the number of results per page requested by a client, capped at max.
+// The size is used when none is requested or the request is not a positive number.
+func PageSize(requested string, size int, max int) int {
+	if perPage, err := strconv.Atoi(requested); err == nil && perPage > 0 {
+		size = perPage
+	}
+	if max > 0 && size > max {
+		size = max
+	}
+	return size
+}
+
+// SetCursor continues the query from an encoded cursor, an empty cursor is ignored.
+func (l *QueryLimit) SetCursor(input string) error {
+	if input == "" {
+		return nil
+	}
+	cursor, err := ParseCursor(input)
+	if err != nil {
+		return err
+	}
+	l.Cursor = &cursor
+	return nil
+}
+
 // PagedResponse contains pagination meta data.
 type PagedResponse struct {
 	RequestTotal int `json:"request_total"`
 	Total        int `json:"total"`
 	Pages        int `json:"pages"`
+	// TotalMode tells how total was counted when it is not exact
+	TotalMode  TotalMode `json:"total_mode,omitempty"`
+	Next       string    `json:"next,omitempty"`
+	Prev       string    `json:"prev,omitempty"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	PrevCursor string    `json:"prev_cursor,omitempty"`
 }
 
 // CalculatePages sets the number of pages based on a query limit.
@@ -46,3 +148,12 @@ func (r *PagedResponse) CalculatePages(limit QueryLimit) {
 	calc := float64(r.Total) / float64(limit.Limit)
 	r.Pages = int(math.Ceil(calc))
 }
+
+// SetTotal sets the total number of results, counted as requested by the query limit, and the number of pages.
+func (r *PagedResponse) SetTotal(total int, limit QueryLimit) {
+	r.Total = total
+	if !limit.Total.Exact() {
+		r.TotalMode = limit.Total
+	}
+	r.CalculatePages(limit)
+}
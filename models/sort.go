@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SortError describes a sort that was requested but is not allowed.
+type SortError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *SortError) Error() string {
+	return fmt.Sprintf("%v (%v)", e.Message, e.Field)
+}
+
+// Sorter validates the sorts requested by clients against the fields a store can be sorted by.
+type Sorter struct {
+	// Fields maps the names clients sort by, including aliases, to the sortable fields
+	Fields map[string]string
+	// Default is the sort when none is requested
+	Default SortBy
+}
+
+// Parse reads a comma separated list of fields, each descending when prefixed by a - (ie: name,-modified).
+// Fields that are not sortable or repeated result in a *SortError, an empty input is the default sort.
+func (s Sorter) Parse(input string) (SortBy, error) {
+	if strings.TrimSpace(input) == "" {
+		return s.Default, nil
+	}
+	var sort SortBy
+	seen := make(map[string]bool)
+	for i, name := range strings.Split(input, ",") {
+		name = strings.TrimSpace(name)
+		direction := ASC
+		if strings.HasPrefix(name, "-") {
+			name = name[1:]
+			direction = DSC
+		}
+		field, ok := s.Fields[strings.ToLower(name)]
+		if !ok {
+			return s.Default, &SortError{Field: name, Message: "unable to sort by this field"}
+		}
+		if seen[field] {
+			return s.Default, &SortError{Field: name, Message: "field is sorted by more than once"}
+		}
+		seen[field] = true
+		if i == 0 {
+			sort.Field, sort.Direction = field, direction
+		} else {
+			sort.Then = append(sort.Then, SortBy{Field: field, Direction: direction})
+		}
+	}
+	return sort, nil
+}
+
+// SortBy is a sort on a single field as requested with the sort_field and sort_dir params.
+// Unknown fields fall back to the field of the default sort, and any direction but ASC is descending.
+func (s Sorter) SortBy(name string, direction SortType) SortBy {
+	sort := SortBy{Field: s.Default.Field, Direction: DSC}
+	if field, ok := s.Fields[strings.ToLower(name)]; ok {
+		sort.Field = field
+	}
+	if direction == ASC {
+		sort.Direction = ASC
+	}
+	return sort
+}
+
+// FromQuery reads the sort of a request from the sort param (see Parse),
+// or the sort_field and sort_dir params kept for older clients (see SortBy).
+func (s Sorter) FromQuery(params url.Values) (SortBy, error) {
+	if input := params.Get("sort"); input != "" {
+		return s.Parse(input)
+	}
+	if params.Get("sort_field") == "" && params.Get("sort_dir") == "" {
+		return s.Default, nil
+	}
+	return s.SortBy(params.Get("sort_field"), SortType(params.Get("sort_dir"))), nil
+}
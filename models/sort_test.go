@@ -0,0 +1,90 @@
+package models_test
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+var sorter = models.Sorter{
+	Fields: map[string]string{
+		"name":     "name",
+		"modified": "modified",
+		"qty":      "quantity",
+		"quantity": "quantity",
+	},
+	Default: models.SortBy{Field: "modified", Direction: models.DSC},
+}
+
+func TestSorterParse(t *testing.T) {
+	sort, err := sorter.Parse("name, -qty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := models.SortBy{Field: "name", Direction: models.ASC, Then: []models.SortBy{{Field: "quantity", Direction: models.DSC}}}
+	if !reflect.DeepEqual(sort, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, sort)
+	}
+	if sort.String() != "name,-quantity" {
+		t.Errorf("Unexpected string %v", sort.String())
+	}
+	if sort.OrderBy("ci") != "ci.name ASC, ci.quantity DESC" {
+		t.Errorf("Unexpected order by %v", sort.OrderBy("ci"))
+	}
+	for _, input := range []string{"password", "name,-name", "qty,quantity"} {
+		if _, err = sorter.Parse(input); err == nil {
+			t.Errorf("Expected %v to be rejected", input)
+		} else if _, ok := err.(*models.SortError); !ok {
+			t.Errorf("Expected a *SortError for %v but got %v", input, err)
+		}
+	}
+}
+
+func TestSorterFromQuery(t *testing.T) {
+	cases := map[string]models.SortBy{
+		"":                                  sorter.Default,
+		"sort=-name":                        {Field: "name", Direction: models.DSC},
+		"sort_field=name&sort_dir=ASC":      {Field: "name", Direction: models.ASC},
+		"sort_field=name":                   {Field: "name", Direction: models.DSC},
+		"sort_field=password&sort_dir=ASC":  {Field: "modified", Direction: models.ASC},
+		"sort=qty&sort_field=name&sort_dir": {Field: "quantity", Direction: models.ASC},
+	}
+	for query, expected := range cases {
+		params, _ := url.ParseQuery(query)
+		sort, err := sorter.FromQuery(params)
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(sort, expected) {
+			t.Errorf("Expected %+v for %v but got %+v", expected, query, sort)
+		}
+	}
+}
+
+func TestNewQueryLimit(t *testing.T) {
+	cases := map[string]models.QueryLimit{
+		"":                  {Limit: 20, Offset: 0},
+		"page=3":            {Limit: 20, Offset: 40},
+		"page=2&per_page=5": {Limit: 5, Offset: 5},
+		"per_page=500":      {Limit: 100, Offset: 0},
+		"per_page=-1":       {Limit: 20, Offset: 0},
+		"total=estimate":    {Limit: 20, Offset: 0, Total: models.TotalEstimate},
+	}
+	for query, expected := range cases {
+		params, _ := url.ParseQuery(query)
+		limit, err := models.NewQueryLimit(params, 20, 100)
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(limit, expected) {
+			t.Errorf("Expected %+v for %v but got %+v", expected, query, limit)
+		}
+	}
+	if _, err := models.NewQueryLimit(url.Values{"cursor": {"nonsense"}}, 20, 100); err != models.ErrInvalidCursor {
+		t.Errorf("Expected an invalid cursor error but got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// ErrPreconditionFailed is returned when a record was changed since the version a request is based on.
+var ErrPreconditionFailed error = &Error{Kind: ErrConflict, Code: "precondition_failed", Message: "the record was changed by another request"}
+
+// Versioned is a record with a version that every update of it increments, for optimistic concurrency control.
+type Versioned interface {
+	// ETag identifies the version of the record (see ETag)
+	ETag() string
+}
+
+// ETag is the entity tag of a version of a record, ie: "3" (quotes included).
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// CheckVersion results in ErrPreconditionFailed when a statement conditioned on the version of a record
+// (where id = ? and version = ?) did not change it, because it has since been changed or removed.
+func CheckVersion(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package containers
 import (
 	"time"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
 	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/locations"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
@@ -16,8 +18,31 @@ type Container struct {
 	UUID               string              `json:"uuid"`
 	Location           *locations.Location `json:"location"`
 	ContainerItemCount int                 `json:"container_item_count"`
-	Created            time.Time           `json:"created"`
-	Modified           time.Time           `json:"modified"`
+	// IsVirtual marks a smart container, its items are those matching its Query.
+	// Smart containers have no ID, they are identified by SmartID.
+	IsVirtual bool   `json:"is_virtual"`
+	SmartID   int64  `json:"smart_id,omitempty"`
+	Query     string `json:"query,omitempty"`
+	// Version is incremented by every change of the container, its item count is maintained without changing it
+	Version  int64     `json:"version"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	// Deleted is set while the container is in the trash, along with the items it held
+	Deleted *time.Time `json:"deleted,omitempty"`
+}
+
+// ETag identifies the version of the container.
+func (c Container) ETag() string {
+	return models.ETag(c.Version)
+}
+
+// auditFields are the values of the container recorded in the audit log.
+func (c Container) auditFields() audit.Fields {
+	fields := audit.Fields{"name": c.Name, "location_id": int64(0)}
+	if c.Location != nil {
+		fields["location_id"] = c.Location.ID
+	}
+	return fields
 }
 
 type ContainerRecord struct {
@@ -26,11 +51,15 @@ type ContainerRecord struct {
 	locationID    int64
 	oldLocationID int64
 	Name          string
+	// Version is the version of the container the record was made from
+	Version int64
 }
 
 type ContainerFilter struct {
 	User        users.User
 	LocationIDs []string
+	// Query optionally restricts containers by text and filters (see SearchFields)
+	Query fulltext.Query
 }
 
 func (f *ContainerFilter) GenericLocationIDList() []interface{} {
@@ -45,6 +74,8 @@ func (f *ContainerFilter) GenericLocationIDList() []interface{} {
 type PagedResponse struct {
 	Containers    Containers           `json:"containers"`
 	PagedResponse models.PagedResponse `json:"meta"`
+	// Suggestions are corrected queries offered when searching with misspelled words
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 func NewRecord(user *users.User) ContainerRecord {
@@ -68,6 +99,11 @@ func (r *ContainerRecord) SetUser(user *users.User) *ContainerRecord {
 	return r
 }
 
+// auditFields are the values of the container recorded in the audit log once the record is stored.
+func (r *ContainerRecord) auditFields() audit.Fields {
+	return audit.Fields{"name": r.Name, "location_id": r.locationID}
+}
+
 // Containers is a group of containers
 type Containers []Container
 
@@ -75,6 +111,7 @@ func (c *Container) ToRecord() ContainerRecord {
 	record := NewRecord(&c.User)
 	if c.ID > 0 {
 		record.ID = c.ID
+		record.Version = c.Version
 	}
 	if c.Location != nil {
 		record.SetLocation(c.Location)
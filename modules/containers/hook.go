@@ -5,11 +5,15 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/binding"
 	"github.com/cjsaylor/boxmeup-go/config"
 	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
 	"github.com/cjsaylor/boxmeup-go/middleware"
 	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
 	"github.com/gorilla/mux"
 	chain "github.com/justinas/alice"
@@ -23,19 +27,31 @@ var routes = []config.Route{
 		Name:    "CreateContainer",
 		Method:  "POST",
 		Pattern: "/api/container",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(createContainerHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(createContainerHandler),
 	},
 	config.Route{
 		Name:    "UpdateContainer",
 		Method:  "PUT",
 		Pattern: "/api/container/{id}",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(updateContainerHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadContainer, "Unable to retrieve the container.")).ThenFunc(updateContainerHandler),
+	},
+	config.Route{
+		Name:    "PatchContainer",
+		Method:  "PATCH",
+		Pattern: "/api/container/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadContainer, "Unable to retrieve the container.")).ThenFunc(patchContainerHandler),
 	},
 	config.Route{
 		Name:    "DeleteContainer",
 		Method:  "DELETE",
 		Pattern: "/api/container/{id}",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(deleteContainerHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadContainer, "Unable to retrieve the container.")).ThenFunc(deleteContainerHandler),
+	},
+	config.Route{
+		Name:    "RestoreContainer",
+		Method:  "POST",
+		Pattern: "/api/container/{id}/restore",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadTrashedContainer, "Unable to retrieve the container from the trash.")).ThenFunc(restoreContainerHandler),
 	},
 	config.Route{
 		Name:    "Container",
@@ -49,6 +65,30 @@ var routes = []config.Route{
 		Pattern: "/api/container",
 		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(containersHandler),
 	},
+	config.Route{
+		Name:    "CreateSmartContainer",
+		Method:  "POST",
+		Pattern: "/api/smart-container",
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(saveSmartContainerHandler),
+	},
+	config.Route{
+		Name:    "UpdateSmartContainer",
+		Method:  "PUT",
+		Pattern: "/api/smart-container/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadSmartContainer, "Unable to retrieve the smart container.")).ThenFunc(saveSmartContainerHandler),
+	},
+	config.Route{
+		Name:    "DeleteSmartContainer",
+		Method:  "DELETE",
+		Pattern: "/api/smart-container/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadSmartContainer, "Unable to retrieve the smart container.")).ThenFunc(deleteSmartContainerHandler),
+	},
+	config.Route{
+		Name:    "SmartContainer",
+		Method:  "GET",
+		Pattern: "/api/smart-container/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(smartContainerHandler),
+	},
 }
 
 // Apply hooks related to items
@@ -62,8 +102,41 @@ func (h Hook) Apply(router *mux.Router) {
 	}
 }
 
+// loadContainer retrieves the container a request changes on behalf of its user.
+func loadContainer(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	containerID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	container, err := NewStore(db).OwnedBy(int64(containerID), middleware.UserIDFromRequest(req))
+	return container, err
+}
+
+// loadTrashedContainer retrieves the container in the trash a request restores on behalf of its user.
+func loadTrashedContainer(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	containerID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	container, err := NewStore(db).TrashedOwnedBy(int64(containerID), middleware.UserIDFromRequest(req))
+	return container, err
+}
+
+// loadSmartContainer retrieves the smart container a request changes on behalf of its user.
+func loadSmartContainer(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	smartID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	smart, err := NewStore(db).SmartOwnedBy(int64(smartID), middleware.UserIDFromRequest(req))
+	return smart, err
+}
+
+// containerRequest is the body of requests creating or updating a container.
+type containerRequest struct {
+	Name       string `json:"name" validate:"required,max=36"`
+	LocationID int64  `json:"location_id"`
+}
+
 // createContainerHandler allows creation of a container from a POST method
-// Expected body:
+// Expected body (JSON or form):
 //   name
 //   location_id (optional)
 func createContainerHandler(res http.ResponseWriter, req *http.Request) {
@@ -73,33 +146,33 @@ func createContainerHandler(res http.ResponseWriter, req *http.Request) {
 	user, err := users.NewStore(db).ByID(userID)
 	jsonOut := json.NewEncoder(res)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "User specified not found."})
+		middleware.WriteError(res, req, err, "Unable to get user information.")
+		return
+	}
+	var body containerRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
 		return
 	}
 	record := NewRecord(&user)
-	record.Name = req.PostFormValue("name")
-	if userLocationID := req.PostFormValue("location_id"); userLocationID != "" {
-		locationID, _ := strconv.Atoi(userLocationID)
-		location, err := locations.NewStore(db).ByID(int64(locationID))
+	record.Name = body.Name
+	if body.LocationID > 0 {
+		location, err := locations.NewStore(db).OwnedBy(body.LocationID, userID)
 		if err != nil {
-			res.WriteHeader(http.StatusNotFound)
-			jsonOut.Encode(middleware.JsonErrorResponse{Code: -5, Text: "Location not found."})
-			return
-		} else if location.User.ID != userID {
-			res.WriteHeader(http.StatusForbidden)
-			jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Not allowed to attach supplied location to this container."})
+			middleware.WriteError(res, req, err, "Unable to retrieve the location.")
 			return
 		}
 		record.SetLocation(&location)
 	} else {
 		record.SetLocation(nil)
 	}
-	err = NewStore(db).Create(&record)
+	err = NewStore(db).As(middleware.UserIDFromRequest(req)).Create(&record)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Failed to create the container."})
+		middleware.WriteError(res, req, err, "Failed to create the container.")
 	} else {
+		op := undo.NewDelete(audit.Container)
+		op.Add(record.ID, record.Version)
+		undo.Offer(res, req, db, op)
 		res.WriteHeader(http.StatusOK)
 		jsonOut.Encode(map[string]int64{
 			"id": record.ID,
@@ -108,84 +181,129 @@ func createContainerHandler(res http.ResponseWriter, req *http.Request) {
 }
 
 // updateContainerHandler exposes updating a container
+// Expected body (JSON or form):
+//   name
+//   location_id (optional, the container is detached from its location when not given)
 // @todo consider a new endpoint for just location attachment/detachment and remove location editing here
 // -> PUT /api/container/<id>/location/<location_id>
 // -> DELETE /api/container/<id>/location
 func updateContainerHandler(res http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
 	db, _ := database.GetDBResource()
 	defer db.Close()
 	userID := middleware.UserIDFromRequest(req)
-	containerModel := NewStore(db)
-	containerID, _ := strconv.Atoi(vars["id"])
-	container, err := containerModel.ByID(int64(containerID))
-	jsonOut := json.NewEncoder(res)
-	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Container not found."})
-		return
-	}
-	if container.User.ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to edit this container."})
+	containerModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	container := middleware.RecordFromRequest(req).(Container)
+	var body containerRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
 		return
 	}
+	before := container.auditFields()
 	record := container.ToRecord()
-	record.Name = req.PostFormValue("name")
-	if userLocationID := req.PostFormValue("location_id"); userLocationID != "" {
-		locationID, _ := strconv.Atoi(userLocationID)
-		location, err := locations.NewStore(db).ByID(int64(locationID))
+	record.Name = body.Name
+	if body.LocationID > 0 {
+		location, err := locations.NewStore(db).OwnedBy(body.LocationID, userID)
 		if err != nil {
-			res.WriteHeader(http.StatusNotFound)
-			jsonOut.Encode(middleware.JsonErrorResponse{Code: -5, Text: "Location not found."})
-			return
-		} else if location.User.ID != userID {
-			res.WriteHeader(http.StatusForbidden)
-			jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Not allowed to attach supplied location to this container."})
+			middleware.WriteError(res, req, err, "Unable to retrieve the location.")
 			return
 		}
 		record.SetLocation(&location)
 	} else {
 		record.SetLocation(nil)
 	}
-	err = containerModel.Update(&record)
+	err := containerModel.Update(&record)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -4, Text: err.Error()})
+		middleware.WriteError(res, req, err, "Failed to update the container.")
 		return
 	}
+	container.Version = record.Version
+	undo.Offer(res, req, db, undo.NewRevert(audit.Container, container.ID, record.Version, before))
+	middleware.SetETag(res, container)
 	res.WriteHeader(http.StatusNoContent)
 }
 
-// deleteContainerHandler removes a container on request of the user
-func deleteContainerHandler(res http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
+// patchContainerHandler changes only the fields of a container given in a partial update
+// Expected body (JSON merge patch or JSON patch):
+//   name (optional)
+//   location_id (optional, null detaches the container from its location)
+func patchContainerHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
 	userID := middleware.UserIDFromRequest(req)
-	containerModel := NewStore(db)
-	containerID, _ := strconv.Atoi(vars["id"])
-	container, err := containerModel.ByID(int64(containerID))
-	jsonOut := json.NewEncoder(res)
-	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Container not found."})
+	containerModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	container := middleware.RecordFromRequest(req).(Container)
+	body := containerRequest{Name: container.Name}
+	if container.Location != nil {
+		body.LocationID = container.Location.ID
+	}
+	patch, errs := binding.BindPatch(req, &body)
+	if errs != nil {
+		middleware.WriteInvalid(res, req, errs)
 		return
 	}
-	if container.User.ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to edit this container."})
+	before := container.auditFields()
+	record := container.ToRecord()
+	record.Name = body.Name
+	if patch.Has("location_id") && body.LocationID > 0 {
+		location, err := locations.NewStore(db).OwnedBy(body.LocationID, userID)
+		if err != nil {
+			middleware.WriteError(res, req, err, "Unable to retrieve the location.")
+			return
+		}
+		record.SetLocation(&location)
+	} else if patch.Has("location_id") {
+		record.SetLocation(nil)
+	}
+	err := containerModel.Update(&record)
+	if err == nil {
+		undo.Offer(res, req, db, undo.NewRevert(audit.Container, container.ID, record.Version, before))
+		container, err = containerModel.ByID(container.ID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Failed to update the container.")
 		return
 	}
-	err = containerModel.Delete(int64(containerID))
+	middleware.SetETag(res, container)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(container)
+}
+
+// deleteContainerHandler moves a container and its items to the trash on request of the user
+func deleteContainerHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	containerModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	container := middleware.RecordFromRequest(req).(Container)
+	err := containerModel.Delete(&container)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Error deleting container."})
+		middleware.WriteError(res, req, err, "Error deleting container.")
 		return
 	}
+	op := undo.NewRestore(audit.Container)
+	op.Add(container.ID, container.Version)
+	undo.Offer(res, req, db, op)
 	res.WriteHeader(http.StatusNoContent)
 }
 
+// restoreContainerHandler brings a container back from the trash along with the items deleted with it
+func restoreContainerHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	containerModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	container := middleware.RecordFromRequest(req).(Container)
+	err := containerModel.Restore(&container)
+	if err == nil {
+		container, err = containerModel.ByID(container.ID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Failed to restore the container.")
+		return
+	}
+	middleware.SetETag(res, container)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(container)
+}
+
 // containerHandler gets a specific container by ID
 func containerHandler(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
@@ -193,23 +311,29 @@ func containerHandler(res http.ResponseWriter, req *http.Request) {
 	defer db.Close()
 	userID := middleware.UserIDFromRequest(req)
 	containerID, _ := strconv.Atoi(vars["id"])
-	container, err := NewStore(db).ByID(int64(containerID))
+	container, err := NewStore(db).OwnedBy(int64(containerID), userID)
 	jsonOut := json.NewEncoder(res)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Container not found."})
-		return
-	}
-	if container.User.ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to view this container."})
+		middleware.WriteError(res, req, err, "Unable to retrieve the container.")
 		return
 	}
+	middleware.SetETag(res, container)
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(container)
 }
 
 // containersHandler gets all user containers
+// Query params:
+//   q (optional, words and filters such as location:garage items>2, see SearchFields)
+//   location_id (optional, repeatable)
+//   include_smart (optional, F leaves smart containers out of the first page)
+//   sort (optional, comma separated fields, - prefixed for descending, ie: name,-modified)
+//   sort_field (optional, when sort is not given)
+//   sort_dir
+//   page
+//   per_page (optional, QueryLimit by default)
+//   cursor (optional, continues from the next or prev cursor of a previous response in place of page)
+//   total (optional, exact by default, estimate or none)
 func containersHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
@@ -218,26 +342,127 @@ func containersHandler(res http.ResponseWriter, req *http.Request) {
 	user, err := userModel.ByID(userID)
 	jsonOut := json.NewEncoder(res)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Unable to get user information."})
+		middleware.WriteError(res, req, err, "Unable to get user information.")
 		return
 	}
 	params := req.URL.Query()
-	var limit models.QueryLimit
-	page, _ := strconv.Atoi(params.Get("page"))
-	limit.SetPage(page, QueryLimit)
 	containerModel := NewStore(db)
-	sort := containerModel.GetSortBy(params.Get("sort_field"), models.SortType(params.Get("sort_dir")))
+	limit, err := models.NewQueryLimit(params, QueryLimit, config.Config.MaxPerPage)
+	var sort models.SortBy
+	if err == nil {
+		sort, err = Sorter.FromQuery(params)
+	}
 	filter := ContainerFilter{
 		User:        user,
 		LocationIDs: params["location_id"],
 	}
-	response, err := containerModel.FilteredContainers(filter, sort, limit)
+	if err == nil {
+		filter.Query, err = fulltext.Parse(params.Get("q"))
+	}
+	// Smart containers lead an unfiltered listing, the real containers follow them from the first page on.
+	var smart Containers
+	if err == nil && len(filter.LocationIDs) == 0 && params.Get("q") == "" && params.Get("include_smart") != "F" {
+		smart, err = containerModel.SmartAsContainers(user)
+	}
+	lead, containerLimit := LeadPage(smart, limit)
+	var response PagedResponse
+	if err == nil {
+		response, err = containerModel.FilteredContainers(filter, sort, containerLimit)
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Unable to retrieve containers."})
+		middleware.WriteError(res, req, err, "Unable to retrieve containers.")
 		return
 	}
+	if len(smart) > 0 {
+		total := response.PagedResponse.Total
+		if limit.Total != models.TotalNone {
+			total += len(smart)
+		}
+		response.PagedResponse.SetTotal(total, limit)
+		response.Containers = append(lead, response.Containers...)
+		response.PagedResponse.RequestTotal = len(response.Containers)
+	}
+	response.PagedResponse.SetLinks(req.URL)
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(response)
 }
+
+// smartContainerRequest is the body of requests creating or updating a smart container.
+type smartContainerRequest struct {
+	Name  string `json:"name" validate:"required,max=40"`
+	Query string `json:"query" validate:"required,max=255"`
+}
+
+// saveSmartContainerHandler creates (POST) or modifies (PUT) a smart container
+// Expected body (JSON or form):
+//   name
+//   query (an item search, ie: winter tag:clothes location:attic)
+func saveSmartContainerHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	containerModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	var smart SmartContainer
+	var err error
+	if record, ok := middleware.RecordFromRequest(req).(SmartContainer); ok {
+		smart = record
+	} else {
+		smart.User, err = users.NewStore(db).ByID(userID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the smart container.")
+		return
+	}
+	var body smartContainerRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	smart.Name = body.Name
+	smart.Query = body.Query
+	_, err = ParseSmartQuery(smart.Query)
+	if err == nil && smart.ID > 0 {
+		err = containerModel.UpdateSmart(&smart)
+	} else if err == nil {
+		err = containerModel.CreateSmart(&smart)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Failed to save the smart container.")
+		return
+	}
+	middleware.SetETag(res, smart)
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string]int64{
+		"id": smart.ID,
+	})
+}
+
+// smartContainerHandler gets a specific smart container by ID
+func smartContainerHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	smartID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	smart, err := NewStore(db).SmartOwnedBy(int64(smartID), userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the smart container.")
+		return
+	}
+	middleware.SetETag(res, smart)
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(smart)
+}
+
+// deleteSmartContainerHandler removes a smart container
+func deleteSmartContainerHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	smart := middleware.RecordFromRequest(req).(SmartContainer)
+	if err := NewStore(db).As(middleware.UserIDFromRequest(req)).DeleteSmart(smart); err != nil {
+		middleware.WriteError(res, req, err, "Unable to remove the smart container.")
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,25 @@
+package containers
+
+import "github.com/cjsaylor/boxmeup-go/fulltext"
+
+// SearchType is the document type of containers in the search index.
+const SearchType = "container"
+
+func init() {
+	fulltext.RegisterSource(SearchType, fulltext.Source{
+		From:    "containers",
+		ID:      "id",
+		User:    "user_id",
+		Columns: []string{"name"},
+		Where:   "deleted is null",
+	})
+}
+
+// SearchFields are the filters available when listing containers.
+var SearchFields = fulltext.Fields{
+	"name":     {Kind: fulltext.TextField, Column: "name"},
+	"location": {Kind: fulltext.TextField, Column: "(select lo.name from locations lo where lo.id = containers.location_id and lo.deleted is null)"},
+	"items":    {Kind: fulltext.NumberField, Column: "container_item_count"},
+	"created":  {Kind: fulltext.DateField, Column: "created"},
+	"modified": {Kind: fulltext.DateField, Column: "modified"},
+}
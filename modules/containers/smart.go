@@ -0,0 +1,105 @@
+package containers
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+)
+
+// ErrEmptySmartQuery is returned when saving a smart container that would match nothing.
+var ErrEmptySmartQuery error = models.NewError(models.ErrValidation, "smart containers need a search query")
+
+// SmartContainer is a saved item search that behaves like a virtual container of the items it matches.
+type SmartContainer struct {
+	ID   int64      `json:"id"`
+	User users.User `json:"-"`
+	UUID string     `json:"uuid"`
+	Name string     `json:"name"`
+	// Query is an item search (see items.SearchFields), ie: "winter tag:clothes location:attic"
+	Query string `json:"query"`
+	// ItemCount is the number of items matching the query when it was last evaluated
+	ItemCount int `json:"item_count"`
+	// Version is incremented by every change of the smart container
+	Version  int64     `json:"version"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+// ETag identifies the version of the smart container.
+func (s SmartContainer) ETag() string {
+	return models.ETag(s.Version)
+}
+
+// SmartContainers is a group of smart containers
+type SmartContainers []SmartContainer
+
+// LeadPage splits a page of a listing led by smart containers (as converted by ToContainer) into the smart
+// containers on the page and the query limit of the real containers following them.
+// Pages continued from a cursor only hold real containers.
+func LeadPage(smart Containers, limit models.QueryLimit) (Containers, models.QueryLimit) {
+	if limit.Cursor != nil || limit.Offset >= len(smart) {
+		if limit.Cursor == nil {
+			limit.Offset -= len(smart)
+		}
+		return Containers{}, limit
+	}
+	end := limit.Offset + limit.Limit
+	if end > len(smart) {
+		end = len(smart)
+	}
+	lead := smart[limit.Offset:end]
+	limit.Limit -= len(lead)
+	limit.Offset = 0
+	return lead, limit
+}
+
+// ToContainer presents a smart container alongside real containers.
+// Its ID is left unset so that it can not be mistaken for a real container.
+func (s *SmartContainer) ToContainer() Container {
+	return Container{
+		SmartID:            s.ID,
+		User:               s.User,
+		Name:               s.Name,
+		UUID:               s.UUID,
+		ContainerItemCount: s.ItemCount,
+		IsVirtual:          true,
+		Query:              s.Query,
+		Version:            s.Version,
+		Created:            s.Created,
+		Modified:           s.Modified,
+	}
+}
+
+// SmartItems evaluates the item queries of smart containers.
+// The items module provides it since containers can not depend on items.
+type SmartItems interface {
+	// Validate reports a *fulltext.ParseError when the query can not be used to search items
+	Validate(query fulltext.Query) error
+	// Count the items of a user matching the query
+	Count(db *sql.DB, userID int64, query fulltext.Query) (int, error)
+}
+
+var smartItems SmartItems
+
+// RegisterSmartItems sets the evaluator of smart container queries.
+func RegisterSmartItems(s SmartItems) {
+	smartItems = s
+}
+
+// ParseSmartQuery parses and validates the query of a smart container.
+func ParseSmartQuery(input string) (fulltext.Query, error) {
+	query, err := fulltext.Parse(input)
+	if err != nil {
+		return query, err
+	}
+	if query.Empty() && len(query.Filters) == 0 {
+		return query, ErrEmptySmartQuery
+	}
+	if smartItems != nil {
+		err = smartItems.Validate(query)
+	}
+	return query, err
+}
@@ -0,0 +1,36 @@
+package containers_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+)
+
+func TestLeadPage(t *testing.T) {
+	smart := containers.Containers{{Name: "one"}, {Name: "two"}, {Name: "three"}}
+	tests := []struct {
+		page   int
+		lead   int
+		limit  int
+		offset int
+	}{
+		{1, 2, 0, 0},
+		{2, 1, 1, 0},
+		{3, 0, 2, 1},
+		{4, 0, 2, 3},
+	}
+	for _, test := range tests {
+		limit := models.QueryLimit{}
+		limit.SetPage(test.page, 2)
+		lead, containerLimit := containers.LeadPage(smart, limit)
+		if len(lead) != test.lead || containerLimit.Limit != test.limit || containerLimit.Offset != test.offset {
+			t.Errorf("Expected page %v to lead with %v smart containers and list %v from %v but got %v, %+v",
+				test.page, test.lead, test.limit, test.offset, len(lead), containerLimit)
+		}
+	}
+	limit := models.QueryLimit{Limit: 2, Cursor: &models.Cursor{}}
+	if lead, containerLimit := containers.LeadPage(smart, limit); len(lead) != 0 || containerLimit.Limit != 2 {
+		t.Errorf("Expected pages continued from a cursor to hold only real containers but got %v, %+v", len(lead), containerLimit)
+	}
+}
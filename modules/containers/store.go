@@ -2,52 +2,57 @@ package containers
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
-	"log"
 	"strings"
 	"sync"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/changelog"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
 	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/locations"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/go-sql-driver/mysql"
 )
 
-// QueryLimit is the maximum number of container results per page.
+// QueryLimit is the number of container results per page unless another is requested.
 const QueryLimit = 20
 
+// Sorter validates the sorts of container queries.
+var Sorter = models.Sorter{
+	Fields: map[string]string{
+		"modified": "modified",
+		"name":     "name",
+	},
+	Default: models.SortBy{Field: "modified", Direction: models.DSC},
+}
+
 // NewStore constructs a storage interface for containers.
 func NewStore(db *sql.DB) *Store {
 	return &Store{DB: db}
 }
 
+// As returns a copy of the store acting on behalf of the authenticated user actorID, the actor of the actions
+// it records in the audit log (see audit.NewEntry).
+func (c *Store) As(actorID int64) *Store {
+	store := *c
+	store.ActorID = actorID
+	return &store
+}
+
 // Store helps store and retrieve
 type Store struct {
 	DB *sql.DB
-}
-
-// GetSortBy will retrieve a SortBy object taylored for container queries
-func (c *Store) GetSortBy(field string, direction models.SortType) models.SortBy {
-	sortable := map[string]string{"modified": "modified", "name": "name"}
-	var sort models.SortBy
-	if _, ok := sortable[field]; ok {
-		sort.Field = field
-	} else {
-		sort.Field = "modified"
-	}
-	if direction == models.ASC {
-		sort.Direction = models.ASC
-	} else {
-		sort.Direction = models.DSC
-	}
-
-	return sort
+	// ActorID is the authenticated user taking the actions, the owner of the records when 0
+	ActorID int64
 }
 
 // Create persists a container to the database
 func (c *Store) Create(record *ContainerRecord) error {
 	if record.Name == "" {
-		return errors.New("Container must have a name")
+		return models.NewError(models.ErrValidation, "containers must have a name")
 	}
 	q := `
 		insert into containers (user_id, location_id, name, uuid, created, modified)
@@ -55,33 +60,61 @@ func (c *Store) Create(record *ContainerRecord) error {
 	`
 	tx, _ := c.DB.Begin()
 	res, err := tx.Exec(q, record.userID, record.locationID, record.Name)
+	var entry audit.Entry
+	if err == nil {
+		record.ID, _ = res.LastInsertId()
+		record.Version = 1
+		err = changelog.Changed(tx, changelog.Container, record.ID)
+	}
+	if err == nil {
+		entry = audit.NewEntry(c.ActorID, record.userID, audit.Container, record.ID, audit.ActionCreate, audit.Diff(nil, record.auditFields()))
+		err = audit.Record(tx, entry)
+	}
 	if err == nil && record.locationID > 0 {
 		err = updateContainerCount(tx, record.locationID)
 	}
 	if err == nil {
-		tx.Commit()
+		err = tx.Commit()
 	} else {
 		tx.Rollback()
 	}
-	record.ID, _ = res.LastInsertId()
-
-	return err
+	if err != nil {
+		return err
+	}
+	events.Committed(entry)
+	return nil
 }
 
 // Update a container
+// The container must not have changed since the record was made (see models.CheckVersion), its version is incremented.
 func (c *Store) Update(record *ContainerRecord) error {
 	if record.ID == 0 {
-		return errors.New("can not update a container without it first being persisted")
+		return models.NewError(models.ErrValidation, "can not update a container without it first being persisted")
 	}
 	if record.Name == "" {
-		return errors.New("containers must have a name")
+		return models.NewError(models.ErrValidation, "containers must have a name")
 	}
 	q := `
-		update containers set name = ?, location_id = ?, modified = now()
-		where id = ?
+		update containers set name = ?, location_id = ?, version = version + 1, modified = now()
+		where id = ? and version = ?
 	`
+	before, err := c.ByID(record.ID)
+	if err != nil {
+		return err
+	}
 	tx, _ := c.DB.Begin()
-	_, err := tx.Exec(q, record.Name, record.locationID, record.ID)
+	res, err := tx.Exec(q, record.Name, record.locationID, record.ID, record.Version)
+	if err == nil {
+		err = models.CheckVersion(res)
+	}
+	if err == nil {
+		err = changelog.Changed(tx, changelog.Container, record.ID)
+	}
+	changes := audit.Diff(before.auditFields(), record.auditFields())
+	entry := audit.NewEntry(c.ActorID, record.userID, audit.Container, record.ID, audit.ActionUpdate, changes)
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
 	if err == nil {
 		if record.locationID > 0 {
 			err = updateContainerCount(tx, record.locationID)
@@ -91,66 +124,222 @@ func (c *Store) Update(record *ContainerRecord) error {
 		}
 	}
 	if err == nil {
-		tx.Commit()
+		err = tx.Commit()
 	} else {
 		tx.Rollback()
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	record.Version++
+	events.Committed(entry)
+	return nil
 }
 
-// Delete will remove a container by its ID.
-// Note that due to the FK constrant set to cascade on deletion, this will
-// delete all the related items as well.
-func (c *Store) Delete(ID int64) error {
-	// Note, the FK has cascade deletion, so this will delete the items as well.
-	q := "delete from containers where id = ?"
+// Delete moves a container to the trash along with its items, provided it has not changed since it was retrieved, its version is incremented.
+// The items share the deletion time of the container so that they are restored with it, items already in the
+// trash are left as they are.
+func (c *Store) Delete(container *Container) error {
+	q := `
+		update containers set deleted = now(), version = version + 1
+		where id = ? and version = ? and deleted is null
+	`
+	entry := audit.NewEntry(c.ActorID, container.User.ID, audit.Container, container.ID, audit.ActionDelete, audit.Diff(container.auditFields(), nil))
+	var itemEntries []audit.Entry
 	tx, _ := c.DB.Begin()
-	_, err := tx.Exec(q, ID)
+	err := changelog.Record(tx, changelog.Item, true, "x.container_id = ? and x.deleted is null", container.ID)
+	if err == nil {
+		err = changelog.Deleted(tx, changelog.Container, container.ID)
+	}
+	if err == nil {
+		var res sql.Result
+		res, err = tx.Exec(q, container.ID, container.Version)
+		if err == nil {
+			err = models.CheckVersion(res)
+		}
+	}
+	if err == nil {
+		q = `
+			update container_items ci inner join containers c on c.id = ci.container_id
+			set ci.deleted = c.deleted
+			where c.id = ? and ci.deleted is null
+		`
+		_, err = tx.Exec(q, container.ID)
+	}
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil {
+		itemEntries, err = c.recordItems(tx, container, audit.ActionDelete)
+	}
+	if err == nil && container.Location != nil {
+		err = updateContainerCount(tx, container.Location.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	container.Version++
+	// The items went with the container, their events take them out of the search index too.
+	events.Committed(append([]audit.Entry{entry}, itemEntries...)...)
+	return nil
+}
+
+// Restore brings a container back from the trash along with the items deleted with it, provided it has not
+// changed since it was retrieved. Its item count is recomputed, as is the container count of its location.
+func (c *Store) Restore(container *Container) error {
+	entry := audit.NewEntry(c.ActorID, container.User.ID, audit.Container, container.ID, audit.ActionRestore, nil)
+	tx, err := c.DB.Begin()
 	if err != nil {
-		err = updateContainerCount(tx, ID)
+		return err
+	}
+	// The items are recorded before they are restored, while they share the deletion time of the container.
+	itemEntries, err := c.recordItems(tx, container, audit.ActionRestore)
+	q := `
+		update container_items ci inner join containers c on c.id = ci.container_id
+		set ci.deleted = null
+		where c.id = ? and ci.deleted = c.deleted
+	`
+	if err == nil {
+		_, err = tx.Exec(q, container.ID)
+	}
+	if err == nil {
+		q = `
+			update containers
+			set deleted = null, container_item_count = (
+				select count(*) from container_items where container_id = ? and deleted is null
+			), version = version + 1, modified = now()
+			where id = ? and version = ? and deleted is not null
+		`
+		var res sql.Result
+		res, err = tx.Exec(q, container.ID, container.ID, container.Version)
+		if err == nil {
+			err = models.CheckVersion(res)
+		}
+	}
+	if err == nil {
+		err = changelog.Changed(tx, changelog.Container, container.ID)
 	}
 	if err == nil {
-		tx.Commit()
+		err = changelog.Record(tx, changelog.Item, false, "x.container_id = ? and x.deleted is null", container.ID)
+	}
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil && container.Location != nil {
+		err = updateContainerCount(tx, container.Location.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
 	} else {
 		tx.Rollback()
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	container.Version++
+	container.Deleted = nil
+	events.Committed(append([]audit.Entry{entry}, itemEntries...)...)
+	return nil
+}
+
+// recordItems appends the action on the items that share the deletion time of a container (the items trashed
+// with it) to the audit log. The entries are returned to be published once the transaction is committed.
+func (c *Store) recordItems(tx *sql.Tx, container *Container, action string) ([]audit.Entry, error) {
+	q := `
+		select ci.id from container_items ci inner join containers c on c.id = ci.container_id
+		where c.id = ? and ci.deleted = c.deleted
+	`
+	rows, err := tx.Query(q, container.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	var changes audit.Changes
+	if action == audit.ActionDelete {
+		changes = audit.Diff(audit.Fields{"container_id": container.ID}, nil)
+	}
+	entries := make([]audit.Entry, len(ids))
+	for i, id := range ids {
+		entries[i] = audit.NewEntry(c.ActorID, container.User.ID, audit.Item, id, action, changes)
+		if err = audit.Record(tx, entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
 }
 
 // @todo consider moving this to a MySQL trigger
+// The count is part of the location so the change is recorded in the change log, its version is left unchanged
+// so that changing containers does not conflict with requests changing the location.
 func updateContainerCount(tx *sql.Tx, locationID int64) error {
 	q := `
 		update locations
 		set container_count = (
-			select count(*) from containers where location_id = ?
-		), modified = now()
+			select count(*) from containers where location_id = ? and deleted is null
+		)
 		where id = ?
 	`
 	_, err := tx.Exec(q, locationID, locationID)
-	return err
+	if err != nil {
+		return err
+	}
+	return changelog.Changed(tx, changelog.Location, locationID)
 }
 
-// ByID retrieves a container by its primary ID
+// ByID retrieves a container by its primary ID, containers in the trash are not found.
 func (c *Store) ByID(ID int64) (Container, error) {
+	return c.find(ID, false)
+}
+
+// TrashedByID retrieves a container in the trash by its primary ID.
+func (c *Store) TrashedByID(ID int64) (Container, error) {
+	return c.find(ID, true)
+}
+
+// find retrieves a container either out of or in the trash.
+func (c *Store) find(ID int64, trashed bool) (Container, error) {
 	var userID int64
 	var locationID int64
+	var deleted mysql.NullTime
 	q := `
-		select id, user_id, location_id, name, uuid, container_item_count, created, modified
+		select id, user_id, location_id, name, uuid, container_item_count, version, created, modified, deleted
 		from containers
-		where id = ?
+		where id = ? and (deleted is not null) = ?
 	`
 	var container Container
-	err := c.DB.QueryRow(q, ID).Scan(
+	err := c.DB.QueryRow(q, ID, trashed).Scan(
 		&container.ID,
 		&userID,
 		&locationID,
 		&container.Name,
 		&container.UUID,
 		&container.ContainerItemCount,
+		&container.Version,
 		&container.Created,
-		&container.Modified)
+		&container.Modified,
+		&deleted)
 	if err != nil {
-		return container, err
+		return container, models.NotFound(err, "container not found")
+	}
+	if deleted.Valid {
+		container.Deleted = &deleted.Time
 	}
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -171,73 +360,426 @@ func (c *Store) ByID(ID int64) (Container, error) {
 	return container, err
 }
 
-func (r *PagedResponse) getContainerIDMap() map[int64]*Container {
-	mappedContainers := make(map[int64]*Container)
-	for index, v := range r.Containers {
-		mappedContainers[v.ID] = &r.Containers[index]
+// OwnedBy retrieves a container by its primary ID on behalf of a user, containers of other users are forbidden.
+func (c *Store) OwnedBy(ID int64, userID int64) (Container, error) {
+	container, err := c.ByID(ID)
+	if err == nil {
+		err = models.CheckOwner(container.User.ID, userID, "container belongs to another user")
 	}
-	return mappedContainers
+	return container, err
+}
+
+// TrashedOwnedBy retrieves a container in the trash on behalf of a user, containers of other users are forbidden.
+func (c *Store) TrashedOwnedBy(ID int64, userID int64) (Container, error) {
+	container, err := c.TrashedByID(ID)
+	if err == nil {
+		err = models.CheckOwner(container.User.ID, userID, "container belongs to another user")
+	}
+	return container, err
+}
+
+// Trashed retrieves the containers of a user in the trash, most recently deleted first.
+// The item count of a trashed container is the number of items that are restored with it.
+func (c *Store) Trashed(user users.User) (Containers, error) {
+	q := `
+		select id from containers
+		where user_id = ? and deleted is not null
+		order by deleted desc, id desc
+	`
+	rows, err := c.DB.Query(q, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	trashed := make(Containers, 0, len(ids))
+	for _, id := range ids {
+		container, err := c.TrashedByID(id)
+		if err != nil {
+			return nil, err
+		}
+		trashed = append(trashed, container)
+	}
+	return trashed, nil
 }
 
 // FilteredContainers will retrieve paginated list of containers with provided filter params.
+// A query with filters that do not suit SearchFields results in a *fulltext.ParseError.
 func (c *Store) FilteredContainers(filter ContainerFilter, sort models.SortBy, limit models.QueryLimit) (PagedResponse, error) {
 	q := `
-		select SQL_CALC_FOUND_ROWS id, location_id, name, uuid, container_item_count, created, modified
+		select id, location_id, name, uuid, container_item_count, version, created, modified, %v
 		from containers
-		where user_id = ? %v
-		order by %v %v, id %v
-		limit %v offset %v
+		%v %v
+		%v
 	`
+	response := PagedResponse{
+		Containers: make([]Container, 0),
+	}
+	predicate, err := filter.Query.Compile(SearchFields)
+	if err != nil {
+		return response, err
+	}
+	keyset := models.Keyset{Sort: sort, Limit: limit}
+	keysetModifier, keysetArgs, err := keyset.Where()
+	if err != nil {
+		return response, err
+	}
 	locationIDQueryModifier := ""
 	queryArgs := []interface{}{filter.User.ID}
 	if len(filter.LocationIDs) > 0 {
 		locationIDQueryModifier = "and location_id in (?" + strings.Repeat(",?", len(filter.LocationIDs)-1) + ")"
 		queryArgs = append(queryArgs, filter.GenericLocationIDList()...)
 	}
-	q = fmt.Sprintf(q, locationIDQueryModifier, sort.Field, sort.Direction, sort.Direction, limit.Limit, limit.Offset)
-	rows, err := c.DB.Query(q, queryArgs...)
+	matchQueryModifier := ""
+	if !filter.Query.Empty() {
+		vocabulary, err := fulltext.LoadVocabulary(c.DB, filter.User.ID)
+		if err != nil {
+			return response, err
+		}
+		if suggestion, ok := vocabulary.Suggest(filter.Query); ok {
+			response.Suggestions = []string{suggestion}
+		}
+		results, err := fulltext.Open(c.DB).Search(fulltext.Request{
+			UserID: filter.User.ID,
+			Types:  []string{SearchType},
+			Query:  vocabulary.Fuzzy(filter.Query),
+		})
+		ids := results.IDs()
+		if err != nil || len(ids) == 0 {
+			return response, err
+		}
+		matchQueryModifier = "and id in (?" + strings.Repeat(",?", len(ids)-1) + ")"
+		for _, id := range ids {
+			queryArgs = append(queryArgs, id)
+		}
+	}
+	queryArgs = append(queryArgs, predicate.Args...)
+	where := fmt.Sprintf("where user_id = ? and deleted is null %v %v %v", locationIDQueryModifier, matchQueryModifier, predicate.And())
+	total, err := database.CountRows(c.DB, limit.Total, "select id from containers "+where, queryArgs...)
 	if err != nil {
-		log.Fatal(err)
+		return response, err
 	}
-	response := PagedResponse{
-		Containers: make([]Container, 0),
+	response.PagedResponse.SetTotal(total, limit)
+	q = fmt.Sprintf(q, keyset.Columns(), where, keysetModifier, keyset.OrderBy())
+	rows, err := c.DB.Query(q, append(queryArgs, keysetArgs...)...)
+	if err != nil {
+		return response, err
 	}
 	defer rows.Close()
 	locationIDs := make(map[int64]int64)
-	var locationID int64
+	values := make([][]interface{}, 0)
+	ids := make([]int64, 0)
 	for rows.Next() {
 		container := Container{}
-		rows.Scan(
+		var locationID sql.NullInt64
+		row, value := keyset.Scan(
 			&container.ID,
 			&locationID,
 			&container.Name,
 			&container.UUID,
 			&container.ContainerItemCount,
+			&container.Version,
 			&container.Created,
 			&container.Modified)
-		if locationID > 0 {
-			locationIDs[container.ID] = locationID
+		if err = rows.Scan(row...); err != nil {
+			return response, err
+		}
+		if locationID.Int64 > 0 {
+			locationIDs[container.ID] = locationID.Int64
 		}
 		response.Containers = append(response.Containers, container)
+		values = append(values, value)
+		ids = append(ids, container.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return response, err
 	}
+	keyset.Page(&response.Containers, values, ids, &response.PagedResponse)
 	response.PagedResponse.RequestTotal = len(response.Containers)
-	c.DB.QueryRow("select FOUND_ROWS()").Scan(&response.PagedResponse.Total)
-	var wg sync.WaitGroup
-	wg.Add(len(locationIDs))
-	containerMap := response.getContainerIDMap()
-	for k, v := range locationIDs {
-		go func(locationID int64, container *Container) {
-			defer wg.Done()
-			// @todo Instead of doing individual queries, make a query in locations to accept
-			// an array of IDs and do a single query
-			// For the time being this is fine because we limit the maximum results to QueryLimit (20)
-			location, _ := locations.NewStore(c.DB).ByID(locationID)
-			if location.ID > 0 {
-				container.Location = &location
-			}
-		}(v, containerMap[k])
-	}
-	response.PagedResponse.CalculatePages(limit)
-	wg.Wait()
-	return response, rows.Err()
+	return response, c.setLocations(response.Containers, locationIDs)
+}
+
+// setLocations sets the locations of containers, given the ID of the location of each container by container ID,
+// in a single query. Containers whose location is in the trash are presented without a location.
+func (c *Store) setLocations(containers Containers, locationIDs map[int64]int64) error {
+	IDs := make([]int64, 0, len(locationIDs))
+	for _, locationID := range locationIDs {
+		IDs = append(IDs, locationID)
+	}
+	found, err := locations.NewStore(c.DB).ByIDs(IDs)
+	if err != nil {
+		return err
+	}
+	for i := range containers {
+		if location, ok := found[locationIDs[containers[i].ID]]; ok {
+			containers[i].Location = &location
+		}
+	}
+	return nil
+}
+
+// ByIDs retrieves containers by their identifiers along with their users and locations, in a query for each.
+// Containers in the trash or that no longer exist are left out.
+func (c *Store) ByIDs(IDs []int64) (map[int64]Container, error) {
+	found := make(map[int64]Container, len(IDs))
+	if len(IDs) == 0 {
+		return found, nil
+	}
+	q := `
+		select id, user_id, location_id, name, uuid, container_item_count, version, created, modified
+		from containers
+		where id in (?%v) and deleted is null
+	`
+	args := make([]interface{}, len(IDs))
+	for i, ID := range IDs {
+		args[i] = ID
+	}
+	rows, err := c.DB.Query(fmt.Sprintf(q, strings.Repeat(",?", len(IDs)-1)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make(Containers, 0, len(IDs))
+	locationIDs := make(map[int64]int64)
+	owners := make(map[int64]users.User)
+	for rows.Next() {
+		var container Container
+		var locationID sql.NullInt64
+		err = rows.Scan(&container.ID, &container.User.ID, &locationID, &container.Name, &container.UUID,
+			&container.ContainerItemCount, &container.Version, &container.Created, &container.Modified)
+		if err != nil {
+			return nil, err
+		}
+		if locationID.Int64 > 0 {
+			locationIDs[container.ID] = locationID.Int64
+		}
+		owners[container.User.ID] = container.User
+		list = append(list, container)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for userID := range owners {
+		if owners[userID], err = users.NewStore(c.DB).ByID(userID); err != nil {
+			return nil, err
+		}
+	}
+	if err = c.setLocations(list, locationIDs); err != nil {
+		return nil, err
+	}
+	for _, container := range list {
+		container.User = owners[container.User.ID]
+		found[container.ID] = container
+	}
+	return found, nil
+}
+
+// ByLocations retrieves a page of the containers of each of the locations in a single query, the pages are grouped
+// by the ID of their location. The limit (and cursor) applies to every location, the totals are left unset.
+func (c *Store) ByLocations(parents locations.Locations, sort models.SortBy, limit models.QueryLimit) (map[int64]PagedResponse, error) {
+	found := make(map[int64]PagedResponse, len(parents))
+	if len(parents) == 0 {
+		return found, nil
+	}
+	keyset := models.Keyset{Sort: sort, Limit: limit}
+	keysetModifier, keysetArgs, err := keyset.Where()
+	if err != nil {
+		return nil, err
+	}
+	// A limited query per location, MySQL 5.6 has no window functions to limit the rows of each location
+	branch := fmt.Sprintf(`(
+		select id, location_id, name, uuid, container_item_count, version, created, modified, %v
+		from containers
+		where location_id = ? and deleted is null %v
+		%v
+	)`, keyset.ColumnsAs(), keysetModifier, keyset.OrderBy())
+	branches := make([]string, len(parents))
+	args := make([]interface{}, 0, len(parents)*(len(keysetArgs)+1))
+	byID := make(map[int64]*locations.Location, len(parents))
+	for i := range parents {
+		branches[i] = branch
+		args = append(append(args, parents[i].ID), keysetArgs...)
+		byID[parents[i].ID] = &parents[i]
+	}
+	q := fmt.Sprintf("select * from (%v) page %v", strings.Join(branches, " union all "), keyset.UnionOrderBy())
+	rows, err := c.DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[int64][][]interface{}, len(parents))
+	ids := make(map[int64][]int64, len(parents))
+	for rows.Next() {
+		var container Container
+		var locationID int64
+		row, value := keyset.Scan(&container.ID, &locationID, &container.Name, &container.UUID,
+			&container.ContainerItemCount, &container.Version, &container.Created, &container.Modified)
+		if err = rows.Scan(row...); err != nil {
+			return nil, err
+		}
+		container.Location = byID[locationID]
+		container.User = container.Location.User
+		page := found[locationID]
+		page.Containers = append(page.Containers, container)
+		found[locationID] = page
+		values[locationID] = append(values[locationID], value)
+		ids[locationID] = append(ids[locationID], container.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for locationID, page := range found {
+		keyset.Page(&page.Containers, values[locationID], ids[locationID], &page.PagedResponse)
+		page.PagedResponse.RequestTotal = len(page.Containers)
+		found[locationID] = page
+	}
+	return found, nil
+}
+
+// CreateSmart persists a smart container along with the number of items its query matches.
+func (c *Store) CreateSmart(smart *SmartContainer) error {
+	if smart.Name == "" {
+		return models.NewError(models.ErrValidation, "smart containers must have a name")
+	}
+	if err := c.countSmart(smart); err != nil {
+		return err
+	}
+	q := `
+		insert into smart_containers (user_id, uuid, name, query, item_count, created, modified)
+		values (?, uuid(), ?, ?, ?, now(), now())
+	`
+	res, err := c.DB.Exec(q, smart.User.ID, smart.Name, smart.Query, smart.ItemCount)
+	if err != nil {
+		return err
+	}
+	smart.ID, err = res.LastInsertId()
+	smart.Version = 1
+	return err
+}
+
+// UpdateSmart changes the name and query of a smart container and counts the items the query matches.
+// The smart container must not have changed since it was retrieved (see models.CheckVersion), its version is incremented.
+func (c *Store) UpdateSmart(smart *SmartContainer) error {
+	if smart.ID == 0 {
+		return models.NewError(models.ErrValidation, "can not update a smart container without it first being persisted")
+	}
+	if smart.Name == "" {
+		return models.NewError(models.ErrValidation, "smart containers must have a name")
+	}
+	if err := c.countSmart(smart); err != nil {
+		return err
+	}
+	q := "update smart_containers set name = ?, query = ?, item_count = ?, version = version + 1, modified = now() where id = ? and version = ?"
+	res, err := c.DB.Exec(q, smart.Name, smart.Query, smart.ItemCount, smart.ID, smart.Version)
+	if err == nil {
+		err = models.CheckVersion(res)
+	}
+	if err == nil {
+		smart.Version++
+	}
+	return err
+}
+
+// countSmart sets the number of items matching the query of a smart container.
+func (c *Store) countSmart(smart *SmartContainer) error {
+	query, err := fulltext.Parse(smart.Query)
+	if err != nil || smartItems == nil {
+		return err
+	}
+	smart.ItemCount, err = smartItems.Count(c.DB, smart.User.ID, query)
+	return err
+}
+
+// RecountSmart stores the number of items found by the last evaluation of the query of a smart container.
+// The count is not part of the version of the smart container.
+func (c *Store) RecountSmart(smart *SmartContainer, itemCount int) error {
+	if _, err := c.DB.Exec("update smart_containers set item_count = ? where id = ?", itemCount, smart.ID); err != nil {
+		return err
+	}
+	smart.ItemCount = itemCount
+	return nil
+}
+
+// DeleteSmart removes a smart container, provided it has not changed since it was retrieved.
+// The items it matched are not affected.
+func (c *Store) DeleteSmart(smart SmartContainer) error {
+	res, err := c.DB.Exec("delete from smart_containers where id = ? and version = ?", smart.ID, smart.Version)
+	if err != nil {
+		return err
+	}
+	return models.CheckVersion(res)
+}
+
+// SmartByID retrieves a smart container by its primary ID
+func (c *Store) SmartByID(ID int64) (SmartContainer, error) {
+	q := `
+		select id, user_id, uuid, name, query, item_count, version, created, modified
+		from smart_containers
+		where id = ?
+	`
+	var smart SmartContainer
+	var userID int64
+	err := c.DB.QueryRow(q, ID).Scan(&smart.ID, &userID, &smart.UUID, &smart.Name, &smart.Query, &smart.ItemCount, &smart.Version, &smart.Created, &smart.Modified)
+	if err != nil {
+		return smart, models.NotFound(err, "smart container not found")
+	}
+	smart.User, err = users.NewStore(c.DB).ByID(userID)
+	return smart, err
+}
+
+// SmartOwnedBy retrieves a smart container by its primary ID on behalf of a user, smart containers of other users are forbidden.
+func (c *Store) SmartOwnedBy(ID int64, userID int64) (SmartContainer, error) {
+	smart, err := c.SmartByID(ID)
+	if err == nil {
+		err = models.CheckOwner(smart.User.ID, userID, "smart container belongs to another user")
+	}
+	return smart, err
+}
+
+// SmartContainers retrieves all smart containers of a user ordered by name.
+func (c *Store) SmartContainers(user users.User) (SmartContainers, error) {
+	q := `
+		select id, uuid, name, query, item_count, version, created, modified
+		from smart_containers
+		where user_id = ?
+		order by name asc, id asc
+	`
+	smarts := make(SmartContainers, 0)
+	rows, err := c.DB.Query(q, user.ID)
+	if err != nil {
+		return smarts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		smart := SmartContainer{User: user}
+		if err = rows.Scan(&smart.ID, &smart.UUID, &smart.Name, &smart.Query, &smart.ItemCount, &smart.Version, &smart.Created, &smart.Modified); err != nil {
+			return smarts, err
+		}
+		smarts = append(smarts, smart)
+	}
+	return smarts, rows.Err()
+}
+
+// SmartAsContainers presents the smart containers of a user as virtual containers.
+// Their item counts are those stored when their queries were last evaluated, no search is run.
+func (c *Store) SmartAsContainers(user users.User) (Containers, error) {
+	smarts, err := c.SmartContainers(user)
+	if err != nil {
+		return nil, err
+	}
+	virtual := make(Containers, 0, len(smarts))
+	for _, smart := range smarts {
+		virtual = append(virtual, smart.ToContainer())
+	}
+	return virtual, nil
 }
@@ -0,0 +1,248 @@
+package containers_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/blob"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/trash"
+	"github.com/cjsaylor/sqlfixture"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var db *sql.DB
+
+func TestMain(m *testing.M) {
+	db, _ = sql.Open("mysql", fmt.Sprintf("%v?parseTime=true", config.Config.MysqlDSN))
+	defer db.Close()
+	setup(db)
+	os.Exit(m.Run())
+}
+
+func setup(db *sql.DB) {
+	db.Exec("SET FOREIGN_KEY_CHECKS=0")
+	fixture := sqlfixture.New(db, sqlfixture.Tables{
+		sqlfixture.Table{
+			Name: "users",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":        1,
+					"email":     "test@test.com",
+					"is_active": 1,
+					"created":   "2017-05-15",
+					"modified":  "2017-05-15",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "locations",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":              1,
+					"user_id":         1,
+					"uuid":            "ff1eda35-4183-11e7-9cc8-0242ac120003",
+					"name":            "My Garage",
+					"address":         "",
+					"container_count": 1,
+					"is_mappable":     false,
+					"created":         "2017-05-15",
+					"modified":        "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":              2,
+					"user_id":         1,
+					"uuid":            "ff1eda35-4183-11e7-9cc8-0242ac120004",
+					"name":            "Basement",
+					"address":         "",
+					"container_count": 0,
+					"is_mappable":     false,
+					"created":         "2017-05-15",
+					"modified":        "2017-05-15",
+					"deleted":         "2017-05-16",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "containers",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":                   1,
+					"user_id":              1,
+					"location_id":          1,
+					"uuid":                 "0a8e7c2e-4184-11e7-9cc8-0242ac120003",
+					"name":                 "Tools",
+					"container_item_count": 2,
+					"version":              1,
+					"created":              "2017-05-15",
+					"modified":             "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":                   2,
+					"user_id":              1,
+					"location_id":          2,
+					"uuid":                 "0a8e7c2e-4184-11e7-9cc8-0242ac120004",
+					"name":                 "Paint",
+					"container_item_count": 0,
+					"version":              1,
+					"created":              "2017-05-15",
+					"modified":             "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":                   3,
+					"user_id":              1,
+					"location_id":          nil,
+					"uuid":                 "0a8e7c2e-4184-11e7-9cc8-0242ac120005",
+					"name":                 "Old boxes",
+					"container_item_count": 0,
+					"version":              2,
+					"created":              "2017-05-15",
+					"modified":             "2017-05-15",
+					"deleted":              "2017-05-16",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "container_items",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":           1,
+					"container_id": 1,
+					"uuid":         "1b2c3d4e-4184-11e7-9cc8-0242ac120003",
+					"body":         "Hammer",
+					"quantity":     1,
+					"version":      1,
+					"created":      "2017-05-15",
+					"modified":     "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":           2,
+					"container_id": 1,
+					"uuid":         "1b2c3d4e-4184-11e7-9cc8-0242ac120004",
+					"body":         "Saw",
+					"quantity":     1,
+					"version":      1,
+					"created":      "2017-05-15",
+					"modified":     "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":           3,
+					"container_id": 1,
+					"uuid":         "1b2c3d4e-4184-11e7-9cc8-0242ac120005",
+					"body":         "Broken drill",
+					"quantity":     1,
+					"version":      2,
+					"created":      "2017-05-15",
+					"modified":     "2017-05-15",
+					"deleted":      "2017-05-16",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "photos",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":            1,
+					"user_id":       1,
+					"entity_type":   "container",
+					"entity_id":     3,
+					"uuid":          "2c3d4e5f-4184-11e7-9cc8-0242ac120003",
+					"content_type":  "image/jpeg",
+					"size":          4,
+					"width":         1,
+					"height":        1,
+					"blob_key":      "photos/old-boxes",
+					"thumbnail_key": "thumbnails/old-boxes",
+					"created":       "2017-05-15",
+				},
+			},
+		},
+	})
+	fixture.Populate()
+	db.Exec("truncate audit_log")
+	db.Exec("SET FOREIGN_KEY_CHECKS=1")
+}
+
+func count(t *testing.T, q string, args ...interface{}) int {
+	var result int
+	if err := db.QueryRow(q, args...).Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestStore_Restore(t *testing.T) {
+	setup(db)
+	containerModel := containers.NewStore(db).As(1)
+	container, err := containerModel.ByID(1)
+	if err == nil {
+		err = containerModel.Delete(&container)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if items := count(t, "select count(*) from container_items where container_id = 1 and deleted is null"); items != 0 {
+		t.Errorf("Expected the items to be trashed with the container but %v were left", items)
+	}
+	// The count is left stale so that restoring has to recompute it
+	if _, err = db.Exec("update containers set container_item_count = 5 where id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	container, err = containerModel.TrashedByID(1)
+	if err == nil {
+		err = containerModel.Restore(&container)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := containerModel.ByID(1)
+	if err != nil || result.ContainerItemCount != 2 {
+		t.Errorf("Expected the container to be restored with 2 items but got %+v (%v)", result, err)
+	}
+	if items := count(t, "select count(*) from container_items where container_id = 1 and deleted is null"); items != 2 {
+		t.Errorf("Expected the items trashed with the container to be restored but got %v", items)
+	}
+	if deleted := count(t, "select count(*) from container_items where id = 3 and deleted is not null"); deleted != 1 {
+		t.Error("Expected the item trashed before the container to stay in the trash")
+	}
+	if containerCount := count(t, "select container_count from locations where id = 1"); containerCount != 1 {
+		t.Errorf("Expected the container count of the location to be recomputed but got %v", containerCount)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	setup(db)
+	blobs := blob.NewLocalStore(t.TempDir())
+	for _, key := range []string{"photos/old-boxes", "thumbnails/old-boxes"} {
+		if err := blobs.Put(key, "image/jpeg", []byte("jpeg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trash.Purge(db, blobs, time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := containers.NewStore(db).TrashedByID(3); err == nil {
+		t.Error("Expected the trashed container to be purged")
+	}
+	if photos := count(t, "select count(*) from photos where entity_type = 'container' and entity_id = 3"); photos != 0 {
+		t.Errorf("Expected the photos of the purged container to be removed but %v were left", photos)
+	}
+	if _, err := blobs.Get("photos/old-boxes"); err != blob.ErrNotFound {
+		t.Errorf("Expected the stored photo to be removed but got %v", err)
+	}
+	container, err := containers.NewStore(db).ByID(2)
+	if err != nil || container.Location != nil {
+		t.Errorf("Expected the container to be detached from the purged location but got %+v (%v)", container, err)
+	}
+	audited := count(t, "select count(*) from audit_log where entity_type = 'container' and entity_id = 2 and action = 'update'")
+	if audited != 1 {
+		t.Errorf("Expected the detached container to be audited but got %v entries", audited)
+	}
+}
@@ -0,0 +1,61 @@
+package containers
+
+import (
+	"database/sql"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+)
+
+func init() {
+	undo.Register(audit.Container, reverse)
+}
+
+// reverse undoes a change to a container of a user (see undo.Reverser).
+// A deleted container is restored along with its items, a created container is deleted, an update is reverted
+// by moving the container back to its former location under its former name.
+func reverse(db *sql.DB, userID int64, op undo.Operation) error {
+	store := NewStore(db).As(userID)
+	record := op.Records[0]
+	if op.Action == undo.ActionDelete {
+		container, err := store.OwnedBy(record.ID, userID)
+		if err != nil {
+			return err
+		}
+		container.Version = record.Version
+		return store.Delete(&container)
+	}
+	if op.Action == undo.ActionRestore {
+		container, err := store.TrashedOwnedBy(record.ID, userID)
+		if err != nil {
+			return err
+		}
+		container.Version = record.Version
+		return store.Restore(&container)
+	}
+	var before struct {
+		Name       string `json:"name"`
+		LocationID int64  `json:"location_id"`
+	}
+	container, err := store.OwnedBy(record.ID, userID)
+	if err == nil {
+		err = record.DecodeBefore(&before)
+	}
+	if err != nil {
+		return err
+	}
+	containerRecord := container.ToRecord()
+	containerRecord.Version = record.Version
+	containerRecord.Name = before.Name
+	if before.LocationID > 0 {
+		location, err := locations.NewStore(db).OwnedBy(before.LocationID, userID)
+		if err != nil {
+			return err
+		}
+		containerRecord.SetLocation(&location)
+	} else {
+		containerRecord.SetLocation(nil)
+	}
+	return store.Update(&containerRecord)
+}
@@ -0,0 +1,277 @@
+package delta
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/changelog"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+)
+
+// applier applies the mutations of a user one at a time, each in its own transaction.
+type applier struct {
+	req  *http.Request
+	db   *sql.DB
+	user users.User
+	// created maps the ID of applied create mutations to the ID of the record they created
+	created map[string]int64
+}
+
+func newApplier(req *http.Request, db *sql.DB, user users.User) *applier {
+	return &applier{req: req, db: db, user: user, created: make(map[string]int64)}
+}
+
+// Apply stores a mutation and describes the outcome.
+func (a *applier) Apply(m Mutation) Result {
+	result := Result{ID: m.ID, RecordID: m.RecordID}
+	err := a.check(&m)
+	if err == nil {
+		switch m.Type {
+		case changelog.Container:
+			err = a.container(m, &result)
+		case changelog.Item:
+			err = a.item(m, &result)
+		case changelog.Location:
+			err = a.location(m, &result)
+		}
+	}
+	switch {
+	case errors.Is(err, models.ErrPreconditionFailed):
+		result.Status = StatusConflict
+		result.Current = a.current(m)
+	case err != nil:
+		problem := middleware.ProblemOf(a.req, err, "Unable to apply the mutation.")
+		result.Status = StatusRejected
+		result.Problem = &problem
+	default:
+		result.Status = StatusApplied
+		if m.Action == ActionCreate {
+			a.created[m.ID] = result.RecordID
+		}
+	}
+	return result
+}
+
+// check validates the envelope of a mutation and resolves its references.
+func (a *applier) check(m *Mutation) error {
+	var errs binding.Errors
+	if m.ID == "" {
+		errs.Add("id", "is required")
+	}
+	if m.Type != changelog.Container && m.Type != changelog.Item && m.Type != changelog.Location {
+		errs.Add("type", "must be container, item or location")
+	}
+	switch m.Action {
+	case ActionCreate:
+	case ActionUpdate, ActionDelete:
+		if m.RecordID <= 0 {
+			errs.Add("record_id", "is required")
+		}
+	default:
+		errs.Add("action", "must be create, update or delete")
+	}
+	if errs != nil {
+		return errs
+	}
+	if errs = m.ResolveRefs(a.created); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// current retrieves the stored record of a conflicting mutation, nil when it was removed.
+func (a *applier) current(m Mutation) interface{} {
+	var record interface{}
+	var err error
+	switch m.Type {
+	case changelog.Container:
+		record, err = containers.NewStore(a.db).ByID(m.RecordID)
+	case changelog.Item:
+		record, err = items.NewStore(a.db).ByID(m.RecordID)
+	case changelog.Location:
+		record, err = locations.NewStore(a.db).ByID(m.RecordID)
+	}
+	if err != nil {
+		return nil
+	}
+	return record
+}
+
+// checkVersion results in models.ErrPreconditionFailed when the record has changed since the mutation was made.
+func checkVersion(m Mutation, version int64) error {
+	if m.Version != 0 && m.Version != version {
+		return models.ErrPreconditionFailed
+	}
+	return nil
+}
+
+// bind sets the fields of dest changed by the data of a mutation and validates the result.
+func bind(m Mutation, dest interface{}) error {
+	if errs := m.Data.Apply(dest); errs != nil {
+		return errs
+	}
+	if errs := binding.Validate(dest); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func (a *applier) container(m Mutation, result *Result) error {
+	store := containers.NewStore(a.db).As(a.user.ID)
+	var container containers.Container
+	var err error
+	if m.Action != ActionCreate {
+		if container, err = store.OwnedBy(m.RecordID, a.user.ID); err != nil {
+			return err
+		}
+		if err = checkVersion(m, container.Version); err != nil {
+			return err
+		}
+	}
+	if m.Action == ActionDelete {
+		return store.Delete(&container)
+	}
+	data := containerData{Name: container.Name}
+	if container.Location != nil {
+		data.LocationID = container.Location.ID
+	}
+	if err = bind(m, &data); err != nil {
+		return err
+	}
+	record := containers.NewRecord(&a.user)
+	if m.Action == ActionUpdate {
+		record = container.ToRecord()
+	}
+	record.Name = data.Name
+	if data.LocationID > 0 {
+		location, err := locations.NewStore(a.db).OwnedBy(data.LocationID, a.user.ID)
+		if err != nil {
+			return err
+		}
+		record.SetLocation(&location)
+	} else {
+		record.SetLocation(nil)
+	}
+	if m.Action == ActionCreate {
+		err = store.Create(&record)
+	} else {
+		err = store.Update(&record)
+	}
+	if err != nil {
+		return err
+	}
+	result.RecordID = record.ID
+	result.Version = record.Version
+	return nil
+}
+
+func (a *applier) item(m Mutation, result *Result) error {
+	store := items.NewStore(a.db).As(a.user.ID)
+	var item items.ContainerItem
+	var err error
+	if m.Action != ActionCreate {
+		if item, err = store.OwnedBy(m.RecordID, a.user.ID); err != nil {
+			return err
+		}
+		if err = checkVersion(m, item.Version); err != nil {
+			return err
+		}
+	}
+	if m.Action == ActionDelete {
+		return store.Delete(&item)
+	}
+	data := itemData{
+		Body:        item.Body,
+		Quantity:    item.Quantity,
+		MinQuantity: item.MinQuantity,
+		Notes:       item.Notes,
+		Tags:        item.Tags,
+	}
+	if item.Container != nil {
+		data.ContainerID = item.Container.ID
+	}
+	if item.Expires != nil {
+		expires := item.Expires.Format(models.DateFormat)
+		data.Expires = &expires
+	}
+	if err = bind(m, &data); err != nil {
+		return err
+	}
+	if m.Action == ActionCreate {
+		container, err := containers.NewStore(a.db).OwnedBy(data.ContainerID, a.user.ID)
+		if err != nil {
+			return err
+		}
+		item.Container = &container
+	} else if data.ContainerID != item.Container.ID {
+		var errs binding.Errors
+		errs.Add("container_id", "can not be changed")
+		return errs
+	}
+	item.Body = data.Body
+	item.Quantity = data.Quantity
+	item.MinQuantity = data.MinQuantity
+	if item.MinQuantity != nil && *item.MinQuantity == 0 {
+		item.MinQuantity = nil
+	}
+	item.Expires = nil
+	if data.Expires != nil && *data.Expires != "" {
+		expires, _ := models.ParseDate(*data.Expires)
+		item.Expires = &expires
+	}
+	item.Notes = data.Notes
+	item.Tags = items.ParseTags(strings.Join(data.Tags, ","))
+	if m.Action == ActionCreate {
+		err = store.Create(&item)
+	} else {
+		err = store.Update(&item)
+	}
+	if err != nil {
+		return err
+	}
+	result.RecordID = item.ID
+	result.Version = item.Version
+	return nil
+}
+
+func (a *applier) location(m Mutation, result *Result) error {
+	store := locations.NewStore(a.db).As(a.user.ID)
+	location := locations.Location{User: a.user}
+	var err error
+	if m.Action != ActionCreate {
+		if location, err = store.OwnedBy(m.RecordID, a.user.ID); err != nil {
+			return err
+		}
+		if err = checkVersion(m, location.Version); err != nil {
+			return err
+		}
+	}
+	if m.Action == ActionDelete {
+		return store.Delete(&location)
+	}
+	data := locationData{Name: location.Name, Address: location.Address}
+	if err = bind(m, &data); err != nil {
+		return err
+	}
+	location.Name = data.Name
+	location.Address = data.Address
+	if m.Action == ActionCreate {
+		err = store.Create(&location)
+	} else {
+		err = store.Update(&location)
+	}
+	if err != nil {
+		return err
+	}
+	result.RecordID = location.ID
+	result.Version = location.Version
+	return nil
+}
@@ -0,0 +1,129 @@
+package delta
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+)
+
+// QueryLimit is the number of changed records per sync response.
+const QueryLimit = 100
+
+// MaxMutations is the largest batch of mutations applied by a single request.
+const MaxMutations = 100
+
+// Actions of mutations
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Statuses of mutation results
+const (
+	// StatusApplied is the status of mutations that were stored
+	StatusApplied = "applied"
+	// StatusConflict is the status of mutations of records changed since the version they were based on
+	StatusConflict = "conflict"
+	// StatusRejected is the status of mutations that are invalid or of records that can not be changed
+	StatusRejected = "rejected"
+)
+
+// Tombstone identifies a removed record.
+type Tombstone struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+// Response holds the records of a user changed since a sync token, in their current state.
+type Response struct {
+	Containers containers.Containers `json:"containers"`
+	Items      items.ContainerItems  `json:"items"`
+	Locations  locations.Locations   `json:"locations"`
+	Deleted    []Tombstone           `json:"deleted"`
+	// Token is sent as since by the next sync
+	Token string `json:"token"`
+	// HasMore is set when the changes did not fit the response, the next sync continues with them
+	HasMore bool `json:"has_more"`
+}
+
+// Mutation is a change of a record made by a client, possibly while offline.
+type Mutation struct {
+	// ID is chosen by the client to match the mutation with its result, and to refer to the record it creates
+	ID string `json:"id"`
+	// Type is the type of the record: container, item or location
+	Type string `json:"type"`
+	// Action is create, update or delete
+	Action   string `json:"action"`
+	RecordID int64  `json:"record_id"`
+	// Version is the version of the record the change is based on, the change conflicts when the record has
+	// changed since. Updates and deletes without a version are applied to the current record.
+	Version int64 `json:"version"`
+	// Data holds the fields of a created record, or the fields to change as a JSON merge patch
+	Data binding.Patch `json:"data"`
+	// Refs sets fields of Data to the ID of a record created by an earlier mutation, ie: {"container_id": "m1"}
+	Refs map[string]string `json:"refs"`
+}
+
+// Result is the outcome of a mutation.
+type Result struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	RecordID int64  `json:"record_id,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	// Current is the stored record when the mutation conflicts
+	Current interface{} `json:"current,omitempty"`
+	// Problem describes why a mutation was rejected
+	Problem *middleware.Problem `json:"problem,omitempty"`
+}
+
+// mutationsRequest is the body of requests applying mutations.
+type mutationsRequest struct {
+	Mutations []Mutation `json:"mutations"`
+}
+
+// ResolveRefs sets the fields of the data of a mutation referring to records created by earlier mutations
+// of the batch, created maps the ID of these mutations to the ID of the record they created.
+func (m *Mutation) ResolveRefs(created map[string]int64) binding.Errors {
+	var errs binding.Errors
+	for field, ref := range m.Refs {
+		id, ok := created[ref]
+		if !ok {
+			errs.Add(field, "refers to "+ref+" which did not create a record")
+			continue
+		}
+		if m.Data == nil {
+			m.Data = make(binding.Patch)
+		}
+		m.Data[field] = json.RawMessage(strconv.FormatInt(id, 10))
+	}
+	return errs
+}
+
+// containerData holds the fields of a container a mutation may set.
+type containerData struct {
+	Name       string `json:"name" validate:"required,max=36"`
+	LocationID int64  `json:"location_id"`
+}
+
+// itemData holds the fields of an item a mutation may set, the container is only set on creation.
+type itemData struct {
+	ContainerID int64        `json:"container_id" validate:"required"`
+	Body        string       `json:"body" validate:"required,max=100"`
+	Quantity    int          `json:"quantity" validate:"min=0"`
+	MinQuantity *int         `json:"min_quantity" validate:"min=0"`
+	Expires     *string      `json:"expires" validate:"date"`
+	Notes       string       `json:"notes"`
+	Tags        binding.List `json:"tags"`
+}
+
+// locationData holds the fields of a location a mutation may set.
+type locationData struct {
+	Name    string `json:"name" validate:"required,max=40"`
+	Address string `json:"address" validate:"max=250"`
+}
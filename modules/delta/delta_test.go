@@ -0,0 +1,22 @@
+package delta_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/modules/delta"
+)
+
+func TestResolveRefs(t *testing.T) {
+	m := delta.Mutation{ID: "m2", Type: "item", Action: delta.ActionCreate, Refs: map[string]string{"container_id": "m1"}}
+	if errs := m.ResolveRefs(map[string]int64{"m1": 12}); errs != nil {
+		t.Fatalf("Unexpected errors %v", errs)
+	}
+	if string(m.Data["container_id"]) != "12" {
+		t.Errorf("Expected container_id to be 12 but got %s", m.Data["container_id"])
+	}
+
+	m = delta.Mutation{ID: "m3", Type: "item", Action: delta.ActionCreate, Refs: map[string]string{"container_id": "m9"}}
+	if errs := m.ResolveRefs(map[string]int64{"m1": 12}); errs == nil {
+		t.Error("Expected a reference to an unknown mutation to fail")
+	}
+}
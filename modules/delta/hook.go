@@ -0,0 +1,161 @@
+package delta
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/changelog"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/gorilla/mux"
+
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin sync module routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "Sync",
+		Method:  "GET",
+		Pattern: "/api/sync",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(SyncHandler),
+	},
+	config.Route{
+		Name:    "ApplyMutations",
+		Method:  "POST",
+		Pattern: "/api/sync",
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(ApplyMutationsHandler),
+	},
+}
+
+// Apply hooks related to sync
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// SyncHandler retrieves the containers, items and locations of a user changed since a sync token,
+// and tombstones of those removed. The token of the response is sent as since by the next sync.
+// Query params:
+//   since (optional, everything is returned without a token)
+func SyncHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	since, err := changelog.ParseToken(req.URL.Query().Get("since"))
+	if err != nil {
+		middleware.WriteError(res, req, err, "")
+		return
+	}
+	// changes are sequenced and the latest sequence read first so changes made while the response is built are synced next time
+	latest, err := changelog.Latest(db, userID)
+	var changes []changelog.Change
+	if err == nil {
+		changes, err = changelog.Since(db, userID, since, QueryLimit+1)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the changes.")
+		return
+	}
+	response := Response{
+		Containers: make(containers.Containers, 0),
+		Items:      make(items.ContainerItems, 0),
+		Locations:  make(locations.Locations, 0),
+		Deleted:    make([]Tombstone, 0),
+		Token:      changelog.Token(since),
+	}
+	if len(changes) > QueryLimit {
+		changes = changes[:QueryLimit]
+		response.HasMore = true
+	}
+	containerStore := containers.NewStore(db)
+	itemStore := items.NewStore(db)
+	locationStore := locations.NewStore(db)
+	for _, change := range changes {
+		if change.Deleted {
+			response.Deleted = append(response.Deleted, Tombstone{Type: change.Type, ID: change.ID})
+			continue
+		}
+		switch change.Type {
+		case changelog.Container:
+			var container containers.Container
+			if container, err = containerStore.ByID(change.ID); err == nil {
+				response.Containers = append(response.Containers, container)
+			}
+		case changelog.Item:
+			var item items.ContainerItem
+			if item, err = itemStore.ByID(change.ID); err == nil {
+				response.Items = append(response.Items, item)
+			}
+		case changelog.Location:
+			var location locations.Location
+			if location, err = locationStore.ByID(change.ID); err == nil {
+				response.Locations = append(response.Locations, location)
+			}
+		}
+		// a record removed since its change was read is synced as a tombstone next time
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			middleware.WriteError(res, req, err, "Unable to retrieve the changes.")
+			return
+		}
+	}
+	switch {
+	case response.HasMore:
+		response.Token = changelog.Token(changes[len(changes)-1].Sequence)
+	case latest > since:
+		response.Token = changelog.Token(latest)
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(response)
+}
+
+// ApplyMutationsHandler applies a batch of changes made by a client, in order. Each mutation is applied
+// on its own, the results report whether it was applied, conflicts with a newer version of the record
+// (along with the current record) or was rejected.
+// Expected body (JSON):
+//   mutations (at most MaxMutations, see Mutation)
+func ApplyMutationsHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	var body mutationsRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	if len(body.Mutations) > MaxMutations {
+		var errs binding.Errors
+		errs.Add("mutations", "must not hold more than "+strconv.Itoa(MaxMutations)+" mutations")
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	user, err := users.NewStore(db).ByID(middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to find user to apply the mutations.")
+		return
+	}
+	applier := newApplier(req, db, user)
+	results := make([]Result, 0, len(body.Mutations))
+	for _, mutation := range body.Mutations {
+		results = append(results, applier.Apply(mutation))
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(map[string][]Result{
+		"results": results,
+	})
+}
@@ -0,0 +1,144 @@
+package graph_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/graphql"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/graph"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+)
+
+func TestSchemaFields(t *testing.T) {
+	sources := map[string]interface{}{
+		"User":      users.User{},
+		"Location":  locations.Location{},
+		"Container": containers.Container{},
+		"Item":      items.ContainerItem{},
+		"PageInfo":  models.PagedResponse{},
+	}
+	seen := make(map[string]bool)
+	var check func(object *graphql.Object)
+	check = func(object *graphql.Object) {
+		if seen[object.Name] {
+			return
+		}
+		seen[object.Name] = true
+		for name, field := range object.Fields {
+			if field.Type != nil {
+				check(field.Type)
+			}
+			source, ok := sources[object.Name]
+			if !ok || field.Resolve != nil {
+				continue
+			}
+			if _, err := graphql.DefaultResolver(graphql.Params{Source: source}, name); err != nil {
+				t.Errorf("Expected %v.%v to be a field of %T: %v", object.Name, name, source, err)
+			}
+		}
+	}
+	check(graph.Schema.Query)
+	for name := range sources {
+		if !seen[name] {
+			t.Errorf("Expected %v to be reachable from the query", name)
+		}
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	cases := []struct {
+		query   string
+		message string
+	}{
+		{`{ location { name } }`, `Field "location" argument "id" of type ID! is required but not provided.`},
+		{`{ items(first: 5) { nodes { body } } }`, `Field "items" argument "q" of type String! is required but not provided.`},
+		{`{ containers { nodes { password } } }`, `Cannot query field "password" on type "Container".`},
+		{`{ viewer { locations { nodes { containers { nodes { items { nodes { container { location { containers { nodes { id } } } } } } } } } } } }`, `The query is nested deeper than 10 fields.`},
+		{`{ containers(first: 100) { nodes { items(first: 100) { nodes { id } } } } }`, `The query may resolve more than 5000 objects.`},
+		{`{ locations { nodes { containers(q: "box") { nodes { id } } } } }`, `Unknown argument "q" on field "containers" of type "Location".`},
+	}
+	for _, c := range cases {
+		response := graphql.Execute(context.Background(), graph.Schema, graphql.Request{Query: c.query})
+		if len(response.Errors) == 0 || response.Errors[0].Message != c.message {
+			t.Errorf("Expected %q for %v, got %+v", c.message, c.query, response.Errors)
+		}
+	}
+}
+
+func TestRelationArgs(t *testing.T) {
+	relations := map[string]*graphql.Field{
+		"Location.containers": graph.Schema.Query.Fields["location"].Type.Fields["containers"],
+		"Container.items":     graph.Schema.Query.Fields["container"].Type.Fields["items"],
+	}
+	for name, field := range relations {
+		for _, arg := range []string{"first", "page", "after", "sort"} {
+			if _, ok := field.Args[arg]; !ok {
+				t.Errorf("Expected %v to accept %v", name, arg)
+			}
+		}
+	}
+}
+
+// introspectionQuery is the query of the schema sent by GraphiQL and most clients.
+const introspectionQuery = `
+	query IntrospectionQuery {
+		__schema {
+			queryType { name }
+			mutationType { name }
+			subscriptionType { name }
+			types { ...FullType }
+			directives { name description locations args { ...InputValue } }
+		}
+	}
+	fragment FullType on __Type {
+		kind name description
+		fields(includeDeprecated: true) { name description args { ...InputValue } type { ...TypeRef } isDeprecated deprecationReason }
+		inputFields { ...InputValue }
+		interfaces { ...TypeRef }
+		enumValues(includeDeprecated: true) { name description isDeprecated deprecationReason }
+		possibleTypes { ...TypeRef }
+	}
+	fragment InputValue on __InputValue { name description type { ...TypeRef } defaultValue }
+	fragment TypeRef on __Type {
+		kind name
+		ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } } }
+	}
+`
+
+func TestIntrospection(t *testing.T) {
+	response := graphql.Execute(context.Background(), graph.Schema, graphql.Request{Query: introspectionQuery})
+	if len(response.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", response.Errors[0])
+	}
+	encoded, err := json.Marshal(response.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Schema struct {
+			Types []struct {
+				Name string `json:"name"`
+			} `json:"types"`
+		} `json:"__schema"`
+	}
+	if err = json.Unmarshal(encoded, &data); err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, typ := range data.Schema.Types {
+		names[typ.Name] = true
+	}
+	for _, name := range []string{"Query", "User", "Location", "Container", "Item", "PageInfo", "LocationConnection"} {
+		if !names[name] {
+			t.Errorf("Expected %v to be introspected", name)
+		}
+	}
+	if names["JSON"] {
+		t.Error("Expected every field to be of a known type")
+	}
+}
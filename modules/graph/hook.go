@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/graphql"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/gorilla/mux"
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin graph routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "GraphQuery",
+		Method:  "GET",
+		Pattern: "/api/graphql",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(graphqlHandler),
+	},
+	config.Route{
+		Name:    "GraphQueryPost",
+		Method:  "POST",
+		Pattern: "/api/graphql",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(graphqlHandler),
+	},
+}
+
+// Apply hooks related to the graph
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// graphqlHandler runs a GraphQL query against the user's locations, containers and items (see Schema).
+// Expected body (JSON) or query params for GET requests:
+//   - query
+//   - variables (optional, a JSON object)
+//   - operationName (optional, when the query has several operations)
+// Queries that cannot be executed are answered with their errors and no data, fields that fail are null
+// and described by the errors of the response.
+func graphqlHandler(res http.ResponseWriter, req *http.Request) {
+	var request graphql.Request
+	if req.Method == "GET" {
+		params := req.URL.Query()
+		request.Query = params.Get("query")
+		request.OperationName = params.Get("operationName")
+		if variables := params.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				middleware.WriteProblem(res, req, middleware.BadRequest, "The variables must be a JSON object.")
+				return
+			}
+		}
+	} else if errs := binding.Decode(req, &request); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	if strings.TrimSpace(request.Query) == "" {
+		middleware.WriteProblem(res, req, middleware.BadRequest, "Must provide a query.")
+		return
+	}
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	ctx := context.WithValue(req.Context(), sessionKey, newSession(db, middleware.UserIDFromRequest(req)))
+	schema := Schema
+	// Errors of fields are described as the problems of the REST endpoints, internal errors are logged
+	schema.ErrorMessage = func(err error) string {
+		return middleware.ProblemOf(req, err, "Unable to resolve the field.").Detail
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(graphql.Execute(ctx, schema, request))
+}
@@ -0,0 +1,461 @@
+package graph
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/graphql"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+)
+
+// Limits of the queries of the graph
+const (
+	// MaxDepth is the deepest nesting of fields a query may select
+	MaxDepth = 10
+	// MaxFields is the most fields a query may select, aliases and fragments included
+	MaxFields = 200
+	// MaxNodes is the most locations, containers and items a query may resolve to, counting full pages of nodes
+	MaxNodes = 5000
+)
+
+// The object types of the graph, their fields are set by init as they refer to each other.
+var (
+	queryType     = &graphql.Object{Name: "Query"}
+	userType      = &graphql.Object{Name: "User"}
+	locationType  = &graphql.Object{Name: "Location"}
+	containerType = &graphql.Object{Name: "Container"}
+	itemType      = &graphql.Object{Name: "Item"}
+	pageInfoType  = &graphql.Object{Name: "PageInfo"}
+)
+
+// connectionTypes are the types of the pages of locations, containers and items.
+var (
+	locationConnectionType  = connectionType("LocationConnection", locationType)
+	containerConnectionType = connectionType("ContainerConnection", containerType)
+	itemConnectionType      = connectionType("ItemConnection", itemType)
+)
+
+// Schema is the graph of a user's locations, containers and items.
+// Lists are connections holding a page of nodes along with the meta data of the REST listings (see models.PagedResponse).
+var Schema = graphql.Schema{Query: queryType, MaxDepth: MaxDepth, MaxFields: MaxFields, MaxNodes: MaxNodes}
+
+// pageArgs are the arguments of connections, as the params of the REST listings:
+// first is the number of nodes per page, after a cursor continuing from a previous page in place of page
+// and sort the comma separated fields to sort by, - prefixed for descending (ie: name,-modified).
+var pageArgs = map[string]string{"first": "Int", "page": "Int", "after": "String", "sort": "String"}
+
+func init() {
+	queryType.Fields = graphql.Fields{
+		"viewer":     {Type: userType, Resolve: resolveViewer},
+		"location":   {Type: locationType, Args: map[string]string{"id": "ID!"}, Resolve: resolveLocation},
+		"locations":  {Type: locationConnectionType, Args: withArgs(pageArgs, "q", "String", "attached", "Boolean"), Resolve: resolveLocations, Cost: pageCost(locations.QueryLimit)},
+		"container":  {Type: containerType, Args: map[string]string{"id": "ID!"}, Resolve: resolveContainer},
+		"containers": {Type: containerConnectionType, Args: withArgs(pageArgs, "q", "String", "location_id", "[ID!]"), Resolve: resolveContainers, Cost: pageCost(containers.QueryLimit)},
+		"item":       {Type: itemType, Args: map[string]string{"id": "ID!"}, Resolve: resolveItem},
+		"items":      {Type: itemConnectionType, Args: withArgs(pageArgs, "q", "String!"), Resolve: resolveItems, Cost: pageCost(items.QueryLimit)},
+	}
+	userType.Fields = graphql.Fields{
+		"id":                   {Scalar: "ID!"},
+		"uuid":                 {Scalar: "String!"},
+		"email":                {Scalar: "String!"},
+		"is_active":            {Scalar: "Boolean!"},
+		"expiry_reminder_days": {Scalar: "Int!"},
+		"created":              {Scalar: "String!"},
+		"modified":             {Scalar: "String!"},
+		"locations":            queryType.Fields["locations"],
+		"containers":           queryType.Fields["containers"],
+		"items":                queryType.Fields["items"],
+	}
+	locationType.Fields = graphql.Fields{
+		"id":              {Scalar: "ID!"},
+		"uuid":            {Scalar: "String!"},
+		"name":            {Scalar: "String!"},
+		"address":         {Scalar: "String!"},
+		"container_count": {Scalar: "Int!"},
+		"version":         {Scalar: "Int!"},
+		"created":         {Scalar: "String!"},
+		"modified":        {Scalar: "String!"},
+		"containers":      {Type: containerConnectionType, Args: pageArgs, Resolve: resolveLocationContainers, Cost: pageCost(containers.QueryLimit)},
+	}
+	containerType.Fields = graphql.Fields{
+		"id":                   {Scalar: "ID!"},
+		"uuid":                 {Scalar: "String!"},
+		"name":                 {Scalar: "String!"},
+		"container_item_count": {Scalar: "Int!"},
+		"version":              {Scalar: "Int!"},
+		"created":              {Scalar: "String!"},
+		"modified":             {Scalar: "String!"},
+		"location":             {Type: locationType},
+		"items":                {Type: itemConnectionType, Args: pageArgs, Resolve: resolveContainerItems, Cost: pageCost(items.QueryLimit)},
+	}
+	itemType.Fields = graphql.Fields{
+		"id":             {Scalar: "ID!"},
+		"uuid":           {Scalar: "String!"},
+		"body":           {Scalar: "String!"},
+		"notes":          {Scalar: "String!"},
+		"tags":           {Scalar: "[String!]"},
+		"quantity":       {Scalar: "Int!"},
+		"min_quantity":   {Scalar: "Int"},
+		"expires":        {Scalar: "String"},
+		"is_checked_out": {Scalar: "Boolean!"},
+		"is_overdue":     {Scalar: "Boolean!"},
+		"version":        {Scalar: "Int!"},
+		"created":        {Scalar: "String!"},
+		"modified":       {Scalar: "String!"},
+		"score":          {Scalar: "Float"},
+		"snippet":        {Scalar: "String"},
+		"container":      {Type: containerType},
+	}
+	pageInfoType.Fields = graphql.Fields{
+		"request_total": {Scalar: "Int!"},
+		"total":         {Scalar: "Int!"},
+		"pages":         {Scalar: "Int!"},
+		"total_mode":    {Scalar: "String"},
+		"next_cursor":   {Scalar: "String"},
+		"prev_cursor":   {Scalar: "String"},
+	}
+}
+
+func connectionType(name string, nodeType *graphql.Object) *graphql.Object {
+	return &graphql.Object{Name: name, Fields: graphql.Fields{
+		"nodes":       {Type: nodeType, List: true},
+		"meta":        {Type: pageInfoType},
+		"suggestions": {Scalar: "[String!]"},
+	}}
+}
+
+// withArgs copies arguments adding pairs of names and types.
+func withArgs(args map[string]string, pairs ...string) map[string]string {
+	copied := make(map[string]string, len(args)+len(pairs)/2)
+	for name, typ := range args {
+		copied[name] = typ
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		copied[pairs[i]] = pairs[i+1]
+	}
+	return copied
+}
+
+// connection is a page of nodes.
+type connection struct {
+	Nodes       interface{}          `json:"nodes"`
+	Meta        models.PagedResponse `json:"meta"`
+	Suggestions []string             `json:"suggestions"`
+}
+
+type contextKey int
+
+const sessionKey contextKey = 0
+
+// session is the state shared by the resolvers of a request.
+type session struct {
+	db     *sql.DB
+	userID int64
+	user   *users.User
+	// batches are the batches of relations being loaded by field and arguments
+	batches map[string]*batch
+}
+
+// batch gathers the parents whose relation is loaded by a field with the same arguments.
+type batch struct {
+	parents map[int64]interface{}
+	loader  *graphql.Loader
+}
+
+func newSession(db *sql.DB, userID int64) *session {
+	return &session{db: db, userID: userID, batches: make(map[string]*batch)}
+}
+
+func sessionOf(ctx context.Context) *session {
+	return ctx.Value(sessionKey).(*session)
+}
+
+// viewer is the user making the request.
+func (s *session) viewer() (users.User, error) {
+	if s.user == nil {
+		user, err := users.NewStore(s.db).ByID(s.userID)
+		if err != nil {
+			return user, err
+		}
+		s.user = &user
+	}
+	return *s.user, nil
+}
+
+// load defers the retrieval of the relation of a parent, the relations of every parent loaded under the same key
+// are retrieved by a single call of retrieve, given the parents and returning the relations by parent ID.
+func (s *session) load(key string, ID int64, parent interface{}, retrieve func(parents []interface{}) (map[int64]interface{}, error)) graphql.Thunk {
+	b, ok := s.batches[key]
+	if !ok {
+		b = &batch{parents: make(map[int64]interface{})}
+		b.loader = graphql.NewLoader(func(keys []int64) (map[int64]interface{}, error) {
+			parents := make([]interface{}, len(keys))
+			for i, key := range keys {
+				parents[i] = b.parents[key]
+			}
+			return retrieve(parents)
+		})
+		s.batches[key] = b
+	}
+	b.parents[ID] = parent
+	return b.loader.Load(ID)
+}
+
+// parseID reads the ID argument of a field.
+func parseID(value interface{}) (int64, error) {
+	ID, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+	if err != nil || ID <= 0 {
+		return 0, models.NewError(models.ErrValidation, "invalid id")
+	}
+	return ID, nil
+}
+
+// queryLimit reads the pagination arguments of a connection, size nodes per page unless first is given.
+func queryLimit(args map[string]interface{}, size int) (models.QueryLimit, error) {
+	var limit models.QueryLimit
+	page, _ := args["page"].(int)
+	limit.SetPage(page, pageSize(args, size))
+	after, _ := args["after"].(string)
+	return limit, limit.SetCursor(after)
+}
+
+// pageSize is the first argument of a connection, size when it is not given, capped at MaxPerPage.
+func pageSize(args map[string]interface{}, size int) int {
+	first, _ := args["first"].(int)
+	return models.PageSize(strconv.Itoa(first), size, config.Config.MaxPerPage)
+}
+
+// pageCost is the cost of connections, the size of their pages (see graphql.Field).
+func pageCost(size int) func(args map[string]interface{}) int {
+	return func(args map[string]interface{}) int {
+		return pageSize(args, size)
+	}
+}
+
+// relationPage is a page of the relation of a record, holding total nodes in all.
+func relationPage(nodes interface{}, meta models.PagedResponse, total int, limit models.QueryLimit) connection {
+	page := connection{Nodes: nodes, Meta: meta}
+	page.Meta.SetTotal(total, limit)
+	return page
+}
+
+// batchKey identifies the relations of a field loaded with the same sort and page.
+func batchKey(field string, sort models.SortBy, limit models.QueryLimit, args map[string]interface{}) string {
+	after, _ := args["after"].(string)
+	return fmt.Sprintf("%v %v %v %v %v", field, sort, limit.Limit, limit.Offset, after)
+}
+
+func resolveViewer(p graphql.Params) (interface{}, error) {
+	return sessionOf(p.Context).viewer()
+}
+
+func resolveLocation(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	ID, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	return locations.NewStore(s.db).OwnedBy(ID, s.userID)
+}
+
+// resolveLocations lists the locations of the user, optionally those matching q or those attached to containers.
+func resolveLocations(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	user, err := s.viewer()
+	if err != nil {
+		return nil, err
+	}
+	input, _ := p.Args["sort"].(string)
+	sort, err := locations.Sorter.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryLimit(p.Args, locations.QueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	attached, _ := p.Args["attached"].(bool)
+	filter := locations.LocationFilter{User: user, IsAttachedToContainer: attached}
+	q, _ := p.Args["q"].(string)
+	if filter.Query, err = fulltext.Parse(q); err != nil {
+		return nil, err
+	}
+	response, err := locations.NewStore(s.db).FilteredLocations(filter, sort, limit)
+	if err != nil {
+		return nil, err
+	}
+	return connection{Nodes: response.Locations, Meta: response.PagedResponse}, nil
+}
+
+// resolveLocationContainers pages the containers of a location, the containers of every location of the level
+// are retrieved in a single query.
+func resolveLocationContainers(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	location := asLocation(p.Source)
+	input, _ := p.Args["sort"].(string)
+	sort, err := containers.Sorter.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryLimit(p.Args, containers.QueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	key := batchKey("Location.containers", sort, limit, p.Args)
+	return s.load(key, location.ID, location, func(parents []interface{}) (map[int64]interface{}, error) {
+		list := make(locations.Locations, len(parents))
+		for i, parent := range parents {
+			list[i] = parent.(locations.Location)
+		}
+		found, err := containers.NewStore(s.db).ByLocations(list, sort, limit)
+		if err != nil {
+			return nil, err
+		}
+		pages := make(map[int64]interface{}, len(list))
+		for _, location := range list {
+			page := found[location.ID]
+			if page.Containers == nil {
+				page.Containers = containers.Containers{}
+			}
+			pages[location.ID] = relationPage(page.Containers, page.PagedResponse, location.ContainerCount, limit)
+		}
+		return pages, nil
+	}), nil
+}
+
+func resolveContainer(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	ID, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	return containers.NewStore(s.db).OwnedBy(ID, s.userID)
+}
+
+// resolveContainers lists the containers of the user, optionally those matching q or within locations.
+// Smart containers are not listed.
+func resolveContainers(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	user, err := s.viewer()
+	if err != nil {
+		return nil, err
+	}
+	input, _ := p.Args["sort"].(string)
+	sort, err := containers.Sorter.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryLimit(p.Args, containers.QueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	filter := containers.ContainerFilter{User: user}
+	locationIDs, _ := p.Args["location_id"].([]interface{})
+	for _, locationID := range locationIDs {
+		filter.LocationIDs = append(filter.LocationIDs, locationID.(string))
+	}
+	q, _ := p.Args["q"].(string)
+	if filter.Query, err = fulltext.Parse(q); err != nil {
+		return nil, err
+	}
+	response, err := containers.NewStore(s.db).FilteredContainers(filter, sort, limit)
+	if err != nil {
+		return nil, err
+	}
+	return connection{Nodes: response.Containers, Meta: response.PagedResponse, Suggestions: response.Suggestions}, nil
+}
+
+// resolveContainerItems pages the items of a container, the items of every container of the level
+// are retrieved in a single query.
+func resolveContainerItems(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	container := asContainer(p.Source)
+	input, _ := p.Args["sort"].(string)
+	sort, err := items.Sorter.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryLimit(p.Args, items.QueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	key := batchKey("Container.items", sort, limit, p.Args)
+	return s.load(key, container.ID, container, func(parents []interface{}) (map[int64]interface{}, error) {
+		list := make(containers.Containers, len(parents))
+		for i, parent := range parents {
+			list[i] = parent.(containers.Container)
+		}
+		found, err := items.NewStore(s.db).ByContainers(list, sort, limit)
+		if err != nil {
+			return nil, err
+		}
+		pages := make(map[int64]interface{}, len(list))
+		for _, container := range list {
+			page := found[container.ID]
+			if page.Items == nil {
+				page.Items = items.ContainerItems{}
+			}
+			pages[container.ID] = relationPage(page.Items, page.PagedResponse, container.ContainerItemCount, limit)
+		}
+		return pages, nil
+	}), nil
+}
+
+func resolveItem(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	ID, err := parseID(p.Args["id"])
+	if err != nil {
+		return nil, err
+	}
+	return items.NewStore(s.db).OwnedBy(ID, s.userID)
+}
+
+// resolveItems ranks the items of the user against the full-text query q, by relevance unless sorted by fields.
+func resolveItems(p graphql.Params) (interface{}, error) {
+	s := sessionOf(p.Context)
+	sort := models.SortBy{Field: fulltext.SortRelevance, Direction: models.DSC}
+	if input, _ := p.Args["sort"].(string); input != "" && input != fulltext.SortRelevance {
+		var err error
+		if sort, err = items.Sorter.Parse(input); err != nil {
+			return nil, err
+		}
+	}
+	limit, err := queryLimit(p.Args, items.QueryLimit)
+	if err != nil {
+		return nil, err
+	}
+	q, _ := p.Args["q"].(string)
+	query, err := fulltext.Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	response, err := items.NewStore(s.db).SearchItems(s.userID, query, sort, limit)
+	if err != nil {
+		return nil, err
+	}
+	return connection{Nodes: response.Items, Meta: response.PagedResponse, Suggestions: response.Suggestions}, nil
+}
+
+// asLocation is the location a field is resolved for, listed locations are values and those of containers pointers.
+func asLocation(source interface{}) locations.Location {
+	if location, ok := source.(*locations.Location); ok {
+		return *location
+	}
+	return source.(locations.Location)
+}
+
+// asContainer is the container a field is resolved for, listed containers are values and those of items pointers.
+func asContainer(source interface{}) containers.Container {
+	if container, ok := source.(*containers.Container); ok {
+		return *container
+	}
+	return source.(containers.Container)
+}
@@ -0,0 +1,165 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/gorilla/mux"
+
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin audit log routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "Audit",
+		Method:  "GET",
+		Pattern: "/api/audit",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(auditHandler),
+	},
+	config.Route{
+		Name:    "ContainerHistory",
+		Method:  "GET",
+		Pattern: "/api/container/{id}/history",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(containerHistoryHandler),
+	},
+}
+
+// Apply hooks related to the audit log
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+var entityTypes = map[string]bool{audit.Container: true, audit.Item: true, audit.Location: true, audit.User: true}
+
+var actions = map[string]bool{audit.ActionCreate: true, audit.ActionUpdate: true, audit.ActionDelete: true, audit.ActionRestore: true}
+
+// auditHandler lists the actions taken on the records of the user, most recent first
+// Query params:
+//   entity_type (optional, container, item, location or user)
+//   entity_id (optional)
+//   action (optional, create, update, delete or restore)
+//   since (optional, YYYY-MM-DD or RFC 3339)
+//   until (optional, YYYY-MM-DD for the end of that day, or RFC 3339)
+//   page
+//   per_page (optional, audit.QueryLimit by default)
+//   cursor (optional, continues from the next or prev cursor of a previous response in place of page)
+//   total (optional, exact by default, estimate or none)
+func auditHandler(res http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	filter, errs := filterFromQuery(params)
+	if errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	filter.UserID = middleware.UserIDFromRequest(req)
+	writeEntries(res, req, db, filter)
+}
+
+// containerHistoryHandler lists the actions taken on a container, most recent first, it may be in the trash
+// Query params:
+//   action (optional, create, update, delete or restore)
+//   since, until, page, per_page, cursor and total (see auditHandler)
+func containerHistoryHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	containerID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	containerModel := containers.NewStore(db)
+	container, err := containerModel.OwnedBy(int64(containerID), userID)
+	if errors.Is(err, models.ErrNotFound) {
+		container, err = containerModel.TrashedOwnedBy(int64(containerID), userID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the container.")
+		return
+	}
+	params := req.URL.Query()
+	params.Set("entity_type", audit.Container)
+	params.Set("entity_id", strconv.FormatInt(container.ID, 10))
+	filter, errs := filterFromQuery(params)
+	if errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	filter.UserID = userID
+	writeEntries(res, req, db, filter)
+}
+
+// filterFromQuery reads the filter params of a request for audit entries.
+func filterFromQuery(params url.Values) (audit.Filter, binding.Errors) {
+	var errs binding.Errors
+	filter := audit.Filter{
+		EntityType: params.Get("entity_type"),
+		Action:     params.Get("action"),
+	}
+	if filter.EntityType != "" && !entityTypes[filter.EntityType] {
+		errs.Add("entity_type", "must be container, item, location or user")
+	}
+	if filter.Action != "" && !actions[filter.Action] {
+		errs.Add("action", "must be create, update, delete or restore")
+	}
+	if value := params.Get("entity_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			errs.Add("entity_id", "must be a positive number")
+		}
+		filter.EntityID = id
+	}
+	if value := params.Get("since"); value != "" {
+		since, err := models.ParseDate(value)
+		if err != nil {
+			errs.Add("since", "must be a date (YYYY-MM-DD) or a timestamp (RFC 3339)")
+		}
+		filter.Since = &since
+	}
+	if value := params.Get("until"); value != "" {
+		until, err := models.ParseDate(value)
+		if err != nil {
+			errs.Add("until", "must be a date (YYYY-MM-DD) or a timestamp (RFC 3339)")
+		}
+		if len(value) == len(models.DateFormat) {
+			until = until.Add(24 * time.Hour)
+		}
+		filter.Until = &until
+	}
+	return filter, errs
+}
+
+// writeEntries responds with the page of audit entries matching a filter requested by the paging params.
+func writeEntries(res http.ResponseWriter, req *http.Request, db *sql.DB, filter audit.Filter) {
+	limit, err := models.NewQueryLimit(req.URL.Query(), audit.QueryLimit, config.Config.MaxPerPage)
+	var response audit.PagedResponse
+	if err == nil {
+		response, err = audit.Entries(db, filter, limit)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the audit log.")
+		return
+	}
+	response.PagedResponse.SetLinks(req.URL)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(response)
+}
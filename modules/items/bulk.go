@@ -0,0 +1,177 @@
+package items
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// MaxBulkItems is the maximum number of items accepted in a single bulk request.
+const MaxBulkItems = 500
+
+// maxBodyLength mirrors the size of the container_items.body column.
+const maxBodyLength = 100
+
+var quantityPrefix = regexp.MustCompile(`^(\d+)\s*[xX]\s+(.+)$`)
+
+// BulkLine is a single item parsed out of a bulk request.
+type BulkLine struct {
+	Line     int    `json:"line"`
+	Body     string `json:"body"`
+	Quantity int    `json:"quantity"`
+}
+
+// BulkLineError describes an entry of a bulk request that could not be used.
+type BulkLineError struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// BulkResponse is the result of a bulk item creation.
+type BulkResponse struct {
+	IDs    []int64         `json:"ids"`
+	Errors []BulkLineError `json:"errors"`
+}
+
+type bulkJSONItem struct {
+	Body     string `json:"body"`
+	Quantity *int   `json:"quantity"`
+}
+
+// ParseBulkItems reads items from a request body.
+// The content type decides the format:
+//   application/json - an array of {"body": "", "quantity": 0} objects
+//   text/csv         - rows of body[,quantity] with an optional header row
+//   text/plain       - one item per line, optionally prefixed with a quantity ("3x batteries")
+// Lines that can not be used are reported as errors rather than failing the whole request.
+func ParseBulkItems(contentType string, body io.Reader) ([]BulkLine, []BulkLineError, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	var lines []BulkLine
+	var lineErrors []BulkLineError
+	switch mediaType {
+	case "application/json":
+		lines, lineErrors, err = parseBulkJSON(body)
+	case "text/csv":
+		lines, lineErrors, err = parseBulkCSV(body)
+	default:
+		lines, lineErrors, err = parseBulkText(body)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lines)+len(lineErrors) > MaxBulkItems {
+		return nil, nil, models.NewError(models.ErrValidation, fmt.Sprintf("a maximum of %d items may be created at once", MaxBulkItems))
+	}
+	return lines, lineErrors, nil
+}
+
+func parseBulkJSON(body io.Reader) ([]BulkLine, []BulkLineError, error) {
+	var entries []bulkJSONItem
+	if err := json.NewDecoder(body).Decode(&entries); err != nil {
+		return nil, nil, models.NewError(models.ErrValidation, fmt.Sprintf("invalid JSON item list: %v", err))
+	}
+	lines := make([]BulkLine, 0, len(entries))
+	lineErrors := make([]BulkLineError, 0)
+	for i, entry := range entries {
+		quantity := 1
+		if entry.Quantity != nil {
+			quantity = *entry.Quantity
+		}
+		line, lineErr := newBulkLine(i+1, entry.Body, quantity)
+		if lineErr != nil {
+			lineErrors = append(lineErrors, *lineErr)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, lineErrors, nil
+}
+
+func parseBulkCSV(body io.Reader) ([]BulkLine, []BulkLineError, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	lines := make([]BulkLine, 0)
+	lineErrors := make([]BulkLineError, 0)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, models.NewError(models.ErrValidation, fmt.Sprintf("invalid CSV: %v", err))
+		}
+		// Quoted fields may span lines, rows are reported by the line they start on
+		row, _ := reader.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "body") {
+			continue
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		quantity := 1
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			quantity, err = strconv.Atoi(strings.TrimSpace(record[1]))
+			if err != nil {
+				lineErrors = append(lineErrors, BulkLineError{Line: row, Text: "Quantity must be a whole number."})
+				continue
+			}
+		}
+		line, lineErr := newBulkLine(row, record[0], quantity)
+		if lineErr != nil {
+			lineErrors = append(lineErrors, *lineErr)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, lineErrors, nil
+}
+
+func parseBulkText(body io.Reader) ([]BulkLine, []BulkLineError, error) {
+	scanner := bufio.NewScanner(body)
+	lines := make([]BulkLine, 0)
+	lineErrors := make([]BulkLineError, 0)
+	for row := 1; scanner.Scan(); row++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		quantity := 1
+		if match := quantityPrefix.FindStringSubmatch(text); match != nil {
+			quantity, _ = strconv.Atoi(match[1])
+			text = match[2]
+		}
+		line, lineErr := newBulkLine(row, text, quantity)
+		if lineErr != nil {
+			lineErrors = append(lineErrors, *lineErr)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, lineErrors, scanner.Err()
+}
+
+func newBulkLine(row int, body string, quantity int) (BulkLine, *BulkLineError) {
+	body = strings.TrimSpace(body)
+	switch {
+	case body == "":
+		return BulkLine{}, &BulkLineError{Line: row, Text: "Item body is required."}
+	case utf8.RuneCountInString(body) > maxBodyLength:
+		return BulkLine{}, &BulkLineError{Line: row, Text: fmt.Sprintf("Item body must be %d characters or less.", maxBodyLength)}
+	case quantity <= 0:
+		return BulkLine{}, &BulkLineError{Line: row, Text: "Quantity must be greater than zero."}
+	}
+	return BulkLine{Line: row, Body: body, Quantity: quantity}, nil
+}
@@ -0,0 +1,86 @@
+package items_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+)
+
+func TestParseBulkItems_Text(t *testing.T) {
+	body := "3x AA batteries\n\nflashlight\n0x nothing\n12 X zip ties\n"
+	lines, lineErrors, err := items.ParseBulkItems("text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(lines) != 3 {
+		t.Errorf("Expected 3 lines but got %v", len(lines))
+		return
+	}
+	if lines[0].Body != "AA batteries" || lines[0].Quantity != 3 {
+		t.Errorf("Unexpected first line: %+v", lines[0])
+	}
+	if lines[1].Body != "flashlight" || lines[1].Quantity != 1 {
+		t.Errorf("Unexpected second line: %+v", lines[1])
+	}
+	if lines[2].Body != "zip ties" || lines[2].Quantity != 12 || lines[2].Line != 5 {
+		t.Errorf("Unexpected third line: %+v", lines[2])
+	}
+	if len(lineErrors) != 1 || lineErrors[0].Line != 4 {
+		t.Errorf("Expected an error on line 4 but got %+v", lineErrors)
+	}
+}
+
+func TestParseBulkItems_CSV(t *testing.T) {
+	body := "body,quantity\nhammer,2\n\"nails, assorted\"\nsaw,many\n"
+	lines, lineErrors, err := items.ParseBulkItems("text/csv", strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(lines) != 2 {
+		t.Errorf("Expected 2 lines but got %v", len(lines))
+		return
+	}
+	if lines[1].Body != "nails, assorted" || lines[1].Quantity != 1 {
+		t.Errorf("Unexpected second line: %+v", lines[1])
+	}
+	if len(lineErrors) != 1 || lineErrors[0].Line != 4 {
+		t.Errorf("Expected an error on line 4 but got %+v", lineErrors)
+	}
+}
+
+func TestParseBulkItems_JSON(t *testing.T) {
+	body := `[{"body": "tent", "quantity": 1}, {"body": "stakes"}, {"body": ""}]`
+	lines, lineErrors, err := items.ParseBulkItems("application/json", strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(lines) != 2 || lines[1].Quantity != 1 {
+		t.Errorf("Unexpected lines: %+v", lines)
+	}
+	if len(lineErrors) != 1 || lineErrors[0].Line != 3 {
+		t.Errorf("Expected an error on entry 3 but got %+v", lineErrors)
+	}
+	_, _, err = items.ParseBulkItems("application/json", strings.NewReader("{"))
+	if err == nil {
+		t.Error("Expected invalid JSON to fail.")
+	}
+}
+
+func TestParseBulkItems_CSVMultiline(t *testing.T) {
+	body := "\"first aid kit,\nbandages\",1\nsaw,many\n" + strings.Repeat("é", 100) + "\n"
+	lines, lineErrors, err := items.ParseBulkItems("text/csv", strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(lines) != 2 || lines[1].Line != 4 {
+		t.Errorf("Expected a body of 100 characters on line 4 but got %+v", lines)
+	}
+	if len(lineErrors) != 1 || lineErrors[0].Line != 3 {
+		t.Errorf("Expected an error on line 3 but got %+v", lineErrors)
+	}
+}
@@ -3,14 +3,21 @@ package items
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/binding"
 	"github.com/cjsaylor/boxmeup-go/config"
 	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
 	"github.com/cjsaylor/boxmeup-go/middleware"
 	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 	chain "github.com/justinas/alice"
@@ -24,19 +31,37 @@ var routes = []config.Route{
 		Name:    "CreateContainerItem",
 		Method:  "POST",
 		Pattern: "/api/container/{id}/item",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(saveContainerItemHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(saveContainerItemHandler),
+	},
+	config.Route{
+		Name:    "CreateContainerItemsBulk",
+		Method:  "POST",
+		Pattern: "/api/container/{id}/item/bulk",
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(bulkCreateContainerItemsHandler),
 	},
 	config.Route{
 		Name:    "ModifyContainerItem",
 		Method:  "PUT",
 		Pattern: "/api/container/{id}/item/{item_id}",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(saveContainerItemHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadItem, "Unable to retrieve item to modify.")).ThenFunc(saveContainerItemHandler),
+	},
+	config.Route{
+		Name:    "ContainerItem",
+		Method:  "GET",
+		Pattern: "/api/container/{id}/item/{item_id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(containerItemHandler),
+	},
+	config.Route{
+		Name:    "PatchContainerItem",
+		Method:  "PATCH",
+		Pattern: "/api/container/{id}/item/{item_id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadItem, "Unable to retrieve item to modify.")).ThenFunc(patchContainerItemHandler),
 	},
 	config.Route{
 		Name:    "DeleteItems",
 		Method:  "DELETE",
 		Pattern: "/api/container/{id}/item/{item_id}",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(deleteContainerItemHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadItem, "Unable to retrieve the item.")).ThenFunc(deleteContainerItemHandler),
 	},
 	config.Route{
 		Name:    "DeleteItemsBulk",
@@ -50,12 +75,54 @@ var routes = []config.Route{
 		Pattern: "/api/container/{id}/item",
 		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(containerItemsHandler),
 	},
+	config.Route{
+		Name:    "IncrementItemQuantity",
+		Method:  "POST",
+		Pattern: "/api/item/{id}/quantity/increment",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(adjustQuantityHandler(1)),
+	},
+	config.Route{
+		Name:    "DecrementItemQuantity",
+		Method:  "POST",
+		Pattern: "/api/item/{id}/quantity/decrement",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(adjustQuantityHandler(-1)),
+	},
+	config.Route{
+		Name:    "RestoreItem",
+		Method:  "POST",
+		Pattern: "/api/item/{id}/restore",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadTrashedItem, "Unable to retrieve the item from the trash.")).ThenFunc(restoreItemHandler),
+	},
+	config.Route{
+		Name:    "ItemQuantityHistory",
+		Method:  "GET",
+		Pattern: "/api/item/{id}/quantity/history",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(quantityHistoryHandler),
+	},
+	config.Route{
+		Name:    "ExpiringItems",
+		Method:  "GET",
+		Pattern: "/api/item/expiring",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(expiringItemsHandler),
+	},
+	config.Route{
+		Name:    "LowStockItems",
+		Method:  "GET",
+		Pattern: "/api/item/low-stock",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(lowStockHandler),
+	},
 	config.Route{
 		Name:    "Items",
 		Method:  "GET",
 		Pattern: "/api/item/search",
 		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(searchItemHandler),
 	},
+	config.Route{
+		Name:    "SmartContainerItems",
+		Method:  "GET",
+		Pattern: "/api/smart-container/{id}/item",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(smartContainerItemsHandler),
+	},
 }
 
 // Apply hooks related to items
@@ -69,8 +136,67 @@ func (h Hook) Apply(router *mux.Router) {
 	}
 }
 
+// loadItem retrieves the item of a container a request changes on behalf of its user.
+func loadItem(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	vars := mux.Vars(req)
+	containerID, _ := strconv.Atoi(vars["id"])
+	itemID, _ := strconv.Atoi(vars["item_id"])
+	item, err := NewStore(db).OwnedBy(int64(itemID), middleware.UserIDFromRequest(req))
+	if err == nil && item.Container.ID != int64(containerID) {
+		err = models.NewError(models.ErrNotFound, "item not found in this container")
+	}
+	return item, err
+}
+
+// loadTrashedItem retrieves the item in the trash a request restores on behalf of its user.
+func loadTrashedItem(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	itemID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	item, err := NewStore(db).TrashedOwnedBy(int64(itemID), middleware.UserIDFromRequest(req))
+	return item, err
+}
+
 type bulkDeleteID struct {
-	IDs []int64 `json:"ids"`
+	IDs []int64 `json:"ids" validate:"required"`
+}
+
+// itemRequest is the body of requests creating or updating an item, fields that are not given are left as they are.
+type itemRequest struct {
+	Body        *string       `json:"body" validate:"max=100"`
+	Quantity    *int          `json:"quantity" validate:"min=1"`
+	MinQuantity *int          `json:"min_quantity" validate:"min=0"`
+	Expires     *string       `json:"expires"`
+	Notes       *string       `json:"notes"`
+	Tags        *binding.List `json:"tags"`
+}
+
+func (r itemRequest) Validate() binding.Errors {
+	var errs binding.Errors
+	if r.Expires != nil && *r.Expires != "" && *r.Expires != "none" {
+		if _, err := models.ParseDate(*r.Expires); err != nil {
+			errs.Add("expires", "must be a date in the form of YYYY-MM-DD or none")
+		}
+	}
+	return errs
+}
+
+// itemPatch holds the fields of an item a partial update may change.
+type itemPatch struct {
+	Body        string       `json:"body" validate:"required,max=100"`
+	Quantity    int          `json:"quantity" validate:"min=0"`
+	MinQuantity *int         `json:"min_quantity" validate:"min=0"`
+	Expires     *string      `json:"expires" validate:"date"`
+	Notes       string       `json:"notes"`
+	Tags        binding.List `json:"tags"`
+}
+
+// quantityRequest is the body of requests adjusting the quantity of an item.
+type quantityRequest struct {
+	Amount *int   `json:"amount" validate:"min=1"`
+	Reason string `json:"reason" validate:"max=255"`
 }
 
 type bulkItemRetrieval struct {
@@ -98,6 +224,12 @@ func (b *bulkItemRetrievals) items() *ContainerItems {
 }
 
 // ContainerItemsHandler is an interface into items of a container
+// Query params:
+//   sort (optional, comma separated fields, - prefixed for descending, ie: body,-modified)
+//   sort_field (optional, when sort is not given)
+//   sort_dir
+//   page
+//   per_page (optional, QueryLimit by default)
 // @todo Consider syncing some of the non-related queries to go routines
 func containerItemsHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
@@ -106,64 +238,143 @@ func containerItemsHandler(res http.ResponseWriter, req *http.Request) {
 	jsonOut := json.NewEncoder(res)
 	vars := mux.Vars(req)
 	containerID, _ := strconv.Atoi(vars["id"])
-	container, err := containers.NewStore(db).ByID(int64(containerID))
+	container, err := containers.NewStore(db).OwnedBy(int64(containerID), userID)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Container not found."})
-		return
-	}
-	if container.User.ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to view items in this container."})
+		middleware.WriteError(res, req, err, "Unable to retrieve the container.")
 		return
 	}
 	params := req.URL.Query()
 	var limit models.QueryLimit
 	page, _ := strconv.Atoi(params.Get("page"))
-	limit.SetPage(page, QueryLimit)
+	limit.SetPage(page, models.PageSize(params.Get("per_page"), QueryLimit, config.Config.MaxPerPage))
 	itemModel := NewStore(db)
-	sort := itemModel.GetSortBy(params.Get("sort_field"), models.SortType(params.Get("sort_dir")))
-	response, err := itemModel.GetContainerItems(&container, sort, limit)
+	sort, err := Sorter.FromQuery(params)
+	var response PagedResponse
+	if err == nil {
+		response, err = itemModel.GetContainerItems(&container, sort, limit)
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Unable to retrieve container items."})
+		middleware.WriteError(res, req, err, "Unable to retrieve container items.")
 		return
 	}
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(response)
 }
 
+// searchSort reads the sort of an item search, relevance unless fields are requested.
+func searchSort(params url.Values) (models.SortBy, error) {
+	requested := params.Get("sort")
+	if requested == "" {
+		requested = params.Get("sort_field")
+	}
+	if requested == "" || requested == fulltext.SortRelevance {
+		return models.SortBy{Field: fulltext.SortRelevance, Direction: models.DSC}, nil
+	}
+	return Sorter.FromQuery(params)
+}
+
+// searchItemHandler ranks a user's items against a full-text query
+// Query params:
+//   term (words, "quoted phrases", prefix* and -excluded words along with filters such as
+//     location:garage qty>2 tag:tools modified:<2024-01-01, see SearchFields)
+//   sort (optional, relevance by default or comma separated fields, - prefixed for descending, ie: body,-modified)
+//   sort_field (optional, when sort is not given)
+//   sort_dir
+//   page
+//   per_page (optional, QueryLimit by default)
+//   cursor (optional, continues from the next or prev cursor of a previous response, not available for relevance)
+//   total (optional, exact by default, estimate or none)
 func searchItemHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
 	userID := int64(req.Context().Value(middleware.UserContextKey).(jwt.MapClaims)["id"].(float64))
 	params := req.URL.Query()
-	var limit models.QueryLimit
 	term := params.Get("term")
 	jsonOut := json.NewEncoder(res)
 	if term == "" {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Must provide a search term."})
+		middleware.WriteProblem(res, req, middleware.BadRequest, "Must provide a search term.")
 		return
 	}
-	page, _ := strconv.Atoi(params.Get("page"))
-	limit.SetPage(page, containers.QueryLimit)
+	limit, err := models.NewQueryLimit(params, QueryLimit, config.Config.MaxPerPage)
 	itemModel := NewStore(db)
-	sort := itemModel.GetSortBy(params.Get("sort_field"), models.SortType(params.Get("sort_dir")))
-	response, err := itemModel.SearchItems(int64(userID), term, sort, limit)
+	var sort models.SortBy
+	if err == nil {
+		sort, err = searchSort(params)
+	}
+	var query fulltext.Query
+	if err == nil {
+		query, err = fulltext.Parse(term)
+	}
+	var response PagedResponse
+	if err == nil {
+		response, err = itemModel.SearchItems(int64(userID), query, sort, limit)
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Unable to retrieve items."})
+		middleware.WriteError(res, req, err, "Unable to retrieve items.")
 		return
 	}
+	response.PagedResponse.SetLinks(req.URL)
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(response)
+}
+
+// smartContainerItemsHandler lists the items currently matching the query of a smart container
+// Query params:
+//   sort (optional, relevance by default or comma separated fields, - prefixed for descending, ie: body,-modified)
+//   sort_field (optional, when sort is not given)
+//   sort_dir
+//   page
+//   per_page (optional, QueryLimit by default)
+//   cursor (optional, continues from the next or prev cursor of a previous response, not available for relevance)
+//   total (optional, exact by default, estimate or none)
+func smartContainerItemsHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	params := req.URL.Query()
+	jsonOut := json.NewEncoder(res)
+	smartID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	smart, err := containers.NewStore(db).SmartOwnedBy(int64(smartID), userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the smart container.")
+		return
+	}
+	limit, err := models.NewQueryLimit(params, QueryLimit, config.Config.MaxPerPage)
+	var sort models.SortBy
+	if err == nil {
+		sort, err = searchSort(params)
+	}
+	var query fulltext.Query
+	if err == nil {
+		query, err = containers.ParseSmartQuery(smart.Query)
+	}
+	var response PagedResponse
+	if err == nil {
+		response, err = NewStore(db).SearchItems(userID, query, sort, limit)
+	}
+	// The item count shown in container listings is refreshed whenever the items are counted exactly.
+	if err == nil && limit.Total.Exact() && response.PagedResponse.Total != smart.ItemCount {
+		err = containers.NewStore(db).RecountSmart(&smart, response.PagedResponse.Total)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve items.")
+		return
+	}
+	// Misspellings are part of the saved query so corrections are not offered.
+	response.Suggestions = nil
+	response.PagedResponse.SetLinks(req.URL)
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(response)
 }
 
 // SaveContainerItemHandler allows creation of a container from a POST method
-// Expected body:
+// Expected body (JSON or form):
 //   body
 //   quantity
+//   min_quantity (optional, 0 removes the low stock threshold)
+//   expires (optional, YYYY-MM-DD or "none" to remove the expiry date)
+//   notes (optional, empty removes the notes)
+//   tags (optional, a list or comma separated, empty removes all tags)
 func saveContainerItemHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
@@ -171,93 +382,364 @@ func saveContainerItemHandler(res http.ResponseWriter, req *http.Request) {
 	jsonOut := json.NewEncoder(res)
 	vars := mux.Vars(req)
 	containerID, _ := strconv.Atoi(vars["id"])
-	container, err := containers.NewStore(db).ByID(int64(containerID))
+	container, err := containers.NewStore(db).OwnedBy(int64(containerID), userID)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Failed to retrieve the container."})
+		middleware.WriteError(res, req, err, "Failed to retrieve the container.")
 		return
 	}
-	if container.User.ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to modify this container."})
+	var body itemRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
 		return
 	}
-	itemModel := NewStore(db)
-	quantity, _ := strconv.Atoi(req.PostFormValue("quantity"))
-	var item ContainerItem
-	if _, ok := vars["item_id"]; ok {
-		itemID, _ := strconv.Atoi(vars["item_id"])
-		item, err = itemModel.ByID(int64(itemID))
-		if err != nil {
-			jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Unable to retrieve item to modify."})
-		}
-	} else {
+	itemModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	item, ok := middleware.RecordFromRequest(req).(ContainerItem)
+	if !ok {
 		item = ContainerItem{
 			Container: &container,
 		}
 	}
-	if quantity > 0 {
-		item.Quantity = quantity
+	before := item.auditFields()
+	if body.Quantity != nil {
+		item.Quantity = *body.Quantity
+	}
+	if body.Body != nil && *body.Body != "" {
+		item.Body = *body.Body
 	}
-	if body := req.PostFormValue("body"); body != "" {
-		item.Body = body
+	if body.Notes != nil {
+		item.Notes = *body.Notes
+	}
+	if body.Tags != nil {
+		item.Tags = ParseTags(strings.Join(*body.Tags, ","))
+	}
+	if body.MinQuantity != nil {
+		if *body.MinQuantity == 0 {
+			item.MinQuantity = nil
+		} else {
+			item.MinQuantity = body.MinQuantity
+		}
+	}
+	if body.Expires != nil && *body.Expires == "none" {
+		item.Expires = nil
+	} else if body.Expires != nil && *body.Expires != "" {
+		expires, _ := models.ParseDate(*body.Expires)
+		item.Expires = &expires
 	}
 	if _, ok := vars["item_id"]; ok {
 		itemID, _ := strconv.Atoi(vars["item_id"])
 		item.ID = int64(itemID)
-		err = itemModel.Update(item)
-	} else {
-		err = itemModel.Create(&item)
+		if err = itemModel.Update(&item); err == nil {
+			undo.Offer(res, req, db, undo.NewRevert(audit.Item, item.ID, item.Version, before))
+		}
+	} else if err = itemModel.Create(&item); err == nil {
+		op := undo.NewDelete(audit.Item)
+		op.Add(item.ID, item.Version)
+		undo.Offer(res, req, db, op)
 	}
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -4, Text: "Unable to create container item"})
+		middleware.WriteError(res, req, err, "Unable to save the container item.")
 		return
 	}
+	middleware.SetETag(res, item)
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(map[string]int64{
 		"id": item.ID,
 	})
 }
 
-// DeleteContainerItemHandler will remove an item from a container and update the container count.
-func deleteContainerItemHandler(res http.ResponseWriter, req *http.Request) {
+// patchContainerItemHandler changes only the fields of an item given in a partial update
+// Expected body (JSON merge patch or JSON patch):
+//   body (optional)
+//   quantity (optional)
+//   min_quantity (optional, null or 0 removes the low stock threshold)
+//   expires (optional, YYYY-MM-DD or null to remove the expiry date)
+//   notes (optional, null removes the notes)
+//   tags (optional, a list or comma separated, null removes all tags)
+func patchContainerItemHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	itemModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	item := middleware.RecordFromRequest(req).(ContainerItem)
+	before := item.auditFields()
+	body := itemPatch{
+		Body:        item.Body,
+		Quantity:    item.Quantity,
+		MinQuantity: item.MinQuantity,
+		Notes:       item.Notes,
+		Tags:        item.Tags,
+	}
+	if item.Expires != nil {
+		expires := item.Expires.Format(models.DateFormat)
+		body.Expires = &expires
+	}
+	if _, errs := binding.BindPatch(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	item.Body = body.Body
+	item.Quantity = body.Quantity
+	item.MinQuantity = body.MinQuantity
+	if item.MinQuantity != nil && *item.MinQuantity == 0 {
+		item.MinQuantity = nil
+	}
+	item.Expires = nil
+	if body.Expires != nil && *body.Expires != "" {
+		expires, _ := models.ParseDate(*body.Expires)
+		item.Expires = &expires
+	}
+	item.Notes = body.Notes
+	item.Tags = ParseTags(strings.Join(body.Tags, ","))
+	err := itemModel.Update(&item)
+	if err == nil {
+		undo.Offer(res, req, db, undo.NewRevert(audit.Item, item.ID, item.Version, before))
+		item, err = itemModel.ByID(item.ID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to save the container item.")
+		return
+	}
+	middleware.SetETag(res, item)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(item)
+}
+
+// containerItemHandler gets a specific item of a container
+func containerItemHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
-	userID := int64(req.Context().Value(middleware.UserContextKey).(jwt.MapClaims)["id"].(float64))
-	jsonOut := json.NewEncoder(res)
 	vars := mux.Vars(req)
+	containerID, _ := strconv.Atoi(vars["id"])
 	itemID, _ := strconv.Atoi(vars["item_id"])
+	item, err := NewStore(db).OwnedBy(int64(itemID), middleware.UserIDFromRequest(req))
+	if err == nil && item.Container.ID != int64(containerID) {
+		err = models.NewError(models.ErrNotFound, "item not found in this container")
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the item.")
+		return
+	}
+	middleware.SetETag(res, item)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(item)
+}
+
+// bulkCreateContainerItemsHandler creates many items in a container from a single request.
+// The body may be a JSON array, CSV or newline separated text (see ParseBulkItems).
+func bulkCreateContainerItemsHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	vars := mux.Vars(req)
+	containerID, _ := strconv.Atoi(vars["id"])
+	container, err := containers.NewStore(db).OwnedBy(int64(containerID), userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the container.")
+		return
+	}
+	lines, lineErrors, err := ParseBulkItems(req.Header.Get("Content-Type"), http.MaxBytesReader(res, req.Body, 1<<20))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to read the items.")
+		return
+	}
+	response := BulkResponse{
+		IDs:    make([]int64, 0, len(lines)),
+		Errors: lineErrors,
+	}
+	if len(lines) == 0 {
+		problem := middleware.NewProblem(middleware.ValidationFailed, "No items could be read from the body.")
+		problem.Errors = lineErrors
+		problem.Write(res, req)
+		return
+	}
+	items := make(ContainerItems, len(lines))
+	for i, line := range lines {
+		items[i] = ContainerItem{Body: line.Body, Quantity: line.Quantity}
+	}
+	if err = NewStore(db).As(middleware.UserIDFromRequest(req)).CreateMany(&container, items); err != nil {
+		middleware.WriteError(res, req, err, "Unable to create container items.")
+		return
+	}
+	op := undo.NewDelete(audit.Item)
+	for _, item := range items {
+		response.IDs = append(response.IDs, item.ID)
+		op.Add(item.ID, item.Version)
+	}
+	undo.Offer(res, req, db, op)
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(response)
+}
+
+// adjustQuantityHandler produces a handler that adds (direction 1) or removes (direction -1)
+// quantity from an item and records the change in its ledger.
+// Expected body (JSON or form):
+//   amount (optional, defaults to 1)
+//   reason (optional)
+func adjustQuantityHandler(direction int) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		db, _ := database.GetDBResource()
+		defer db.Close()
+		userID := middleware.UserIDFromRequest(req)
+		jsonOut := json.NewEncoder(res)
+		itemID, _ := strconv.Atoi(mux.Vars(req)["id"])
+		itemModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+		item, err := itemModel.OwnedBy(int64(itemID), userID)
+		if err != nil {
+			middleware.WriteError(res, req, err, "Unable to retrieve the item.")
+			return
+		}
+		var body quantityRequest
+		if errs := binding.Bind(req, &body); errs != nil {
+			middleware.WriteInvalid(res, req, errs)
+			return
+		}
+		amount := 1
+		if body.Amount != nil {
+			amount = *body.Amount
+		}
+		err = itemModel.AdjustQuantity(&item, direction*amount, body.Reason)
+		if err != nil {
+			middleware.WriteError(res, req, err, "Unable to adjust item quantity.")
+			return
+		}
+		before := audit.Fields{"quantity": item.Quantity - direction*amount}
+		undo.Offer(res, req, db, undo.NewRevert(audit.Item, item.ID, item.Version, before))
+		res.WriteHeader(http.StatusOK)
+		jsonOut.Encode(map[string]interface{}{
+			"id":           item.ID,
+			"quantity":     item.Quantity,
+			"is_low_stock": item.IsLowStock(),
+		})
+	}
+}
+
+// restoreItemHandler brings an item back from the trash, items of a container in the trash are restored with it
+func restoreItemHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	itemModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	item := middleware.RecordFromRequest(req).(ContainerItem)
+	err := itemModel.Restore(&item)
+	if err == nil {
+		item, err = itemModel.ByID(item.ID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Failed to restore the item.")
+		return
+	}
+	middleware.SetETag(res, item)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(item)
+}
+
+// quantityHistoryHandler retrieves the (paginated) quantity ledger of an item
+func quantityHistoryHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	itemID, _ := strconv.Atoi(mux.Vars(req)["id"])
 	itemModel := NewStore(db)
-	item, err := itemModel.ByID(int64(itemID))
+	item, err := itemModel.OwnedBy(int64(itemID), userID)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Item not found."})
+		middleware.WriteError(res, req, err, "Unable to retrieve the item.")
 		return
 	}
-	if item.Container.User.ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to delete this item."})
+	var limit models.QueryLimit
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	limit.SetPage(page, QueryLimit)
+	changes, err := itemModel.QuantityHistory(item, limit)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve quantity history.")
 		return
 	}
-	err = itemModel.Delete(item)
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string]QuantityChanges{
+		"changes": changes,
+	})
+}
+
+// expiringItemsHandler retrieves items expiring within a number of days (including expired items).
+// The window defaults to the user's expiry reminder setting and can be overridden with days=N.
+func expiringItemsHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	jsonOut := json.NewEncoder(res)
+	user, err := users.NewStore(db).ByID(middleware.UserIDFromRequest(req))
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Unable to delete this item."})
+		middleware.WriteError(res, req, err, "Unable to get user information.")
 		return
 	}
+	days := user.ExpiryReminderDays
+	if days <= 0 {
+		days = DefaultExpiryWindow
+	}
+	if userDays := req.URL.Query().Get("days"); userDays != "" {
+		days, err = strconv.Atoi(userDays)
+		if err != nil || days < 0 {
+			middleware.WriteProblem(res, req, middleware.BadRequest, "Days must be a positive whole number.")
+			return
+		}
+	}
+	expiring, err := NewStore(db).Expiring(user.ID, days)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve expiring items.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string]ContainerItems{
+		"items": expiring,
+	})
+}
+
+// lowStockHandler retrieves every item below its minimum quantity, across all containers.
+// The result doubles as a shopping list with the amount needed to restock each item.
+func lowStockHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	lowStock, err := NewStore(db).LowStock(userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve low stock items.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string][]LowStockItem{
+		"items": lowStock,
+	})
+}
+
+// DeleteContainerItemHandler will move an item to the trash and update the container count.
+func deleteContainerItemHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	itemModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	item := middleware.RecordFromRequest(req).(ContainerItem)
+	err := itemModel.Delete(&item)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to delete this item.")
+		return
+	}
+	op := undo.NewRestore(audit.Item)
+	op.Add(item.ID, item.Version)
+	undo.Offer(res, req, db, op)
 	res.WriteHeader(http.StatusNoContent)
 }
 
+// deleteManyHandler moves a set of items to the trash, the undo token of the response restores them all
+// Expected body (JSON or form):
+//   ids
 func deleteManyHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
-	jsonOut := json.NewEncoder(res)
 	userID := int64(req.Context().Value(middleware.UserContextKey).(jwt.MapClaims)["id"].(float64))
-	decoder := json.NewDecoder(req.Body)
-	itemStore := NewStore(db)
+	itemStore := NewStore(db).As(middleware.UserIDFromRequest(req))
 	var bulkOptions bulkDeleteID
-	decoder.Decode(&bulkOptions)
+	if errs := binding.Bind(req, &bulkOptions); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
 	var wg sync.WaitGroup
 	retrieve := make(chan bulkItemRetrieval, len(bulkOptions.IDs))
 	for _, id := range bulkOptions.IDs {
@@ -276,21 +758,25 @@ func deleteManyHandler(res http.ResponseWriter, req *http.Request) {
 		itemsRetrieved = append(itemsRetrieved, resp)
 	}
 	if itemsRetrieved.anyErrors() {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Some or all of the items could not be retrieved"})
+		middleware.WriteProblem(res, req, middleware.NotFound, "Some or all of the items could not be retrieved")
 		return
 	}
 	users := itemsRetrieved.items().ExtractUsers()
 	if len(users) > 1 || users[0].ID != userID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not authorized to delete some or all of the items"})
+		middleware.WriteProblem(res, req, middleware.Forbidden, "Not authorized to delete some or all of the items")
 		return
 	}
-	err := itemStore.DeleteMany(*itemsRetrieved.items())
+	items := *itemsRetrieved.items()
+	err := itemStore.DeleteMany(items)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: err.Error()})
+		middleware.WriteError(res, req, err, "Unable to delete the items.")
 		return
 	}
+	// the items are restored together
+	op := undo.NewRestore(audit.Item)
+	for _, item := range items {
+		op.Add(item.ID, item.Version)
+	}
+	undo.Offer(res, req, db, op)
 	res.WriteHeader(http.StatusNoContent)
 }
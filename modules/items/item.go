@@ -1,21 +1,141 @@
 package items
 
 import (
+	"database/sql"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/containers"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/go-sql-driver/mysql"
 )
 
+// MaxTagLength is the longest tag that can be given to an item.
+const MaxTagLength = 30
+
+// MaxReasonLength is the longest reason a quantity change can be recorded with.
+const MaxReasonLength = 255
+
 // ContainerItem represents a single item in a container
 type ContainerItem struct {
-	ID        int64                 `json:"id"`
-	Container *containers.Container `json:"container"`
-	UUID      string                `json:"uuid"`
-	Body      string                `json:"body"`
-	Quantity  int                   `json:"quantity"`
-	Created   time.Time             `json:"created"`
-	Modified  time.Time             `json:"modified"`
+	ID           int64                 `json:"id"`
+	Container    *containers.Container `json:"container"`
+	UUID         string                `json:"uuid"`
+	Body         string                `json:"body"`
+	Notes        string                `json:"notes"`
+	Tags         []string              `json:"tags"`
+	Quantity     int                   `json:"quantity"`
+	MinQuantity  *int                  `json:"min_quantity"`
+	Expires      *time.Time            `json:"expires"`
+	IsCheckedOut bool                  `json:"is_checked_out"`
+	IsOverdue    bool                  `json:"is_overdue"`
+	// Version is incremented by every change of the item
+	Version  int64     `json:"version"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	// Deleted is set while the item is in the trash
+	Deleted *time.Time `json:"deleted,omitempty"`
+	// Score and Snippet are only set on search results
+	Score   float64 `json:"score,omitempty"`
+	Snippet string  `json:"snippet,omitempty"`
+}
+
+// ETag identifies the version of the item.
+func (i ContainerItem) ETag() string {
+	return models.ETag(i.Version)
+}
+
+// auditFields are the values of the item recorded in the audit log.
+func (i ContainerItem) auditFields() audit.Fields {
+	fields := audit.Fields{
+		"body":         i.Body,
+		"notes":        i.Notes,
+		"tags":         i.Tags,
+		"quantity":     i.Quantity,
+		"min_quantity": i.MinQuantity,
+		"expires":      i.Expires,
+	}
+	if i.Container != nil {
+		fields["container_id"] = i.Container.ID
+	}
+	return fields
+}
+
+// IsLowStock reports whether the item has dropped below its minimum quantity.
+func (i *ContainerItem) IsLowStock() bool {
+	return i.MinQuantity != nil && i.Quantity < *i.MinQuantity
+}
+
+// Adjust increments (or decrements with a negative delta) the quantity of the item and returns the entry
+// recording the change in its quantity ledger. A change leaving a negative quantity results in ErrInsufficientQuantity.
+func (i *ContainerItem) Adjust(delta int, reason string) (QuantityChange, error) {
+	reason = strings.TrimSpace(reason)
+	switch {
+	case delta == 0:
+		return QuantityChange{}, models.NewError(models.ErrValidation, "quantity adjustment must not be zero")
+	case utf8.RuneCountInString(reason) > MaxReasonLength:
+		return QuantityChange{}, models.NewError(models.ErrValidation, fmt.Sprintf("reason must be at most %v characters", MaxReasonLength))
+	case i.Quantity+delta < 0:
+		return QuantityChange{}, ErrInsufficientQuantity
+	}
+	i.Quantity += delta
+	return QuantityChange{Delta: delta, Quantity: i.Quantity, Reason: reason}, nil
+}
+
+func (i *ContainerItem) setMinQuantity(minQuantity sql.NullInt64) {
+	if minQuantity.Valid {
+		value := int(minQuantity.Int64)
+		i.MinQuantity = &value
+	} else {
+		i.MinQuantity = nil
+	}
+}
+
+func (i *ContainerItem) setNotes(notes sql.NullString) {
+	i.Notes = notes.String
+}
+
+func (i *ContainerItem) setTags(tags string) {
+	i.Tags = ParseTags(tags)
+}
+
+// tagList is the stored form of the item's tags.
+func (i *ContainerItem) tagList() string {
+	return strings.Join(i.Tags, ",")
+}
+
+// ParseTags normalizes a comma separated list of tags.
+// Tags are lower cased and trimmed, empty and repeated tags are dropped.
+func ParseTags(input string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(input, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] || len(tag) > MaxTagLength {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func (i *ContainerItem) setExpires(expires mysql.NullTime) {
+	if expires.Valid {
+		i.Expires = &expires.Time
+	} else {
+		i.Expires = nil
+	}
+}
+
+// setLoan flags an item lent out by its outstanding loan, if any, and overdue once the loan is past due.
+func (i *ContainerItem) setLoan(loanID sql.NullInt64, due mysql.NullTime) {
+	i.IsCheckedOut = loanID.Valid
+	i.IsOverdue = loanID.Valid && due.Valid && models.PastDue(&due.Time, time.Now())
 }
 
 // ContainerItems is a collection of container items.
@@ -46,3 +166,27 @@ func (i *ContainerItems) ExtractContainers() []containers.Container {
 	}
 	return containers
 }
+
+// QuantityChange is a ledger entry of an item's quantity being adjusted.
+type QuantityChange struct {
+	ID       int64     `json:"id"`
+	Delta    int       `json:"delta"`
+	Quantity int       `json:"quantity"`
+	Reason   string    `json:"reason"`
+	Created  time.Time `json:"created"`
+}
+
+// QuantityChanges is a collection of quantity ledger entries.
+type QuantityChanges []QuantityChange
+
+// LowStockItem is an item below its minimum quantity and how many are needed to restock it.
+type LowStockItem struct {
+	ContainerItem
+	Needed int `json:"needed"`
+}
+
+// ExpiryReminder groups the items of a user that are about to expire.
+type ExpiryReminder struct {
+	User  users.User
+	Items ContainerItems
+}
@@ -0,0 +1,66 @@
+package items_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+)
+
+func TestParseTags(t *testing.T) {
+	tags := items.ParseTags(" Tools, garden,,tools , a-very-long-tag-that-will-not-fit-in-a-tag")
+	expected := []string{"tools", "garden"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected %v but got %v", expected, tags)
+	}
+	if tags := items.ParseTags(""); len(tags) != 0 {
+		t.Errorf("Expected no tags but got %v", tags)
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	item := items.ContainerItem{ID: 1, Quantity: 3}
+	change, err := item.Adjust(-2, "  used for the fence ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := items.QuantityChange{Delta: -2, Quantity: 1, Reason: "used for the fence"}
+	if change != expected || item.Quantity != 1 {
+		t.Errorf("Expected the ledger entry %+v and a quantity of 1 but got %+v and %v", expected, change, item.Quantity)
+	}
+	if change, err = item.Adjust(5, ""); err != nil || change.Quantity != 6 || item.Quantity != 6 {
+		t.Errorf("Expected the quantity to be restocked to 6 but got %+v %v", change, err)
+	}
+}
+
+func TestAdjust_Rejected(t *testing.T) {
+	cases := []struct {
+		name   string
+		delta  int
+		reason string
+		kind   error
+	}{
+		{"negative result", -4, "", models.ErrConflict},
+		{"no change", 0, "", models.ErrValidation},
+		{"long reason", 1, strings.Repeat("é", items.MaxReasonLength+1), models.ErrValidation},
+	}
+	for _, c := range cases {
+		item := items.ContainerItem{ID: 1, Quantity: 3}
+		if _, err := item.Adjust(c.delta, c.reason); !errors.Is(err, c.kind) {
+			t.Errorf("%v: expected an error of kind %v but got %v", c.name, c.kind, err)
+		}
+		if item.Quantity != 3 {
+			t.Errorf("%v: expected the quantity to be left unchanged but got %v", c.name, item.Quantity)
+		}
+	}
+	item := items.ContainerItem{ID: 1, Quantity: 3}
+	if _, err := item.Adjust(-4, ""); err != items.ErrInsufficientQuantity {
+		t.Errorf("Expected ErrInsufficientQuantity but got %v", err)
+	}
+	if _, err := item.Adjust(1, strings.Repeat("é", items.MaxReasonLength)); err != nil {
+		t.Errorf("Expected a reason of %v characters to be allowed but got %v", items.MaxReasonLength, err)
+	}
+}
@@ -0,0 +1,71 @@
+package items
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/notify"
+	"github.com/cjsaylor/boxmeup-go/scheduler"
+)
+
+// DefaultExpiryWindow is the number of days used to list expiring items when the user has disabled reminders.
+const DefaultExpiryWindow = 7
+
+// ExpiryReminderJob constructs a scheduled job that notifies users of items entering their expiry reminder window.
+// Each item is only reminded about once unless its expiry date changes.
+func ExpiryReminderJob(notifier notify.Notifier, interval time.Duration) scheduler.Job {
+	return scheduler.Job{
+		Name:     "expiry-reminders",
+		Interval: interval,
+		Run: func() error {
+			db, err := database.GetDBResource()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return SendExpiryReminders(NewStore(db), notifier)
+		},
+	}
+}
+
+// SendExpiryReminders delivers one reminder per user for all of their pending expiring items.
+func SendExpiryReminders(store *Store, notifier notify.Notifier) error {
+	reminders, err := store.PendingExpiryReminders()
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, reminder := range reminders {
+		err = notifier.Notify(expiryMessage(reminder))
+		if err == nil {
+			err = store.MarkReminded(reminder.Items)
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func expiryMessage(reminder ExpiryReminder) notify.Message {
+	var body bytes.Buffer
+	body.WriteString("The following items are expiring soon:\n\n")
+	for _, item := range reminder.Items {
+		fmt.Fprintf(&body, "  %v (x%v) in %v - expires %v\n", item.Body, item.Quantity, item.Container.Name, item.Expires.Format(models.DateFormat))
+	}
+	subject := fmt.Sprintf("%v items expiring soon", len(reminder.Items))
+	if len(reminder.Items) == 1 {
+		subject = fmt.Sprintf("%v is expiring soon", reminder.Items[0].Body)
+	}
+	return notify.Message{
+		UserID:  reminder.User.ID,
+		Event:   "item.expiring",
+		Email:   reminder.User.Email,
+		Subject: subject,
+		Body:    body.String(),
+		Data:    reminder.Items,
+	}
+}
@@ -0,0 +1,337 @@
+package items
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/go-sql-driver/mysql"
+)
+
+// SearchType is the document type of items in the search index.
+const SearchType = "item"
+
+func init() {
+	fulltext.RegisterSource(SearchType, fulltext.Source{
+		From:    "container_items ci inner join containers c on c.id = ci.container_id",
+		ID:      "ci.id",
+		User:    "c.user_id",
+		Columns: []string{"ci.body", "ci.tags", "ci.notes"},
+		Where:   "ci.deleted is null",
+	})
+	containers.RegisterSmartItems(smartItems{})
+}
+
+// smartItems evaluates the queries of smart containers against items.
+type smartItems struct{}
+
+func (smartItems) Validate(query fulltext.Query) error {
+	_, err := query.Compile(SearchFields)
+	return err
+}
+
+func (smartItems) Count(db *sql.DB, userID int64, query fulltext.Query) (int, error) {
+	sort := models.SortBy{Field: fulltext.SortRelevance, Direction: models.DSC}
+	response, err := NewStore(db).SearchItems(userID, query, sort, models.QueryLimit{Limit: 1})
+	return response.PagedResponse.Total, err
+}
+
+// SearchFields are the filters available when searching items.
+var SearchFields = fulltext.Fields{
+	"body":      {Kind: fulltext.TextField, Column: "ci.body"},
+	"notes":     {Kind: fulltext.TextField, Column: "ci.notes"},
+	"tag":       {Kind: fulltext.ListField, Column: "ci.tags"},
+	"qty":       {Kind: fulltext.NumberField, Column: "ci.quantity"},
+	"quantity":  {Kind: fulltext.NumberField, Column: "ci.quantity"},
+	"container": {Kind: fulltext.TextField, Column: "c.name"},
+	"location":  {Kind: fulltext.TextField, Column: "(select lo.name from locations lo where lo.id = c.location_id and lo.deleted is null)"},
+	"expires":   {Kind: fulltext.DateField, Column: "ci.expires"},
+	"created":   {Kind: fulltext.DateField, Column: "ci.created"},
+	"modified":  {Kind: fulltext.DateField, Column: "ci.modified"},
+}
+
+// SearchItems finds the items of a user matching a query of text and filters (see SearchFields).
+// Sorting by fulltext.SortRelevance orders the most relevant items first, otherwise every match is ordered by the sort field.
+// Queries with filters that do not suit SearchFields result in a *fulltext.ParseError.
+// Column sorts page by cursor or offset, relevance by offset only (a cursor results in models.ErrInvalidCursor).
+func (c *Store) SearchItems(userID int64, query fulltext.Query, sort models.SortBy, limit models.QueryLimit) (PagedResponse, error) {
+	response := PagedResponse{Items: ContainerItems{}}
+	predicate, err := query.Compile(SearchFields)
+	if err != nil {
+		return response, err
+	}
+	var ids []int64
+	hits := make(map[int64]fulltext.Hit)
+	if query.Empty() {
+		if predicate.Empty() {
+			return response, nil
+		}
+		if sort.Field == fulltext.SortRelevance {
+			sort = Sorter.Default
+		}
+		ids, _, err = c.sortedIDs(userID, nil, fulltext.Predicate{}, predicate, sort, limit, &response.PagedResponse)
+	} else {
+		var vocabulary *fulltext.Vocabulary
+		if vocabulary, err = fulltext.LoadVocabulary(c.DB, userID); err != nil {
+			return response, err
+		}
+		if suggestion, ok := vocabulary.Suggest(query); ok {
+			response.Suggestions = []string{suggestion}
+		}
+		query = vocabulary.Fuzzy(query)
+		request := fulltext.Request{
+			UserID: userID,
+			Types:  []string{SearchType},
+			Query:  query,
+		}
+		relevance := sort.Field == fulltext.SortRelevance
+		if relevance && limit.Cursor != nil {
+			return response, models.ErrInvalidCursor
+		}
+		backend := fulltext.Open(c.DB)
+		if matcher, ok := backend.(fulltext.Matcher); ok && !relevance {
+			// The database sorts and pages the matches, so only the IDs of the page are fetched.
+			match, _ := matcher.Match(SearchType, query)
+			var scores map[int64]float64
+			if ids, scores, err = c.sortedIDs(userID, nil, match, predicate, sort, limit, &response.PagedResponse); err != nil {
+				return response, err
+			}
+			if response.Items, err = c.ByIDs(ids); err != nil {
+				return response, err
+			}
+			for i := range response.Items {
+				item := &response.Items[i]
+				item.Score = scores[item.ID]
+				item.Snippet = fulltext.Snippet([]string{item.Body, item.tagList(), item.Notes}, query)
+			}
+			response.PagedResponse.RequestTotal = len(response.Items)
+			return response, nil
+		}
+		if relevance && predicate.Empty() {
+			request.Limit = limit
+		}
+		var results fulltext.Results
+		if results, err = backend.Search(request); err != nil {
+			return response, err
+		}
+		for _, hit := range results.Hits {
+			hits[hit.ID] = hit
+		}
+		ids = results.IDs()
+		response.PagedResponse.SetTotal(results.Total, limit)
+		switch {
+		case len(ids) == 0 || (relevance && predicate.Empty()):
+		case relevance:
+			ids, err = c.filterRanked(userID, ids, predicate, limit, &response.PagedResponse)
+		default:
+			ids, _, err = c.sortedIDs(userID, ids, fulltext.Predicate{}, predicate, sort, limit, &response.PagedResponse)
+		}
+	}
+	if err != nil {
+		return response, err
+	}
+	if response.Items, err = c.ByIDs(ids); err != nil {
+		return response, err
+	}
+	for i := range response.Items {
+		response.Items[i].Score = hits[response.Items[i].ID].Score
+		response.Items[i].Snippet = hits[response.Items[i].ID].Snippet
+	}
+	response.PagedResponse.RequestTotal = len(response.Items)
+	return response, nil
+}
+
+// matchingQuery selects columns of the items of a user matching predicates, optionally only amongst the given IDs.
+func matchingQuery(columns string, userID int64, within []int64, predicates ...fulltext.Predicate) (string, []interface{}) {
+	q := `
+		select %v
+		from container_items ci
+		inner join containers c on c.id = ci.container_id
+		where c.user_id = ? and ci.deleted is null %v
+	`
+	args := []interface{}{userID}
+	conditions := make([]string, 0, len(predicates)+1)
+	if within != nil {
+		conditions = append(conditions, fmt.Sprintf("and ci.id in (%v)", placeholders(len(within))))
+		args = append(args, int64Args(within)...)
+	}
+	for _, predicate := range predicates {
+		conditions = append(conditions, predicate.And())
+		args = append(args, predicate.Args...)
+	}
+	return fmt.Sprintf(q, columns, strings.Join(conditions, " ")), args
+}
+
+// sortedIDs pages through the items matching a predicate (see matchingQuery) in the order of a sort field.
+// A non-empty match (see fulltext.Matcher) restricts the items to those matching a full-text query, their scores are
+// returned by ID. The total and the cursors of the neighbouring pages are set on the meta data.
+func (c *Store) sortedIDs(userID int64, within []int64, match fulltext.Predicate, predicate fulltext.Predicate, sort models.SortBy, limit models.QueryLimit, meta *models.PagedResponse) ([]int64, map[int64]float64, error) {
+	keyset := models.Keyset{Sort: sort, Alias: "ci", Limit: limit}
+	q, args := matchingQuery("ci.id", userID, within, match, predicate)
+	keysetFragment, keysetArgs, err := keyset.Where()
+	if err != nil {
+		return nil, nil, err
+	}
+	// The total and the page are read from the snapshot of a single transaction.
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	total, err := database.CountRows(tx, limit.Total, q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.SetTotal(total, limit)
+	score := "0"
+	selectArgs := []interface{}{}
+	if !match.Empty() {
+		score = match.SQL
+		selectArgs = append(selectArgs, match.Args...)
+	}
+	q, _ = matchingQuery("ci.id, "+score+", "+keyset.Columns(), userID, within, match, predicate)
+	args = append(append(selectArgs, args...), keysetArgs...)
+	rows, err := tx.Query(q+keysetFragment+" "+keyset.OrderBy(), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	scores := make(map[int64]float64)
+	values := make([][]interface{}, 0)
+	for rows.Next() {
+		var id int64
+		var score float64
+		row, value := keyset.Scan(&id, &score)
+		if err = rows.Scan(row...); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		scores[id] = score
+		values = append(values, value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	keyset.Page(&ids, values, ids, meta)
+	return ids, scores, nil
+}
+
+// filterRanked filters ranked IDs by a predicate keeping their order, then applies the limit.
+// Ranked results are paged by offset only, the total is set on the meta data.
+func (c *Store) filterRanked(userID int64, ranked []int64, predicate fulltext.Predicate, limit models.QueryLimit, meta *models.PagedResponse) ([]int64, error) {
+	q, args := matchingQuery("ci.id", userID, ranked, predicate)
+	rows, err := c.DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	isMatch := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		isMatch[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	meta.SetTotal(len(isMatch), limit)
+	ids := make([]int64, 0, limit.Limit)
+	position := 0
+	for _, id := range ranked {
+		if !isMatch[id] {
+			continue
+		}
+		if position >= limit.Offset && len(ids) < limit.Limit {
+			ids = append(ids, id)
+		}
+		position++
+	}
+	return ids, nil
+}
+
+// ByIDs retrieves items along with their containers in the order of the given IDs.
+// IDs of items that no longer exist or are in the trash are skipped.
+func (c *Store) ByIDs(ids []int64) (ContainerItems, error) {
+	items := ContainerItems{}
+	if len(ids) == 0 {
+		return items, nil
+	}
+	q := `
+		select ci.id, ci.container_id, ci.uuid, ci.body, ci.notes, ci.tags, ci.quantity, ci.min_quantity, ci.expires,
+			l.id, l.due, ci.version, ci.created, ci.modified
+		from container_items ci
+		left join item_loans l on l.container_item_id = ci.id and l.checked_in is null
+		where ci.id in (%v) and ci.deleted is null
+	`
+	rows, err := c.DB.Query(fmt.Sprintf(q, placeholders(len(ids))), int64Args(ids)...)
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+	found := make(map[int64]ContainerItem)
+	containerIDs := make(map[int64]int64)
+	for rows.Next() {
+		item := ContainerItem{}
+		var containerID int64
+		var notes sql.NullString
+		var tags string
+		var minQuantity sql.NullInt64
+		var expires mysql.NullTime
+		var loanID sql.NullInt64
+		var loanDue mysql.NullTime
+		err = rows.Scan(&item.ID, &containerID, &item.UUID, &item.Body, &notes, &tags, &item.Quantity, &minQuantity, &expires, &loanID, &loanDue, &item.Version, &item.Created, &item.Modified)
+		if err != nil {
+			return items, err
+		}
+		item.setNotes(notes)
+		item.setTags(tags)
+		item.setMinQuantity(minQuantity)
+		item.setExpires(expires)
+		item.setLoan(loanID, loanDue)
+		found[item.ID] = item
+		containerIDs[item.ID] = containerID
+	}
+	if err = rows.Err(); err != nil {
+		return items, err
+	}
+	for _, id := range ids {
+		if item, ok := found[id]; ok {
+			items = append(items, item)
+		}
+	}
+	IDs := make([]int64, 0, len(containerIDs))
+	for _, containerID := range containerIDs {
+		IDs = append(IDs, containerID)
+	}
+	itemContainers, err := containers.NewStore(c.DB).ByIDs(IDs)
+	if err != nil {
+		return items, err
+	}
+	for i := range items {
+		container := itemContainers[containerIDs[items[i].ID]]
+		items[i].Container = &container
+	}
+	return items, nil
+}
+
+func placeholders(count int) string {
+	return "?" + strings.Repeat(",?", count-1)
+}
+
+func int64Args(values []int64) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
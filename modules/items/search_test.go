@@ -0,0 +1,22 @@
+package items_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	_ "github.com/cjsaylor/boxmeup-go/modules/items"
+)
+
+func TestParseSmartQuery(t *testing.T) {
+	if _, err := containers.ParseSmartQuery("winter tag:clothes location:attic qty>1"); err != nil {
+		t.Errorf("Expected a valid smart query but got %v", err)
+	}
+	if _, err := containers.ParseSmartQuery("  "); err != containers.ErrEmptySmartQuery {
+		t.Errorf("Expected an empty query error but got %v", err)
+	}
+	_, err := containers.ParseSmartQuery("winter colour:red")
+	if parseErr, ok := err.(*fulltext.ParseError); !ok || parseErr.Term != "colour:red" {
+		t.Errorf("Expected the unknown item field to be reported but got %v", err)
+	}
+}
@@ -6,18 +6,41 @@ import (
 	"fmt"
 	"log"
 	"strings"
-	"sync"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/changelog"
+	"github.com/cjsaylor/boxmeup-go/events"
 	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/go-sql-driver/mysql"
 )
 
-// QueryLimit is the maximum number of container results per page.
+// QueryLimit is the number of item results per page unless another is requested.
 const QueryLimit = 20
 
+// Sorter validates the sorts of item queries.
+var Sorter = models.Sorter{
+	Fields: map[string]string{
+		"modified": "modified",
+		"body":     "body",
+		"quantity": "quantity",
+		"qty":      "quantity",
+	},
+	Default: models.SortBy{Field: "modified", Direction: models.DSC},
+}
+
+// ErrInsufficientQuantity is returned when decrementing an item below zero.
+var ErrInsufficientQuantity error = &models.Error{Kind: models.ErrConflict, Code: "insufficient_quantity", Message: "not enough quantity to remove"}
+
+// ErrContainerTrashed is returned when restoring an item whose container is in the trash, the container must be restored.
+var ErrContainerTrashed error = &models.Error{Kind: models.ErrConflict, Code: "container_trashed", Message: "the container of the item is in the trash"}
+
 // Store persists and queries container items
 type Store struct {
 	DB *sql.DB
+	// ActorID is the authenticated user taking the actions, the owner of the records when 0
+	ActorID int64
 }
 
 // NewStore constructs a storage interface for items.
@@ -25,116 +48,458 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{DB: db}
 }
 
-// GetSortBy will retrieve a SortBy object taylored for container queries
-func (c *Store) GetSortBy(field string, direction models.SortType) models.SortBy {
-	sortable := map[string]string{"modified": "modified", "body": "body", "quantity": "quantity"}
-	var sort models.SortBy
-	if _, ok := sortable[field]; ok {
-		sort.Field = field
-	} else {
-		sort.Field = "modified"
-	}
-	if direction == models.ASC {
-		sort.Direction = models.ASC
-	} else {
-		sort.Direction = models.DSC
-	}
-
-	return sort
+// As returns a copy of the store acting on behalf of the authenticated user actorID, the actor of the actions
+// it records in the audit log (see audit.NewEntry).
+func (c *Store) As(actorID int64) *Store {
+	store := *c
+	store.ActorID = actorID
+	return &store
 }
 
 // Create will persist a given container item.
 func (c *Store) Create(item *ContainerItem) error {
 	q := `
-		insert into container_items (container_id, uuid, body, quantity, created, modified)
-		values(?, uuid(), ?, ?, now(), now())
+		insert into container_items (container_id, uuid, body, notes, tags, quantity, min_quantity, expires, created, modified)
+		values(?, uuid(), ?, ?, ?, ?, ?, ?, now(), now())
 	`
 	tx, _ := c.DB.Begin()
-	res, err := tx.Exec(q, item.Container.ID, item.Body, item.Quantity)
-	item.ID, _ = res.LastInsertId()
+	res, err := tx.Exec(q, item.Container.ID, item.Body, item.Notes, item.tagList(), item.Quantity, item.MinQuantity, item.Expires)
+	var entry audit.Entry
+	if err == nil {
+		item.ID, _ = res.LastInsertId()
+		item.Version = 1
+		err = changelog.Changed(tx, changelog.Item, item.ID)
+	}
+	if err == nil {
+		entry, err = c.recordAudit(tx, *item, audit.ActionCreate, audit.Diff(nil, item.auditFields()))
+	}
 	if err == nil {
 		err = updateContainerItemCount(tx, item.Container.ID)
 	}
 	if err == nil {
-		tx.Commit()
+		err = tx.Commit()
 	} else {
 		tx.Rollback()
 	}
+	if err == nil {
+		events.Committed(entry)
+	}
 
 	return err
 }
 
+// CreateMany persists a group of items into a single container.
+// All items are inserted in one transaction and the container item count is updated once.
+func (c *Store) CreateMany(container *containers.Container, items ContainerItems) error {
+	if len(items) == 0 {
+		return models.NewError(models.ErrValidation, "no items supplied")
+	}
+	q := `
+		insert into container_items (container_id, uuid, body, quantity, created, modified)
+		values(?, uuid(), ?, ?, now(), now())
+	`
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(q)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	entries := make([]audit.Entry, 0, len(items))
+	for i := range items {
+		res, err := stmt.Exec(container.ID, items[i].Body, items[i].Quantity)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		items[i].ID, _ = res.LastInsertId()
+		items[i].Version = 1
+		items[i].Container = container
+		if err = changelog.Changed(tx, changelog.Item, items[i].ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		var entry audit.Entry
+		if entry, err = c.recordAudit(tx, items[i], audit.ActionCreate, audit.Diff(nil, items[i].auditFields())); err != nil {
+			tx.Rollback()
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	if err = updateContainerItemCount(tx, container.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	events.Committed(entries...)
+	return nil
+}
+
 // Update a container item
-func (c *Store) Update(item ContainerItem) error {
+// A change in quantity is recorded in the item's quantity ledger.
+// The item must not have changed since it was retrieved (see models.CheckVersion), its version is incremented.
+func (c *Store) Update(item *ContainerItem) error {
 	if item.ID == 0 {
-		return errors.New("can not update an item without it first being persisted")
+		return models.NewError(models.ErrValidation, "can not update an item without it first being persisted")
+	}
+	before, _, err := c.find(item.ID, false)
+	if err != nil {
+		return err
+	}
+	before.Container = item.Container
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	var oldQuantity int
+	err = tx.QueryRow("select quantity from container_items where id = ? for update", item.ID).Scan(&oldQuantity)
+	if err != nil {
+		tx.Rollback()
+		return models.NotFound(err, "item not found")
 	}
 	q := `
-		update container_items set body = ?, quantity = ?, modified = now()
-		where id = ?
+		update container_items
+		set body = ?, notes = ?, tags = ?, quantity = ?, min_quantity = ?,
+			expiry_reminded = if(expires <=> ?, expiry_reminded, null), expires = ?,
+			version = version + 1, modified = now()
+		where id = ? and version = ?
 	`
-	_, err := c.DB.Exec(q, item.Body, item.Quantity, item.ID)
+	res, err := tx.Exec(q, item.Body, item.Notes, item.tagList(), item.Quantity, item.MinQuantity, item.Expires, item.Expires, item.ID, item.Version)
+	if err == nil {
+		err = models.CheckVersion(res)
+	}
+	if err == nil {
+		err = changelog.Changed(tx, changelog.Item, item.ID)
+	}
+	var entry audit.Entry
+	if err == nil {
+		entry, err = c.recordAudit(tx, *item, audit.ActionUpdate, audit.Diff(before.auditFields(), item.auditFields()))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if item.Quantity != oldQuantity {
+		change := QuantityChange{Delta: item.Quantity - oldQuantity, Quantity: item.Quantity, Reason: "Updated"}
+		err = recordQuantityChange(tx, item.ID, change)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	item.Version++
+	events.Committed(entry)
+	return nil
+}
+
+// AdjustQuantity increments (or decrements with a negative delta) the quantity of an item
+// and records the change with a reason in the item's quantity ledger.
+func (c *Store) AdjustQuantity(item *ContainerItem, delta int, reason string) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	locked := *item
+	err = tx.QueryRow("select quantity, version from container_items where id = ? for update", item.ID).Scan(&locked.Quantity, &locked.Version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	change, err := locked.Adjust(delta, reason)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("update container_items set quantity = ?, version = version + 1, modified = now() where id = ?", change.Quantity, item.ID)
+	if err == nil {
+		err = recordQuantityChange(tx, item.ID, change)
+	}
+	if err == nil {
+		err = changelog.Changed(tx, changelog.Item, item.ID)
+	}
+	var entry audit.Entry
+	if err == nil {
+		changes := audit.Diff(audit.Fields{"quantity": change.Quantity - delta}, audit.Fields{"quantity": change.Quantity})
+		entry, err = c.recordAudit(tx, *item, audit.ActionUpdate, changes)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	item.Quantity = change.Quantity
+	item.Version = locked.Version + 1
+	events.Committed(entry)
+	return nil
+}
+
+// recordAudit appends an action on an item to the audit log on behalf of the actor of the store.
+// The entry is returned to be published once the transaction is committed (see events.Committed).
+func (c *Store) recordAudit(tx *sql.Tx, item ContainerItem, action string, changes audit.Changes) (audit.Entry, error) {
+	entry := audit.NewEntry(c.ActorID, item.Container.User.ID, audit.Item, item.ID, action, changes)
+	return entry, audit.Record(tx, entry)
+}
+
+// recordQuantityChange writes an entry of the quantity ledger of an item (see ContainerItem.Adjust).
+func recordQuantityChange(tx *sql.Tx, itemID int64, change QuantityChange) error {
+	q := `
+		insert into item_quantity_changes (container_item_id, delta, quantity, reason, created)
+		values (?, ?, ?, ?, now())
+	`
+	_, err := tx.Exec(q, itemID, change.Delta, change.Quantity, change.Reason)
 	return err
 }
 
+// QuantityHistory retrieves the quantity ledger of an item, most recent first.
+func (c *Store) QuantityHistory(item ContainerItem, limit models.QueryLimit) (QuantityChanges, error) {
+	q := `
+		select id, delta, quantity, reason, created
+		from item_quantity_changes
+		where container_item_id = ?
+		order by created desc, id desc
+		limit %v offset %v
+	`
+	rows, err := c.DB.Query(fmt.Sprintf(q, limit.Limit, limit.Offset), item.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	changes := make(QuantityChanges, 0)
+	for rows.Next() {
+		change := QuantityChange{}
+		if err = rows.Scan(&change.ID, &change.Delta, &change.Quantity, &change.Reason, &change.Created); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// LowStock retrieves every item of a user, across all containers, that is below its minimum quantity.
+func (c *Store) LowStock(userID int64) ([]LowStockItem, error) {
+	q := `
+		select ci.id, ci.container_id, ci.uuid, ci.body, ci.quantity, ci.min_quantity, ci.version, ci.created, ci.modified
+		from container_items ci
+		inner join containers c on c.id = ci.container_id and c.user_id = ?
+		where ci.deleted is null and ci.min_quantity is not null and ci.quantity < ci.min_quantity
+		order by ci.min_quantity - ci.quantity desc, ci.body asc
+	`
+	rows, err := c.DB.Query(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lowStock := make([]LowStockItem, 0)
+	containerIDs := make([]int64, 0)
+	for rows.Next() {
+		item := LowStockItem{}
+		var containerID int64
+		var minQuantity sql.NullInt64
+		err = rows.Scan(&item.ID, &containerID, &item.UUID, &item.Body, &item.Quantity, &minQuantity, &item.Version, &item.Created, &item.Modified)
+		if err != nil {
+			return nil, err
+		}
+		item.setMinQuantity(minQuantity)
+		item.Needed = *item.MinQuantity - item.Quantity
+		lowStock = append(lowStock, item)
+		containerIDs = append(containerIDs, containerID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	itemContainers, err := c.containersOf(containerIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, containerID := range containerIDs {
+		container := itemContainers[containerID]
+		lowStock[i].Container = &container
+	}
+	return lowStock, nil
+}
+
+// containersOf loads the containers of items at once, by the container ID of each item.
+func (c *Store) containersOf(containerIDs []int64) (map[int64]containers.Container, error) {
+	seen := make(map[int64]bool, len(containerIDs))
+	IDs := make([]int64, 0, len(containerIDs))
+	for _, containerID := range containerIDs {
+		if !seen[containerID] {
+			seen[containerID] = true
+			IDs = append(IDs, containerID)
+		}
+	}
+	return containers.NewStore(c.DB).ByIDs(IDs)
+}
+
 // @todo determine if this should be the number of "rows" or if it should be based on quantity
 // Also consider moving this to a MySQL trigger
+// The count is part of the container so the change is recorded in the change log, its version is left unchanged
+// so that changing items does not conflict with requests changing the container.
 func updateContainerItemCount(tx *sql.Tx, containerID int64) error {
 	q := `
 		update containers
 		set container_item_count = (
-			select count(*) from container_items where container_id = ?
-		), modified = now()
+			select count(*) from container_items where container_id = ? and deleted is null
+		)
 		where id = ?
 	`
 	_, err := tx.Exec(q, containerID, containerID)
-	return err
+	if err != nil {
+		return err
+	}
+	return changelog.Changed(tx, changelog.Container, containerID)
 }
 
-// Delete removes an item from a container
-func (c *Store) Delete(item ContainerItem) error {
-	q := "delete from container_items where id = ?"
+// Delete moves an item to the trash, provided it has not changed since it was retrieved, its version is incremented.
+func (c *Store) Delete(item *ContainerItem) error {
+	q := `
+		update container_items set deleted = now(), version = version + 1
+		where id = ? and version = ? and deleted is null
+	`
 	tx, _ := c.DB.Begin()
-	_, err := tx.Exec(q, item.ID)
+	err := changelog.Deleted(tx, changelog.Item, item.ID)
+	var entry audit.Entry
+	if err == nil {
+		var res sql.Result
+		res, err = tx.Exec(q, item.ID, item.Version)
+		if err == nil {
+			err = models.CheckVersion(res)
+		}
+	}
+	if err == nil {
+		entry, err = c.recordAudit(tx, *item, audit.ActionDelete, audit.Diff(item.auditFields(), nil))
+	}
 	if err == nil {
 		err = updateContainerItemCount(tx, item.Container.ID)
 	}
 	if err == nil {
-		tx.Commit()
+		err = tx.Commit()
 	} else {
 		tx.Rollback()
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	item.Version++
+	events.Committed(entry)
+	return nil
 }
 
-// DeleteMany remove a set of items from a container
+// DeleteMany moves a set of items to the trash at once, provided none of them has changed since they were retrieved.
 func (c *Store) DeleteMany(items ContainerItems) error {
-	ids := make([]interface{}, 0)
-	for _, item := range items {
-		ids = append(ids, item.ID)
-	}
-	q := fmt.Sprintf("delete from container_items where id in (%s)", "?"+strings.Repeat(",?", len(items)-1))
-	tx, _ := c.DB.Begin()
-	_, err := tx.Exec(q, ids...)
+	q := `
+		update container_items set deleted = now(), version = version + 1
+		where id = ? and version = ? and deleted is null
+	`
+	tx, err := c.DB.Begin()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
+	entries := make([]audit.Entry, len(items))
+	for i := 0; err == nil && i < len(items); i++ {
+		err = changelog.Deleted(tx, changelog.Item, items[i].ID)
+		if err == nil {
+			var res sql.Result
+			res, err = tx.Exec(q, items[i].ID, items[i].Version)
+			if err == nil {
+				err = models.CheckVersion(res)
+			}
+		}
+		if err == nil {
+			entries[i], err = c.recordAudit(tx, items[i], audit.ActionDelete, audit.Diff(items[i].auditFields(), nil))
+		}
+	}
 	for _, container := range items.ExtractContainers() {
-		err := updateContainerItemCount(tx, container.ID)
-		if err != nil {
-			tx.Rollback()
-			return err
+		if err == nil {
+			err = updateContainerItemCount(tx, container.ID)
 		}
 	}
-	tx.Commit()
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	events.Committed(entries...)
+	for i := range items {
+		items[i].Version++
+	}
+	return nil
+}
+
+// Restore brings an item back from the trash, provided it has not changed since it was retrieved.
+func (c *Store) Restore(item *ContainerItem) error {
+	items := ContainerItems{*item}
+	err := c.RestoreMany(items)
+	if err == nil {
+		*item = items[0]
+	}
 	return err
 }
 
+// RestoreMany brings a set of items back from the trash at once, provided none of them has changed since they were retrieved.
+func (c *Store) RestoreMany(items ContainerItems) error {
+	q := `
+		update container_items set deleted = null, version = version + 1, modified = now()
+		where id = ? and version = ? and deleted is not null
+	`
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	entries := make([]audit.Entry, len(items))
+	for i := 0; err == nil && i < len(items); i++ {
+		var res sql.Result
+		res, err = tx.Exec(q, items[i].ID, items[i].Version)
+		if err == nil {
+			err = models.CheckVersion(res)
+		}
+		if err == nil {
+			err = changelog.Changed(tx, changelog.Item, items[i].ID)
+		}
+		if err == nil {
+			entries[i], err = c.recordAudit(tx, items[i], audit.ActionRestore, nil)
+		}
+	}
+	for _, container := range items.ExtractContainers() {
+		if err == nil {
+			err = updateContainerItemCount(tx, container.ID)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	events.Committed(entries...)
+	for i := range items {
+		items[i].Version++
+		items[i].Deleted = nil
+	}
+	return nil
+}
+
 // PagedResponse is a response object that contains items and paginated meta.
 type PagedResponse struct {
 	Items         ContainerItems       `json:"items"`
 	PagedResponse models.PagedResponse `json:"paged_response"`
+	// Suggestions are corrected queries offered when searching with misspelled words
+	Suggestions []string `json:"suggestions,omitempty"`
 }
 
 func (r *PagedResponse) getItemIDMap() map[int64]*ContainerItem {
@@ -145,16 +510,9 @@ func (r *PagedResponse) getItemIDMap() map[int64]*ContainerItem {
 	return mappedItems
 }
 
-// ByID retrieves an item by its ID
+// ByID retrieves an item by its ID, items in the trash are not found.
 func (c *Store) ByID(ID int64) (ContainerItem, error) {
-	q := `
-		select id, container_id, uuid, body, quantity, created, modified
-		from container_items
-		where id = ?
-	`
-	item := ContainerItem{}
-	var containerID int64
-	err := c.DB.QueryRow(q, ID).Scan(&item.ID, &containerID, &item.UUID, &item.Body, &item.Quantity, &item.Created, &item.Modified)
+	item, containerID, err := c.find(ID, false)
 	if err != nil {
 		return item, err
 	}
@@ -165,16 +523,121 @@ func (c *Store) ByID(ID int64) (ContainerItem, error) {
 	return item, err
 }
 
+// OwnedBy retrieves an item by its ID on behalf of a user, items in the containers of other users are forbidden.
+func (c *Store) OwnedBy(ID int64, userID int64) (ContainerItem, error) {
+	item, err := c.ByID(ID)
+	if err == nil {
+		err = models.CheckOwner(item.Container.User.ID, userID, "item belongs to another user")
+	}
+	return item, err
+}
+
+// TrashedByID retrieves an item in the trash by its ID, its container may be in the trash as well.
+func (c *Store) TrashedByID(ID int64) (ContainerItem, error) {
+	item, containerID, err := c.find(ID, true)
+	if err != nil {
+		return item, err
+	}
+	containerModel := containers.NewStore(c.DB)
+	container, err := containerModel.ByID(containerID)
+	if errors.Is(err, models.ErrNotFound) {
+		container, err = containerModel.TrashedByID(containerID)
+	}
+	if err == nil {
+		item.Container = &container
+	}
+	return item, err
+}
+
+// TrashedOwnedBy retrieves an item in the trash on behalf of a user, items in the containers of other users are forbidden.
+// ErrContainerTrashed is returned along with the item when its container is in the trash as well.
+func (c *Store) TrashedOwnedBy(ID int64, userID int64) (ContainerItem, error) {
+	item, err := c.TrashedByID(ID)
+	if err == nil {
+		err = models.CheckOwner(item.Container.User.ID, userID, "item belongs to another user")
+	}
+	if err == nil && item.Container.Deleted != nil {
+		err = ErrContainerTrashed
+	}
+	return item, err
+}
+
+// find retrieves an item either out of or in the trash, along with the ID of its container.
+func (c *Store) find(ID int64, trashed bool) (ContainerItem, int64, error) {
+	q := `
+		select id, container_id, uuid, body, notes, tags, quantity, min_quantity, expires, version, created, modified, deleted
+		from container_items
+		where id = ? and (deleted is not null) = ?
+	`
+	item := ContainerItem{}
+	var containerID int64
+	var notes sql.NullString
+	var tags string
+	var minQuantity sql.NullInt64
+	var expires, deleted mysql.NullTime
+	err := c.DB.QueryRow(q, ID, trashed).Scan(&item.ID, &containerID, &item.UUID, &item.Body, &notes, &tags, &item.Quantity, &minQuantity, &expires, &item.Version, &item.Created, &item.Modified, &deleted)
+	if err != nil {
+		return item, 0, models.NotFound(err, "item not found")
+	}
+	item.setNotes(notes)
+	item.setTags(tags)
+	item.setMinQuantity(minQuantity)
+	item.setExpires(expires)
+	if deleted.Valid {
+		item.Deleted = &deleted.Time
+	}
+	return item, containerID, nil
+}
+
+// Trashed retrieves the items of a user in the trash, most recently deleted first.
+// Items of containers in the trash are left out, they are restored along with their container.
+func (c *Store) Trashed(userID int64) (ContainerItems, error) {
+	q := `
+		select ci.id
+		from container_items ci
+		inner join containers c on c.id = ci.container_id and c.user_id = ? and c.deleted is null
+		where ci.deleted is not null
+		order by ci.deleted desc, ci.id desc
+	`
+	rows, err := c.DB.Query(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	trashed := make(ContainerItems, 0, len(ids))
+	for _, id := range ids {
+		item, err := c.TrashedByID(id)
+		if err != nil {
+			return nil, err
+		}
+		trashed = append(trashed, item)
+	}
+	return trashed, nil
+}
+
 // GetContainerItems retrieves all items (paginated) from a container
 func (c *Store) GetContainerItems(container *containers.Container, sort models.SortBy, limit models.QueryLimit) (PagedResponse, error) {
 	q := `
-		select id, uuid, body, quantity, created, modified
-		from container_items
-		where container_id = ?
-		order by %v %v
+		select ci.id, ci.uuid, ci.body, ci.notes, ci.tags, ci.quantity, ci.min_quantity, ci.expires,
+			l.id, l.due, ci.version, ci.created, ci.modified
+		from container_items ci
+		left join item_loans l on l.container_item_id = ci.id and l.checked_in is null
+		where ci.container_id = ? and ci.deleted is null
+		order by %v, ci.id %v
 		limit %v offset %v
 	`
-	rows, err := c.DB.Query(fmt.Sprintf(q, sort.Field, sort.Direction, limit.Limit, limit.Offset), container.ID)
+	rows, err := c.DB.Query(fmt.Sprintf(q, sort.OrderBy("ci"), sort.Direction, limit.Limit, limit.Offset), container.ID)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -182,7 +645,18 @@ func (c *Store) GetContainerItems(container *containers.Container, sort models.S
 	response := PagedResponse{}
 	for rows.Next() {
 		item := ContainerItem{}
-		rows.Scan(&item.ID, &item.UUID, &item.Body, &item.Quantity, &item.Created, &item.Modified)
+		var notes sql.NullString
+		var tags string
+		var minQuantity sql.NullInt64
+		var expires mysql.NullTime
+		var loanID sql.NullInt64
+		var loanDue mysql.NullTime
+		rows.Scan(&item.ID, &item.UUID, &item.Body, &notes, &tags, &item.Quantity, &minQuantity, &expires, &loanID, &loanDue, &item.Version, &item.Created, &item.Modified)
+		item.setNotes(notes)
+		item.setTags(tags)
+		item.setMinQuantity(minQuantity)
+		item.setExpires(expires)
+		item.setLoan(loanID, loanDue)
 		item.Container = container
 		response.Items = append(response.Items, item)
 	}
@@ -190,54 +664,181 @@ func (c *Store) GetContainerItems(container *containers.Container, sort models.S
 	countQ := `
 		select count(*)
 		from container_items
-		where container_id = ?
+		where container_id = ? and deleted is null
 	`
 	c.DB.QueryRow(countQ, container.ID).Scan(&response.PagedResponse.Total)
 	response.PagedResponse.CalculatePages(limit)
 	return response, rows.Err()
 }
 
-func (c *Store) SearchItems(userID int64, term string, sort models.SortBy, limit models.QueryLimit) (PagedResponse, error) {
+// ByContainers retrieves a page of the items of each of the containers in a single query, the pages are grouped
+// by the ID of their container. The limit (and cursor) applies to every container, the totals are left unset.
+func (c *Store) ByContainers(parents containers.Containers, sort models.SortBy, limit models.QueryLimit) (map[int64]PagedResponse, error) {
+	found := make(map[int64]PagedResponse, len(parents))
+	if len(parents) == 0 {
+		return found, nil
+	}
+	keyset := models.Keyset{Sort: sort, Alias: "ci", Limit: limit}
+	keysetModifier, keysetArgs, err := keyset.Where()
+	if err != nil {
+		return nil, err
+	}
+	// A limited query per container, MySQL 5.6 has no window functions to limit the rows of each container
+	branch := fmt.Sprintf(`(
+		select ci.id, ci.container_id, ci.uuid, ci.body, ci.notes, ci.tags, ci.quantity, ci.min_quantity, ci.expires,
+			l.id as loan_id, l.due as loan_due, ci.version, ci.created, ci.modified, %v
+		from container_items ci
+		left join item_loans l on l.container_item_id = ci.id and l.checked_in is null
+		where ci.container_id = ? and ci.deleted is null %v
+		%v
+	)`, keyset.ColumnsAs(), keysetModifier, keyset.OrderBy())
+	branches := make([]string, len(parents))
+	args := make([]interface{}, 0, len(parents)*(len(keysetArgs)+1))
+	byID := make(map[int64]*containers.Container, len(parents))
+	for i := range parents {
+		branches[i] = branch
+		args = append(append(args, parents[i].ID), keysetArgs...)
+		byID[parents[i].ID] = &parents[i]
+	}
+	q := fmt.Sprintf("select * from (%v) page %v", strings.Join(branches, " union all "), keyset.UnionOrderBy())
+	rows, err := c.DB.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[int64][][]interface{}, len(parents))
+	ids := make(map[int64][]int64, len(parents))
+	for rows.Next() {
+		item := ContainerItem{}
+		var containerID int64
+		var notes sql.NullString
+		var tags string
+		var minQuantity sql.NullInt64
+		var expires mysql.NullTime
+		var loanID sql.NullInt64
+		var loanDue mysql.NullTime
+		row, value := keyset.Scan(&item.ID, &containerID, &item.UUID, &item.Body, &notes, &tags, &item.Quantity, &minQuantity, &expires, &loanID, &loanDue, &item.Version, &item.Created, &item.Modified)
+		if err = rows.Scan(row...); err != nil {
+			return nil, err
+		}
+		item.setNotes(notes)
+		item.setTags(tags)
+		item.setMinQuantity(minQuantity)
+		item.setExpires(expires)
+		item.setLoan(loanID, loanDue)
+		item.Container = byID[containerID]
+		page := found[containerID]
+		page.Items = append(page.Items, item)
+		found[containerID] = page
+		values[containerID] = append(values[containerID], value)
+		ids[containerID] = append(ids[containerID], item.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for containerID, page := range found {
+		keyset.Page(&page.Items, values[containerID], ids[containerID], &page.PagedResponse)
+		page.PagedResponse.RequestTotal = len(page.Items)
+		found[containerID] = page
+	}
+	return found, nil
+}
+
+// Expiring retrieves every item of a user that expires within the given number of days,
+// including items that have already expired, soonest first.
+func (c *Store) Expiring(userID int64, days int) (ContainerItems, error) {
 	q := `
-		select SQL_CALC_FOUND_ROWS ci.id, container_id, ci.uuid, body, quantity, ci.created, ci.modified
+		select ci.id, ci.container_id, ci.uuid, ci.body, ci.quantity, ci.min_quantity, ci.expires, ci.version, ci.created, ci.modified
 		from container_items ci
 		inner join containers c on c.id = ci.container_id and c.user_id = ?
-		where body like concat('%%', ?, '%%')
-		order by %v %v
-		limit %v offset %v
+		where ci.deleted is null and ci.expires is not null and ci.expires <= date_add(now(), interval ? day)
+		order by ci.expires asc, ci.id asc
 	`
-	q = fmt.Sprintf(q, sort.Field, sort.Direction, limit.Limit, limit.Offset)
-	rows, err := c.DB.Query(q, userID, term)
+	rows, err := c.DB.Query(q, userID, days)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer rows.Close()
-	response := PagedResponse{}
-	containerIDs := make(map[int64]int64)
+	expiring := make(ContainerItems, 0)
+	containerIDs := make([]int64, 0)
 	for rows.Next() {
 		item := ContainerItem{}
 		var containerID int64
-		rows.Scan(&item.ID, &containerID, &item.UUID, &item.Body, &item.Quantity, &item.Created, &item.Modified)
-		containerIDs[item.ID] = containerID
-		response.Items = append(response.Items, item)
+		var minQuantity sql.NullInt64
+		var expires mysql.NullTime
+		err = rows.Scan(&item.ID, &containerID, &item.UUID, &item.Body, &item.Quantity, &minQuantity, &expires, &item.Version, &item.Created, &item.Modified)
+		if err != nil {
+			return nil, err
+		}
+		item.setMinQuantity(minQuantity)
+		item.setExpires(expires)
+		expiring = append(expiring, item)
+		containerIDs = append(containerIDs, containerID)
 	}
-	response.PagedResponse.RequestTotal = len(response.Items)
-	c.DB.QueryRow("select FOUND_ROWS()").Scan(&response.PagedResponse.Total)
-	var wg sync.WaitGroup
-	wg.Add(len(containerIDs))
-	itemMap := response.getItemIDMap()
-	containerModel := containers.NewStore(c.DB)
-	for k, v := range containerIDs {
-		go func(containerID int64, item *ContainerItem) {
-			defer wg.Done()
-			// @todo Instead of doing individual queries, make a query in containers to accept
-			// an array of IDs and do a single query
-			// For the time being this is fine because we limit the maximum results to QueryLimit (20)
-			container, _ := containerModel.ByID(containerID)
-			item.Container = &container
-		}(v, itemMap[k])
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	response.PagedResponse.CalculatePages(limit)
-	wg.Wait()
-	return response, rows.Err()
+	itemContainers, err := c.containersOf(containerIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i, containerID := range containerIDs {
+		container := itemContainers[containerID]
+		expiring[i].Container = &container
+	}
+	return expiring, nil
+}
+
+// PendingExpiryReminders retrieves, for every user, the items that have entered the user's
+// expiry reminder window and have not yet been reminded about.
+func (c *Store) PendingExpiryReminders() ([]ExpiryReminder, error) {
+	q := `
+		select ci.id, ci.uuid, ci.body, ci.quantity, ci.expires, c.id, c.name, u.id, u.email
+		from container_items ci
+		inner join containers c on c.id = ci.container_id
+		inner join users u on u.id = c.user_id
+		where ci.deleted is null
+			and ci.expires is not null
+			and ci.expiry_reminded is null
+			and u.expiry_reminder_days > 0
+			and ci.expires <= date_add(now(), interval u.expiry_reminder_days day)
+		order by u.id, ci.expires
+	`
+	rows, err := c.DB.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reminders := make([]ExpiryReminder, 0)
+	for rows.Next() {
+		item := ContainerItem{Container: &containers.Container{}}
+		var user users.User
+		var expires mysql.NullTime
+		err = rows.Scan(&item.ID, &item.UUID, &item.Body, &item.Quantity, &expires, &item.Container.ID, &item.Container.Name, &user.ID, &user.Email)
+		if err != nil {
+			return nil, err
+		}
+		item.setExpires(expires)
+		item.Container.User = user
+		if len(reminders) == 0 || reminders[len(reminders)-1].User.ID != user.ID {
+			reminders = append(reminders, ExpiryReminder{User: user})
+		}
+		last := &reminders[len(reminders)-1]
+		last.Items = append(last.Items, item)
+	}
+	return reminders, rows.Err()
+}
+
+// MarkReminded records that the user has been reminded about the expiry of the given items.
+func (c *Store) MarkReminded(items ContainerItems) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	q := fmt.Sprintf("update container_items set expiry_reminded = now() where id in (%s)", "?"+strings.Repeat(",?", len(items)-1))
+	_, err := c.DB.Exec(q, ids...)
+	return err
 }
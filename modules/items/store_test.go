@@ -0,0 +1,233 @@
+package items_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/blob"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/trash"
+	"github.com/cjsaylor/sqlfixture"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var db *sql.DB
+
+func TestMain(m *testing.M) {
+	db, _ = sql.Open("mysql", fmt.Sprintf("%v?parseTime=true", config.Config.MysqlDSN))
+	defer db.Close()
+	setup(db)
+	os.Exit(m.Run())
+}
+
+func setup(db *sql.DB) {
+	db.Exec("SET FOREIGN_KEY_CHECKS=0")
+	fixture := sqlfixture.New(db, sqlfixture.Tables{
+		sqlfixture.Table{
+			Name: "users",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":        1,
+					"email":     "test@test.com",
+					"is_active": 1,
+					"created":   "2017-05-15",
+					"modified":  "2017-05-15",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "locations",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":              1,
+					"user_id":         1,
+					"uuid":            "ff1eda35-4183-11e7-9cc8-0242ac120003",
+					"name":            "My Garage",
+					"address":         "",
+					"container_count": 1,
+					"is_mappable":     false,
+					"created":         "2017-05-15",
+					"modified":        "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":              2,
+					"user_id":         1,
+					"uuid":            "ff1eda35-4183-11e7-9cc8-0242ac120004",
+					"name":            "Basement",
+					"address":         "",
+					"container_count": 0,
+					"is_mappable":     false,
+					"created":         "2017-05-15",
+					"modified":        "2017-05-15",
+					"deleted":         "2017-05-16",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "containers",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":                   1,
+					"user_id":              1,
+					"location_id":          1,
+					"uuid":                 "0a8e7c2e-4184-11e7-9cc8-0242ac120003",
+					"name":                 "Tools",
+					"container_item_count": 2,
+					"version":              1,
+					"created":              "2017-05-15",
+					"modified":             "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":                   2,
+					"user_id":              1,
+					"location_id":          2,
+					"uuid":                 "0a8e7c2e-4184-11e7-9cc8-0242ac120004",
+					"name":                 "Paint",
+					"container_item_count": 0,
+					"version":              1,
+					"created":              "2017-05-15",
+					"modified":             "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":                   3,
+					"user_id":              1,
+					"location_id":          nil,
+					"uuid":                 "0a8e7c2e-4184-11e7-9cc8-0242ac120005",
+					"name":                 "Old boxes",
+					"container_item_count": 0,
+					"version":              2,
+					"created":              "2017-05-15",
+					"modified":             "2017-05-15",
+					"deleted":              "2017-05-16",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "container_items",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":           1,
+					"container_id": 1,
+					"uuid":         "1b2c3d4e-4184-11e7-9cc8-0242ac120003",
+					"body":         "Hammer",
+					"quantity":     1,
+					"version":      1,
+					"created":      "2017-05-15",
+					"modified":     "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":           2,
+					"container_id": 1,
+					"uuid":         "1b2c3d4e-4184-11e7-9cc8-0242ac120004",
+					"body":         "Saw",
+					"quantity":     1,
+					"version":      1,
+					"created":      "2017-05-15",
+					"modified":     "2017-05-15",
+				},
+				sqlfixture.Row{
+					"id":           3,
+					"container_id": 1,
+					"uuid":         "1b2c3d4e-4184-11e7-9cc8-0242ac120005",
+					"body":         "Broken drill",
+					"quantity":     1,
+					"version":      2,
+					"created":      "2017-05-15",
+					"modified":     "2017-05-15",
+					"deleted":      "2017-05-16",
+				},
+			},
+		},
+		sqlfixture.Table{
+			Name: "photos",
+			Rows: sqlfixture.Rows{
+				sqlfixture.Row{
+					"id":            1,
+					"user_id":       1,
+					"entity_type":   "item",
+					"entity_id":     3,
+					"uuid":          "2c3d4e5f-4184-11e7-9cc8-0242ac120003",
+					"content_type":  "image/jpeg",
+					"size":          4,
+					"width":         1,
+					"height":        1,
+					"blob_key":      "photos/broken-drill",
+					"thumbnail_key": "thumbnails/broken-drill",
+					"created":       "2017-05-15",
+				},
+			},
+		},
+	})
+	fixture.Populate()
+	db.Exec("truncate audit_log")
+	db.Exec("SET FOREIGN_KEY_CHECKS=1")
+}
+
+func TestStore_RestoreWithContainer(t *testing.T) {
+	setup(db)
+	itemModel := items.NewStore(db).As(1)
+	item, err := itemModel.ByID(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	container := *item.Container
+	containerModel := containers.NewStore(db).As(1)
+	if err = containerModel.Delete(&container); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = itemModel.ByID(1); err == nil {
+		t.Error("Expected the item to be trashed with its container")
+	}
+	container, err = containerModel.TrashedByID(container.ID)
+	if err == nil {
+		err = containerModel.Restore(&container)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	item, err = itemModel.ByID(1)
+	if err != nil || item.Container.ContainerItemCount != 2 {
+		t.Errorf("Expected the item to be restored in a container of 2 items but got %+v (%v)", item, err)
+	}
+	if _, err = itemModel.ByID(3); err == nil {
+		t.Error("Expected the item trashed before its container to stay in the trash")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	setup(db)
+	blobs := blob.NewLocalStore(t.TempDir())
+	for _, key := range []string{"photos/broken-drill", "thumbnails/broken-drill"} {
+		if err := blobs.Put(key, "image/jpeg", []byte("jpeg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trash.Purge(db, blobs, time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	itemModel := items.NewStore(db)
+	if _, err := itemModel.TrashedByID(3); err == nil {
+		t.Error("Expected the trashed item to be purged")
+	}
+	if _, err := itemModel.ByID(1); err != nil {
+		t.Errorf("Expected the items outside the trash to be kept but got %v", err)
+	}
+	var photos int
+	if err := db.QueryRow("select count(*) from photos where entity_type = 'item' and entity_id = 3").Scan(&photos); err != nil || photos != 0 {
+		t.Errorf("Expected the photos of the purged item to be removed but %v were left (%v)", photos, err)
+	}
+	for _, key := range []string{"photos/broken-drill", "thumbnails/broken-drill"} {
+		if _, err := blobs.Get(key); err != blob.ErrNotFound {
+			t.Errorf("Expected %v to be removed but got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package items
+
+import (
+	"database/sql"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+)
+
+func init() {
+	undo.Register(audit.Item, reverse)
+}
+
+// reverse undoes a change to items of a user (see undo.Reverser).
+// Items deleted together are restored together and items created together are deleted together, an update
+// (or a quantity adjustment) is reverted by updating the item with its former fields.
+func reverse(db *sql.DB, userID int64, op undo.Operation) error {
+	store := NewStore(db).As(userID)
+	if op.Action == undo.ActionDelete {
+		items := make(ContainerItems, 0, len(op.Records))
+		for _, record := range op.Records {
+			item, err := store.OwnedBy(record.ID, userID)
+			if err != nil {
+				return err
+			}
+			item.Version = record.Version
+			items = append(items, item)
+		}
+		return store.DeleteMany(items)
+	}
+	if op.Action == undo.ActionRestore {
+		items := make(ContainerItems, 0, len(op.Records))
+		for _, record := range op.Records {
+			item, err := store.TrashedOwnedBy(record.ID, userID)
+			if err != nil {
+				return err
+			}
+			item.Version = record.Version
+			items = append(items, item)
+		}
+		return store.RestoreMany(items)
+	}
+	record := op.Records[0]
+	item, err := store.OwnedBy(record.ID, userID)
+	if err == nil {
+		err = record.DecodeBefore(&item)
+	}
+	if err != nil {
+		return err
+	}
+	item.Version = record.Version
+	return store.Update(&item)
+}
@@ -0,0 +1,75 @@
+package items_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+)
+
+func setupUndo(t *testing.T) *items.Store {
+	setup(db)
+	if _, err := db.Exec("truncate undo_operations"); err != nil {
+		t.Fatal(err)
+	}
+	return items.NewStore(db).As(1)
+}
+
+func TestUndo_CreateMany(t *testing.T) {
+	itemModel := setupUndo(t)
+	item, err := itemModel.ByID(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	created := items.ContainerItems{{Body: "Nails", Quantity: 100}, {Body: "Screws", Quantity: 50}}
+	err = itemModel.CreateMany(item.Container, created)
+	op := undo.NewDelete(audit.Item)
+	for _, item := range created {
+		op.Add(item.ID, item.Version)
+	}
+	var token string
+	if err == nil {
+		token, err = undo.Save(db, 1, op)
+	}
+	if err == nil {
+		err = undo.Undo(db, 1, token)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, item := range created {
+		if _, err = itemModel.ByID(item.ID); err == nil {
+			t.Errorf("Expected the created item %v to be moved to the trash", item.ID)
+		}
+	}
+	kept, err := itemModel.ByID(1)
+	if err != nil || kept.Container.ContainerItemCount != 2 {
+		t.Errorf("Expected the container to be left with 2 items but got %+v (%v)", kept.Container, err)
+	}
+}
+
+func TestUndo_AdjustQuantity(t *testing.T) {
+	itemModel := setupUndo(t)
+	item, err := itemModel.ByID(1)
+	if err == nil {
+		err = itemModel.AdjustQuantity(&item, 3, "Bought more")
+	}
+	var token string
+	if err == nil {
+		token, err = undo.Save(db, 1, undo.NewRevert(audit.Item, item.ID, item.Version, audit.Fields{"quantity": item.Quantity - 3}))
+	}
+	if err == nil {
+		err = undo.Undo(db, 1, token)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := itemModel.ByID(1)
+	if err != nil || result.Quantity != 1 {
+		t.Errorf("Expected the quantity to be set back to 1 but got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,227 @@
+package loans
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/gorilla/mux"
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin loan module routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "CheckOutItem",
+		Method:  "POST",
+		Pattern: "/api/item/{id}/checkout",
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(checkOutHandler),
+	},
+	config.Route{
+		Name:    "CheckInItem",
+		Method:  "POST",
+		Pattern: "/api/item/{id}/checkin",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(checkInHandler),
+	},
+	config.Route{
+		Name:    "ItemLoans",
+		Method:  "GET",
+		Pattern: "/api/item/{id}/loans",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(itemLoansHandler),
+	},
+	config.Route{
+		Name:    "Loans",
+		Method:  "GET",
+		Pattern: "/api/loans",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(loansHandler),
+	},
+}
+
+// Apply hooks related to loans
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// checkOutRequest is the body of requests lending an item.
+type checkOutRequest struct {
+	Borrower      string `json:"borrower" validate:"max=100"`
+	BorrowerEmail string `json:"borrower_email" validate:"email"`
+	Due           string `json:"due" validate:"date"`
+	Notes         string `json:"notes"`
+}
+
+func (r checkOutRequest) Validate() binding.Errors {
+	var errs binding.Errors
+	if r.Borrower == "" && r.BorrowerEmail == "" {
+		errs.Add("borrower", "is required unless borrower_email is given")
+	}
+	return errs
+}
+
+// checkOutHandler lends an item to somebody
+// Expected body (JSON or form):
+//   borrower (name of the person, optional if borrower_email is supplied)
+//   borrower_email (email of another Boxmeup user, optional)
+//   due (YYYY-MM-DD, optional)
+//   notes (optional)
+func checkOutHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	itemID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	item, err := items.NewStore(db).OwnedBy(int64(itemID), userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the item.")
+		return
+	}
+	var body checkOutRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	loan := Loan{
+		Item:     &item,
+		User:     item.Container.User,
+		Borrower: body.Borrower,
+		Notes:    body.Notes,
+	}
+	if body.BorrowerEmail != "" {
+		borrower, err := users.NewStore(db).ByEmail(body.BorrowerEmail)
+		if errors.Is(err, models.ErrNotFound) {
+			middleware.WriteProblem(res, req, middleware.NotFound, "Borrower not found.")
+			return
+		} else if err != nil {
+			middleware.WriteError(res, req, err, "Unable to retrieve the borrower.")
+			return
+		}
+		loan.BorrowerUserID = borrower.ID
+		if loan.Borrower == "" {
+			loan.Borrower = borrower.Email
+		}
+	}
+	if body.Due != "" {
+		dueDate, _ := models.ParseDate(body.Due)
+		loan.Due = &dueDate
+	}
+	err = NewStore(db).CheckOut(&loan)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to check out this item.")
+		return
+	}
+	op := undo.NewDelete(undoType)
+	op.Add(loan.ID, 0)
+	undo.Offer(res, req, db, op)
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string]int64{
+		"id": loan.ID,
+	})
+}
+
+// checkInRequest is the body of requests returning a lent item.
+type checkInRequest struct {
+	Notes string `json:"notes"`
+}
+
+// checkInHandler marks a lent item as returned
+// Expected body (JSON or form):
+//   notes (optional, replaces the notes recorded at check out)
+func checkInHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	itemID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	item, err := items.NewStore(db).OwnedBy(int64(itemID), userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the item.")
+		return
+	}
+	var body checkInRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	loanModel := NewStore(db)
+	loan, err := loanModel.OutstandingByItem(item.ID)
+	before := audit.Fields{"notes": loan.Notes}
+	if err == nil {
+		err = loanModel.CheckIn(&loan, body.Notes)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to check in this item.")
+		return
+	}
+	undo.Offer(res, req, db, undo.NewRevert(undoType, loan.ID, 0, before))
+	loan.Item = &item
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(loan)
+}
+
+// itemLoansHandler retrieves the loan history of an item
+func itemLoansHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	itemID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	item, err := items.NewStore(db).OwnedBy(int64(itemID), userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the item.")
+		return
+	}
+	loans, err := NewStore(db).ByItem(&item)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve loans.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string]Loans{
+		"loans": loans,
+	})
+}
+
+// loansHandler retrieves every item the user currently has lent out.
+// Supply overdue=T to only retrieve loans past their due date.
+func loansHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	jsonOut := json.NewEncoder(res)
+	user, err := users.NewStore(db).ByID(userID)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to get user information.")
+		return
+	}
+	filter := LoanFilter{
+		User:        user,
+		OverdueOnly: req.URL.Query().Get("overdue") == "T",
+	}
+	loans, err := NewStore(db).Outstanding(filter)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve loans.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(map[string]Loans{
+		"loans": loans,
+	})
+}
@@ -0,0 +1,71 @@
+package loans
+
+import (
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+)
+
+// Loan records an item being checked out to somebody.
+type Loan struct {
+	ID             int64                `json:"id"`
+	Item           *items.ContainerItem `json:"item,omitempty"`
+	User           users.User           `json:"-"`
+	BorrowerUserID int64                `json:"borrower_user_id,omitempty"`
+	Borrower       string               `json:"borrower"`
+	Notes          string               `json:"notes"`
+	Due            *time.Time           `json:"due"`
+	CheckedOut     time.Time            `json:"checked_out"`
+	CheckedIn      *time.Time           `json:"checked_in"`
+	IsOverdue      bool                 `json:"is_overdue"`
+	Created        time.Time            `json:"created"`
+	Modified       time.Time            `json:"modified"`
+}
+
+// Overdue reports whether the loan is outstanding past its due date at a time.
+func (l Loan) Overdue(at time.Time) bool {
+	return l.CheckedIn == nil && models.PastDue(l.Due, at)
+}
+
+// Lend checks the loan out at a time, given the number of loans of its item still outstanding.
+// A loan must be for a stored item and have a borrower, and an item may only have one outstanding loan at a time.
+func (l *Loan) Lend(outstanding int, at time.Time) error {
+	if l.Item == nil || l.Item.ID == 0 {
+		return models.NewError(models.ErrValidation, "a loan must be for a stored item")
+	}
+	if l.Borrower == "" {
+		return models.NewError(models.ErrValidation, "a loan must have a borrower")
+	}
+	if outstanding > 0 {
+		return ErrAlreadyCheckedOut
+	}
+	l.CheckedOut = at
+	l.CheckedIn = nil
+	l.IsOverdue = l.Overdue(at)
+	return nil
+}
+
+// Return checks the loan in at a time, notes replace those recorded at check out unless empty.
+// Loans that were already returned result in ErrNotCheckedOut.
+func (l *Loan) Return(at time.Time, notes string) error {
+	if l.CheckedIn != nil {
+		return ErrNotCheckedOut
+	}
+	if notes != "" {
+		l.Notes = notes
+	}
+	l.CheckedIn = &at
+	l.IsOverdue = false
+	return nil
+}
+
+// Loans is a group of loans.
+type Loans []Loan
+
+// LoanFilter narrows down which loans are retrieved for a user.
+type LoanFilter struct {
+	User        users.User
+	OverdueOnly bool
+}
@@ -0,0 +1,87 @@
+package loans_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/loans"
+)
+
+func TestOverdue(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	tomorrow := now.AddDate(0, 0, 1)
+	cases := []struct {
+		name     string
+		loan     loans.Loan
+		expected bool
+	}{
+		{"no due date", loans.Loan{}, false},
+		{"due later", loans.Loan{Due: &tomorrow}, false},
+		{"past due", loans.Loan{Due: &yesterday}, true},
+		{"returned late", loans.Loan{Due: &yesterday, CheckedIn: &now}, false},
+	}
+	for _, c := range cases {
+		if overdue := c.loan.Overdue(now); overdue != c.expected {
+			t.Errorf("%v: expected overdue to be %v", c.name, c.expected)
+		}
+	}
+}
+
+func TestLend(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	loan := loans.Loan{Item: &items.ContainerItem{ID: 1}, Borrower: "Sam", Due: &yesterday}
+	if err := loan.Lend(0, now); err != nil {
+		t.Fatal(err)
+	}
+	if !loan.CheckedOut.Equal(now) || loan.CheckedIn != nil || !loan.IsOverdue {
+		t.Errorf("Expected the loan to be checked out and overdue, got %+v", loan)
+	}
+	if err := loan.Lend(1, now); err != loans.ErrAlreadyCheckedOut {
+		t.Errorf("Expected an item with an outstanding loan not to be lent again, got %v", err)
+	}
+	invalid := []loans.Loan{
+		{Borrower: "Sam"},
+		{Item: &items.ContainerItem{}, Borrower: "Sam"},
+		{Item: &items.ContainerItem{ID: 1}},
+	}
+	for _, loan := range invalid {
+		if err := loan.Lend(0, now); !errors.Is(err, models.ErrValidation) {
+			t.Errorf("Expected %+v to be invalid, got %v", loan, err)
+		}
+	}
+}
+
+func TestReturn(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	loan := loans.Loan{Item: &items.ContainerItem{ID: 1}, Borrower: "Sam", Notes: "with charger", Due: &yesterday}
+	if err := loan.Lend(0, yesterday.AddDate(0, 0, -7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := loan.Return(now, ""); err != nil {
+		t.Fatal(err)
+	}
+	if loan.CheckedIn == nil || !loan.CheckedIn.Equal(now) || loan.IsOverdue || loan.Overdue(now) {
+		t.Errorf("Expected the loan to be checked in and no longer overdue, got %+v", loan)
+	}
+	if loan.Notes != "with charger" {
+		t.Errorf("Expected the notes of the check out to be kept, got %q", loan.Notes)
+	}
+	if err := loan.Return(now, "again"); err != loans.ErrNotCheckedOut {
+		t.Errorf("Expected a returned loan not to be checked in again, got %v", err)
+	}
+	if loan.Notes != "with charger" {
+		t.Errorf("Expected a refused check in to leave the loan unchanged, got %q", loan.Notes)
+	}
+	loan = loans.Loan{Item: &items.ContainerItem{ID: 1}, Borrower: "Sam", Notes: "with charger"}
+	loan.Lend(0, yesterday)
+	loan.Return(now, "charger missing")
+	if loan.Notes != "charger missing" {
+		t.Errorf("Expected the notes of the check in to replace those of the check out, got %q", loan.Notes)
+	}
+}
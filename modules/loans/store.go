@@ -0,0 +1,239 @@
+package loans
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrAlreadyCheckedOut is returned when checking out an item that has not been returned.
+	ErrAlreadyCheckedOut error = &models.Error{Kind: models.ErrConflict, Code: "already_checked_out", Message: "item is already checked out"}
+	// ErrNotCheckedOut is returned when checking in an item that is not on loan.
+	ErrNotCheckedOut error = &models.Error{Kind: models.ErrConflict, Code: "not_checked_out", Message: "item is not checked out"}
+)
+
+// NewStore constructs a storage interface for loans.
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db}
+}
+
+// Store persists and queries item loans
+type Store struct {
+	DB *sql.DB
+}
+
+const loanColumns = `
+	id, container_item_id, coalesce(borrower_user_id, 0), borrower_name, coalesce(notes, ''),
+	due, checked_out, checked_in, created, modified
+`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLoan(row scanner, loan *Loan, itemID *int64) error {
+	var due, checkedIn mysql.NullTime
+	err := row.Scan(
+		&loan.ID,
+		itemID,
+		&loan.BorrowerUserID,
+		&loan.Borrower,
+		&loan.Notes,
+		&due,
+		&loan.CheckedOut,
+		&checkedIn,
+		&loan.Created,
+		&loan.Modified)
+	if due.Valid {
+		loan.Due = &due.Time
+	}
+	if checkedIn.Valid {
+		loan.CheckedIn = &checkedIn.Time
+	}
+	loan.IsOverdue = loan.Overdue(time.Now())
+	return err
+}
+
+// CheckOut records an item as lent out.
+// An item may only have one outstanding loan at a time.
+func (s *Store) CheckOut(loan *Loan) error {
+	// Validate before counting the outstanding loans of the item
+	if err := loan.Lend(0, time.Now()); err != nil {
+		return err
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	var open int
+	q := "select count(*) from item_loans where container_item_id = ? and checked_in is null for update"
+	if err = tx.QueryRow(q, loan.Item.ID).Scan(&open); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = loan.Lend(open, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var borrowerUserID interface{}
+	if loan.BorrowerUserID > 0 {
+		borrowerUserID = loan.BorrowerUserID
+	}
+	q = `
+		insert into item_loans (container_item_id, user_id, borrower_user_id, borrower_name, notes, due, checked_out, created, modified)
+		values (?, ?, ?, ?, ?, ?, ?, now(), now())
+	`
+	res, err := tx.Exec(q, loan.Item.ID, loan.User.ID, borrowerUserID, loan.Borrower, loan.Notes, loan.Due, loan.CheckedOut)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	loan.ID, _ = res.LastInsertId()
+	return tx.Commit()
+}
+
+// OutstandingByItem retrieves the outstanding loan of an item, ErrNotCheckedOut when it is not lent out.
+func (s *Store) OutstandingByItem(itemID int64) (Loan, error) {
+	var loan Loan
+	var loanItemID int64
+	q := "select" + loanColumns + "from item_loans where container_item_id = ? and checked_in is null"
+	err := scanLoan(s.DB.QueryRow(q, itemID), &loan, &loanItemID)
+	if err == sql.ErrNoRows {
+		return loan, ErrNotCheckedOut
+	}
+	return loan, err
+}
+
+// CheckIn closes an outstanding loan (see OutstandingByItem).
+// The closed loan is kept as part of the item's loan history.
+func (s *Store) CheckIn(loan *Loan, notes string) error {
+	if err := loan.Return(time.Now(), notes); err != nil {
+		return err
+	}
+	q := "update item_loans set checked_in = ?, notes = ?, modified = now() where id = ? and checked_in is null"
+	res, err := s.DB.Exec(q, loan.CheckedIn, loan.Notes, loan.ID)
+	if err != nil {
+		return err
+	}
+	// The loan was checked in by a concurrent request
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrNotCheckedOut
+	}
+	return nil
+}
+
+// Cancel removes an outstanding loan of a user, as if its item had never been checked out.
+// It results in models.ErrPreconditionFailed once the loan was checked in.
+func (s *Store) Cancel(loanID int64, userID int64) error {
+	res, err := s.DB.Exec("delete from item_loans where id = ? and user_id = ? and checked_in is null", loanID, userID)
+	if err != nil {
+		return err
+	}
+	return models.CheckVersion(res)
+}
+
+// Reopen takes back the check in of a loan of a user, with the notes the loan had before it was checked in.
+// It results in models.ErrPreconditionFailed when the loan is outstanding or its item was checked out again since.
+func (s *Store) Reopen(loanID int64, userID int64, notes string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var itemID int64
+	q := "select container_item_id from item_loans where id = ? and user_id = ? for update"
+	if err = tx.QueryRow(q, loanID, userID).Scan(&itemID); err != nil {
+		return models.NotFound(err, "loan not found")
+	}
+	var later int
+	q = "select count(*) from item_loans where container_item_id = ? and (id > ? or checked_in is null) for update"
+	if err = tx.QueryRow(q, itemID, loanID).Scan(&later); err != nil {
+		return err
+	}
+	if later > 0 {
+		return models.ErrPreconditionFailed
+	}
+	if _, err = tx.Exec("update item_loans set checked_in = null, notes = ?, modified = now() where id = ?", notes, loanID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ByItem retrieves the loan history of an item, most recent first.
+func (s *Store) ByItem(item *items.ContainerItem) (Loans, error) {
+	q := "select" + loanColumns + "from item_loans where container_item_id = ? order by checked_out desc, id desc"
+	rows, err := s.DB.Query(q, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	loans := make(Loans, 0)
+	for rows.Next() {
+		var loan Loan
+		var itemID int64
+		if err = scanLoan(rows, &loan, &itemID); err != nil {
+			return nil, err
+		}
+		loan.Item = item
+		loan.User = item.Container.User
+		loans = append(loans, loan)
+	}
+	return loans, rows.Err()
+}
+
+// Outstanding retrieves every item currently lent out by a user.
+func (s *Store) Outstanding(filter LoanFilter) (Loans, error) {
+	q := "select" + loanColumns + `
+		from item_loans
+		where user_id = ? and checked_in is null %v
+			and container_item_id in (select id from container_items where deleted is null)
+		order by due is null, due asc, checked_out asc
+	`
+	overdueFragment := ""
+	args := []interface{}{filter.User.ID}
+	if filter.OverdueOnly {
+		// Compared with the clock of the application, as is Loan.Overdue
+		overdueFragment = "and due < ?"
+		args = append(args, time.Now())
+	}
+	rows, err := s.DB.Query(fmt.Sprintf(q, overdueFragment), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	loans := make(Loans, 0)
+	itemIDs := make([]int64, 0)
+	for rows.Next() {
+		var loan Loan
+		var itemID int64
+		if err = scanLoan(rows, &loan, &itemID); err != nil {
+			return nil, err
+		}
+		loan.User = filter.User
+		loans = append(loans, loan)
+		itemIDs = append(itemIDs, itemID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(loans))
+	itemModel := items.NewStore(s.DB)
+	for i, itemID := range itemIDs {
+		go func(itemID int64, loan *Loan) {
+			defer wg.Done()
+			item, err := itemModel.ByID(itemID)
+			if err == nil {
+				loan.Item = &item
+			}
+		}(itemID, &loans[i])
+	}
+	wg.Wait()
+	return loans, nil
+}
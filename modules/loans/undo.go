@@ -0,0 +1,33 @@
+package loans
+
+import (
+	"database/sql"
+
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+)
+
+// undoType identifies the operations on loans, loans have no audit type of their own.
+const undoType = "loan"
+
+func init() {
+	undo.Register(undoType, reverse)
+}
+
+// reverse undoes a change to a loan of a user (see undo.Reverser).
+// A check out is undone by removing the loan and a check in by reopening it. Loans have no version,
+// their state is checked instead: a loan checked in since its check out, or checked out again since
+// its check in, is left as it is.
+func reverse(db *sql.DB, userID int64, op undo.Operation) error {
+	store := NewStore(db)
+	record := op.Records[0]
+	if op.Action == undo.ActionDelete {
+		return store.Cancel(record.ID, userID)
+	}
+	var before struct {
+		Notes string `json:"notes"`
+	}
+	if err := record.DecodeBefore(&before); err != nil {
+		return err
+	}
+	return store.Reopen(record.ID, userID, before.Notes)
+}
@@ -5,10 +5,14 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/binding"
 	"github.com/cjsaylor/boxmeup-go/config"
 	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
 	"github.com/cjsaylor/boxmeup-go/middleware"
 	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
@@ -24,19 +28,37 @@ var routes = []config.Route{
 		Name:    "CreateLocation",
 		Method:  "POST",
 		Pattern: "/api/location",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(CreateLocationHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(CreateLocationHandler),
 	},
 	config.Route{
 		Name:    "UpdateLocation",
 		Method:  "PUT",
 		Pattern: "/api/location/{id}",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(UpdateLocationHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadLocation, "Unable to retrieve the location.")).ThenFunc(UpdateLocationHandler),
+	},
+	config.Route{
+		Name:    "PatchLocation",
+		Method:  "PATCH",
+		Pattern: "/api/location/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadLocation, "Unable to retrieve the location.")).ThenFunc(PatchLocationHandler),
 	},
 	config.Route{
 		Name:    "DeleteLocation",
 		Method:  "DELETE",
 		Pattern: "/api/location/{id}",
-		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(DeleteLocationHandler),
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadLocation, "Unable to retrieve the location.")).ThenFunc(DeleteLocationHandler),
+	},
+	config.Route{
+		Name:    "RestoreLocation",
+		Method:  "POST",
+		Pattern: "/api/location/{id}/restore",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler, middleware.PreconditionHandler(loadTrashedLocation, "Unable to retrieve the location from the trash.")).ThenFunc(RestoreLocationHandler),
+	},
+	config.Route{
+		Name:    "Location",
+		Method:  "GET",
+		Pattern: "/api/location/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(LocationHandler),
 	},
 	config.Route{
 		Name:    "Locations",
@@ -57,8 +79,32 @@ func (h Hook) Apply(router *mux.Router) {
 	}
 }
 
+// loadLocation retrieves the location a request changes on behalf of its user.
+func loadLocation(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	locationID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	location, err := NewStore(db).OwnedBy(int64(locationID), middleware.UserIDFromRequest(req))
+	return location, err
+}
+
+// loadTrashedLocation retrieves the location in the trash a request restores on behalf of its user.
+func loadTrashedLocation(req *http.Request) (models.Versioned, error) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	locationID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	location, err := NewStore(db).TrashedOwnedBy(int64(locationID), middleware.UserIDFromRequest(req))
+	return location, err
+}
+
+// locationRequest is the body of requests creating or updating a location.
+type locationRequest struct {
+	Name    string `json:"name" validate:"required,max=40"`
+	Address string `json:"address" validate:"max=250"`
+}
+
 // CreateLocationHandler will create a location from user input
-// Expected body:
+// Expected body (JSON or form):
 //   - name
 //   - address
 func CreateLocationHandler(res http.ResponseWriter, req *http.Request) {
@@ -68,21 +114,27 @@ func CreateLocationHandler(res http.ResponseWriter, req *http.Request) {
 	user, err := users.NewStore(db).ByID(userID)
 	jsonOut := json.NewEncoder(res)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Unable to find user to associate this location."})
+		middleware.WriteError(res, req, err, "Unable to find user to associate this location.")
+		return
+	}
+	var body locationRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
 		return
 	}
 	location := Location{
 		User:    user,
-		Name:    req.PostFormValue("name"),
-		Address: req.PostFormValue("address"),
+		Name:    body.Name,
+		Address: body.Address,
 	}
-	err = NewStore(db).Create(&location)
+	err = NewStore(db).As(middleware.UserIDFromRequest(req)).Create(&location)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Unable to store location."})
+		middleware.WriteError(res, req, err, "Unable to store location.")
 		return
 	}
+	op := undo.NewDelete(audit.Location)
+	op.Add(location.ID, location.Version)
+	undo.Offer(res, req, db, op)
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(map[string]int64{
 		"id": location.ID,
@@ -90,102 +142,165 @@ func CreateLocationHandler(res http.ResponseWriter, req *http.Request) {
 }
 
 // UpdateLocationHandler will handle updating location based on user input
+// Expected body (JSON or form):
+//   - name
+//   - address
 func UpdateLocationHandler(res http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
 	db, _ := database.GetDBResource()
 	defer db.Close()
-	userID := int64(req.Context().Value(middleware.UserContextKey).(jwt.MapClaims)["id"].(float64))
-	locationModel := NewStore(db)
-	locationID, _ := strconv.Atoi(vars["id"])
-	location, err := locationModel.ByID(int64(locationID))
-	jsonOut := json.NewEncoder(res)
+	locationModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	location := middleware.RecordFromRequest(req).(Location)
+	var body locationRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	before := location.auditFields()
+	location.Name = body.Name
+	location.Address = body.Address
+	err := locationModel.Update(&location)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Location not found."})
+		middleware.WriteError(res, req, err, "Failed to update location.")
 		return
 	}
-	if userID != location.User.ID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to modify this location."})
+	undo.Offer(res, req, db, undo.NewRevert(audit.Location, location.ID, location.Version, before))
+	middleware.SetETag(res, location)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// PatchLocationHandler changes only the fields of a location given in a partial update
+// Expected body (JSON merge patch or JSON patch):
+//   name (optional)
+//   address (optional, null removes the address)
+func PatchLocationHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	locationModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	location := middleware.RecordFromRequest(req).(Location)
+	body := locationRequest{Name: location.Name, Address: location.Address}
+	if _, errs := binding.BindPatch(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
 		return
 	}
-	location.Name = req.PostFormValue("name")
-	location.Address = req.PostFormValue("address")
-	err = locationModel.Update(&location)
+	before := location.auditFields()
+	location.Name = body.Name
+	location.Address = body.Address
+	err := locationModel.Update(&location)
+	if err == nil {
+		undo.Offer(res, req, db, undo.NewRevert(audit.Location, location.ID, location.Version, before))
+		location, err = locationModel.ByID(location.ID)
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Failed to update location."})
+		middleware.WriteError(res, req, err, "Failed to update location.")
 		return
 	}
-	res.WriteHeader(http.StatusNoContent)
+	middleware.SetETag(res, location)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(location)
 }
 
-// DeleteLocationHandler will remove a location upon user request.
-func DeleteLocationHandler(res http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
+// RestoreLocationHandler brings a location back from the trash
+func RestoreLocationHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
-	userID := int64(req.Context().Value(middleware.UserContextKey).(jwt.MapClaims)["id"].(float64))
-	locationModel := NewStore(db)
-	locationID, _ := strconv.Atoi(vars["id"])
-	location, err := locationModel.ByID(int64(locationID))
-	jsonOut := json.NewEncoder(res)
+	locationModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	location := middleware.RecordFromRequest(req).(Location)
+	err := locationModel.Restore(&location)
+	if err == nil {
+		location, err = locationModel.ByID(location.ID)
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Location not found."})
+		middleware.WriteError(res, req, err, "Failed to restore the location.")
 		return
 	}
-	if userID != location.User.ID {
-		res.WriteHeader(http.StatusForbidden)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "Not allowed to remove this location."})
+	middleware.SetETag(res, location)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(location)
+}
+
+// LocationHandler gets a specific location by ID
+func LocationHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	locationID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	location, err := NewStore(db).OwnedBy(int64(locationID), middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the location.")
 		return
 	}
-	err = locationModel.Delete(int64(locationID))
+	middleware.SetETag(res, location)
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(location)
+}
+
+// DeleteLocationHandler will move a location to the trash upon user request.
+func DeleteLocationHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	locationModel := NewStore(db).As(middleware.UserIDFromRequest(req))
+	location := middleware.RecordFromRequest(req).(Location)
+	err := locationModel.Delete(&location)
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Unable to remove location."})
+		middleware.WriteError(res, req, err, "Unable to remove location.")
+		return
 	}
+	op := undo.NewRestore(audit.Location)
+	op.Add(location.ID, location.Version)
+	undo.Offer(res, req, db, op)
 	res.WriteHeader(http.StatusNoContent)
 }
 
 // LocationsHandler will retrieve user locations
+// Query params:
+//   q (optional, words and filters such as address:main containers>0, see SearchFields)
+//   is_attached_to_container (optional, T)
+//   sort (optional, comma separated fields, - prefixed for descending, ie: name,-modified)
+//   sort_field (optional, when sort is not given)
+//   sort_dir
+//   page
+//   per_page (optional, QueryLimit by default)
+//   cursor (optional, continues from the next or prev cursor of a previous response in place of page)
+//   total (optional, exact by default, estimate or none)
 func LocationsHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
 	defer db.Close()
 	userID := int64(req.Context().Value(middleware.UserContextKey).(jwt.MapClaims)["id"].(float64))
 	jsonOut := json.NewEncoder(res)
 	params := req.URL.Query()
-	var limit models.QueryLimit
-	page, _ := strconv.Atoi(params.Get("page"))
-	limit.SetPage(page, QueryLimit)
 	locationModel := NewStore(db)
-	var sortField SortableField
-	if userSortField := params.Get("sort_field"); userSortField != "" {
-		var err error
-		sortField, err = locationModel.SortableFieldByName(userSortField)
-		if err != nil {
-			res.WriteHeader(http.StatusBadRequest)
-			jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Invalid sort field"})
+	if userSortField := params.Get("sort_field"); userSortField != "" && params.Get("sort") == "" {
+		if _, ok := Sorter.Fields[userSortField]; !ok {
+			middleware.WriteError(res, req, &models.SortError{Field: userSortField, Message: "unable to sort by this field"}, "")
 			return
 		}
 	}
+	sort, err := Sorter.FromQuery(params)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to get locations.")
+		return
+	}
 	user, err := users.NewStore(db).ByID(int64(userID))
 	if err != nil {
-		res.WriteHeader(http.StatusUnauthorized)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -2, Text: "User not found."})
+		middleware.WriteError(res, req, err, "Unable to get locations.")
 		return
 	}
-	sort := locationModel.GetSortBy(sortField, models.SortType(params.Get("sort_dir")))
 	filter := LocationFilter{
 		User: user,
 		IsAttachedToContainer: params.Get("is_attached_to_container") == "T",
 	}
-	response, err := locationModel.FilteredLocations(filter, sort, limit)
+	limit, err := models.NewQueryLimit(params, QueryLimit, config.Config.MaxPerPage)
+	if err == nil {
+		filter.Query, err = fulltext.Parse(params.Get("q"))
+	}
+	var response PagedResponse
+	if err == nil {
+		response, err = locationModel.FilteredLocations(filter, sort, limit)
+	}
 	if err != nil {
-		res.WriteHeader(http.StatusInternalServerError)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -3, Text: "Unable to get locations."})
+		middleware.WriteError(res, req, err, "Unable to get locations.")
 		return
 	}
+	response.PagedResponse.SetLinks(req.URL)
 	res.WriteHeader(http.StatusOK)
 	jsonOut.Encode(response)
 }
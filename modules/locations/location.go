@@ -3,6 +3,9 @@ package locations
 import (
 	"time"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
 )
 
@@ -14,8 +17,22 @@ type Location struct {
 	Name           string     `json:"name"`
 	Address        string     `json:"address"`
 	ContainerCount int        `json:"container_count"`
-	Created        time.Time  `json:"created"`
-	Modified       time.Time  `json:"modified"`
+	// Version is incremented by every change of the location, its container count is maintained without changing it
+	Version  int64     `json:"version"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	// Deleted is set while the location is in the trash
+	Deleted *time.Time `json:"deleted,omitempty"`
+}
+
+// ETag identifies the version of the location.
+func (l Location) ETag() string {
+	return models.ETag(l.Version)
+}
+
+// auditFields are the values of the location recorded in the audit log.
+func (l Location) auditFields() audit.Fields {
+	return audit.Fields{"name": l.Name, "address": l.Address}
 }
 
 // Locations group of locations
@@ -25,4 +42,6 @@ type LocationFilter struct {
 	User                  users.User
 	ContainerID           int64
 	IsAttachedToContainer bool
+	// Query optionally restricts locations by text and filters (see SearchFields)
+	Query fulltext.Query
 }
@@ -0,0 +1,25 @@
+package locations
+
+import "github.com/cjsaylor/boxmeup-go/fulltext"
+
+// SearchType is the document type of locations in the search index.
+const SearchType = "location"
+
+func init() {
+	fulltext.RegisterSource(SearchType, fulltext.Source{
+		From:    "locations",
+		ID:      "id",
+		User:    "user_id",
+		Columns: []string{"name", "address"},
+		Where:   "deleted is null",
+	})
+}
+
+// SearchFields are the filters available when listing locations.
+var SearchFields = fulltext.Fields{
+	"name":       {Kind: fulltext.TextField, Column: "name"},
+	"address":    {Kind: fulltext.TextField, Column: "address"},
+	"containers": {Kind: fulltext.NumberField, Column: "container_count"},
+	"created":    {Kind: fulltext.DateField, Column: "created"},
+	"modified":   {Kind: fulltext.DateField, Column: "modified"},
+}
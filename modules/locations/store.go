@@ -3,28 +3,57 @@ package locations
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
 	"errors"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/changelog"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/fulltext"
 	"github.com/cjsaylor/boxmeup-go/models"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/go-sql-driver/mysql"
 )
 
-// QueryLimit is the maximum number of container results per page.
+// QueryLimit is the number of location results per page unless another is requested.
 const QueryLimit = 20
 
+// Sorter validates the sorts of location queries.
+var Sorter = models.Sorter{
+	Fields: map[string]string{
+		"id":              "id",
+		"modified":        "modified",
+		"name":            "name",
+		"container_count": "container_count",
+	},
+	Default: models.SortBy{Field: "id", Direction: models.DSC},
+}
+
 // NewStore constructs a storage interface for containers.
 func NewStore(db *sql.DB) *Store {
 	return &Store{DB: db}
 }
 
+// As returns a copy of the store acting on behalf of the authenticated user actorID, the actor of the actions
+// it records in the audit log (see audit.NewEntry).
+func (l *Store) As(actorID int64) *Store {
+	store := *l
+	store.ActorID = actorID
+	return &store
+}
+
 // Store helps store and retrieve
 type Store struct {
 	DB *sql.DB
+	// ActorID is the authenticated user taking the actions, the owner of the records when 0
+	ActorID int64
 }
 
 // SortableField represents a field that is sortable
+// Deprecated: use Sorter, which also sorts by more than one field.
 type SortableField int
 
 const (
@@ -42,7 +71,7 @@ var fields = [...]string{
 	"id",
 	"modified",
 	"name",
-	"countainer_count",
+	"container_count",
 }
 
 // PagedResponse contains a group of locations and meta data for pagination
@@ -66,19 +95,9 @@ func (l *Store) SortableFieldByName(name string) (SortableField, error) {
 }
 
 // GetSortBy will retrieve a SortBy object taylored for location queries
+// Deprecated: use Sorter.
 func (l *Store) GetSortBy(sortField SortableField, direction models.SortType) models.SortBy {
-	var sort models.SortBy
-	if field := fields[sortField]; field != "" {
-		sort.Field = field
-	} else {
-		sort.Field = SortFieldModified.String()
-	}
-	if direction == models.ASC {
-		sort.Direction = models.ASC
-	} else {
-		sort.Direction = models.DSC
-	}
-	return sort
+	return Sorter.SortBy(sortField.String(), direction)
 }
 
 // Create a location entry
@@ -87,90 +106,373 @@ func (l *Store) Create(location *Location) error {
 		insert into locations (user_id, uuid, name, is_mappable, address, created, modified)
 		values (?, uuid(), ?, ?, ?, now(), now())
 	`
-	res, err := l.DB.Exec(q, location.User.ID, location.Name, location.Address != "", location.Address)
-	location.ID, _ = res.LastInsertId()
-	return err
+	tx, err := l.DB.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(q, location.User.ID, location.Name, location.Address != "", location.Address)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	ID, _ := res.LastInsertId()
+	err = changelog.Changed(tx, changelog.Location, ID)
+	entry := audit.NewEntry(l.ActorID, location.User.ID, audit.Location, ID, audit.ActionCreate, audit.Diff(nil, location.auditFields()))
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	location.ID = ID
+	location.Version = 1
+	events.Committed(entry)
+	return nil
 }
 
 // Update will update details of the provided location
+// The location must not have changed since it was retrieved (see models.CheckVersion), its version is incremented.
 func (l *Store) Update(location *Location) error {
 	if location.ID == 0 {
-		return errors.New("location must already be stored")
+		return models.NewError(models.ErrValidation, "location must already be stored")
+	}
+	q := `
+		update locations set name = ?, address = ?, version = version + 1, modified = now()
+		where id = ? and version = ?
+	`
+	before, err := l.ByID(location.ID)
+	if err != nil {
+		return err
+	}
+	tx, err := l.DB.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(q, location.Name, location.Address, location.ID, location.Version)
+	if err == nil {
+		err = models.CheckVersion(res)
+	}
+	if err == nil {
+		err = changelog.Changed(tx, changelog.Location, location.ID)
+	}
+	entry := audit.NewEntry(l.ActorID, location.User.ID, audit.Location, location.ID, audit.ActionUpdate, audit.Diff(before.auditFields(), location.auditFields()))
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	location.Version++
+	events.Committed(entry)
+	return nil
+}
+
+// Delete moves a location to the trash, provided it has not changed since it was retrieved, its version is incremented.
+// Its containers keep referring to it but are presented without a location until it is restored.
+func (l *Store) Delete(location *Location) error {
+	q := `
+		update locations set deleted = now(), version = version + 1
+		where id = ? and version = ? and deleted is null
+	`
+	tx, err := l.DB.Begin()
+	if err != nil {
+		return err
+	}
+	err = changelog.Deleted(tx, changelog.Location, location.ID)
+	if err == nil {
+		var res sql.Result
+		res, err = tx.Exec(q, location.ID, location.Version)
+		if err == nil {
+			err = models.CheckVersion(res)
+		}
+	}
+	if err == nil {
+		err = containersChanged(tx, location.ID)
+	}
+	entry := audit.NewEntry(l.ActorID, location.User.ID, audit.Location, location.ID, audit.ActionDelete, audit.Diff(location.auditFields(), nil))
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
 	}
+	if err != nil {
+		return err
+	}
+	location.Version++
+	events.Committed(entry)
+	return nil
+}
+
+// Restore brings a location back from the trash, provided it has not changed since it was retrieved.
+// Its container count is recomputed since containers may have moved while it was in the trash.
+func (l *Store) Restore(location *Location) error {
 	q := `
-		update locations set name = ?, address = ?, modified = now() where id = ?
+		update locations
+		set deleted = null, container_count = (
+			select count(*) from containers where location_id = ? and deleted is null
+		), version = version + 1, modified = now()
+		where id = ? and version = ? and deleted is not null
 	`
-	_, err := l.DB.Exec(q, location.Name, location.Address, location.ID)
-	return err
+	tx, err := l.DB.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(q, location.ID, location.ID, location.Version)
+	if err == nil {
+		err = models.CheckVersion(res)
+	}
+	if err == nil {
+		err = changelog.Changed(tx, changelog.Location, location.ID)
+	}
+	if err == nil {
+		err = containersChanged(tx, location.ID)
+	}
+	entry := audit.NewEntry(l.ActorID, location.User.ID, audit.Location, location.ID, audit.ActionRestore, nil)
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	location.Version++
+	location.Deleted = nil
+	events.Committed(entry)
+	return nil
 }
 
-// Delete will remove a location by ID.
-func (l *Store) Delete(ID int64) error {
-	q := "delete from locations where ID = ?"
-	_, err := l.DB.Exec(q, ID)
-	return err
+// containersChanged marks the containers of a location as changed when the location leaves or returns from the trash,
+// since they are presented with or without it.
+func containersChanged(tx *sql.Tx, locationID int64) error {
+	_, err := tx.Exec("update containers set version = version + 1 where location_id = ? and deleted is null", locationID)
+	if err != nil {
+		return err
+	}
+	return changelog.Record(tx, changelog.Container, false, "x.location_id = ? and x.deleted is null", locationID)
 }
 
-// ByID will return a location by its identifier.
+// ByID will return a location by its identifier, locations in the trash are not found.
 func (l *Store) ByID(ID int64) (Location, error) {
+	return l.find(ID, false)
+}
+
+// OwnedBy retrieves a location by its identifier on behalf of a user, locations of other users are forbidden.
+func (l *Store) OwnedBy(ID int64, userID int64) (Location, error) {
+	location, err := l.ByID(ID)
+	if err == nil {
+		err = models.CheckOwner(location.User.ID, userID, "location belongs to another user")
+	}
+	return location, err
+}
+
+// TrashedOwnedBy retrieves a location in the trash on behalf of a user, locations of other users are forbidden.
+func (l *Store) TrashedOwnedBy(ID int64, userID int64) (Location, error) {
+	location, err := l.find(ID, true)
+	if err == nil {
+		err = models.CheckOwner(location.User.ID, userID, "location belongs to another user")
+	}
+	return location, err
+}
+
+// find retrieves a location either out of or in the trash.
+func (l *Store) find(ID int64, trashed bool) (Location, error) {
 	q := `
-		select id, user_id, uuid, name, address, container_count, created, modified
-		from locations where id = ?
+		select id, user_id, uuid, name, address, container_count, version, created, modified, deleted
+		from locations where id = ? and (deleted is not null) = ?
 	`
 	var location Location
 	var userID int64
-	err := l.DB.QueryRow(q, ID).Scan(
+	var deleted mysql.NullTime
+	err := l.DB.QueryRow(q, ID, trashed).Scan(
 		&location.ID,
 		&userID,
 		&location.UUID,
 		&location.Name,
 		&location.Address,
 		&location.ContainerCount,
+		&location.Version,
 		&location.Created,
-		&location.Modified)
-	if err == nil {
-		location.User, err = users.NewStore(l.DB).ByID(userID)
+		&location.Modified,
+		&deleted)
+	if err != nil {
+		return location, models.NotFound(err, "location not found")
+	}
+	if deleted.Valid {
+		location.Deleted = &deleted.Time
 	}
+	location.User, err = users.NewStore(l.DB).ByID(userID)
 	return location, err
 }
 
+// ByIDs retrieves locations by their identifiers in a single query, along with their users.
+// Locations in the trash or that no longer exist are left out.
+func (l *Store) ByIDs(IDs []int64) (map[int64]Location, error) {
+	found := make(map[int64]Location, len(IDs))
+	if len(IDs) == 0 {
+		return found, nil
+	}
+	q := `
+		select id, user_id, uuid, name, address, container_count, version, created, modified
+		from locations where id in (?%v) and deleted is null
+	`
+	args := make([]interface{}, len(IDs))
+	for i, ID := range IDs {
+		args[i] = ID
+	}
+	rows, err := l.DB.Query(fmt.Sprintf(q, strings.Repeat(",?", len(IDs)-1)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	owners := make(map[int64]users.User)
+	for rows.Next() {
+		var location Location
+		err = rows.Scan(&location.ID, &location.User.ID, &location.UUID, &location.Name, &location.Address, &location.ContainerCount, &location.Version, &location.Created, &location.Modified)
+		if err != nil {
+			return nil, err
+		}
+		owners[location.User.ID] = location.User
+		found[location.ID] = location
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// Locations are retrieved on behalf of their owner, there is a single user almost always
+	for userID := range owners {
+		if owners[userID], err = users.NewStore(l.DB).ByID(userID); err != nil {
+			return nil, err
+		}
+	}
+	for ID, location := range found {
+		location.User = owners[location.User.ID]
+		found[ID] = location
+	}
+	return found, nil
+}
+
+// Trashed retrieves the locations of a user in the trash, most recently deleted first.
+func (l *Store) Trashed(user users.User) (Locations, error) {
+	q := `
+		select id, uuid, name, address, container_count, version, created, modified, deleted
+		from locations
+		where user_id = ? and deleted is not null
+		order by deleted desc, id desc
+	`
+	rows, err := l.DB.Query(q, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	trashed := make(Locations, 0)
+	for rows.Next() {
+		location := Location{User: user}
+		var deleted time.Time
+		err = rows.Scan(&location.ID, &location.UUID, &location.Name, &location.Address, &location.ContainerCount, &location.Version, &location.Created, &location.Modified, &deleted)
+		if err != nil {
+			return nil, err
+		}
+		location.Deleted = &deleted
+		trashed = append(trashed, location)
+	}
+	return trashed, rows.Err()
+}
+
 // FilteredLocations will get all containers belonging to a user with filters
+// A query with filters that do not suit SearchFields results in a *fulltext.ParseError.
 func (l *Store) FilteredLocations(filter LocationFilter, sort models.SortBy, limit models.QueryLimit) (PagedResponse, error) {
 	q := `
-		select SQL_CALC_FOUND_ROWS id, uuid, name, address, container_count, created, modified
+		select id, uuid, name, address, container_count, version, created, modified, %v
 		from locations
-		where user_id = ?
+		%v %v
 		%v
-		order by %v %v
-		limit %v offset %v
 	`
+	response := PagedResponse{}
+	predicate, err := filter.Query.Compile(SearchFields)
+	if err != nil {
+		return response, err
+	}
+	keyset := models.Keyset{Sort: sort, Limit: limit}
+	keysetFragment, keysetArgs, err := keyset.Where()
+	if err != nil {
+		return response, err
+	}
 	var mustBeAttachedFragment string
 	if filter.IsAttachedToContainer {
 		mustBeAttachedFragment = "and container_count > 0"
 	} else {
 		mustBeAttachedFragment = ""
 	}
-	q = fmt.Sprintf(q, mustBeAttachedFragment, sort.Field, sort.Direction, limit.Limit, limit.Offset)
-	rows, err := l.DB.Query(q, filter.User.ID)
+	queryArgs := []interface{}{filter.User.ID}
+	matchFragment := ""
+	if !filter.Query.Empty() {
+		results, err := fulltext.Open(l.DB).Search(fulltext.Request{
+			UserID: filter.User.ID,
+			Types:  []string{SearchType},
+			Query:  filter.Query,
+		})
+		ids := results.IDs()
+		if err != nil || len(ids) == 0 {
+			return response, err
+		}
+		matchFragment = "and id in (?" + strings.Repeat(",?", len(ids)-1) + ")"
+		for _, id := range ids {
+			queryArgs = append(queryArgs, id)
+		}
+	}
+	queryArgs = append(queryArgs, predicate.Args...)
+	where := fmt.Sprintf("where user_id = ? and deleted is null %v %v %v", mustBeAttachedFragment, matchFragment, predicate.And())
+	total, err := database.CountRows(l.DB, limit.Total, "select id from locations "+where, queryArgs...)
 	if err != nil {
-		log.Fatal(err)
+		return response, err
+	}
+	response.PagedResponse.SetTotal(total, limit)
+	q = fmt.Sprintf(q, keyset.Columns(), where, keysetFragment, keyset.OrderBy())
+	rows, err := l.DB.Query(q, append(queryArgs, keysetArgs...)...)
+	if err != nil {
+		return response, err
 	}
-	response := PagedResponse{}
 	defer rows.Close()
+	values := make([][]interface{}, 0)
+	ids := make([]int64, 0)
 	for rows.Next() {
 		location := Location{}
-		rows.Scan(
+		row, value := keyset.Scan(
 			&location.ID,
 			&location.UUID,
 			&location.Name,
 			&location.Address,
 			&location.ContainerCount,
+			&location.Version,
 			&location.Created,
 			&location.Modified)
+		if err = rows.Scan(row...); err != nil {
+			return response, err
+		}
 		response.Locations = append(response.Locations, location)
+		values = append(values, value)
+		ids = append(ids, location.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return response, err
 	}
+	keyset.Page(&response.Locations, values, ids, &response.PagedResponse)
 	response.PagedResponse.RequestTotal = len(response.Locations)
-	l.DB.QueryRow("select FOUND_ROWS()").Scan(&response.PagedResponse.Total)
-	response.PagedResponse.CalculatePages(limit)
-	return response, rows.Err()
+	return response, nil
 }
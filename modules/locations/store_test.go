@@ -174,12 +174,40 @@ func TestStore_Update(t *testing.T) {
 	if result.Name != location.Name {
 		t.Errorf("Expected %v but got %v", location.Name, result.Name)
 	}
+	if result.Version != location.Version {
+		t.Errorf("Expected version %v but got %v", location.Version, result.Version)
+	}
+}
+
+func TestStore_UpdateStale(t *testing.T) {
+	setup(db)
+	locationModel := locations.NewStore(db)
+	location, err := locationModel.ByID(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	stale := location
+	location.Name = "A new name"
+	if err = locationModel.Update(&location); err != nil {
+		t.Error(err)
+		return
+	}
+	stale.Name = "Another name"
+	if err = locationModel.Update(&stale); err != models.ErrPreconditionFailed {
+		t.Errorf("Expected the stale update to fail but got %v", err)
+	}
 }
 
 func TestStore_Delete(t *testing.T) {
 	setup(db)
 	locationModel := locations.NewStore(db)
-	err := locationModel.Delete(1)
+	location, err := locationModel.ByID(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = locationModel.Delete(&location)
 	if err != nil {
 		t.Error(err)
 		return
@@ -191,6 +219,33 @@ func TestStore_Delete(t *testing.T) {
 	}
 }
 
+func TestStore_Restore(t *testing.T) {
+	setup(db)
+	locationModel := locations.NewStore(db)
+	location, err := locationModel.ByID(1)
+	if err == nil {
+		err = locationModel.Delete(&location)
+	}
+	if err == nil {
+		location, err = locationModel.TrashedOwnedBy(1, 1)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if location.Deleted == nil {
+		t.Error("Expected the location to be in the trash")
+	}
+	if err = locationModel.Restore(&location); err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := locationModel.ByID(1)
+	if err != nil || result.Deleted != nil || result.Version != location.Version {
+		t.Errorf("Expected the location to be restored but got %v (%v)", result, err)
+	}
+}
+
 func TestStore_FilteredLocations(t *testing.T) {
 	setup(db)
 	locationModel := locations.NewStore(db)
@@ -0,0 +1,45 @@
+package locations
+
+import (
+	"database/sql"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+)
+
+func init() {
+	undo.Register(audit.Location, reverse)
+}
+
+// reverse undoes a change to a location of a user (see undo.Reverser).
+// A deleted location is restored, a created location is deleted, an update is reverted by updating the location
+// with its former fields.
+func reverse(db *sql.DB, userID int64, op undo.Operation) error {
+	store := NewStore(db).As(userID)
+	record := op.Records[0]
+	if op.Action == undo.ActionDelete {
+		location, err := store.OwnedBy(record.ID, userID)
+		if err != nil {
+			return err
+		}
+		location.Version = record.Version
+		return store.Delete(&location)
+	}
+	if op.Action == undo.ActionRestore {
+		location, err := store.TrashedOwnedBy(record.ID, userID)
+		if err != nil {
+			return err
+		}
+		location.Version = record.Version
+		return store.Restore(&location)
+	}
+	location, err := store.OwnedBy(record.ID, userID)
+	if err == nil {
+		err = record.DecodeBefore(&location)
+	}
+	if err != nil {
+		return err
+	}
+	location.Version = record.Version
+	return store.Update(&location)
+}
@@ -0,0 +1,151 @@
+package locations_test
+
+import (
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+)
+
+func setupUndo(t *testing.T) *locations.Store {
+	setup(db)
+	if _, err := db.Exec("truncate undo_operations"); err != nil {
+		t.Fatal(err)
+	}
+	return locations.NewStore(db).As(1)
+}
+
+func TestUndo_Restore(t *testing.T) {
+	locationModel := setupUndo(t)
+	location, err := locationModel.ByID(1)
+	if err == nil {
+		err = locationModel.Delete(&location)
+	}
+	op := undo.NewRestore(audit.Location)
+	op.Add(location.ID, location.Version)
+	var token string
+	if err == nil {
+		token, err = undo.Save(db, 1, op)
+	}
+	if err == nil {
+		err = undo.Undo(db, 1, token)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = locationModel.ByID(1); err != nil {
+		t.Errorf("Expected the location to be restored but got %v", err)
+	}
+	if err = undo.Undo(db, 1, token); err != undo.ErrTokenNotFound {
+		t.Errorf("Expected the token to be used once but got %v", err)
+	}
+}
+
+func TestUndo_Revert(t *testing.T) {
+	locationModel := setupUndo(t)
+	location, err := locationModel.ByID(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	location.Name = "A new name"
+	if err = locationModel.Update(&location); err != nil {
+		t.Error(err)
+		return
+	}
+	token, err := undo.Save(db, 1, undo.NewRevert(audit.Location, location.ID, location.Version, audit.Fields{"name": "My Garage"}))
+	if err == nil {
+		err = undo.Undo(db, 1, token)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := locationModel.ByID(1)
+	if err != nil || result.Name != "My Garage" || result.Version != location.Version+1 {
+		t.Errorf("Expected the update to be reverted but got %v (%v)", result, err)
+	}
+}
+
+func TestUndo_Changed(t *testing.T) {
+	locationModel := setupUndo(t)
+	location, err := locationModel.ByID(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	location.Name = "A new name"
+	if err = locationModel.Update(&location); err != nil {
+		t.Error(err)
+		return
+	}
+	token, err := undo.Save(db, 1, undo.NewRevert(audit.Location, location.ID, location.Version, audit.Fields{"name": "My Garage"}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	location.Name = "Another name"
+	if err = locationModel.Update(&location); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = undo.Undo(db, 1, token); err != undo.ErrConflict {
+		t.Errorf("Expected the changed location not to be reverted but got %v", err)
+	}
+	result, err := locationModel.ByID(1)
+	if err != nil || result.Name != "Another name" {
+		t.Errorf("Expected the location to keep its latest change but got %v (%v)", result, err)
+	}
+}
+
+func TestUndo_Expired(t *testing.T) {
+	locationModel := setupUndo(t)
+	location, err := locationModel.ByID(1)
+	if err == nil {
+		err = locationModel.Delete(&location)
+	}
+	op := undo.NewRestore(audit.Location)
+	op.Add(location.ID, location.Version)
+	var token string
+	if err == nil {
+		token, err = undo.Save(db, 1, op)
+	}
+	if err == nil {
+		_, err = db.Exec("update undo_operations set expires = now() where token = ?", token)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = undo.Undo(db, 1, token); err != undo.ErrTokenNotFound {
+		t.Errorf("Expected the expired token to be refused but got %v", err)
+	}
+	if _, err = locationModel.ByID(1); err == nil {
+		t.Error("Expected the location to stay in the trash")
+	}
+}
+
+func TestUndo_Delete(t *testing.T) {
+	locationModel := setupUndo(t)
+	location := locations.Location{User: users.User{ID: 1}, Name: "Attic"}
+	err := locationModel.Create(&location)
+	op := undo.NewDelete(audit.Location)
+	op.Add(location.ID, location.Version)
+	var token string
+	if err == nil {
+		token, err = undo.Save(db, 1, op)
+	}
+	if err == nil {
+		err = undo.Undo(db, 1, token)
+	}
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = locationModel.ByID(location.ID); err == nil {
+		t.Error("Expected the created location to be moved to the trash")
+	}
+}
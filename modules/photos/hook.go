@@ -0,0 +1,236 @@
+package photos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/cjsaylor/boxmeup-go/blob"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/gorilla/mux"
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin photo module routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "UploadContainerPhoto",
+		Method:  "POST",
+		Pattern: "/api/container/{id}/photo",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(uploadHandler(EntityContainer)),
+	},
+	config.Route{
+		Name:    "ContainerPhotos",
+		Method:  "GET",
+		Pattern: "/api/container/{id}/photo",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(photosHandler(EntityContainer)),
+	},
+	config.Route{
+		Name:    "UploadItemPhoto",
+		Method:  "POST",
+		Pattern: "/api/item/{id}/photo",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(uploadHandler(EntityItem)),
+	},
+	config.Route{
+		Name:    "ItemPhotos",
+		Method:  "GET",
+		Pattern: "/api/item/{id}/photo",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(photosHandler(EntityItem)),
+	},
+	config.Route{
+		Name:    "Photo",
+		Method:  "GET",
+		Pattern: "/api/photo/{id}",
+		Handler: chain.New(middleware.AuthHandler).ThenFunc(photoDataHandler(false)),
+	},
+	config.Route{
+		Name:    "PhotoThumbnail",
+		Method:  "GET",
+		Pattern: "/api/photo/{id}/thumbnail",
+		Handler: chain.New(middleware.AuthHandler).ThenFunc(photoDataHandler(true)),
+	},
+	config.Route{
+		Name:    "DeletePhoto",
+		Method:  "DELETE",
+		Pattern: "/api/photo/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(deletePhotoHandler),
+	},
+}
+
+// Apply hooks related to photos
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+var (
+	blobStore     blob.Store
+	blobStoreErr  error
+	blobStoreOnce sync.Once
+)
+
+// blobs lazily resolves the configured blob store shared by all requests.
+func blobs() (blob.Store, error) {
+	blobStoreOnce.Do(func() {
+		blobStore, blobStoreErr = blob.FromConfig(config.Config)
+		if blobStoreErr != nil {
+			fmt.Fprintln(os.Stderr, blobStoreErr)
+		}
+	})
+	return blobStore, blobStoreErr
+}
+
+// checkEntityOwner ensures the container or item a photo is attached to belongs to a user.
+func checkEntityOwner(db *sql.DB, entityType EntityType, entityID int64, userID int64) error {
+	if entityType == EntityContainer {
+		_, err := containers.NewStore(db).OwnedBy(entityID, userID)
+		return err
+	}
+	_, err := items.NewStore(db).OwnedBy(entityID, userID)
+	return err
+}
+
+// uploadHandler attaches an uploaded image to a container or an item
+// Expected body (multipart/form-data):
+//   photo (jpeg, png or gif no larger than UPLOAD_MAX_BYTES)
+func uploadHandler(entityType EntityType) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		db, _ := database.GetDBResource()
+		defer db.Close()
+		userID := middleware.UserIDFromRequest(req)
+		jsonOut := json.NewEncoder(res)
+		entityID, _ := strconv.Atoi(mux.Vars(req)["id"])
+		if err := checkEntityOwner(db, entityType, int64(entityID), userID); err != nil {
+			middleware.WriteError(res, req, err, fmt.Sprintf("Unable to retrieve the %v.", entityType))
+			return
+		}
+		maxBytes := config.Config.UploadMaxBytes
+		// Leave some room for the multipart envelope around the file.
+		req.Body = http.MaxBytesReader(res, req.Body, maxBytes+1<<16)
+		file, _, err := req.FormFile("photo")
+		if err != nil {
+			middleware.WriteProblem(res, req, middleware.BadRequest, "A photo file must be uploaded in the photo field.")
+			return
+		}
+		defer file.Close()
+		data, err := ioutil.ReadAll(io.LimitReader(file, maxBytes+1))
+		if err != nil || int64(len(data)) > maxBytes {
+			middleware.WriteProblem(res, req, middleware.PayloadTooLarge, fmt.Sprintf("Photos must be %v bytes or less.", maxBytes))
+			return
+		}
+		store, err := blobs()
+		if err != nil {
+			middleware.WriteProblem(res, req, middleware.StorageUnavailable, "Photo storage is not available.")
+			return
+		}
+		photo := Photo{
+			UserID:     userID,
+			EntityType: entityType,
+			EntityID:   int64(entityID),
+		}
+		err = NewStore(db, store).Create(&photo, data)
+		if err != nil {
+			middleware.WriteError(res, req, err, "Unable to store the photo.")
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+		jsonOut.Encode(photo)
+	}
+}
+
+// photosHandler lists the photos attached to a container or an item
+func photosHandler(entityType EntityType) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		db, _ := database.GetDBResource()
+		defer db.Close()
+		userID := middleware.UserIDFromRequest(req)
+		jsonOut := json.NewEncoder(res)
+		entityID, _ := strconv.Atoi(mux.Vars(req)["id"])
+		if err := checkEntityOwner(db, entityType, int64(entityID), userID); err != nil {
+			middleware.WriteError(res, req, err, fmt.Sprintf("Unable to retrieve the %v.", entityType))
+			return
+		}
+		photos, err := NewStore(db, nil).ByEntity(entityType, int64(entityID))
+		if err != nil {
+			middleware.WriteError(res, req, err, "Unable to retrieve photos.")
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+		jsonOut.Encode(map[string]Photos{
+			"photos": photos,
+		})
+	}
+}
+
+// photoDataHandler streams the image data of a photo or its thumbnail
+func photoDataHandler(thumbnail bool) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		db, _ := database.GetDBResource()
+		defer db.Close()
+		photoID, _ := strconv.Atoi(mux.Vars(req)["id"])
+		photo, err := NewStore(db, nil).OwnedBy(int64(photoID), middleware.UserIDFromRequest(req))
+		if err != nil {
+			middleware.WriteError(res, req, err, "Unable to retrieve the photo.")
+			return
+		}
+		store, err := blobs()
+		if err != nil {
+			middleware.WriteProblem(res, req, middleware.StorageUnavailable, "Photo storage is not available.")
+			return
+		}
+		key, contentType := photo.BlobKey, photo.ContentType
+		if thumbnail {
+			key, contentType = photo.ThumbnailKey, "image/jpeg"
+		}
+		data, err := store.Get(key)
+		if err != nil {
+			middleware.WriteProblem(res, req, middleware.NotFound, "Photo data not found.")
+			return
+		}
+		defer data.Close()
+		res.Header().Set("Content-Type", contentType)
+		res.Header().Set("Cache-Control", "private, max-age=86400")
+		res.WriteHeader(http.StatusOK)
+		io.Copy(res, data)
+	}
+}
+
+// deletePhotoHandler removes a photo and its stored data
+func deletePhotoHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	photoID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	store, err := blobs()
+	if err != nil {
+		middleware.WriteProblem(res, req, middleware.StorageUnavailable, "Photo storage is not available.")
+		return
+	}
+	photoModel := NewStore(db, store)
+	photo, err := photoModel.OwnedBy(int64(photoID), middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the photo.")
+		return
+	}
+	if err = photoModel.Delete(photo); err != nil {
+		middleware.WriteError(res, req, err, "Unable to remove the photo.")
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
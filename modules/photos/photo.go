@@ -0,0 +1,42 @@
+package photos
+
+import (
+	"fmt"
+	"time"
+)
+
+// EntityType is the kind of record a photo is attached to.
+type EntityType string
+
+const (
+	// EntityContainer is a photo of a container
+	EntityContainer EntityType = "container"
+	// EntityItem is a photo of a container item
+	EntityItem EntityType = "item"
+)
+
+// Photo is an uploaded image attached to a container or an item.
+type Photo struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"-"`
+	EntityType   EntityType `json:"entity_type"`
+	EntityID     int64      `json:"entity_id"`
+	UUID         string     `json:"uuid"`
+	ContentType  string     `json:"content_type"`
+	Size         int        `json:"size"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	BlobKey      string     `json:"-"`
+	ThumbnailKey string     `json:"-"`
+	URL          string     `json:"url"`
+	ThumbnailURL string     `json:"thumbnail_url"`
+	Created      time.Time  `json:"created"`
+}
+
+// Photos is a group of photos.
+type Photos []Photo
+
+func (p *Photo) setURLs() {
+	p.URL = fmt.Sprintf("/api/photo/%v", p.ID)
+	p.ThumbnailURL = fmt.Sprintf("/api/photo/%v/thumbnail", p.ID)
+}
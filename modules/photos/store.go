@@ -0,0 +1,179 @@
+package photos
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/cjsaylor/boxmeup-go/blob"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// NewStore constructs a storage interface for photos.
+func NewStore(db *sql.DB, blobs blob.Store) *Store {
+	return &Store{DB: db, Blobs: blobs}
+}
+
+// Store persists photo records in the database and their data in a blob store.
+type Store struct {
+	DB    *sql.DB
+	Blobs blob.Store
+}
+
+func randomKey() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// Create validates an uploaded image, stores it with a generated thumbnail and records the photo.
+func (s *Store) Create(photo *Photo, data []byte) error {
+	contentType, err := DetectContentType(data)
+	if err != nil {
+		return err
+	}
+	thumbnail, width, height, err := Thumbnail(data)
+	if err == ErrImageTooLarge {
+		return err
+	} else if err != nil {
+		return ErrUnsupportedType
+	}
+	key := fmt.Sprintf("%v/%v", photo.UserID, randomKey())
+	photo.ContentType = contentType
+	photo.Size = len(data)
+	photo.Width = width
+	photo.Height = height
+	photo.BlobKey = fmt.Sprintf("%v.%v", key, extensions[contentType])
+	photo.ThumbnailKey = fmt.Sprintf("%v_thumb.jpg", key)
+	if err = s.Blobs.Put(photo.BlobKey, contentType, data); err != nil {
+		return err
+	}
+	if err = s.Blobs.Put(photo.ThumbnailKey, "image/jpeg", thumbnail); err != nil {
+		s.Blobs.Delete(photo.BlobKey)
+		return err
+	}
+	q := `
+		insert into photos (user_id, entity_type, entity_id, uuid, content_type, size, width, height, blob_key, thumbnail_key, created)
+		values (?, ?, ?, uuid(), ?, ?, ?, ?, ?, ?, now())
+	`
+	res, err := s.DB.Exec(q, photo.UserID, photo.EntityType, photo.EntityID, photo.ContentType, photo.Size, photo.Width, photo.Height, photo.BlobKey, photo.ThumbnailKey)
+	if err != nil {
+		s.Blobs.Delete(photo.BlobKey)
+		s.Blobs.Delete(photo.ThumbnailKey)
+		return err
+	}
+	photo.ID, _ = res.LastInsertId()
+	photo.setURLs()
+	return nil
+}
+
+const photoColumns = `
+	id, user_id, entity_type, entity_id, uuid, content_type, size, width, height, blob_key, thumbnail_key, created
+`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPhoto(row scanner, photo *Photo) error {
+	err := row.Scan(
+		&photo.ID,
+		&photo.UserID,
+		&photo.EntityType,
+		&photo.EntityID,
+		&photo.UUID,
+		&photo.ContentType,
+		&photo.Size,
+		&photo.Width,
+		&photo.Height,
+		&photo.BlobKey,
+		&photo.ThumbnailKey,
+		&photo.Created)
+	photo.setURLs()
+	return err
+}
+
+// ByID retrieves a photo record by its identifier.
+func (s *Store) ByID(ID int64) (Photo, error) {
+	var photo Photo
+	err := scanPhoto(s.DB.QueryRow("select"+photoColumns+"from photos where id = ?", ID), &photo)
+	return photo, models.NotFound(err, "photo not found")
+}
+
+// OwnedBy retrieves a photo record by its identifier on behalf of a user, photos of other users are forbidden.
+func (s *Store) OwnedBy(ID int64, userID int64) (Photo, error) {
+	photo, err := s.ByID(ID)
+	if err == nil {
+		err = models.CheckOwner(photo.UserID, userID, "photo belongs to another user")
+	}
+	return photo, err
+}
+
+// ByEntity retrieves all photos attached to a container or item, oldest first.
+func (s *Store) ByEntity(entityType EntityType, entityID int64) (Photos, error) {
+	q := "select" + photoColumns + "from photos where entity_type = ? and entity_id = ? order by created, id"
+	rows, err := s.DB.Query(q, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	photos := make(Photos, 0)
+	for rows.Next() {
+		var photo Photo
+		if err = scanPhoto(rows, &photo); err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	return photos, rows.Err()
+}
+
+// Delete removes a photo record and its stored data.
+func (s *Store) Delete(photo Photo) error {
+	if _, err := s.DB.Exec("delete from photos where id = ?", photo.ID); err != nil {
+		return err
+	}
+	if err := s.Blobs.Delete(photo.BlobKey); err != nil {
+		return err
+	}
+	return s.Blobs.Delete(photo.ThumbnailKey)
+}
+
+// DeleteOrphans removes the photos, along with their stored data, of the containers and items that no longer exist,
+// ie: purged from the trash (items go along with their container).
+func (s *Store) DeleteOrphans() error {
+	q := "select" + photoColumns + `
+		from photos p
+		where (entity_type = 'container' and not exists (select 1 from containers c where c.id = p.entity_id))
+			or (entity_type = 'item' and not exists (select 1 from container_items ci where ci.id = p.entity_id))
+	`
+	rows, err := s.DB.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	orphans := make(Photos, 0)
+	for rows.Next() {
+		var photo Photo
+		if err = scanPhoto(rows, &photo); err != nil {
+			return err
+		}
+		orphans = append(orphans, photo)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, photo := range orphans {
+		if err = s.Delete(photo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package photos
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	// Register the gif decoder
+	_ "image/gif"
+	"image/jpeg"
+	// Register the png decoder
+	_ "image/png"
+	"net/http"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// ThumbnailSize is the maximum width and height of generated thumbnails.
+const ThumbnailSize = 256
+
+// MaxPixels is the largest number of pixels of the images that are accepted, decoding an image takes up
+// to 4 bytes per pixel.
+const MaxPixels = 40000000
+
+// ErrImageTooLarge is returned for images of more than MaxPixels.
+var ErrImageTooLarge error = &models.Error{Kind: models.ErrValidation, Code: "payload_too_large", Message: "images must be 40 megapixels or less"}
+
+// ErrUnsupportedType is returned for uploads that are not a supported image format.
+var ErrUnsupportedType error = &models.Error{Kind: models.ErrValidation, Code: "unsupported_media_type", Message: "only jpeg, png and gif images are supported"}
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// DetectContentType sniffs the image format of uploaded data rather than trusting the client.
+func DetectContentType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return contentType, ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Thumbnail decodes an image and produces a JPEG scaled down to fit within ThumbnailSize.
+// The dimensions of the original image are returned alongside the thumbnail.
+// Images of more than MaxPixels are refused before they are decoded.
+func Thumbnail(data []byte) (thumbnail []byte, width int, height int, err error) {
+	header, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		return nil, 0, 0, errors.New("image has no pixels")
+	}
+	if int64(header.Width)*int64(header.Height) > MaxPixels {
+		return nil, 0, 0, ErrImageTooLarge
+	}
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := source.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, 0, 0, errors.New("image has no pixels")
+	}
+	thumbWidth, thumbHeight := fit(width, height, ThumbnailSize)
+	var out bytes.Buffer
+	err = jpeg.Encode(&out, scale(source, thumbWidth, thumbHeight), &jpeg.Options{Quality: 85})
+	return out.Bytes(), width, height, err
+}
+
+// fit scales dimensions down (never up) to fit within a square while keeping the aspect ratio.
+func fit(width int, height int, max int) (int, int) {
+	if width <= max && height <= max {
+		return width, height
+	}
+	if width >= height {
+		return max, maxInt(1, height*max/width)
+	}
+	return maxInt(1, width*max/height), max
+}
+
+// scale resizes an image by averaging the block of source pixels behind each destination pixel.
+// Pixels are flattened onto white so transparent images look reasonable as a jpeg.
+func scale(source image.Image, width int, height int) *image.RGBA {
+	bounds := source.Bounds()
+	dest := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * bounds.Dy() / height
+		y1 := maxInt(y0+1, (y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := x * bounds.Dx() / width
+			x1 := maxInt(x0+1, (x+1)*bounds.Dx()/width)
+			var r, g, b, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// premultiplied components, the white behind shows through what the alpha leaves uncovered
+					cr, cg, cb, ca := source.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					count++
+				}
+			}
+			offset := dest.PixOffset(x, y)
+			dest.Pix[offset] = uint8(r / count >> 8)
+			dest.Pix[offset+1] = uint8(g / count >> 8)
+			dest.Pix[offset+2] = uint8(b / count >> 8)
+			dest.Pix[offset+3] = 0xff
+		}
+	}
+	return dest
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,73 @@
+package photos_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/modules/photos"
+)
+
+func TestThumbnail(t *testing.T) {
+	source := image.NewNRGBA(image.Rect(0, 0, 1024, 512))
+	for x := 0; x < 1024; x++ {
+		for y := 0; y < 512; y++ {
+			source.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var data bytes.Buffer
+	png.Encode(&data, source)
+	contentType, err := photos.DetectContentType(data.Bytes())
+	if err != nil || contentType != "image/png" {
+		t.Errorf("Expected image/png but got %v (%v)", contentType, err)
+	}
+	thumbnail, width, height, err := photos.Thumbnail(data.Bytes())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if width != 1024 || height != 512 {
+		t.Errorf("Expected original dimensions 1024x512 but got %vx%v", width, height)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if bounds := decoded.Bounds(); bounds.Dx() != photos.ThumbnailSize || bounds.Dy() != photos.ThumbnailSize/2 {
+		t.Errorf("Expected a 256x128 thumbnail but got %vx%v", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestDetectContentType_Unsupported(t *testing.T) {
+	if _, err := photos.DetectContentType([]byte("<html></html>")); err != photos.ErrUnsupportedType {
+		t.Errorf("Expected unsupported type error but got %v", err)
+	}
+}
+
+func TestThumbnail_Transparent(t *testing.T) {
+	var data bytes.Buffer
+	png.Encode(&data, image.NewNRGBA(image.Rect(0, 0, 10, 10)))
+	thumbnail, _, _, err := photos.Thumbnail(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := decoded.At(5, 5).RGBA(); r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("Expected transparent pixels to be flattened onto white, got %v %v %v", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestThumbnail_TooLarge(t *testing.T) {
+	// The header of a gif declaring a 60000x60000 screen, refused before any pixel is decoded
+	header := []byte{'G', 'I', 'F', '8', '9', 'a', 0x60, 0xea, 0x60, 0xea, 0, 0, 0}
+	if _, _, _, err := photos.Thumbnail(header); err != photos.ErrImageTooLarge {
+		t.Errorf("Expected the image to be too large but got %v", err)
+	}
+}
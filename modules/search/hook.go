@@ -0,0 +1,116 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/gorilla/mux"
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin search module routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "Search",
+		Method:  "GET",
+		Pattern: "/api/search",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(searchHandler),
+	},
+	config.Route{
+		Name:    "SearchAutocomplete",
+		Method:  "GET",
+		Pattern: "/api/search/autocomplete",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(autocompleteHandler),
+	},
+}
+
+// Apply hooks related to search
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// searchHandler searches items, containers and locations together
+// Query params:
+//   q (words, "quoted phrases", prefix* and -excluded words)
+//   types (optional, comma separated list of item, container and location)
+//   page (applies to every group)
+//   per_page (optional, results per group, QueryLimit by default)
+func searchHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	params := req.URL.Query()
+	jsonOut := json.NewEncoder(res)
+	input := strings.TrimSpace(params.Get("q"))
+	if input == "" {
+		middleware.WriteProblem(res, req, middleware.BadRequest, "Must provide a search query.")
+		return
+	}
+	types := Types
+	if requested := params.Get("types"); requested != "" {
+		types = make([]string, 0)
+		for _, docType := range strings.Split(requested, ",") {
+			if !isType(docType) {
+				middleware.WriteProblem(res, req, middleware.BadRequest, "Unknown search type: "+docType)
+				return
+			}
+			types = append(types, docType)
+		}
+	}
+	var limit models.QueryLimit
+	page, _ := strconv.Atoi(params.Get("page"))
+	limit.SetPage(page, models.PageSize(params.Get("per_page"), QueryLimit, config.Config.MaxPerPage))
+	response, err := NewStore(db).Search(userID, input, types, limit)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to search.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(response)
+}
+
+func isType(docType string) bool {
+	for _, known := range Types {
+		if known == docType {
+			return true
+		}
+	}
+	return false
+}
+
+// autocompleteHandler completes the word being typed in a search box
+// Query params:
+//   q (the partially typed query)
+//   limit (optional, at most CompletionLimit)
+func autocompleteHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	params := req.URL.Query()
+	jsonOut := json.NewEncoder(res)
+	limit, _ := strconv.Atoi(params.Get("limit"))
+	if limit <= 0 || limit > CompletionLimit {
+		limit = CompletionLimit
+	}
+	completions, err := NewStore(db).Complete(userID, params.Get("q"), limit)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to complete the query.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(completions)
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+)
+
+// Types are the searchable document types in the order their groups are returned.
+var Types = []string{items.SearchType, containers.SearchType, locations.SearchType}
+
+// Result is a single matching item, container or location.
+// Only the field named by Type is set.
+type Result struct {
+	Type      string                `json:"type"`
+	ID        int64                 `json:"id"`
+	Score     float64               `json:"score"`
+	Snippet   string                `json:"snippet,omitempty"`
+	Item      *items.ContainerItem  `json:"item,omitempty"`
+	Container *containers.Container `json:"container,omitempty"`
+	Location  *locations.Location   `json:"location,omitempty"`
+}
+
+// Group is a page of results of a single type.
+type Group struct {
+	Type    string               `json:"type"`
+	Results []Result             `json:"results"`
+	Meta    models.PagedResponse `json:"meta"`
+}
+
+// Response groups search results by type.
+type Response struct {
+	Query  string         `json:"query"`
+	Total  int            `json:"total"`
+	Counts map[string]int `json:"counts"`
+	Groups []Group        `json:"groups"`
+	// Suggestions are corrected queries offered when searching with misspelled words
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Completions are the ways a partially typed query may continue.
+type Completions struct {
+	Query       string   `json:"query"`
+	Completions []string `json:"completions"`
+}
@@ -0,0 +1,140 @@
+package search
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/cjsaylor/boxmeup-go/fulltext"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+)
+
+const (
+	// QueryLimit is the maximum number of results per group.
+	QueryLimit = 20
+	// CompletionLimit is the maximum number of completions offered.
+	CompletionLimit = 10
+)
+
+// Store searches across the items, containers and locations of a user.
+type Store struct {
+	DB *sql.DB
+}
+
+// NewStore constructs a storage interface for search.
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db}
+}
+
+// Search finds the best matches of each type for a query.
+// Every group is paged independently by the same limit.
+func (s *Store) Search(userID int64, input string, types []string, limit models.QueryLimit) (Response, error) {
+	response := Response{
+		Query:  input,
+		Counts: make(map[string]int),
+		Groups: make([]Group, 0, len(types)),
+	}
+	vocabulary, err := fulltext.LoadVocabulary(s.DB, userID)
+	if err != nil {
+		return response, err
+	}
+	query := fulltext.ParseQuery(input)
+	if suggestion, ok := vocabulary.Suggest(query); ok {
+		response.Suggestions = []string{suggestion}
+	}
+	query = vocabulary.Fuzzy(query)
+	backend := fulltext.Open(s.DB)
+	for _, docType := range types {
+		results, err := backend.Search(fulltext.Request{
+			UserID: userID,
+			Types:  []string{docType},
+			Query:  query,
+			Limit:  limit,
+		})
+		if err != nil {
+			return response, err
+		}
+		group := Group{Type: docType}
+		if group.Results, err = s.load(docType, results.Hits); err != nil {
+			return response, err
+		}
+		group.Meta.Total = results.Total
+		group.Meta.RequestTotal = len(group.Results)
+		group.Meta.CalculatePages(limit)
+		response.Counts[docType] = results.Total
+		response.Total += results.Total
+		response.Groups = append(response.Groups, group)
+	}
+	return response, nil
+}
+
+// Complete suggests how the last word of a partially typed query may be finished
+// using the words of the user's items, containers and locations.
+func (s *Store) Complete(userID int64, input string, limit int) (Completions, error) {
+	completions := Completions{Query: input, Completions: make([]string, 0)}
+	tokens := fulltext.Tokenize(input)
+	// Only a word still being typed (not followed by a space) is completed.
+	if len(tokens) == 0 || tokens[len(tokens)-1].End != len(input) {
+		return completions, nil
+	}
+	vocabulary, err := fulltext.LoadVocabulary(s.DB, userID)
+	if err != nil {
+		return completions, err
+	}
+	last := tokens[len(tokens)-1]
+	for _, word := range vocabulary.Complete(last.Word, limit) {
+		completions.Completions = append(completions.Completions, input[:last.Start]+word)
+	}
+	return completions, nil
+}
+
+// load fetches the records of a page of hits.
+// Hits for records removed since they were indexed are dropped.
+func (s *Store) load(docType string, hits []fulltext.Hit) ([]Result, error) {
+	results := make([]Result, 0, len(hits))
+	switch docType {
+	case items.SearchType:
+		ids := make([]int64, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.ID
+		}
+		found, err := items.NewStore(s.DB).ByIDs(ids)
+		if err != nil {
+			return results, err
+		}
+		byID := make(map[int64]*items.ContainerItem)
+		for i := range found {
+			byID[found[i].ID] = &found[i]
+		}
+		for _, hit := range hits {
+			if item, ok := byID[hit.ID]; ok {
+				results = append(results, Result{Type: hit.Type, ID: hit.ID, Score: hit.Score, Snippet: hit.Snippet, Item: item})
+			}
+		}
+	case containers.SearchType:
+		containerModel := containers.NewStore(s.DB)
+		for _, hit := range hits {
+			container, err := containerModel.ByID(hit.ID)
+			if errors.Is(err, models.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return results, err
+			}
+			results = append(results, Result{Type: hit.Type, ID: hit.ID, Score: hit.Score, Snippet: hit.Snippet, Container: &container})
+		}
+	case locations.SearchType:
+		locationModel := locations.NewStore(s.DB)
+		for _, hit := range hits {
+			location, err := locationModel.ByID(hit.ID)
+			if errors.Is(err, models.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return results, err
+			}
+			results = append(results, Result{Type: hit.Type, ID: hit.ID, Score: hit.Score, Snippet: hit.Snippet, Location: &location})
+		}
+	}
+	return results, nil
+}
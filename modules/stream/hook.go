@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/gorilla/mux"
+
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin stream routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "Stream",
+		Method:  "GET",
+		Pattern: "/api/stream",
+		Handler: chain.New(middleware.AuthHandler).ThenFunc(streamHandler),
+	},
+}
+
+// Apply hooks related to streams
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// batchSize is the number of entries read from the audit log at once.
+const batchSize = 100
+
+// streamHandler pushes the changes of the user's records as server-sent events (text/event-stream) until the
+// client disconnects. Events are named type.action (container.created, item.updated, location.deleted, ...),
+// their id is the sequence of the audit entry, in the order entries were committed, and their data is the entry,
+// as listed by /api/audit.
+// Reconnecting clients resume after the last event they received with the Last-Event-ID header (sent by EventSource)
+// or the last_event_id query param, otherwise only changes made after connecting are sent.
+// A heartbeat comment is sent while no changes are made.
+func streamHandler(res http.ResponseWriter, req *http.Request) {
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		middleware.WriteProblem(res, req, middleware.InternalError, "Streaming is not supported.")
+		return
+	}
+	lastID, resume, err := LastEventID(req)
+	if err != nil {
+		middleware.WriteError(res, req, err, "")
+		return
+	}
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userID := middleware.UserIDFromRequest(req)
+	// Listen before reading the log so that changes made meanwhile are not missed
+	wakeup, stop := Listen(userID)
+	defer stop()
+	var missed []audit.Entry
+	latest, err := audit.SequenceCommitted(db, userID)
+	if err == nil && resume {
+		missed, err = audit.After(db, userID, lastID, MaxReplay+1)
+	} else {
+		lastID = latest
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to open the stream.")
+		return
+	}
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	s := stream{res: res, flusher: flusher, db: db, userID: userID, lastID: lastID}
+	if len(missed) > MaxReplay {
+		err = s.reset()
+	} else {
+		err = s.write(missed)
+	}
+	if err == nil {
+		err = WriteHeartbeat(res)
+		flusher.Flush()
+	}
+	heartbeat := time.NewTicker(config.Config.StreamHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(config.Config.StreamPollInterval)
+	defer poll.Stop()
+	for err == nil {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err = WriteHeartbeat(res); err == nil {
+				flusher.Flush()
+			}
+		case <-wakeup:
+			err = s.catchUp()
+		case <-poll.C:
+			err = s.catchUp()
+		}
+	}
+	if req.Context().Err() == nil {
+		log.Printf("stream of user %v closed: %v", userID, err)
+	}
+}
+
+// stream follows the audit log of a user on behalf of a connection.
+type stream struct {
+	res     http.ResponseWriter
+	flusher http.Flusher
+	db      *sql.DB
+	userID  int64
+	// lastID is the sequence of the last entry sent
+	lastID int64
+}
+
+// catchUp sends the entries committed since the last one sent.
+func (s *stream) catchUp() error {
+	// Entries committed since the last call are only returned by After once they are sequenced
+	if _, err := audit.SequenceCommitted(s.db, s.userID); err != nil {
+		return err
+	}
+	for {
+		entries, err := audit.After(s.db, s.userID, s.lastID, batchSize)
+		if err == nil {
+			err = s.write(entries)
+		}
+		if err != nil || len(entries) < batchSize {
+			return err
+		}
+	}
+}
+
+// reset sends a reset event and follows the log from its latest entry.
+func (s *stream) reset() error {
+	lastID, err := audit.SequenceCommitted(s.db, s.userID)
+	if err == nil {
+		s.lastID = lastID
+		err = WriteReset(s.res, lastID)
+		s.flusher.Flush()
+	}
+	return err
+}
+
+func (s *stream) write(entries []audit.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, entry := range entries {
+		if err := WriteEntry(s.res, entry); err != nil {
+			return err
+		}
+		s.lastID = entry.Sequence
+	}
+	s.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,114 @@
+// Package stream pushes the changes made to a user's containers, items, locations and settings to their open
+// connections as server-sent events, so that every device of the user sees the changes of the others as they happen.
+// The audit log is the source of the events: a stream follows the entries of its user, it is woken up by the events
+// of the stores (see events.Bus) and polls the log for the changes made through other servers.
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// MaxReplay is the number of missed events a resumed stream catches up with.
+// Streams that missed more are sent a reset event and should resynchronize (see /api/sync).
+const MaxReplay = 500
+
+// ResetEvent tells a client that events were missed and its records should be retrieved again.
+const ResetEvent = "reset"
+
+// LastEventIDHeader is sent by clients reconnecting to a stream with the identifier of the last event they received.
+const LastEventIDHeader = "Last-Event-ID"
+
+// ErrInvalidLastEventID is returned for a last event identifier that is not the identifier of an event.
+var ErrInvalidLastEventID error = models.NewError(models.ErrValidation, "last event id must be the id of an event")
+
+// listeners are the wake up channels of the open streams by user.
+var listeners = struct {
+	sync.Mutex
+	byUser map[int64]map[chan struct{}]struct{}
+}{byUser: make(map[int64]map[chan struct{}]struct{})}
+
+func init() {
+	events.Subscribe("*", func(event events.Event) {
+		wake(event.UserID)
+	})
+}
+
+// Listen wakes up the returned channel whenever records of a user change, until stop is called.
+// Changes made while the listener is awake are coalesced into a single wake up.
+func Listen(userID int64) (wakeup <-chan struct{}, stop func()) {
+	ch := make(chan struct{}, 1)
+	listeners.Lock()
+	if listeners.byUser[userID] == nil {
+		listeners.byUser[userID] = make(map[chan struct{}]struct{})
+	}
+	listeners.byUser[userID][ch] = struct{}{}
+	listeners.Unlock()
+	return ch, func() {
+		listeners.Lock()
+		delete(listeners.byUser[userID], ch)
+		if len(listeners.byUser[userID]) == 0 {
+			delete(listeners.byUser, userID)
+		}
+		listeners.Unlock()
+	}
+}
+
+func wake(userID int64) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	for ch := range listeners.byUser[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// LastEventID is the identifier of the last event a client received, from the Last-Event-ID header sent when
+// reconnecting or the last_event_id query param. ok is false when the client is not resuming a stream.
+func LastEventID(req *http.Request) (ID int64, ok bool, err error) {
+	value := req.Header.Get(LastEventIDHeader)
+	if value == "" {
+		value = req.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	ID, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || ID < 0 {
+		return 0, false, ErrInvalidLastEventID
+	}
+	return ID, true, nil
+}
+
+// WriteEntry writes an audit entry as an event named after its action (see events.NameOf), identified by the
+// sequence of the entry.
+func WriteEntry(w io.Writer, entry audit.Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", entry.Sequence, events.NameOf(entry.EntityType, entry.Action), data)
+	return err
+}
+
+// WriteReset writes a reset event, the stream resumes from the entry of the sequence.
+func WriteReset(w io.Writer, sequence int64) error {
+	_, err := fmt.Fprintf(w, "id: %v\nevent: %v\ndata: {}\n\n", sequence, ResetEvent)
+	return err
+}
+
+// WriteHeartbeat writes a comment, ignored by clients, keeping idle connections open through proxies.
+func WriteHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	return err
+}
@@ -0,0 +1,87 @@
+package stream_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/modules/stream"
+)
+
+func TestListen(t *testing.T) {
+	wakeup, stop := stream.Listen(1)
+	other, stopOther := stream.Listen(2)
+	defer stopOther()
+	events.Publish(events.Event{Name: events.ItemCreated, UserID: 1})
+	events.Publish(events.Event{Name: events.ItemUpdated, UserID: 1})
+	select {
+	case <-wakeup:
+	default:
+		t.Error("Expected the listener of the user to be woken up")
+	}
+	select {
+	case <-wakeup:
+		t.Error("Expected changes made while awake to be coalesced")
+	default:
+	}
+	select {
+	case <-other:
+		t.Error("Expected the listener of another user not to be woken up")
+	default:
+	}
+	stop()
+	events.Publish(events.Event{Name: events.ItemDeleted, UserID: 1})
+	select {
+	case <-wakeup:
+		t.Error("Expected a stopped listener not to be woken up")
+	default:
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/stream", nil)
+	if _, ok, err := stream.LastEventID(req); ok || err != nil {
+		t.Errorf("Expected a new stream, got %v %v", ok, err)
+	}
+	req = httptest.NewRequest("GET", "/api/stream?last_event_id=12", nil)
+	req.Header.Set(stream.LastEventIDHeader, "42")
+	if ID, ok, err := stream.LastEventID(req); ID != 42 || !ok || err != nil {
+		t.Errorf("Expected the header to take precedence, got %v %v %v", ID, ok, err)
+	}
+	req = httptest.NewRequest("GET", "/api/stream?last_event_id=12", nil)
+	if ID, ok, _ := stream.LastEventID(req); ID != 12 || !ok {
+		t.Errorf("Expected the query param to resume the stream, got %v %v", ID, ok)
+	}
+	req = httptest.NewRequest("GET", "/api/stream?last_event_id=abc", nil)
+	if _, _, err := stream.LastEventID(req); err != stream.ErrInvalidLastEventID {
+		t.Errorf("Expected an invalid last event id, got %v", err)
+	}
+}
+
+func TestWriteEntry(t *testing.T) {
+	var buf bytes.Buffer
+	entry := audit.NewEntry(1, 1, audit.Container, 3, audit.ActionCreate, audit.Diff(nil, audit.Fields{"name": "Kitchen\nbox"}))
+	entry.ID = 40
+	entry.Sequence = 7
+	if err := stream.WriteEntry(&buf, entry); err != nil {
+		t.Error(err)
+		return
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 5 || lines[0] != "id: 7" || lines[1] != "event: container.created" || lines[3] != "" {
+		t.Errorf("Unexpected event: %q", buf.String())
+		return
+	}
+	var data audit.Entry
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &data); err != nil {
+		t.Error(err)
+		return
+	}
+	if data.ID != 40 || data.EntityID != 3 || data.Changes["name"].After == nil {
+		t.Errorf("Unexpected data: %+v", data)
+	}
+}
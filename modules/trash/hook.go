@@ -0,0 +1,67 @@
+package trash
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/gorilla/mux"
+
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin trash module routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "Trash",
+		Method:  "GET",
+		Pattern: "/api/trash",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(trashHandler),
+	},
+}
+
+// Apply hooks related to the trash
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// trashHandler lists the containers, items and locations of the user in the trash.
+// They are restored with POST /api/container/{id}/restore, /api/item/{id}/restore and /api/location/{id}/restore.
+func trashHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	user, err := users.NewStore(db).ByID(middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to get user information.")
+		return
+	}
+	response := Response{Retention: int64(config.Config.TrashRetention / time.Second)}
+	response.Containers, err = containers.NewStore(db).Trashed(user)
+	if err == nil {
+		response.Items, err = items.NewStore(db).Trashed(user.ID)
+	}
+	if err == nil {
+		response.Locations, err = locations.NewStore(db).Trashed(user)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the trash.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(response)
+}
@@ -0,0 +1,105 @@
+package trash
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/blob"
+	"github.com/cjsaylor/boxmeup-go/changelog"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/photos"
+)
+
+// Response holds the records of a user in the trash.
+type Response struct {
+	// Containers are listed with the number of items restored along with them
+	Containers containers.Containers `json:"containers"`
+	Items      items.ContainerItems  `json:"items"`
+	Locations  locations.Locations   `json:"locations"`
+	// Retention is the number of seconds records stay in the trash before they are removed for good
+	Retention int64 `json:"retention"`
+}
+
+// Purge removes the containers, items and locations that have been in the trash longer than the retention,
+// along with their photos. Items go with their container through the cascading foreign key, containers of a
+// removed location are detached from it.
+func Purge(db *sql.DB, blobs blob.Store, retention time.Duration) error {
+	seconds := int64(retention / time.Second)
+	for _, table := range []string{"container_items", "containers"} {
+		q := "delete from " + table + " where deleted <= date_sub(now(), interval ? second)"
+		if _, err := db.Exec(q, seconds); err != nil {
+			return err
+		}
+	}
+	if err := purgeLocations(db, seconds); err != nil {
+		return err
+	}
+	return photos.NewStore(db, blobs).DeleteOrphans()
+}
+
+// purgeLocations removes the locations in the trash for longer than a number of seconds, their containers
+// (including those in the trash) are detached first. The detached containers are audited as updates of their owner.
+func purgeLocations(db *sql.DB, seconds int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	q := `
+		select c.id, c.user_id, c.location_id
+		from containers c inner join locations l on l.id = c.location_id
+		where l.deleted <= date_sub(now(), interval ? second)
+		for update
+	`
+	var entries []audit.Entry
+	rows, err := tx.Query(q, seconds)
+	if err == nil {
+		entries, err = detachEntries(rows)
+	}
+	purged := "select id from locations where deleted <= date_sub(now(), interval ? second)"
+	if err == nil {
+		err = changelog.Record(tx, changelog.Container, false, "x.location_id in ("+purged+")", seconds)
+	}
+	if err == nil {
+		q = `
+			update containers c inner join locations l on l.id = c.location_id
+			set c.location_id = null, c.version = c.version + 1, c.modified = now()
+			where l.deleted <= date_sub(now(), interval ? second)
+		`
+		_, err = tx.Exec(q, seconds)
+	}
+	for i := 0; err == nil && i < len(entries); i++ {
+		err = audit.Record(tx, entries[i])
+	}
+	if err == nil {
+		_, err = tx.Exec("delete from locations where deleted <= date_sub(now(), interval ? second)", seconds)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return err
+	}
+	events.Committed(entries...)
+	return nil
+}
+
+// detachEntries describes the removal of the location of the containers read from rows of id, user_id, location_id.
+func detachEntries(rows *sql.Rows) ([]audit.Entry, error) {
+	defer rows.Close()
+	entries := make([]audit.Entry, 0)
+	for rows.Next() {
+		var containerID, userID, locationID int64
+		if err := rows.Scan(&containerID, &userID, &locationID); err != nil {
+			return nil, err
+		}
+		changes := audit.Diff(audit.Fields{"location_id": locationID}, audit.Fields{"location_id": int64(0)})
+		entries = append(entries, audit.NewEntry(0, userID, audit.Container, containerID, audit.ActionUpdate, changes))
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,48 @@
+package undo
+
+import (
+	"net/http"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/gorilla/mux"
+
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin undo routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "Undo",
+		Method:  "POST",
+		Pattern: "/api/undo/{token}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(undoHandler),
+	},
+}
+
+// Apply hooks related to undo
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// undoHandler reverses the change that handed out the token in its Undo-Token header, within the undo window.
+// It is refused with undo_conflict once the records were changed again.
+func undoHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	err := Undo(db, middleware.UserIDFromRequest(req), mux.Vars(req)["token"])
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to undo the operation.")
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,183 @@
+// Package undo keeps, for a short while, how to reverse the changes users make to their containers, items and
+// locations. Handlers record an operation after a change and hand its token to the client (see Offer), posting
+// the token back reverses the change unless the records were changed again since.
+package undo
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// The ways an operation is reversed
+const (
+	// ActionRestore brings the records back from the trash
+	ActionRestore = "restore"
+	// ActionRevert sets the fields of the records back to their values before the change
+	ActionRevert = "revert"
+	// ActionDelete removes the records created by the change, to the trash for records that have one
+	ActionDelete = "delete"
+)
+
+// Errors of undoing an operation
+var (
+	// ErrTokenNotFound is returned for tokens that are unknown, expired or already used
+	ErrTokenNotFound error = &models.Error{Kind: models.ErrNotFound, Code: "undo_token_not_found", Message: "the undo token is unknown, expired or was already used"}
+	// ErrConflict is returned when a record of the operation was changed after it
+	ErrConflict error = &models.Error{Kind: models.ErrConflict, Code: "undo_conflict", Message: "the records were changed since, the operation can no longer be undone"}
+)
+
+// Record is a record changed by an operation.
+type Record struct {
+	ID int64 `json:"id"`
+	// Version is the version of the record right after the operation, it must not have changed to be reversed
+	Version int64 `json:"version"`
+	// Before holds the audited fields of the record before the operation, only for ActionRevert
+	Before audit.Fields `json:"before,omitempty"`
+}
+
+// DecodeBefore reads the fields of the record before the operation into v, by their JSON names.
+func (r Record) DecodeBefore(v interface{}) error {
+	encoded, err := json.Marshal(r.Before)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// Operation describes how to reverse a change to records of a type (see the audit types).
+type Operation struct {
+	Type    string   `json:"type"`
+	Action  string   `json:"action"`
+	Records []Record `json:"records"`
+}
+
+// NewRestore describes how to bring back records moved to the trash.
+func NewRestore(entityType string) Operation {
+	return Operation{Type: entityType, Action: ActionRestore, Records: make([]Record, 0)}
+}
+
+// NewDelete describes how to remove records created by an operation.
+func NewDelete(entityType string) Operation {
+	return Operation{Type: entityType, Action: ActionDelete, Records: make([]Record, 0)}
+}
+
+// Add appends a record removed (or created, see NewDelete) by the operation.
+func (o *Operation) Add(ID int64, version int64) {
+	o.Records = append(o.Records, Record{ID: ID, Version: version})
+}
+
+// NewRevert describes how to set back the fields of a record changed by an update.
+func NewRevert(entityType string, ID int64, version int64, before audit.Fields) Operation {
+	return Operation{
+		Type:    entityType,
+		Action:  ActionRevert,
+		Records: []Record{Record{ID: ID, Version: version, Before: before}},
+	}
+}
+
+// Reverser reverses an operation on records of the user in a single transaction.
+// It returns models.ErrNotFound or models.ErrPreconditionFailed errors when the records changed after the operation.
+type Reverser func(db *sql.DB, userID int64, op Operation) error
+
+var reversers = make(map[string]Reverser)
+
+// Register sets the reverser of operations on a type of records.
+func Register(entityType string, reverser Reverser) {
+	reversers[entityType] = reverser
+}
+
+// Save keeps an operation of a user for the undo window and returns its token.
+func Save(db *sql.DB, userID int64, op Operation) (string, error) {
+	encoded, err := json.Marshal(op)
+	if err != nil {
+		return "", err
+	}
+	token := newToken()
+	q := `
+		insert into undo_operations (token, user_id, operation, created, expires)
+		values (?, ?, ?, now(), date_add(now(), interval ? second))
+	`
+	_, err = db.Exec(q, token, userID, encoded, int64(config.Config.UndoWindow/time.Second))
+	return token, err
+}
+
+// Offer saves an operation and hands its token to the client in the response header.
+// The change was made already, so failing to save it only leaves the response without a token.
+func Offer(res http.ResponseWriter, req *http.Request, db *sql.DB, op Operation) {
+	if len(op.Records) == 0 {
+		return
+	}
+	token, err := Save(db, middleware.UserIDFromRequest(req), op)
+	if err != nil {
+		log.Printf("%v %v (request %v): unable to save the undo operation: %v", req.Method, req.URL.Path, middleware.RequestIDFromRequest(req), err)
+		return
+	}
+	res.Header().Set(middleware.UndoTokenHeader, token)
+}
+
+// Undo reverses the operation of a token of the user, a token is used once.
+// It is given back when the operation fails for another reason than a conflict, so that it may be tried again.
+func Undo(db *sql.DB, userID int64, token string) error {
+	q := `
+		update undo_operations set used = now()
+		where token = ? and user_id = ? and used is null and expires > now()
+	`
+	res, err := db.Exec(q, token, userID)
+	if err != nil {
+		return err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = ErrTokenNotFound
+		}
+		return err
+	}
+	var encoded []byte
+	var op Operation
+	err = db.QueryRow("select operation from undo_operations where token = ?", token).Scan(&encoded)
+	if err == nil {
+		err = json.Unmarshal(encoded, &op)
+	}
+	if err == nil {
+		err = reverse(db, userID, op)
+	}
+	if err != nil && !errors.Is(err, ErrConflict) {
+		db.Exec("update undo_operations set used = null where token = ?", token)
+	}
+	return err
+}
+
+func reverse(db *sql.DB, userID int64, op Operation) error {
+	reverser, ok := reversers[op.Type]
+	if !ok {
+		return errors.New("undo: no reverser for " + op.Type)
+	}
+	err := reverser(db, userID, op)
+	if errors.Is(err, models.ErrNotFound) || errors.Is(err, models.ErrPreconditionFailed) {
+		return ErrConflict
+	}
+	return err
+}
+
+// Purge removes the expired operations of all users.
+func Purge(db *sql.DB) error {
+	_, err := db.Exec("delete from undo_operations where expires <= now()")
+	return err
+}
+
+func newToken() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
@@ -0,0 +1,52 @@
+package undo_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
+)
+
+func TestRecord_DecodeBefore(t *testing.T) {
+	expires := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	op := undo.NewRevert(audit.Item, 4, 7, audit.Fields{"body": "Gloves", "min_quantity": nil, "expires": &expires, "tags": []string{"winter"}})
+	encoded, _ := json.Marshal(op)
+	var saved undo.Operation
+	if err := json.Unmarshal(encoded, &saved); err != nil {
+		t.Fatal(err)
+	}
+	var before struct {
+		Body        string     `json:"body"`
+		MinQuantity *int       `json:"min_quantity"`
+		Expires     *time.Time `json:"expires"`
+		Tags        []string   `json:"tags"`
+	}
+	if err := saved.Records[0].DecodeBefore(&before); err != nil {
+		t.Fatal(err)
+	}
+	if before.Body != "Gloves" || before.MinQuantity != nil || len(before.Tags) != 1 || before.Tags[0] != "winter" {
+		t.Errorf("Expected the fields before the update but got %+v", before)
+	}
+	if before.Expires == nil || !before.Expires.Equal(expires) {
+		t.Errorf("Expected to expire on %v but got %v", expires, before.Expires)
+	}
+	if saved.Records[0].Version != 7 {
+		t.Errorf("Expected the version after the update but got %v", saved.Records[0].Version)
+	}
+}
+
+func TestOperation_Add(t *testing.T) {
+	op := undo.NewRestore(audit.Item)
+	op.Add(1, 2)
+	op.Add(3, 4)
+	if op.Action != undo.ActionRestore || len(op.Records) != 2 || op.Records[1].ID != 3 || op.Records[1].Before != nil {
+		t.Errorf("Expected both items to be restored but got %+v", op)
+	}
+	op = undo.NewDelete(audit.Container)
+	op.Add(5, 1)
+	if op.Action != undo.ActionDelete || len(op.Records) != 1 || op.Records[0].ID != 5 {
+		t.Errorf("Expected the created container to be deleted but got %+v", op)
+	}
+}
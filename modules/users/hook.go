@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/cjsaylor/boxmeup-go/binding"
 	"github.com/cjsaylor/boxmeup-go/config"
 	"github.com/cjsaylor/boxmeup-go/database"
 	"github.com/cjsaylor/boxmeup-go/middleware"
@@ -41,6 +42,12 @@ var routes = []config.Route{
 		Pattern: "/api/user/current",
 		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(userHandler),
 	},
+	config.Route{
+		Name:    "UserSettings",
+		Method:  "PUT",
+		Pattern: "/api/user/settings",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(settingsHandler),
+	},
 }
 
 // Apply hooks related to items
@@ -54,21 +61,39 @@ func (h Hook) Apply(router *mux.Router) {
 	}
 }
 
+// loginRequest is the body of login requests.
+type loginRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// registerRequest is the body of registration requests.
+type registerRequest struct {
+	Email    string `json:"email" validate:"required,email,max=60"`
+	Password string `json:"password" validate:"required"`
+}
+
 // LoginHandler authenticates via email and password
+// Expected body (JSON or form):
+//   email
+//   password
 func loginHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
-
+	jsonOut := json.NewEncoder(res)
+	var body loginRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
 	token, err := NewStore(db).Login(
 		middleware.AuthConfig{
 			LegacySalt: config.Config.LegacySalt,
 			JWTSecret:  config.Config.JWTSecret,
 		},
-		req.PostFormValue("email"),
-		req.PostFormValue("password"))
-	jsonOut := json.NewEncoder(res)
+		body.Email,
+		body.Password)
 	if err != nil {
-		res.WriteHeader(http.StatusUnauthorized)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "Authentication failure."})
+		middleware.WriteError(res, req, err, "Authentication failure.")
 	} else {
 		expiration := time.Now().Add(14 * 24 * time.Hour)
 		cookie := http.Cookie{
@@ -99,22 +124,26 @@ func logoutHandler(res http.ResponseWriter, req *http.Request) {
 }
 
 // RegisterHandler creates new users.
+// Expected body (JSON or form):
+//   email
+//   password
 func registerHandler(res http.ResponseWriter, req *http.Request) {
 	db, _ := database.GetDBResource()
-
-	email := req.PostFormValue("email")
-	password := req.PostFormValue("password")
+	jsonOut := json.NewEncoder(res)
+	var body registerRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
 	id, err := NewStore(db).Register(
 		middleware.AuthConfig{
 			LegacySalt: config.Config.LegacySalt,
 			JWTSecret:  config.Config.JWTSecret,
 		},
-		email,
-		password)
-	jsonOut := json.NewEncoder(res)
+		body.Email,
+		body.Password)
 	if err != nil {
-		res.WriteHeader(http.StatusBadRequest)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: err.Error()})
+		middleware.WriteError(res, req, err, "Unable to register.")
 		return
 	}
 	res.WriteHeader(http.StatusOK)
@@ -131,8 +160,41 @@ func userHandler(res http.ResponseWriter, req *http.Request) {
 	user, err := NewStore(db).ByID(userID)
 	jsonOut := json.NewEncoder(res)
 	if err != nil {
-		res.WriteHeader(http.StatusNotFound)
-		jsonOut.Encode(middleware.JsonErrorResponse{Code: -1, Text: "User specified not found."})
+		middleware.WriteError(res, req, err, "Unable to retrieve the user.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	jsonOut.Encode(user)
+}
+
+// settingsRequest is the body of requests updating the preferences of a user.
+type settingsRequest struct {
+	ExpiryReminderDays *int `json:"expiry_reminder_days" validate:"min=0"`
+}
+
+// settingsHandler updates preferences of the current user.
+// Expected body (JSON or form):
+//   expiry_reminder_days (days ahead of expiry to send reminders, 0 disables them)
+func settingsHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	userModel := NewStore(db)
+	user, err := userModel.ByID(middleware.UserIDFromRequest(req))
+	jsonOut := json.NewEncoder(res)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the user.")
+		return
+	}
+	var body settingsRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	if body.ExpiryReminderDays != nil {
+		user.ExpiryReminderDays = *body.ExpiryReminderDays
+	}
+	if err = userModel.UpdateSettings(&user); err != nil {
+		middleware.WriteError(res, req, err, "Unable to save the settings.")
 		return
 	}
 	res.WriteHeader(http.StatusOK)
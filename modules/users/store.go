@@ -4,15 +4,23 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"database/sql"
-	"errors"
 	"fmt"
-	"log"
 	"time"
 
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/events"
 	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
+var (
+	// ErrInvalidCredentials is returned when logging in with an unknown email or a wrong password.
+	ErrInvalidCredentials error = &models.Error{Kind: models.ErrValidation, Code: "invalid_credentials", Message: "invalid email or password"}
+	// ErrEmailTaken is returned when registering with the email of an existing user.
+	ErrEmailTaken error = &models.Error{Kind: models.ErrConflict, Code: "email_taken", Message: "user already exists with given email"}
+)
+
 // Store is a persistence structure to get and store users.
 type Store struct {
 	DB *sql.DB
@@ -37,10 +45,9 @@ func (s *Store) Login(config middleware.AuthConfig, email string, password strin
 		select id, uuid from users where email = ? and password = ?
 	`
 	err := s.DB.QueryRow(q, email, hashedPassword).Scan(&ID, &UUID)
-	if err != nil {
-		if err != sql.ErrNoRows {
-			log.Fatal(err)
-		}
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidCredentials
+	} else if err != nil {
 		return "", err
 	}
 
@@ -64,15 +71,33 @@ func csrfToken() []byte {
 // @todo Replace shitty password hashing with a more robust mechanism (bcrypt)
 func (s *Store) Register(config middleware.AuthConfig, email string, password string) (id int64, err error) {
 	if s.doesUserExistByEmail(email) {
-		return 0, errors.New("user already exists with given email")
+		return 0, ErrEmailTaken
 	}
 	hashedPassword := hashPassword(config, password)
 	q := `
 		insert into users (email, password, uuid, created, modified)
 		values (?, ?, uuid(), now(), now())
 	`
-	res, err := s.DB.Exec(q, email, hashedPassword)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(q, email, hashedPassword)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 	id, _ = res.LastInsertId()
+	entry := audit.NewEntry(id, id, audit.User, id, audit.ActionCreate, audit.Diff(nil, audit.Fields{"email": email}))
+	if err = audit.Record(tx, entry); err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return 0, err
+	}
+	events.Committed(entry)
 	return
 }
 
@@ -88,7 +113,7 @@ func (s *Store) doesUserExistByEmail(email string) bool {
 func (s *Store) ByID(ID int64) (User, error) {
 	user := User{}
 	q := `
-		select id, email, password, uuid, is_active, reset_password, created, modified
+		select id, email, password, uuid, is_active, reset_password, expiry_reminder_days, created, modified
 		from users where id = ?
 	`
 	err := s.DB.QueryRow(q, ID).Scan(
@@ -98,15 +123,48 @@ func (s *Store) ByID(ID int64) (User, error) {
 		&user.UUID,
 		&user.IsActive,
 		&user.ResetPassword,
+		&user.ExpiryReminderDays,
 		&user.Created,
 		&user.Modified)
+	return user, models.NotFound(err, "user not found")
+}
+
+// UpdateSettings persists the user's preferences.
+func (s *Store) UpdateSettings(user *User) error {
+	if user.ExpiryReminderDays < 0 {
+		return models.NewError(models.ErrValidation, "expiry reminder days must not be negative")
+	}
+	before, err := s.ByID(user.ID)
+	if err != nil {
+		return err
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	q := "update users set expiry_reminder_days = ?, modified = now() where id = ?"
+	_, err = tx.Exec(q, user.ExpiryReminderDays, user.ID)
+	entry := audit.NewEntry(user.ID, user.ID, audit.User, user.ID, audit.ActionUpdate, audit.Diff(before.auditFields(), user.auditFields()))
+	if err == nil {
+		err = audit.Record(tx, entry)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err == nil {
+		events.Committed(entry)
+	}
+	return err
+}
+
+// ByEmail retrieves a user by their email address.
+func (s *Store) ByEmail(email string) (User, error) {
+	var ID int64
+	err := s.DB.QueryRow("select id from users where email = ?", email).Scan(&ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// user not found
-			// @todo consider sending a custom error that the route handler can consume
-		} else {
-			log.Fatal(err)
-		}
+		return User{}, models.NotFound(err, "user not found")
 	}
-	return user, err
+	return s.ByID(ID)
 }
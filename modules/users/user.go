@@ -1,15 +1,25 @@
 package users
 
-import "time"
+import (
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+)
 
 // User is a user entity structure
 type User struct {
-	ID            int64     `json:"id"`
-	Email         string    `json:"email"`
-	Password      string    `json:"-"`
-	UUID          string    `json:"uuid"`
-	IsActive      bool      `json:"is_active"`
-	ResetPassword bool      `json:"-"`
-	Created       time.Time `json:"created"`
-	Modified      time.Time `json:"modified"`
+	ID                 int64     `json:"id"`
+	Email              string    `json:"email"`
+	Password           string    `json:"-"`
+	UUID               string    `json:"uuid"`
+	IsActive           bool      `json:"is_active"`
+	ResetPassword      bool      `json:"-"`
+	ExpiryReminderDays int       `json:"expiry_reminder_days"`
+	Created            time.Time `json:"created"`
+	Modified           time.Time `json:"modified"`
+}
+
+// auditFields are the values of the user recorded in the audit log, the password is never recorded.
+func (u User) auditFields() audit.Fields {
+	return audit.Fields{"email": u.Email, "expiry_reminder_days": u.ExpiryReminderDays}
 }
@@ -0,0 +1,238 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cjsaylor/boxmeup-go/binding"
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/middleware"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/webhook"
+	"github.com/gorilla/mux"
+
+	chain "github.com/justinas/alice"
+)
+
+// Hook is the mechanism to plugin webhook routes
+type Hook struct{}
+
+var routes = []config.Route{
+	config.Route{
+		Name:    "CreateWebhook",
+		Method:  "POST",
+		Pattern: "/api/webhook",
+		Handler: chain.New(middleware.AuthHandler, middleware.IdempotencyHandler, middleware.JsonResponseHandler).ThenFunc(createWebhookHandler),
+	},
+	config.Route{
+		Name:    "Webhooks",
+		Method:  "GET",
+		Pattern: "/api/webhook",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(webhooksHandler),
+	},
+	config.Route{
+		Name:    "Webhook",
+		Method:  "GET",
+		Pattern: "/api/webhook/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(webhookHandler),
+	},
+	config.Route{
+		Name:    "UpdateWebhook",
+		Method:  "PUT",
+		Pattern: "/api/webhook/{id}",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(updateWebhookHandler),
+	},
+	config.Route{
+		Name:    "DeleteWebhook",
+		Method:  "DELETE",
+		Pattern: "/api/webhook/{id}",
+		Handler: chain.New(middleware.AuthHandler).ThenFunc(deleteWebhookHandler),
+	},
+	config.Route{
+		Name:    "WebhookDeliveries",
+		Method:  "GET",
+		Pattern: "/api/webhook/{id}/delivery",
+		Handler: chain.New(middleware.AuthHandler, middleware.JsonResponseHandler).ThenFunc(deliveriesHandler),
+	},
+}
+
+// Apply hooks related to webhooks
+func (h Hook) Apply(router *mux.Router) {
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.Handler)
+	}
+}
+
+// webhookRequest is the body of requests registering or updating a webhook.
+type webhookRequest struct {
+	URL    string       `json:"url" validate:"required,url,max=2048"`
+	Events binding.List `json:"events" validate:"required"`
+	Active *bool        `json:"active"`
+}
+
+func (r webhookRequest) Validate() binding.Errors {
+	var errs binding.Errors
+	// Deliveries must not reach the services of the network the server runs in (see webhook.NewClient)
+	if parsed, err := url.Parse(r.URL); err == nil && parsed.Hostname() != "" {
+		if err = webhook.CheckHost(parsed.Hostname()); errors.Is(err, webhook.ErrPrivateAddress) {
+			errs.Add("url", "must not be a private, loopback or link-local address")
+		} else if err != nil {
+			errs.Add("url", "must have a host that can be resolved")
+		}
+	}
+	for _, event := range r.Events {
+		if !webhook.ValidEvent(event) {
+			errs.Add("events", "has an unknown event "+event+", must be one of "+strings.Join(webhook.Events, ", ")+" or a type.* wildcard")
+			break
+		}
+	}
+	if len(strings.Join(r.Events, ",")) > 1024 {
+		errs.Add("events", "must be at most 1024 characters once joined")
+	}
+	return errs
+}
+
+// apply sets the fields of a webhook from the request, webhooks are active unless told otherwise.
+func (r webhookRequest) apply(hook *webhook.Webhook) {
+	hook.URL = r.URL
+	hook.Events = r.Events
+	hook.Active = r.Active == nil || *r.Active
+}
+
+// createWebhookHandler registers a URL to post events to, the response holds the secret signing the deliveries.
+// The secret is not shown again.
+// Expected body (JSON or form):
+//   url (http or https, to a public address)
+//   events (a list or comma separated, see webhook.Events, type.* or * subscribe to several events)
+//   active (optional, true by default)
+func createWebhookHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	var body webhookRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	hook := webhook.Webhook{UserID: middleware.UserIDFromRequest(req)}
+	body.apply(&hook)
+	if err := webhook.NewStore(db).Create(&hook); err != nil {
+		middleware.WriteError(res, req, err, "Unable to register the webhook.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(hook)
+}
+
+// webhooksHandler lists the webhooks of the user
+func webhooksHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	hooks, err := webhook.NewStore(db).ForUser(middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the webhooks.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(map[string]webhook.Webhooks{
+		"webhooks": hooks,
+	})
+}
+
+// webhookHandler gets a webhook of the user
+func webhookHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	webhookID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	hook, err := webhook.NewStore(db).OwnedBy(int64(webhookID), middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the webhook.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(hook)
+}
+
+// updateWebhookHandler changes the URL, events or activity of a webhook, its secret stays the same
+// Expected body (JSON or form):
+//   url
+//   events
+//   active (optional, true by default)
+func updateWebhookHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	store := webhook.NewStore(db)
+	webhookID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	hook, err := store.OwnedBy(int64(webhookID), middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the webhook.")
+		return
+	}
+	var body webhookRequest
+	if errs := binding.Bind(req, &body); errs != nil {
+		middleware.WriteInvalid(res, req, errs)
+		return
+	}
+	body.apply(&hook)
+	if err = store.Update(&hook); err == nil {
+		hook, err = store.ByID(hook.ID)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Failed to update the webhook.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(hook)
+}
+
+// deleteWebhookHandler removes a webhook along with its delivery log
+func deleteWebhookHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	store := webhook.NewStore(db)
+	webhookID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	hook, err := store.OwnedBy(int64(webhookID), middleware.UserIDFromRequest(req))
+	if err == nil {
+		err = store.Delete(hook)
+	}
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to delete the webhook.")
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// deliveriesHandler retrieves the delivery log of a webhook, most recent first.
+// Query params:
+//   page
+func deliveriesHandler(res http.ResponseWriter, req *http.Request) {
+	db, _ := database.GetDBResource()
+	defer db.Close()
+	store := webhook.NewStore(db)
+	webhookID, _ := strconv.Atoi(mux.Vars(req)["id"])
+	hook, err := store.OwnedBy(int64(webhookID), middleware.UserIDFromRequest(req))
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the webhook.")
+		return
+	}
+	var limit models.QueryLimit
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	limit.SetPage(page, webhook.QueryLimit)
+	deliveries, err := store.Deliveries(hook, limit)
+	if err != nil {
+		middleware.WriteError(res, req, err, "Unable to retrieve the delivery log.")
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(map[string]webhook.Deliveries{
+		"deliveries": deliveries,
+	})
+}
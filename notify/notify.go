@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+)
+
+// Message is a notification addressed to a single user.
+type Message struct {
+	// UserID is the user the message is addressed to
+	UserID  int64       `json:"-"`
+	Event   string      `json:"event"`
+	Email   string      `json:"email"`
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Notifier delivers messages to users.
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+var (
+	registry   = make(map[string]Notifier)
+	registryMu sync.RWMutex
+)
+
+// Register makes a notifier available by name so that plugins can provide their own delivery mechanism.
+func Register(name string, notifier Notifier) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = notifier
+}
+
+// FromConfig resolves the notifier selected by the REMINDER_NOTIFIER configuration.
+// Nil is returned when no notifier is configured.
+func FromConfig(c config.Configuration) (Notifier, error) {
+	switch c.ReminderNotifier {
+	case "":
+		return nil, nil
+	case "email":
+		if c.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the email notifier")
+		}
+		return EmailNotifier{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.SMTPFrom,
+		}, nil
+	case "webhook":
+		if c.ReminderWebhookURL == "" {
+			return nil, fmt.Errorf("REMINDER_WEBHOOK_URL is required for the webhook notifier")
+		}
+		return WebhookNotifier{URL: c.ReminderWebhookURL}, nil
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if notifier, ok := registry[c.ReminderNotifier]; ok {
+		return notifier, nil
+	}
+	return nil, fmt.Errorf("unknown notifier: %v", c.ReminderNotifier)
+}
+
+// Notifiers delivers messages through each of a set of notifiers.
+type Notifiers []Notifier
+
+// Notify delivers the message through every notifier, even when some of them fail. The last error is returned.
+func (n Notifiers) Notify(msg Message) error {
+	var lastErr error
+	for _, notifier := range n {
+		if err := notifier.Notify(msg); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// EmailNotifier delivers messages over SMTP.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Notify sends the message as a plain text email.
+func (n EmailNotifier) Notify(msg Message) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%v:%v", n.Host, n.Port), auth, n.From, []string{msg.Email}, n.Message(msg))
+}
+
+// Message formats the message as a plain text email.
+// The subject is built from user content, it is kept on a single line and encoded (RFC 2047) so it cannot add headers.
+func (n EmailNotifier) Message(msg Message) []byte {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %v\r\n", headerValue(n.From))
+	fmt.Fprintf(&body, "To: %v\r\n", headerValue(msg.Email))
+	fmt.Fprintf(&body, "Subject: %v\r\n", mime.QEncoding.Encode("UTF-8", headerValue(msg.Subject)))
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(msg.Body)
+	return body.Bytes()
+}
+
+// headerValue replaces the line breaks of a header value with spaces.
+func headerValue(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	}), " ")
+}
+
+// WebhookNotifier delivers messages as a JSON POST to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the message and expects a 2xx response.
+func (n WebhookNotifier) Notify(msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Post(n.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %v", res.StatusCode)
+	}
+	return nil
+}
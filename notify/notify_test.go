@@ -0,0 +1,99 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/notify"
+)
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	var received notify.Message
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&received)
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	err := notify.WebhookNotifier{URL: server.URL}.Notify(notify.Message{
+		Event:   "item.expiring",
+		Email:   "test@test.com",
+		Subject: "Milk is expiring soon",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if received.Event != "item.expiring" || received.Email != "test@test.com" {
+		t.Errorf("Unexpected message received: %+v", received)
+	}
+}
+
+func TestWebhookNotifier_NotifyFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	err := notify.WebhookNotifier{URL: server.URL}.Notify(notify.Message{})
+	if err == nil {
+		t.Error("Expected a non 2xx response to fail.")
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	notifier, err := notify.FromConfig(config.Configuration{})
+	if notifier != nil || err != nil {
+		t.Error("Expected no notifier without configuration.")
+	}
+	_, err = notify.FromConfig(config.Configuration{ReminderNotifier: "webhook"})
+	if err == nil {
+		t.Error("Expected the webhook notifier to require a URL.")
+	}
+	notify.Register("pigeon", notify.WebhookNotifier{})
+	notifier, err = notify.FromConfig(config.Configuration{ReminderNotifier: "pigeon"})
+	if notifier == nil || err != nil {
+		t.Error("Expected the registered notifier to be resolved.")
+	}
+}
+
+func TestNotifiers_Notify(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	notifiers := notify.Notifiers{notify.WebhookNotifier{URL: "http://127.0.0.1:0"}, notify.WebhookNotifier{URL: server.URL}}
+	if err := notifiers.Notify(notify.Message{Event: "item.expiring"}); err == nil {
+		t.Error("Expected the failure of a notifier to be returned.")
+	}
+	if calls != 1 {
+		t.Errorf("Expected the other notifiers to be notified but got %v calls", calls)
+	}
+}
+
+func TestEmailNotifier_Message(t *testing.T) {
+	notifier := notify.EmailNotifier{From: "boxmeup@test.com"}
+	message := string(notifier.Message(notify.Message{
+		Email:   "test@test.com",
+		Subject: "Milk\r\nBcc: victim@test.com\r\n is expiring",
+		Body:    "Milk expires tomorrow.",
+	}))
+	headers := strings.SplitN(message, "\r\n\r\n", 2)[0]
+	if strings.Contains(headers, "\r\nBcc:") {
+		t.Errorf("Expected the subject not to add headers:\n%v", headers)
+	}
+	if len(strings.Split(headers, "\r\n")) != 4 {
+		t.Errorf("Expected the From, To, Subject and Content-Type headers only:\n%v", headers)
+	}
+	if !strings.Contains(headers, "Subject: Milk Bcc: victim@test.com  is expiring\r\n") {
+		t.Errorf("Expected the subject to be kept on a single line:\n%v", headers)
+	}
+	message = string(notifier.Message(notify.Message{Email: "test@test.com", Subject: "Crème fraîche is expiring"}))
+	if !strings.Contains(message, "Subject: =?UTF-8?q?Cr=C3=A8me_fra=C3=AEche_is_expiring?=\r\n") {
+		t.Errorf("Expected a non ASCII subject to be encoded:\n%v", message)
+	}
+}
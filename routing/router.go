@@ -5,14 +5,32 @@ import (
 	"net/http"
 	"os"
 	"plugin"
+	"sync"
+	"time"
 
+	"github.com/cjsaylor/boxmeup-go/blob"
 	"github.com/cjsaylor/boxmeup-go/config"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/events"
 	"github.com/cjsaylor/boxmeup-go/hooks"
 	"github.com/cjsaylor/boxmeup-go/middleware"
 	"github.com/cjsaylor/boxmeup-go/modules/containers"
+	"github.com/cjsaylor/boxmeup-go/modules/delta"
+	"github.com/cjsaylor/boxmeup-go/modules/graph"
+	"github.com/cjsaylor/boxmeup-go/modules/history"
 	"github.com/cjsaylor/boxmeup-go/modules/items"
+	"github.com/cjsaylor/boxmeup-go/modules/loans"
 	"github.com/cjsaylor/boxmeup-go/modules/locations"
+	"github.com/cjsaylor/boxmeup-go/modules/photos"
+	"github.com/cjsaylor/boxmeup-go/modules/search"
+	"github.com/cjsaylor/boxmeup-go/modules/stream"
+	"github.com/cjsaylor/boxmeup-go/modules/trash"
+	"github.com/cjsaylor/boxmeup-go/modules/undo"
 	"github.com/cjsaylor/boxmeup-go/modules/users"
+	"github.com/cjsaylor/boxmeup-go/modules/webhooks"
+	"github.com/cjsaylor/boxmeup-go/notify"
+	"github.com/cjsaylor/boxmeup-go/scheduler"
+	"github.com/cjsaylor/boxmeup-go/webhook"
 	"github.com/gorilla/mux"
 )
 
@@ -29,22 +47,135 @@ func NewRouter() *mux.Router {
 		res.WriteHeader(http.StatusNoContent)
 	})
 
+	// Describe the problem types of error responses
+	router.Methods("GET").Path("/problems/{code}").HandlerFunc(middleware.ProblemTypeHandler)
+
 	// Global middleware
+	router.Use(middleware.RequestIDHandler)
 	router.Use(middleware.CORSHandler)
 	router.Use(middleware.LogHandler)
+	router.Use(middleware.ConditionalHandler)
 
 	// Built in
 	(users.Hook{}).Apply(router)
 	(items.Hook{}).Apply(router)
 	(containers.Hook{}).Apply(router)
 	(locations.Hook{}).Apply(router)
+	(loans.Hook{}).Apply(router)
+	(photos.Hook{}).Apply(router)
+	(search.Hook{}).Apply(router)
+	(delta.Hook{}).Apply(router)
+	(trash.Hook{}).Apply(router)
+	(history.Hook{}).Apply(router)
+	(undo.Hook{}).Apply(router)
+	(webhooks.Hook{}).Apply(router)
+	(stream.Hook{}).Apply(router)
+	(graph.Hook{}).Apply(router)
 
 	// External propriatary plugins (these assume to be in a local hooks/ folder)
 	loadExternalPlugins(router)
 
+	if config.Config.SchedulerEnabled {
+		startScheduler.Do(scheduleJobs)
+	}
+
 	return router
 }
 
+// Jobs is the scheduler for background work of the server.
+var Jobs = scheduler.New()
+
+var startScheduler sync.Once
+
+// addJob schedules a job, jobs that cannot be scheduled (ie: configured with a zero interval) are reported and skipped.
+func addJob(job scheduler.Job) {
+	if err := Jobs.Add(job); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func scheduleJobs() {
+	// expiring items are always sent to the webhooks subscribed to item.expiring
+	notifiers := notify.Notifiers{webhook.Notifier{}}
+	notifier, err := notify.FromConfig(config.Config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else if notifier != nil {
+		notifiers = append(notifiers, notifier)
+	}
+	addJob(items.ExpiryReminderJob(notifiers, config.Config.ExpiryReminderInterval))
+	addJob(scheduler.Job{
+		Name:     "idempotency-keys",
+		Interval: time.Hour,
+		Run: func() error {
+			db, err := database.GetDBResource()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return middleware.PurgeIdempotencyKeys(db)
+		},
+	})
+	addJob(scheduler.Job{
+		Name:     "trash",
+		Interval: time.Hour,
+		Run: func() error {
+			db, err := database.GetDBResource()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			blobs, err := blob.FromConfig(config.Config)
+			if err != nil {
+				return err
+			}
+			return trash.Purge(db, blobs, config.Config.TrashRetention)
+		},
+	})
+	addJob(scheduler.Job{
+		Name:     "undo-operations",
+		Interval: time.Hour,
+		Run: func() error {
+			db, err := database.GetDBResource()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return undo.Purge(db)
+		},
+	})
+	addJob(scheduler.Job{
+		Name:     "webhook-deliveries",
+		Interval: config.Config.WebhookInterval,
+		Run: func() error {
+			db, err := database.GetDBResource()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			dispatcher := webhook.Dispatcher{
+				DB:          db,
+				Client:      webhook.NewClient(config.Config.WebhookTimeout),
+				MaxAttempts: config.Config.WebhookMaxAttempts,
+			}
+			return dispatcher.Dispatch()
+		},
+	})
+	addJob(scheduler.Job{
+		Name:     "webhook-log",
+		Interval: time.Hour,
+		Run: func() error {
+			db, err := database.GetDBResource()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return webhook.Purge(db, config.Config.WebhookLogRetention)
+		},
+	})
+	Jobs.Start()
+}
+
 func loadExternalPlugins(router *mux.Router) {
 	for _, name := range config.Config.AllowedExtensions {
 		plugin, err := plugin.Open(fmt.Sprintf("hooks/%s.so", name))
@@ -56,5 +187,10 @@ func loadExternalPlugins(router *mux.Router) {
 		routeHook := routeHookSym.(*hooks.RouteHook)
 		(*routeHook).Apply(router)
 		fmt.Fprintf(os.Stderr, "Applied routehook: %s.so\n", name)
+		if eventHookSym, err := plugin.Lookup("EventHook"); err == nil {
+			eventHook := eventHookSym.(*hooks.EventHook)
+			(*eventHook).Subscribe(events.Default)
+			fmt.Fprintf(os.Stderr, "Subscribed eventhook: %s.so\n", name)
+		}
 	}
 }
@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job is a unit of background work run on a fixed interval.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func() error
+}
+
+// Scheduler runs jobs in the background of the server.
+type Scheduler struct {
+	jobs    []Job
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running bool
+}
+
+// New constructs an idle scheduler.
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers a job. Jobs added after Start are started immediately.
+// Jobs without a positive interval are not registered.
+func (s *Scheduler) Add(job Job) error {
+	if job.Interval <= 0 {
+		return fmt.Errorf("scheduled job %v must have a positive interval, got %v", job.Name, job.Interval)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	if s.running {
+		s.start(job)
+	}
+	return nil
+}
+
+// Start runs every registered job on its interval until Stop is called.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	s.stop = make(chan struct{})
+	for _, job := range s.jobs {
+		s.start(job)
+	}
+}
+
+// Stop halts all jobs and waits for any in progress runs to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stop)
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) start(job Job) {
+	s.wg.Add(1)
+	go func(stop chan struct{}) {
+		defer s.wg.Done()
+		ticker := time.NewTicker(job.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := job.Run(); err != nil {
+					fmt.Fprintf(os.Stderr, "Scheduled job %v failed: %v\n", job.Name, err)
+				}
+			}
+		}
+	}(s.stop)
+}
@@ -0,0 +1,37 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/scheduler"
+)
+
+func TestAdd(t *testing.T) {
+	s := scheduler.New()
+	noop := func() error { return nil }
+	if err := s.Add(scheduler.Job{Name: "disabled", Run: noop}); err == nil {
+		t.Error("Expected a job without an interval to be refused")
+	}
+	if err := s.Add(scheduler.Job{Name: "negative", Interval: -time.Second, Run: noop}); err == nil {
+		t.Error("Expected a job with a negative interval to be refused")
+	}
+	ran := make(chan bool, 1)
+	err := s.Add(scheduler.Job{Name: "tick", Interval: time.Millisecond, Run: func() error {
+		select {
+		case ran <- true:
+		default:
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	defer s.Stop()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Error("Expected the job to run")
+	}
+}
@@ -0,0 +1,410 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/audit"
+	"github.com/cjsaylor/boxmeup-go/database"
+	"github.com/cjsaylor/boxmeup-go/events"
+	"github.com/cjsaylor/boxmeup-go/models"
+	"github.com/cjsaylor/boxmeup-go/notify"
+	"github.com/go-sql-driver/mysql"
+)
+
+// QueryLimit is the number of deliveries per page of the delivery log.
+const QueryLimit = 50
+
+// Headers of deliveries
+const (
+	// EventHeader names the event delivered
+	EventHeader = "X-Boxmeup-Event"
+	// DeliveryHeader identifies the delivery, it is the same for every attempt
+	DeliveryHeader = "X-Boxmeup-Delivery"
+	// TimestampHeader is the time of the attempt in seconds since the epoch, it is part of the signature
+	TimestampHeader = "X-Boxmeup-Timestamp"
+	// SignatureHeader holds the signature of the attempt (see Sign)
+	SignatureHeader = "X-Boxmeup-Signature"
+)
+
+// The states of deliveries
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// maxBatch is the number of deliveries attempted by a run of Dispatch.
+const maxBatch = 100
+
+// maxBackoff caps the delay between attempts.
+const maxBackoff = 6 * time.Hour
+
+// Event is the payload posted to webhooks.
+type Event struct {
+	// ID identifies the event, it is shared by the deliveries to every webhook
+	ID      string      `json:"id"`
+	Name    string      `json:"event"`
+	Created time.Time   `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// NewEvent constructs an event occurring now.
+func NewEvent(name string, data interface{}) Event {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Event{ID: hex.EncodeToString(id), Name: name, Created: time.Now(), Data: data}
+}
+
+// Enqueue queues the delivery of an event to the webhooks of a user subscribed to it.
+func Enqueue(db audit.Execer, userID int64, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	wildcard := event.Name[:strings.Index(event.Name, ".")+1] + "*"
+	q := `
+		insert into webhook_deliveries (webhook_id, event_id, event, payload, status, attempts, next_attempt, created)
+		select id, ?, ?, ?, ?, 0, now(), now()
+		from webhooks
+		where user_id = ? and (find_in_set(?, events) or find_in_set(?, events) or find_in_set('*', events))
+	`
+	_, err = db.Exec(q, event.ID, event.Name, payload, StatusPending, userID, event.Name, wildcard)
+	return err
+}
+
+func init() {
+	// Asynchronously, so that the requests changing records do not wait for the deliveries to be queued.
+	events.SubscribeAsync("*", enqueueEvent)
+}
+
+// enqueueEvent queues the event of an action on a container, item or location once it is committed
+// (see events.Committed). The event of the bus is the data of the event.
+func enqueueEvent(event events.Event) {
+	if event.EntityType == audit.User {
+		return
+	}
+	db, err := database.GetDBResource()
+	if err == nil {
+		defer db.Close()
+		err = Enqueue(db, event.UserID, NewEvent(event.Name, event))
+	}
+	if err != nil {
+		log.Printf("webhook: unable to queue %v %v: %v", event.Name, event.EntityID, err)
+	}
+}
+
+// Notifier queues notifications of users, such as item.expiring, as events of their webhooks.
+type Notifier struct{}
+
+// Notify queues the message as an event whose data is the data of the message.
+func (Notifier) Notify(msg notify.Message) error {
+	db, err := database.GetDBResource()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return Enqueue(db, msg.UserID, NewEvent(msg.Event, msg.Data))
+}
+
+// Delivery is the delivery of an event to a webhook, as shown in its delivery log.
+type Delivery struct {
+	ID      int64  `json:"id"`
+	EventID string `json:"event_id"`
+	Event   string `json:"event"`
+	// Status is pending until the event is delivered or every attempt failed
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, if a response was received
+	ResponseStatus *int       `json:"response_status"`
+	Error          string     `json:"error,omitempty"`
+	NextAttempt    *time.Time `json:"next_attempt,omitempty"`
+	Created        time.Time  `json:"created"`
+	Delivered      *time.Time `json:"delivered"`
+}
+
+// Deliveries is a group of deliveries
+type Deliveries []Delivery
+
+// Deliveries retrieves the delivery log of a webhook, most recent first.
+func (s *Store) Deliveries(webhook Webhook, limit models.QueryLimit) (Deliveries, error) {
+	q := `
+		select id, event_id, event, status, attempts, response_status, error, next_attempt, created, delivered
+		from webhook_deliveries
+		where webhook_id = ?
+		order by created desc, id desc
+		limit %v offset %v
+	`
+	rows, err := s.DB.Query(fmt.Sprintf(q, limit.Limit, limit.Offset), webhook.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := make(Deliveries, 0)
+	for rows.Next() {
+		delivery := Delivery{}
+		var responseStatus sql.NullInt64
+		var deliveryError sql.NullString
+		var nextAttempt, delivered mysql.NullTime
+		err = rows.Scan(&delivery.ID, &delivery.EventID, &delivery.Event, &delivery.Status, &delivery.Attempts,
+			&responseStatus, &deliveryError, &nextAttempt, &delivery.Created, &delivered)
+		if err != nil {
+			return nil, err
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			delivery.ResponseStatus = &status
+		}
+		delivery.Error = deliveryError.String
+		if delivery.Status == StatusPending && nextAttempt.Valid {
+			delivery.NextAttempt = &nextAttempt.Time
+		}
+		if delivered.Valid {
+			delivery.Delivered = &delivered.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// Sign computes the signature of a delivery attempt: the hex encoded HMAC-SHA256, keyed by the secret of the
+// webhook, of the timestamp and the body joined by a dot. Receivers recompute it to verify the sender and should
+// reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is the delay before the next attempt of a delivery that failed a number of times:
+// 30 seconds doubling with every attempt, up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Dispatcher attempts the pending deliveries that are due.
+type Dispatcher struct {
+	DB     *sql.DB
+	Client *http.Client
+	// MaxAttempts is the number of attempts after which a delivery is given up
+	MaxAttempts int
+}
+
+// pendingDelivery is a delivery waiting to be attempted along with its webhook.
+type pendingDelivery struct {
+	ID       int64
+	Event    string
+	Payload  []byte
+	Attempts int
+	URL      string
+	Secret   string
+}
+
+// Dispatch attempts the due deliveries of active webhooks. A delivery is claimed before it is attempted so that
+// several servers may dispatch at once, a delivery whose attempt was interrupted is attempted again once its claim lapses.
+func (d Dispatcher) Dispatch() error {
+	q := `
+		select d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		from webhook_deliveries d
+		inner join webhooks w on w.id = d.webhook_id and w.active = 1
+		where d.status = ? and d.next_attempt <= now()
+		order by d.next_attempt, d.id
+		limit %v
+	`
+	rows, err := d.DB.Query(fmt.Sprintf(q, maxBatch), StatusPending)
+	if err != nil {
+		return err
+	}
+	pending := make([]pendingDelivery, 0)
+	for rows.Next() {
+		delivery := pendingDelivery{}
+		err = rows.Scan(&delivery.ID, &delivery.Event, &delivery.Payload, &delivery.Attempts, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, delivery)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	var lastErr error
+	for _, delivery := range pending {
+		if err = d.attempt(delivery); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// attempt claims a delivery, posts it and records the outcome.
+func (d Dispatcher) attempt(delivery pendingDelivery) error {
+	q := `
+		update webhook_deliveries set next_attempt = date_add(now(), interval ? second)
+		where id = ? and status = ? and next_attempt <= now()
+	`
+	res, err := d.DB.Exec(q, int64(d.client().Timeout/time.Second)*2+60, delivery.ID, StatusPending)
+	if err != nil {
+		return err
+	}
+	if claimed, err := res.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+	status, err := Post(d.client(), delivery.URL, delivery.Secret, delivery.Event, strconv.FormatInt(delivery.ID, 10), delivery.Payload)
+	var responseStatus *int
+	if status > 0 {
+		responseStatus = &status
+	}
+	attempts := delivery.Attempts + 1
+	if err == nil {
+		q = `
+			update webhook_deliveries
+			set status = ?, attempts = ?, response_status = ?, error = null, delivered = now()
+			where id = ?
+		`
+		_, err = d.DB.Exec(q, StatusDelivered, attempts, responseStatus, delivery.ID)
+		return err
+	}
+	message := err.Error()
+	if len(message) > 255 {
+		message = message[:255]
+	}
+	nextStatus := StatusPending
+	if attempts >= d.MaxAttempts {
+		nextStatus = StatusFailed
+	}
+	q = `
+		update webhook_deliveries
+		set status = ?, attempts = ?, response_status = ?, error = ?, next_attempt = date_add(now(), interval ? second)
+		where id = ?
+	`
+	_, err = d.DB.Exec(q, nextStatus, attempts, responseStatus, message, int64(Backoff(attempts)/time.Second), delivery.ID)
+	return err
+}
+
+func (d Dispatcher) client() *http.Client {
+	if d.Client == nil {
+		return NewClient(10 * time.Second)
+	}
+	return d.Client
+}
+
+// ErrPrivateAddress is returned for webhook URLs whose host is not a public internet address.
+var ErrPrivateAddress = errors.New("webhook: the host is a private, loopback or link-local address")
+
+// reservedNetworks are not reachable on the public internet although net.IP does not classify them:
+// "this network" and the shared address space of carrier-grade NAT.
+var reservedNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// publicIP tells whether an address is reachable on the public internet, deliveries must not reach the services
+// of the network the server runs in.
+func publicIP(ip net.IP) bool {
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// CheckHost resolves the host of a webhook URL, it returns ErrPrivateAddress when any of its addresses is not public.
+func CheckHost(host string) error {
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// NewClient builds the client posting deliveries. The address is checked as the connection is made, so that a host
+// resolving to a private address after it was registered is refused, and redirects are not followed: the response
+// to a delivery is its redirect, which is not a success.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Post delivers the payload of an event to a URL, signed with a secret (see Sign).
+// Responses other than 2xx are errors, the status of the response is returned when one was received.
+func Post(client *http.Client, url string, secret string, event string, deliveryID string, payload []byte) (int, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Boxmeup-Webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, payload))
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook responded with status %v", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Purge removes the deliveries that were completed, delivered or given up, longer ago than the retention.
+func Purge(db *sql.DB, retention time.Duration) error {
+	q := "delete from webhook_deliveries where status != ? and created <= date_sub(now(), interval ? second)"
+	_, err := db.Exec(q, StatusPending, int64(retention/time.Second))
+	return err
+}
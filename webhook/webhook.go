@@ -0,0 +1,145 @@
+// Package webhook delivers the events of a user's containers, items and locations to the URLs they registered.
+// Events are queued with the change that raised them and posted, signed with the secret of the webhook, by a
+// scheduled job (see Dispatch). Failed deliveries are retried with a growing delay and every delivery is logged.
+package webhook
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/models"
+)
+
+// The events webhooks subscribe to. Subscribing to type.* covers every event of a type, * covers all events.
+var Events = []string{
+	"container.created", "container.updated", "container.deleted", "container.restored",
+	"item.created", "item.updated", "item.deleted", "item.restored", "item.expiring",
+	"location.created", "location.updated", "location.deleted", "location.restored",
+}
+
+// ValidEvent reports whether webhooks can subscribe to an event, wildcards included.
+func ValidEvent(event string) bool {
+	if event == "*" {
+		return true
+	}
+	prefix := strings.TrimSuffix(event, "*")
+	wildcard := prefix != event && strings.HasSuffix(prefix, ".")
+	for _, name := range Events {
+		if name == event || wildcard && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook is a URL of a user that events are posted to.
+type Webhook struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	URL    string `json:"url"`
+	// Events are the subscribed events (see Events)
+	Events []string `json:"events"`
+	// Secret signs the deliveries, it is only shown when the webhook is created
+	Secret string `json:"secret,omitempty"`
+	// Active webhooks are delivered to, deliveries of inactive ones wait until they are active again
+	Active   bool      `json:"active"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+// Webhooks is a group of webhooks
+type Webhooks []Webhook
+
+// NewStore constructs a storage interface for webhooks.
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db}
+}
+
+// Store helps store and retrieve webhooks and their deliveries
+type Store struct {
+	DB *sql.DB
+}
+
+// Create persists a webhook with a new secret.
+func (s *Store) Create(webhook *Webhook) error {
+	q := `
+		insert into webhooks (user_id, url, events, secret, active, created, modified)
+		values (?, ?, ?, ?, ?, now(), now())
+	`
+	webhook.Secret = newSecret()
+	res, err := s.DB.Exec(q, webhook.UserID, webhook.URL, strings.Join(webhook.Events, ","), webhook.Secret, webhook.Active)
+	if err != nil {
+		return err
+	}
+	webhook.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// Update changes the URL, events and activity of a webhook, its secret stays the same.
+func (s *Store) Update(webhook *Webhook) error {
+	q := "update webhooks set url = ?, events = ?, active = ?, modified = now() where id = ?"
+	_, err := s.DB.Exec(q, webhook.URL, strings.Join(webhook.Events, ","), webhook.Active, webhook.ID)
+	return err
+}
+
+// Delete removes a webhook along with its deliveries.
+func (s *Store) Delete(webhook Webhook) error {
+	_, err := s.DB.Exec("delete from webhooks where id = ?", webhook.ID)
+	return err
+}
+
+// ByID retrieves a webhook by its identifier, without its secret.
+func (s *Store) ByID(ID int64) (Webhook, error) {
+	q := "select id, user_id, url, events, active, created, modified from webhooks where id = ?"
+	webhook, err := scan(s.DB.QueryRow(q, ID))
+	return webhook, models.NotFound(err, "webhook not found")
+}
+
+// OwnedBy retrieves a webhook by its identifier on behalf of a user, webhooks of other users are forbidden.
+func (s *Store) OwnedBy(ID int64, userID int64) (Webhook, error) {
+	webhook, err := s.ByID(ID)
+	if err == nil {
+		err = models.CheckOwner(webhook.UserID, userID, "webhook belongs to another user")
+	}
+	return webhook, err
+}
+
+// ForUser retrieves the webhooks of a user, oldest first.
+func (s *Store) ForUser(userID int64) (Webhooks, error) {
+	q := "select id, user_id, url, events, active, created, modified from webhooks where user_id = ? order by id"
+	rows, err := s.DB.Query(q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := make(Webhooks, 0)
+	for rows.Next() {
+		webhook, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(row scanner) (Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &events, &webhook.Active, &webhook.Created, &webhook.Modified)
+	webhook.Events = strings.Split(events, ",")
+	return webhook, err
+}
+
+func newSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
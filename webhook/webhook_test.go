@@ -0,0 +1,118 @@
+package webhook_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cjsaylor/boxmeup-go/webhook"
+)
+
+func TestValidEvent(t *testing.T) {
+	for event, valid := range map[string]bool{
+		"item.created":  true,
+		"item.expiring": true,
+		"item.*":        true,
+		"*":             true,
+		"container.*":   true,
+		"user.created":  false,
+		"user.*":        false,
+		"item":          false,
+		"item*":         false,
+	} {
+		if webhook.ValidEvent(event) != valid {
+			t.Errorf("Expected %v to be valid (%v)", event, valid)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		20: 6 * time.Hour,
+	}
+	for attempts, delay := range expected {
+		if actual := webhook.Backoff(attempts); actual != delay {
+			t.Errorf("Expected a delay of %v after %v attempts but got %v", delay, attempts, actual)
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	payload := []byte(`{"id":"abc","event":"item.created"}`)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get(webhook.TimestampHeader), 10, 64)
+		if req.Header.Get(webhook.SignatureHeader) != webhook.Sign("secret", timestamp, body) {
+			t.Errorf("Expected the signature to match the body but got %v", req.Header.Get(webhook.SignatureHeader))
+		}
+		if req.Header.Get(webhook.EventHeader) != "item.created" || req.Header.Get(webhook.DeliveryHeader) != "7" {
+			t.Errorf("Unexpected headers %v", req.Header)
+		}
+		res.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	status, err := webhook.Post(server.Client(), server.URL, "secret", "item.created", "7", payload)
+	if err != nil || status != http.StatusAccepted {
+		t.Errorf("Expected the delivery to succeed but got %v (%v)", status, err)
+	}
+}
+
+func TestPostFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	status, err := webhook.Post(server.Client(), server.URL, "secret", "item.created", "7", []byte("{}"))
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the delivery to fail with the status of the response but got %v (%v)", status, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	if webhook.Sign("secret", 1, []byte("{}")) == webhook.Sign("other", 1, []byte("{}")) {
+		t.Error("Expected signatures to depend on the secret")
+	}
+	if webhook.Sign("secret", 1, []byte("{}")) == webhook.Sign("secret", 2, []byte("{}")) {
+		t.Error("Expected signatures to depend on the timestamp")
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	for host, public := range map[string]bool{
+		"93.184.216.34":     true,
+		"127.0.0.1":         false,
+		"10.0.0.5":          false,
+		"192.168.1.20":      false,
+		"169.254.169.254":   false,
+		"::1":               false,
+		"fe80::1":           false,
+		"0.0.0.0":           false,
+		"0.1.2.3":           false,
+		"100.64.0.1":        false,
+		"100.127.255.254":   false,
+		"100.128.0.1":       true,
+		"::ffff:100.64.0.1": false,
+	} {
+		if err := webhook.CheckHost(host); (err == nil) != public {
+			t.Errorf("Expected %v to be public (%v) but got %v", host, public, err)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		t.Error("Expected the delivery not to reach a loopback address")
+	}))
+	defer server.Close()
+	status, err := webhook.Post(webhook.NewClient(time.Second), server.URL, "secret", "item.created", "7", []byte("{}"))
+	if status != 0 || !errors.Is(err, webhook.ErrPrivateAddress) {
+		t.Errorf("Expected the connection to be refused but got %v (%v)", status, err)
+	}
+}